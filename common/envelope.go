@@ -0,0 +1,231 @@
+package common
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// 信封加密：每个值使用随机数据密钥 (DEK) 以 AES-256-GCM 加密，DEK 再由主密钥 (KEK) 加密后与密文一同存储。
+// 格式为 enc:v1:<主密钥ID>:<加密后的DEK>:<密文>，轮换主密钥时只需重新加密 DEK
+const secretEnvelopePrefix = "enc:v1:"
+
+type secretMasterKey struct {
+	id   string
+	aead cipher.AEAD
+}
+
+var (
+	// 当前用于加密的主密钥，为 nil 表示未启用加密
+	activeSecretMasterKey *secretMasterKey
+	// 主密钥ID -> 主密钥，包含当前主密钥和轮换前的旧主密钥
+	secretMasterKeys = map[string]*secretMasterKey{}
+)
+
+func newSecretMasterKey(raw string) (*secretMasterKey, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil, errors.New("master key is empty")
+	}
+	kek := sha256.Sum256([]byte(raw))
+	block, err := aes.NewCipher(kek[:])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	id := sha256.Sum256(kek[:])
+	return &secretMasterKey{id: hex.EncodeToString(id[:4]), aead: aead}, nil
+}
+
+// SetSecretMasterKeys 设置主密钥，active 为空表示不再加密新值，oldKeys 仅用于解密轮换前写入的值
+func SetSecretMasterKeys(active string, oldKeys ...string) error {
+	keys := map[string]*secretMasterKey{}
+	var activeKey *secretMasterKey
+	if strings.TrimSpace(active) != "" {
+		key, err := newSecretMasterKey(active)
+		if err != nil {
+			return err
+		}
+		activeKey = key
+		keys[key.id] = key
+	}
+	for _, old := range oldKeys {
+		if strings.TrimSpace(old) == "" {
+			continue
+		}
+		key, err := newSecretMasterKey(old)
+		if err != nil {
+			return err
+		}
+		if _, ok := keys[key.id]; !ok {
+			keys[key.id] = key
+		}
+	}
+	activeSecretMasterKey = activeKey
+	secretMasterKeys = keys
+	return nil
+}
+
+// InitSecretMasterKeys 从环境变量加载渠道密钥的主密钥：
+// CHANNEL_KEY_MASTER_KEY 或 CHANNEL_KEY_MASTER_KEY_FILE 为当前主密钥，CHANNEL_KEY_OLD_MASTER_KEYS 为逗号分隔的旧主密钥
+func InitSecretMasterKeys() error {
+	active := os.Getenv("CHANNEL_KEY_MASTER_KEY")
+	if path := os.Getenv("CHANNEL_KEY_MASTER_KEY_FILE"); active == "" && path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read master key file: %w", err)
+		}
+		active = string(data)
+	}
+	var oldKeys []string
+	if old := os.Getenv("CHANNEL_KEY_OLD_MASTER_KEYS"); old != "" {
+		oldKeys = strings.Split(old, ",")
+	}
+	return SetSecretMasterKeys(active, oldKeys...)
+}
+
+// SecretEncryptionEnabled 是否配置了用于加密的主密钥
+func SecretEncryptionEnabled() bool {
+	return activeSecretMasterKey != nil
+}
+
+// IsEncryptedSecret 值是否为信封加密后的密文
+func IsEncryptedSecret(s string) bool {
+	return strings.HasPrefix(s, secretEnvelopePrefix)
+}
+
+func sealWithNonce(aead cipher.AEAD, plain []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plain, nil), nil
+}
+
+func openWithNonce(aead cipher.AEAD, data []byte) ([]byte, error) {
+	if len(data) < aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	return aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+}
+
+func wrapSecret(key *secretMasterKey, dek []byte, data string) (string, error) {
+	wrapped, err := sealWithNonce(key.aead, dek)
+	if err != nil {
+		return "", err
+	}
+	return secretEnvelopePrefix + key.id + ":" + base64.RawStdEncoding.EncodeToString(wrapped) + ":" + data, nil
+}
+
+// EncryptSecret 使用当前主密钥加密，未启用加密、空值或已加密的值原样返回
+func EncryptSecret(plain string) (string, error) {
+	key := activeSecretMasterKey
+	if key == nil || plain == "" || IsEncryptedSecret(plain) {
+		return plain, nil
+	}
+	dek := make([]byte, 32)
+	if _, err := rand.Read(dek); err != nil {
+		return "", err
+	}
+	block, err := aes.NewCipher(dek)
+	if err != nil {
+		return "", err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := sealWithNonce(aead, []byte(plain))
+	if err != nil {
+		return "", err
+	}
+	return wrapSecret(key, dek, base64.RawStdEncoding.EncodeToString(sealed))
+}
+
+// parseSecretEnvelope 解析密文，返回主密钥ID、解密后的 DEK 和数据密文部分
+func parseSecretEnvelope(s string) (string, []byte, string, error) {
+	parts := strings.Split(strings.TrimPrefix(s, secretEnvelopePrefix), ":")
+	if len(parts) != 3 {
+		return "", nil, "", errors.New("malformed encrypted secret")
+	}
+	key, ok := secretMasterKeys[parts[0]]
+	if !ok {
+		return "", nil, "", fmt.Errorf("master key %s not configured", parts[0])
+	}
+	wrapped, err := base64.RawStdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", nil, "", err
+	}
+	dek, err := openWithNonce(key.aead, wrapped)
+	if err != nil {
+		return "", nil, "", fmt.Errorf("failed to decrypt data key: %w", err)
+	}
+	return parts[0], dek, parts[2], nil
+}
+
+// DecryptSecret 解密信封加密的值，未加密的值原样返回
+func DecryptSecret(s string) (string, error) {
+	if !IsEncryptedSecret(s) {
+		return s, nil
+	}
+	_, dek, data, err := parseSecretEnvelope(s)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(data)
+	if err != nil {
+		return "", err
+	}
+	block, err := aes.NewCipher(dek)
+	if err != nil {
+		return "", err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+	plain, err := openWithNonce(aead, sealed)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt secret: %w", err)
+	}
+	return string(plain), nil
+}
+
+// RewrapSecret 将值迁移到当前主密钥：明文加密，旧主密钥的密文仅重新加密 DEK；
+// 未配置当前主密钥时解密为明文。changed 表示值是否发生变化
+func RewrapSecret(s string) (result string, changed bool, err error) {
+	if s == "" {
+		return s, false, nil
+	}
+	key := activeSecretMasterKey
+	if !IsEncryptedSecret(s) {
+		if key == nil {
+			return s, false, nil
+		}
+		result, err = EncryptSecret(s)
+		return result, err == nil, err
+	}
+	if key == nil {
+		result, err = DecryptSecret(s)
+		return result, err == nil, err
+	}
+	id, dek, data, err := parseSecretEnvelope(s)
+	if err != nil {
+		return "", false, err
+	}
+	if id == key.id {
+		return s, false, nil
+	}
+	result, err = wrapSecret(key, dek, data)
+	return result, err == nil, err
+}
@@ -0,0 +1,54 @@
+package common
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSecretEnvelopeRotation(t *testing.T) {
+	t.Cleanup(func() { _ = SetSecretMasterKeys("") })
+
+	require.NoError(t, SetSecretMasterKeys(""))
+	plain, err := EncryptSecret("sk-test")
+	require.NoError(t, err)
+	require.Equal(t, "sk-test", plain)
+
+	require.NoError(t, SetSecretMasterKeys("old-master"))
+	encrypted, err := EncryptSecret(`{"type":"service_account"}`)
+	require.NoError(t, err)
+	require.True(t, IsEncryptedSecret(encrypted))
+	again, err := EncryptSecret(`{"type":"service_account"}`)
+	require.NoError(t, err)
+	require.NotEqual(t, encrypted, again)
+
+	decrypted, err := DecryptSecret(encrypted)
+	require.NoError(t, err)
+	require.Equal(t, `{"type":"service_account"}`, decrypted)
+	passthrough, err := DecryptSecret("sk-plain")
+	require.NoError(t, err)
+	require.Equal(t, "sk-plain", passthrough)
+
+	// 轮换：旧主密钥的密文仍可解密，重新加密后只依赖新主密钥
+	require.NoError(t, SetSecretMasterKeys("new-master", "old-master"))
+	rewrapped, changed, err := RewrapSecret(encrypted)
+	require.NoError(t, err)
+	require.True(t, changed)
+	_, changed, err = RewrapSecret(rewrapped)
+	require.NoError(t, err)
+	require.False(t, changed)
+
+	require.NoError(t, SetSecretMasterKeys("new-master"))
+	_, err = DecryptSecret(encrypted)
+	require.Error(t, err)
+	decrypted, err = DecryptSecret(rewrapped)
+	require.NoError(t, err)
+	require.Equal(t, `{"type":"service_account"}`, decrypted)
+
+	// 移除当前主密钥后迁移为明文
+	require.NoError(t, SetSecretMasterKeys("", "new-master"))
+	restored, changed, err := RewrapSecret(rewrapped)
+	require.NoError(t, err)
+	require.True(t, changed)
+	require.Equal(t, `{"type":"service_account"}`, restored)
+}
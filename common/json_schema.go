@@ -0,0 +1,332 @@
+package common
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ValidateJSONSchema 使用 JSON Schema 校验已解码的 JSON 值（map[string]any / []any / float64 等）。
+// 仅实现结构化输出常用的子集：type、enum、const、properties、required、additionalProperties、
+// items、长度与数值范围、pattern、anyOf / oneOf / allOf / not 以及文档内的 $ref。
+func ValidateJSONSchema(schema any, value any) error {
+	v := &jsonSchemaValidator{root: schema}
+	return v.validate(schema, value, "$", 0)
+}
+
+const maxJSONSchemaDepth = 64
+
+type jsonSchemaValidator struct {
+	root any
+}
+
+func (v *jsonSchemaValidator) validate(schema any, value any, path string, depth int) error {
+	if depth > maxJSONSchemaDepth {
+		return fmt.Errorf("%s: schema nesting too deep", path)
+	}
+	switch s := schema.(type) {
+	case nil:
+		return nil
+	case bool:
+		if !s {
+			return fmt.Errorf("%s: value is not allowed", path)
+		}
+		return nil
+	case map[string]any:
+		return v.validateObjectSchema(s, value, path, depth)
+	default:
+		return fmt.Errorf("%s: invalid schema", path)
+	}
+}
+
+func (v *jsonSchemaValidator) validateObjectSchema(s map[string]any, value any, path string, depth int) error {
+	if ref, ok := s["$ref"].(string); ok {
+		target, err := v.resolveRef(ref)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if err := v.validate(target, value, path, depth+1); err != nil {
+			return err
+		}
+	}
+
+	if t, ok := s["type"]; ok {
+		if err := validateJSONSchemaType(t, value, path); err != nil {
+			return err
+		}
+	}
+	if enum, ok := s["enum"].([]any); ok {
+		matched := false
+		for _, candidate := range enum {
+			if jsonValueEqual(candidate, value) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return fmt.Errorf("%s: value is not one of the allowed enum values", path)
+		}
+	}
+	if c, ok := s["const"]; ok && !jsonValueEqual(c, value) {
+		return fmt.Errorf("%s: value does not match const", path)
+	}
+
+	switch val := value.(type) {
+	case map[string]any:
+		if err := v.validateObject(s, val, path, depth); err != nil {
+			return err
+		}
+	case []any:
+		if err := v.validateArray(s, val, path, depth); err != nil {
+			return err
+		}
+	case string:
+		if err := validateJSONString(s, val, path); err != nil {
+			return err
+		}
+	case float64:
+		if err := validateJSONNumber(s, val, path); err != nil {
+			return err
+		}
+	}
+
+	if allOf, ok := s["allOf"].([]any); ok {
+		for _, sub := range allOf {
+			if err := v.validate(sub, value, path, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+	if anyOf, ok := s["anyOf"].([]any); ok {
+		var firstErr error
+		matched := false
+		for _, sub := range anyOf {
+			err := v.validate(sub, value, path, depth+1)
+			if err == nil {
+				matched = true
+				break
+			}
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+		if !matched {
+			return fmt.Errorf("%s: value does not match any schema in anyOf (%v)", path, firstErr)
+		}
+	}
+	if oneOf, ok := s["oneOf"].([]any); ok {
+		count := 0
+		for _, sub := range oneOf {
+			if v.validate(sub, value, path, depth+1) == nil {
+				count++
+			}
+		}
+		if count != 1 {
+			return fmt.Errorf("%s: value matches %d schemas in oneOf, expected exactly 1", path, count)
+		}
+	}
+	if not, ok := s["not"]; ok {
+		if v.validate(not, value, path, depth+1) == nil {
+			return fmt.Errorf("%s: value must not match schema in not", path)
+		}
+	}
+	return nil
+}
+
+func (v *jsonSchemaValidator) validateObject(s map[string]any, obj map[string]any, path string, depth int) error {
+	if required, ok := s["required"].([]any); ok {
+		for _, r := range required {
+			name, _ := r.(string)
+			if _, exists := obj[name]; !exists {
+				return fmt.Errorf("%s: missing required property %q", path, name)
+			}
+		}
+	}
+	properties, _ := s["properties"].(map[string]any)
+	for name, propValue := range obj {
+		propPath := path + "." + name
+		if propSchema, ok := properties[name]; ok {
+			if err := v.validate(propSchema, propValue, propPath, depth+1); err != nil {
+				return err
+			}
+			continue
+		}
+		additional, ok := s["additionalProperties"]
+		if !ok {
+			continue
+		}
+		if allowed, isBool := additional.(bool); isBool && !allowed {
+			return fmt.Errorf("%s: additional property %q is not allowed", path, name)
+		}
+		if err := v.validate(additional, propValue, propPath, depth+1); err != nil {
+			return err
+		}
+	}
+	if n, ok := jsonSchemaInt(s["minProperties"]); ok && len(obj) < n {
+		return fmt.Errorf("%s: expected at least %d properties", path, n)
+	}
+	if n, ok := jsonSchemaInt(s["maxProperties"]); ok && len(obj) > n {
+		return fmt.Errorf("%s: expected at most %d properties", path, n)
+	}
+	return nil
+}
+
+func (v *jsonSchemaValidator) validateArray(s map[string]any, arr []any, path string, depth int) error {
+	if n, ok := jsonSchemaInt(s["minItems"]); ok && len(arr) < n {
+		return fmt.Errorf("%s: expected at least %d items", path, n)
+	}
+	if n, ok := jsonSchemaInt(s["maxItems"]); ok && len(arr) > n {
+		return fmt.Errorf("%s: expected at most %d items", path, n)
+	}
+	prefixLen := 0
+	if prefixItems, ok := s["prefixItems"].([]any); ok {
+		prefixLen = len(prefixItems)
+		for i := 0; i < len(prefixItems) && i < len(arr); i++ {
+			if err := v.validate(prefixItems[i], arr[i], path+"["+strconv.Itoa(i)+"]", depth+1); err != nil {
+				return err
+			}
+		}
+	}
+	if items, ok := s["items"]; ok {
+		for i := prefixLen; i < len(arr); i++ {
+			if err := v.validate(items, arr[i], path+"["+strconv.Itoa(i)+"]", depth+1); err != nil {
+				return err
+			}
+		}
+	}
+	if unique, ok := s["uniqueItems"].(bool); ok && unique {
+		for i := 0; i < len(arr); i++ {
+			for j := i + 1; j < len(arr); j++ {
+				if jsonValueEqual(arr[i], arr[j]) {
+					return fmt.Errorf("%s: items must be unique", path)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func validateJSONString(s map[string]any, str string, path string) error {
+	length := len([]rune(str))
+	if n, ok := jsonSchemaInt(s["minLength"]); ok && length < n {
+		return fmt.Errorf("%s: string is shorter than %d", path, n)
+	}
+	if n, ok := jsonSchemaInt(s["maxLength"]); ok && length > n {
+		return fmt.Errorf("%s: string is longer than %d", path, n)
+	}
+	if pattern, ok := s["pattern"].(string); ok && pattern != "" {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("%s: invalid pattern %q", path, pattern)
+		}
+		if !re.MatchString(str) {
+			return fmt.Errorf("%s: string does not match pattern %q", path, pattern)
+		}
+	}
+	return nil
+}
+
+func validateJSONNumber(s map[string]any, num float64, path string) error {
+	if m, ok := s["minimum"].(float64); ok && num < m {
+		return fmt.Errorf("%s: %v is less than minimum %v", path, num, m)
+	}
+	if m, ok := s["maximum"].(float64); ok && num > m {
+		return fmt.Errorf("%s: %v is greater than maximum %v", path, num, m)
+	}
+	if m, ok := s["exclusiveMinimum"].(float64); ok && num <= m {
+		return fmt.Errorf("%s: %v must be greater than %v", path, num, m)
+	}
+	if m, ok := s["exclusiveMaximum"].(float64); ok && num >= m {
+		return fmt.Errorf("%s: %v must be less than %v", path, num, m)
+	}
+	if m, ok := s["multipleOf"].(float64); ok && m > 0 {
+		q := num / m
+		if math.Abs(q-math.Round(q)) > 1e-9 {
+			return fmt.Errorf("%s: %v is not a multiple of %v", path, num, m)
+		}
+	}
+	return nil
+}
+
+func validateJSONSchemaType(t any, value any, path string) error {
+	var types []string
+	switch tv := t.(type) {
+	case string:
+		types = []string{tv}
+	case []any:
+		for _, item := range tv {
+			if s, ok := item.(string); ok {
+				types = append(types, s)
+			}
+		}
+	default:
+		return nil
+	}
+	actual := jsonValueType(value)
+	for _, expected := range types {
+		if expected == actual || (expected == "number" && actual == "integer") {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s: expected type %s, got %s", path, strings.Join(types, "|"), actual)
+}
+
+func jsonValueType(value any) string {
+	switch val := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case float64:
+		if val == math.Trunc(val) && !math.IsInf(val, 0) {
+			return "integer"
+		}
+		return "number"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+func jsonValueEqual(a, b any) bool {
+	return reflect.DeepEqual(a, b)
+}
+
+func jsonSchemaInt(value any) (int, bool) {
+	f, ok := value.(float64)
+	if !ok {
+		return 0, false
+	}
+	return int(f), true
+}
+
+// resolveRef 仅支持文档内引用，如 #/$defs/Item、#/definitions/Item
+func (v *jsonSchemaValidator) resolveRef(ref string) (any, error) {
+	if ref == "#" {
+		return v.root, nil
+	}
+	if !strings.HasPrefix(ref, "#/") {
+		return nil, fmt.Errorf("unsupported $ref %q", ref)
+	}
+	current := v.root
+	for _, token := range strings.Split(ref[2:], "/") {
+		token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+		obj, ok := current.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("unresolvable $ref %q", ref)
+		}
+		current, ok = obj[token]
+		if !ok {
+			return nil, fmt.Errorf("unresolvable $ref %q", ref)
+		}
+	}
+	return current, nil
+}
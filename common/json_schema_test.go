@@ -0,0 +1,50 @@
+package common
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateJSONSchema(t *testing.T) {
+	t.Parallel()
+
+	var schema any
+	require.NoError(t, UnmarshalJsonStr(`{
+		"type": "object",
+		"properties": {
+			"name": {"type": "string", "minLength": 1},
+			"age": {"type": "integer", "minimum": 0},
+			"tags": {"type": "array", "items": {"$ref": "#/$defs/tag"}},
+			"status": {"enum": ["active", "inactive"]}
+		},
+		"required": ["name", "age"],
+		"additionalProperties": false,
+		"$defs": {"tag": {"type": "string", "pattern": "^[a-z]+$"}}
+	}`, &schema))
+
+	tests := []struct {
+		name    string
+		value   string
+		wantErr string
+	}{
+		{name: "valid", value: `{"name":"bob","age":3,"tags":["a","b"],"status":"active"}`},
+		{name: "missing required", value: `{"name":"bob"}`, wantErr: `missing required property "age"`},
+		{name: "wrong type", value: `{"name":"bob","age":1.5}`, wantErr: "$.age: expected type integer, got number"},
+		{name: "additional property", value: `{"name":"bob","age":1,"extra":true}`, wantErr: `additional property "extra" is not allowed`},
+		{name: "ref pattern", value: `{"name":"bob","age":1,"tags":["A"]}`, wantErr: "$.tags[0]: string does not match pattern"},
+		{name: "enum", value: `{"name":"bob","age":1,"status":"gone"}`, wantErr: "$.status: value is not one of the allowed enum values"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var value any
+			require.NoError(t, UnmarshalJsonStr(tt.value, &value))
+			err := ValidateJSONSchema(schema, value)
+			if tt.wantErr == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
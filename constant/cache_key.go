@@ -11,4 +11,5 @@ const (
 const (
 	TokenFiledRemainQuota = "RemainQuota"
 	TokenFieldGroup       = "Group"
+	TokenFieldBudgetUsed  = "BudgetUsed"
 )
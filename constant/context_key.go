@@ -19,6 +19,11 @@ const (
 	ContextKeyTokenModelLimitEnabled ContextKey = "token_model_limit_enabled"
 	ContextKeyTokenModelLimit        ContextKey = "token_model_limit"
 	ContextKeyTokenCrossGroupRetry   ContextKey = "token_cross_group_retry"
+	ContextKeyTokenOrgId             ContextKey = "token_org_id"
+	ContextKeyTokenBudgetEnabled     ContextKey = "token_budget_enabled"
+	ContextKeyTokenMaxTokens         ContextKey = "token_max_tokens"
+	ContextKeyClientTokenId          ContextKey = "client_token_id"
+	ContextKeyClientTokenEndUserId   ContextKey = "client_token_end_user_id"
 
 	/* channel related keys */
 	ContextKeyChannelId                ContextKey = "channel_id"
@@ -42,6 +47,12 @@ const (
 	ContextKeyAutoGroupIndex      ContextKey = "auto_group_index"
 	ContextKeyAutoGroupRetryIndex ContextKey = "auto_group_retry_index"
 
+	/* virtual model related keys */
+	ContextKeyVirtualModel              ContextKey = "virtual_model"
+	ContextKeyVirtualModelTargets       ContextKey = "virtual_model_targets"
+	ContextKeyVirtualModelIndex         ContextKey = "virtual_model_index"
+	ContextKeyVirtualModelParamOverride ContextKey = "virtual_model_param_override"
+
 	/* user related keys */
 	ContextKeyUserId      ContextKey = "id"
 	ContextKeyUserSetting ContextKey = "user_setting"
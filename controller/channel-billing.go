@@ -439,11 +439,13 @@ func UpdateChannelBalance(c *gin.Context) {
 		})
 		return
 	}
+	previous, firstCheck := channel.Balance, channel.BalanceUpdatedTime == 0
 	balance, err := updateChannelBalance(channel)
 	if err != nil {
 		common.ApiError(c, err)
 		return
 	}
+	service.HandleChannelBalance(channel, previous, firstCheck, balance)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -457,7 +459,8 @@ func updateAllChannelsBalance() error {
 		return err
 	}
 	for _, channel := range channels {
-		if channel.Status != common.ChannelStatusEnabled {
+		// 因余额低于下限被禁用的渠道也需要刷新，以便余额回升后自动启用
+		if channel.Status != common.ChannelStatusEnabled && !service.IsChannelDisabledByBalance(channel) {
 			continue
 		}
 		if channel.ChannelInfo.IsMultiKey {
@@ -467,10 +470,12 @@ func updateAllChannelsBalance() error {
 		//if channel.Type != common.ChannelTypeOpenAI && channel.Type != common.ChannelTypeCustom {
 		//	continue
 		//}
+		previous, firstCheck := channel.Balance, channel.BalanceUpdatedTime == 0
 		balance, err := updateChannelBalance(channel)
 		if err != nil {
 			continue
 		} else {
+			service.HandleChannelBalance(channel, previous, firstCheck, balance)
 			// err is nil & balance <= 0 means quota is used up
 			if balance <= 0 {
 				service.DisableChannel(*types.NewChannelError(channel.Id, channel.Type, channel.Name, channel.ChannelInfo.IsMultiKey, "", channel.GetAutoBan()), "余额不足")
@@ -478,6 +483,9 @@ func updateAllChannelsBalance() error {
 		}
 		time.Sleep(common.RequestInterval)
 	}
+	if _, err := model.DeleteChannelBalanceHistoryBefore(common.GetTimestamp() - model.ChannelBalanceHistoryRetention); err != nil {
+		common.SysLog(fmt.Sprintf("failed to clean up channel balance history: %v", err))
+	}
 	return nil
 }
 
@@ -503,3 +511,29 @@ func AutomaticallyUpdateChannels(frequency int) {
 		common.SysLog("channels update done")
 	}
 }
+
+// GetChannelBalanceHistory 返回渠道余额历史及耗尽时间预测，默认最近 30 天
+func GetChannelBalanceHistory(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	if startTimestamp <= 0 {
+		startTimestamp = common.GetTimestamp() - 30*24*3600
+	}
+	histories, err := model.GetChannelBalanceHistory(id, startTimestamp)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"history":  histories,
+			"forecast": model.ForecastChannelBalance(histories),
+		},
+	})
+}
@@ -0,0 +1,141 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type clientTokenRequest struct {
+	TTL       int64    `json:"ttl"` // 有效期（秒）
+	Models    []string `json:"models"`
+	MaxQuota  int      `json:"max_quota"`
+	EndUserId string   `json:"end_user_id"`
+}
+
+func clientTokenError(c *gin.Context, status int, message string) {
+	c.JSON(status, gin.H{
+		"error": types.OpenAIError{
+			Message: message,
+			Type:    "invalid_request_error",
+		},
+	})
+}
+
+// CreateClientToken 使用正式令牌签发短期客户端令牌，供浏览器/移动端直接调用
+func CreateClientToken(c *gin.Context) {
+	if common.GetContextKeyInt(c, constant.ContextKeyClientTokenId) != 0 {
+		clientTokenError(c, http.StatusForbidden, "客户端令牌不能签发新的令牌")
+		return
+	}
+	var req clientTokenRequest
+	if err := common.UnmarshalBodyReusable(c, &req); err != nil {
+		clientTokenError(c, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if req.TTL == 0 {
+		req.TTL = model.ClientTokenDefaultTTL
+	}
+	if req.TTL < 0 || req.TTL > model.ClientTokenMaxTTL {
+		clientTokenError(c, http.StatusBadRequest, fmt.Sprintf("ttl 必须在 1 到 %d 秒之间", model.ClientTokenMaxTTL))
+		return
+	}
+	if req.MaxQuota < 0 {
+		clientTokenError(c, http.StatusBadRequest, "max_quota 不能为负数")
+		return
+	}
+	req.EndUserId = strings.TrimSpace(req.EndUserId)
+	if len(req.EndUserId) > 128 {
+		clientTokenError(c, http.StatusBadRequest, "end_user_id 不能超过 128 个字符")
+		return
+	}
+
+	token, err := model.GetCachedTokenById(c.GetInt("token_id"))
+	if err != nil {
+		common.SysLog("failed to get parent token: " + err.Error())
+		clientTokenError(c, http.StatusInternalServerError, "父令牌查询失败")
+		return
+	}
+	models := make([]string, 0, len(req.Models))
+	for _, m := range req.Models {
+		m = strings.TrimSpace(m)
+		if m == "" {
+			continue
+		}
+		if token.ModelLimitsEnabled && !token.GetModelLimitsMap()[m] {
+			clientTokenError(c, http.StatusBadRequest, fmt.Sprintf("父令牌无权访问模型 %s", m))
+			return
+		}
+		models = append(models, m)
+	}
+	modelsStr := strings.Join(models, ",")
+	if len(modelsStr) > 1024 {
+		clientTokenError(c, http.StatusBadRequest, "models 过长")
+		return
+	}
+
+	expiredTime := common.GetTimestamp() + req.TTL
+	if token.ExpiredTime != -1 && token.ExpiredTime < expiredTime {
+		expiredTime = token.ExpiredTime
+	}
+	ct := &model.ClientToken{
+		TokenId:     token.Id,
+		UserId:      token.UserId,
+		EndUserId:   req.EndUserId,
+		Models:      modelsStr,
+		MaxQuota:    req.MaxQuota,
+		ExpiredTime: expiredTime,
+	}
+	key, err := model.CreateClientToken(ct)
+	if err != nil {
+		common.SysLog("failed to create client token: " + err.Error())
+		clientTokenError(c, http.StatusInternalServerError, "客户端令牌创建失败")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"object":      "client_token",
+		"id":          ct.Id,
+		"token":       "sk-" + key,
+		"expires_at":  ct.ExpiredTime,
+		"models":      models,
+		"max_quota":   ct.MaxQuota,
+		"end_user_id": ct.EndUserId,
+	})
+}
+
+// RevokeClientToken 吊销当前令牌签发的客户端令牌，吊销后立即失效
+func RevokeClientToken(c *gin.Context) {
+	if common.GetContextKeyInt(c, constant.ContextKeyClientTokenId) != 0 {
+		clientTokenError(c, http.StatusForbidden, "客户端令牌不能吊销令牌")
+		return
+	}
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		clientTokenError(c, http.StatusBadRequest, "无效的客户端令牌 id")
+		return
+	}
+	if err := model.RevokeClientToken(c.GetInt("token_id"), id); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			clientTokenError(c, http.StatusNotFound, "客户端令牌不存在")
+			return
+		}
+		common.SysLog("failed to revoke client token: " + err.Error())
+		clientTokenError(c, http.StatusInternalServerError, "客户端令牌吊销失败")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"object":  "client_token",
+		"id":      id,
+		"deleted": true,
+	})
+}
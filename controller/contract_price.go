@@ -0,0 +1,96 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+func GetContractPrices(c *gin.Context) {
+	userId, _ := strconv.Atoi(c.Query("user_id"))
+	pageInfo := common.GetPageQuery(c)
+	prices, total, err := model.GetContractPrices(userId, c.Query("user_group"), pageInfo)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(prices)
+	common.ApiSuccess(c, pageInfo)
+}
+
+func AddContractPrice(c *gin.Context) {
+	price := model.ContractPrice{}
+	if err := c.ShouldBindJSON(&price); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := price.Validate(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	price.Id = 0
+	if err := price.Insert(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, price)
+}
+
+func UpdateContractPrice(c *gin.Context) {
+	price := model.ContractPrice{}
+	if err := c.ShouldBindJSON(&price); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if _, err := model.GetContractPriceById(price.Id); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := price.Validate(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := price.Update(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, price)
+}
+
+func DeleteContractPrice(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	price, err := model.GetContractPriceById(id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := price.Delete(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+// PreviewContractPrice 查询用户对某模型生效的合同价
+func PreviewContractPrice(c *gin.Context) {
+	userId, _ := strconv.Atoi(c.Query("user_id"))
+	modelName := c.Query("model")
+	if userId <= 0 || modelName == "" {
+		common.ApiErrorMsg(c, "参数错误")
+		return
+	}
+	user, err := model.GetUserCache(userId)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, model.ResolveContractPrice(user.Id, user.Group, modelName))
+}
@@ -0,0 +1,239 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+func GetAllCoupons(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	coupons, total, err := model.GetAllCoupons(strings.TrimSpace(c.Query("keyword")), pageInfo)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(coupons)
+	common.ApiSuccess(c, pageInfo)
+}
+
+func GetCoupon(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	coupon, err := model.GetCouponById(id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, coupon)
+}
+
+func GetCouponUsages(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo := common.GetPageQuery(c)
+	usages, total, err := model.GetCouponUsages(id, pageInfo)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(usages)
+	common.ApiSuccess(c, pageInfo)
+}
+
+func AddCoupon(c *gin.Context) {
+	coupon := model.Coupon{}
+	if err := c.ShouldBindJSON(&coupon); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := coupon.Validate(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	coupon.Id = 0
+	coupon.UsedCount = 0
+	if coupon.Status == 0 {
+		coupon.Status = model.CouponStatusEnabled
+	}
+	if err := coupon.Insert(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, coupon)
+}
+
+func UpdateCoupon(c *gin.Context) {
+	coupon := model.Coupon{}
+	if err := c.ShouldBindJSON(&coupon); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	origin, err := model.GetCouponById(coupon.Id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	// 优惠码创建后不可修改，避免已下单的订单对应不上
+	coupon.Code = origin.Code
+	if err := coupon.Validate(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if coupon.Status != model.CouponStatusEnabled && coupon.Status != model.CouponStatusDisabled {
+		common.ApiErrorMsg(c, "无效的状态")
+		return
+	}
+	if err := coupon.Update(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, coupon)
+}
+
+func DeleteCoupon(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	coupon, err := model.GetCouponById(id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := coupon.Delete(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+type CouponPreviewRequest struct {
+	Code          string `json:"code"`
+	PaymentMethod string `json:"payment_method"`
+	Amount        int64  `json:"amount"`
+	ProductId     string `json:"product_id"`
+	PlanId        int    `json:"plan_id"`
+}
+
+// PreviewCoupon 用户下单前试算优惠券，充值按支付方式计算原价，传入 plan_id 时按订阅套餐计算
+func PreviewCoupon(c *gin.Context) {
+	var req CouponPreviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Code) == "" {
+		common.ApiErrorMsg(c, "参数错误")
+		return
+	}
+	userId := c.GetInt("id")
+	group, err := model.GetUserGroup(userId, true)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	target := &model.CouponTarget{UserId: userId, Group: group, Scope: model.CouponScopeTopUp}
+	if req.PlanId > 0 {
+		plan, err := model.GetSubscriptionPlanById(req.PlanId)
+		if err != nil {
+			common.ApiError(c, err)
+			return
+		}
+		target.Scope = model.CouponScopeSubscription
+		target.PlanId = plan.Id
+		target.Money = plan.PriceAmount
+	} else {
+		switch req.PaymentMethod {
+		case PaymentMethodStripe:
+			target.Money = getStripePayMoney(float64(req.Amount), group)
+		case PaymentMethodPayPal:
+			target.Money = getPayPalPayMoney(req.Amount, group)
+		case PaymentMethodCreem:
+			product, err := findCreemProduct(req.ProductId)
+			if err != nil {
+				common.ApiError(c, err)
+				return
+			}
+			target.Money = product.Price
+		default:
+			target.Money = getPayMoney(req.Amount, group)
+		}
+	}
+	usage, err := model.PreviewCoupon(req.Code, target)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, gin.H{
+		"origin_money": usage.OriginMoney,
+		"discount":     usage.Discount,
+		"pay_money":    usage.PayMoney(),
+		"bonus_quota":  usage.BonusQuota,
+	})
+}
+
+// reserveOrderCoupon 下单时占用优惠券，未填写优惠码时返回 nil。
+// 支付金额在扣除优惠后低于 0.01 时释放占用并返回错误。
+func reserveOrderCoupon(code string, target *model.CouponTarget) (*model.CouponUsage, error) {
+	if strings.TrimSpace(code) == "" {
+		return nil, nil
+	}
+	usage, err := model.ReserveCoupon(code, target)
+	if err != nil {
+		return nil, err
+	}
+	if usage.Discount > 0 && usage.PayMoney() < 0.01 {
+		_ = model.ReleaseCouponUsage(target.TradeNo)
+		return nil, errors.New("优惠后支付金额过低")
+	}
+	return usage, nil
+}
+
+// applyOrderCoupon 按优惠券调整待支付订单的金额，usage 为 nil 时不做修改
+func applyOrderCoupon(order *PaymentOrder, usage *model.CouponUsage) {
+	if usage == nil {
+		return
+	}
+	order.Money = usage.PayMoney()
+	order.Discount = usage.Discount
+}
+
+// applyTopUpCoupon 在充值订单上记录使用的优惠券
+func applyTopUpCoupon(topUp *model.TopUp, usage *model.CouponUsage) {
+	if usage == nil {
+		return
+	}
+	topUp.CouponId = usage.CouponId
+	topUp.Discount = usage.Discount
+	topUp.BonusQuota = usage.BonusQuota
+}
+
+// applySubscriptionCoupon 在订阅订单上记录使用的优惠券，Money 改为抵扣后的实付金额
+func applySubscriptionCoupon(order *model.SubscriptionOrder, usage *model.CouponUsage) {
+	if usage == nil {
+		return
+	}
+	order.CouponId = usage.CouponId
+	order.Discount = usage.Discount
+	order.Money = usage.PayMoney()
+}
+
+func releaseOrderCoupon(usage *model.CouponUsage) {
+	if usage == nil {
+		return
+	}
+	if err := model.ReleaseCouponUsage(usage.TradeNo); err != nil {
+		common.SysError("failed to release coupon usage: " + err.Error())
+	}
+}
@@ -0,0 +1,179 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+// GetInvoiceSelf 返回当前用户的信用账户与账单列表
+func GetInvoiceSelf(c *gin.Context) {
+	userId := c.GetInt("id")
+	credit, err := model.GetUserCredit(userId)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo := common.GetPageQuery(c)
+	invoices, total, err := model.GetInvoices(userId, c.Query("status"), pageInfo)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(invoices)
+	common.ApiSuccess(c, gin.H{
+		"credit":   credit,
+		"invoices": pageInfo,
+	})
+}
+
+type InvoicePayRequest struct {
+	InvoiceId     int    `json:"invoice_id"`
+	PaymentMethod string `json:"payment_method"` // paypal 或易支付的支付方式
+}
+
+// RequestInvoicePay 通过支付渠道偿还账单。Stripe、Creem 按预设商品价格收款，不支持任意金额的账单
+func RequestInvoicePay(c *gin.Context) {
+	var req InvoicePayRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.InvoiceId <= 0 {
+		common.ApiErrorMsg(c, "参数错误")
+		return
+	}
+	userId := c.GetInt("id")
+	invoice, err := model.GetInvoiceById(req.InvoiceId)
+	if err != nil || invoice.UserId != userId {
+		common.ApiErrorMsg(c, "账单不存在")
+		return
+	}
+	if !invoice.IsOpen() {
+		common.ApiErrorMsg(c, "账单已结清")
+		return
+	}
+
+	var p PaymentProvider
+	var unitPrice float64
+	switch {
+	case req.PaymentMethod == PaymentMethodPayPal:
+		p = paypalAdaptor
+		unitPrice = setting.PayPalUnitPrice
+	case operation_setting.ContainsPayMethod(req.PaymentMethod):
+		p = epayAdaptor
+		unitPrice = operation_setting.Price
+	default:
+		common.ApiErrorMsg(c, "该支付方式不支持账单还款")
+		return
+	}
+	if !p.Enabled() {
+		common.ApiErrorMsg(c, "当前管理员未配置支付信息")
+		return
+	}
+	payMoney, _ := decimal.NewFromFloat(invoice.Money).Mul(decimal.NewFromFloat(unitPrice)).Round(2).Float64()
+	if payMoney < 0.01 {
+		common.ApiErrorMsg(c, "账单金额过低")
+		return
+	}
+
+	tradeNo := fmt.Sprintf("INVUSR%dNO%s%d", userId, common.GetRandomString(6), time.Now().Unix())
+	topUp := &model.TopUp{
+		UserId:        userId,
+		Amount:        int64(invoice.Quota),
+		Money:         payMoney,
+		TradeNo:       tradeNo,
+		PaymentMethod: req.PaymentMethod,
+		CreateTime:    time.Now().Unix(),
+		Status:        common.TopUpStatusPending,
+		InvoiceId:     invoice.Id,
+	}
+	if err := topUp.Insert(); err != nil {
+		common.ApiErrorMsg(c, "创建订单失败")
+		return
+	}
+	checkout, err := p.CreateCheckout(&PaymentOrder{
+		TradeNo:   tradeNo,
+		UserId:    userId,
+		Title:     fmt.Sprintf("INV%d", invoice.Id),
+		Money:     payMoney,
+		Method:    req.PaymentMethod,
+		CancelURL: system_setting.ServerAddress + "/console/topup",
+	})
+	if err != nil {
+		topUp.Status = common.TopUpStatusExpired
+		_ = topUp.Update()
+		common.ApiErrorMsg(c, paymentErrorMessage(p, err, "拉起支付失败"))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "success",
+		"data": gin.H{
+			"pay_link": checkout.PayLink,
+			"params":   checkout.Params,
+		},
+	})
+}
+
+func AdminListInvoices(c *gin.Context) {
+	userId, _ := strconv.Atoi(c.Query("user_id"))
+	pageInfo := common.GetPageQuery(c)
+	invoices, total, err := model.GetInvoices(userId, c.Query("status"), pageInfo)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(invoices)
+	common.ApiSuccess(c, pageInfo)
+}
+
+// AdminSettleInvoice 管理员确认线下收款（如对公转账）后结清账单
+func AdminSettleInvoice(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := model.SettleInvoice(id); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+func AdminListUserCredits(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	credits, total, err := model.GetAllUserCredits(pageInfo)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(credits)
+	common.ApiSuccess(c, pageInfo)
+}
+
+// AdminSaveUserCredit 开通或修改用户的信用额度，credit_limit 为 0 时停止透支但仍按月结算欠款
+func AdminSaveUserCredit(c *gin.Context) {
+	var req model.UserCredit
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	credit, err := model.SaveUserCredit(&req)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, credit)
+}
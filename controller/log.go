@@ -3,6 +3,7 @@ package controller
 import (
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/model"
@@ -120,6 +121,41 @@ func GetLogsStat(c *gin.Context) {
 	return
 }
 
+// GetChannelCostReport 按渠道、模型、日期汇总收入、上游成本与毛利，group_by 以逗号分隔
+func GetChannelCostReport(c *gin.Context) {
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	channel, _ := strconv.Atoi(c.Query("channel"))
+	utcOffset, _ := strconv.Atoi(c.Query("utc_offset"))
+	var groupBy []string
+	if value := c.Query("group_by"); value != "" {
+		groupBy = strings.Split(value, ",")
+	}
+	items, err := model.GetChannelCostReport(model.ChannelCostReportQuery{
+		StartTimestamp: startTimestamp,
+		EndTimestamp:   endTimestamp,
+		ChannelId:      channel,
+		ModelName:      c.Query("model_name"),
+		GroupBy:        groupBy,
+		UtcOffset:      utcOffset,
+	})
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	var revenue, cost int64
+	for _, item := range items {
+		revenue += item.Revenue
+		cost += item.Cost
+	}
+	common.ApiSuccess(c, gin.H{
+		"items":   items,
+		"revenue": revenue,
+		"cost":    cost,
+		"margin":  revenue - cost,
+	})
+}
+
 func GetLogsSelfStat(c *gin.Context) {
 	username := c.GetString("username")
 	logType, _ := strconv.Atoi(c.Query("type"))
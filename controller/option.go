@@ -10,6 +10,7 @@ import (
 	"github.com/QuantumNous/new-api/model"
 	"github.com/QuantumNous/new-api/setting"
 	"github.com/QuantumNous/new-api/setting/console_setting"
+	"github.com/QuantumNous/new-api/setting/model_setting"
 	"github.com/QuantumNous/new-api/setting/operation_setting"
 	"github.com/QuantumNous/new-api/setting/ratio_setting"
 	"github.com/QuantumNous/new-api/setting/system_setting"
@@ -178,6 +179,60 @@ func UpdateOption(c *gin.Context) {
 			})
 			return
 		}
+	case "ModelPricingTiers":
+		err = ratio_setting.UpdateModelPricingTiersByJSONString(option.Value.(string))
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "分档价格设置失败: " + err.Error(),
+			})
+			return
+		}
+	case "MediaPricing":
+		err = ratio_setting.UpdateMediaPricingByJSONString(option.Value.(string))
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "媒体计费设置失败: " + err.Error(),
+			})
+			return
+		}
+	case "PricingExpression":
+		err = ratio_setting.UpdatePricingExpressionByJSONString(option.Value.(string))
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "计费表达式设置失败: " + err.Error(),
+			})
+			return
+		}
+	case "ReasoningRatio":
+		err = ratio_setting.UpdateReasoningRatioByJSONString(option.Value.(string))
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "推理倍率设置失败: " + err.Error(),
+			})
+			return
+		}
+	case "ToolCallPrice":
+		err = ratio_setting.UpdateToolCallPriceByJSONString(option.Value.(string))
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "工具调用价格设置失败: " + err.Error(),
+			})
+			return
+		}
+	case "ChannelTagCostRatio":
+		err = ratio_setting.UpdateChannelTagCostRatioByJSONString(option.Value.(string))
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "渠道标签成本比例设置失败: " + err.Error(),
+			})
+			return
+		}
 	case "ModelRequestRateLimitGroup":
 		err = setting.CheckModelRequestRateLimitGroup(option.Value.(string))
 		if err != nil {
@@ -205,6 +260,15 @@ func UpdateOption(c *gin.Context) {
 			})
 			return
 		}
+	case "virtual_model.models":
+		err = model_setting.ValidateVirtualModels(option.Value.(string))
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "虚拟模型设置失败: " + err.Error(),
+			})
+			return
+		}
 	case "console_setting.api_info":
 		err = console_setting.ValidateConsoleSettings(option.Value.(string), "ApiInfo")
 		if err != nil {
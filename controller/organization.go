@@ -0,0 +1,363 @@
+package controller
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+type organizationRequest struct {
+	Name string `json:"name"`
+}
+
+type organizationMemberRequest struct {
+	Username   string `json:"username"`
+	Role       string `json:"role"`
+	QuotaLimit int    `json:"quota_limit"`
+	ResetUsed  bool   `json:"reset_used"`
+}
+
+type organizationQuotaRequest struct {
+	Quota int `json:"quota"`
+}
+
+// getOrgMember 解析路径中的组织 id 并校验当前用户是组织成员
+func getOrgMember(c *gin.Context) (*model.Organization, *model.OrganizationMember, bool) {
+	orgId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiErrorMsg(c, "参数错误")
+		return nil, nil, false
+	}
+	org, err := model.GetOrganizationById(orgId)
+	if err != nil {
+		common.ApiErrorMsg(c, "组织不存在")
+		return nil, nil, false
+	}
+	member, err := model.GetOrganizationMember(orgId, c.GetInt("id"))
+	if err != nil {
+		common.ApiErrorMsg(c, "无权访问该组织")
+		return nil, nil, false
+	}
+	return org, member, true
+}
+
+func GetSelfOrganizations(c *gin.Context) {
+	orgs, err := model.GetUserOrganizations(c.GetInt("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, orgs)
+}
+
+func CreateOrganization(c *gin.Context) {
+	var req organizationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiErrorMsg(c, "参数错误")
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > 64 {
+		common.ApiErrorMsg(c, "组织名称不能为空且不能超过 64 个字符")
+		return
+	}
+	org, err := model.CreateOrganization(req.Name, c.GetInt("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, org)
+}
+
+func GetOrganization(c *gin.Context) {
+	org, _, ok := getOrgMember(c)
+	if !ok {
+		return
+	}
+	common.ApiSuccess(c, org)
+}
+
+func UpdateOrganization(c *gin.Context) {
+	org, member, ok := getOrgMember(c)
+	if !ok {
+		return
+	}
+	if !member.CanManage() {
+		common.ApiErrorMsg(c, "无权管理该组织")
+		return
+	}
+	var req organizationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiErrorMsg(c, "参数错误")
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > 64 {
+		common.ApiErrorMsg(c, "组织名称不能为空且不能超过 64 个字符")
+		return
+	}
+	org.Name = req.Name
+	if err := org.Update(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, org)
+}
+
+func DeleteOrganization(c *gin.Context) {
+	org, member, ok := getOrgMember(c)
+	if !ok {
+		return
+	}
+	if member.Role != model.OrgRoleOwner {
+		common.ApiErrorMsg(c, "只有组织所有者可以删除组织")
+		return
+	}
+	if org.Quota > 0 {
+		common.ApiErrorMsg(c, "组织钱包仍有余额，无法删除")
+		return
+	}
+	if err := model.DeleteOrganization(org.Id); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+func GetOrganizationMembers(c *gin.Context) {
+	org, _, ok := getOrgMember(c)
+	if !ok {
+		return
+	}
+	members, err := model.GetOrganizationMembers(org.Id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, members)
+}
+
+func AddOrganizationMember(c *gin.Context) {
+	org, member, ok := getOrgMember(c)
+	if !ok {
+		return
+	}
+	if !member.CanManage() {
+		common.ApiErrorMsg(c, "无权管理该组织")
+		return
+	}
+	var req organizationMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiErrorMsg(c, "参数错误")
+		return
+	}
+	if req.Role == "" {
+		req.Role = model.OrgRoleDeveloper
+	}
+	if !model.IsValidOrgRole(req.Role) || req.Role == model.OrgRoleOwner {
+		common.ApiErrorMsg(c, "无效的成员角色")
+		return
+	}
+	if req.Role == model.OrgRoleAdmin && member.Role != model.OrgRoleOwner {
+		common.ApiErrorMsg(c, "只有组织所有者可以添加管理员")
+		return
+	}
+	if req.QuotaLimit < 0 {
+		common.ApiErrorMsg(c, "成员预算不能为负数")
+		return
+	}
+	userId, err := model.GetUserIdByUsername(strings.TrimSpace(req.Username))
+	if err != nil || userId == 0 {
+		common.ApiErrorMsg(c, "用户不存在")
+		return
+	}
+	if _, err := model.GetOrganizationMember(org.Id, userId); err == nil {
+		common.ApiErrorMsg(c, "该用户已是组织成员")
+		return
+	}
+	newMember := &model.OrganizationMember{
+		OrgId:      org.Id,
+		UserId:     userId,
+		Role:       req.Role,
+		QuotaLimit: req.QuotaLimit,
+	}
+	if err := model.AddOrganizationMember(newMember); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, newMember)
+}
+
+func UpdateOrganizationMember(c *gin.Context) {
+	org, member, ok := getOrgMember(c)
+	if !ok {
+		return
+	}
+	if !member.CanManage() {
+		common.ApiErrorMsg(c, "无权管理该组织")
+		return
+	}
+	userId, _ := strconv.Atoi(c.Param("user_id"))
+	target, err := model.GetOrganizationMember(org.Id, userId)
+	if err != nil {
+		common.ApiErrorMsg(c, "成员不存在")
+		return
+	}
+	var req organizationMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiErrorMsg(c, "参数错误")
+		return
+	}
+	if req.QuotaLimit < 0 {
+		common.ApiErrorMsg(c, "成员预算不能为负数")
+		return
+	}
+	if req.Role != "" && req.Role != target.Role {
+		if !model.IsValidOrgRole(req.Role) || req.Role == model.OrgRoleOwner || target.Role == model.OrgRoleOwner {
+			common.ApiErrorMsg(c, "无效的成员角色")
+			return
+		}
+		if (req.Role == model.OrgRoleAdmin || target.Role == model.OrgRoleAdmin) && member.Role != model.OrgRoleOwner {
+			common.ApiErrorMsg(c, "只有组织所有者可以变更管理员")
+			return
+		}
+		target.Role = req.Role
+	}
+	target.QuotaLimit = req.QuotaLimit
+	if err := model.UpdateOrganizationMember(target, req.ResetUsed); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, target)
+}
+
+func RemoveOrganizationMember(c *gin.Context) {
+	org, member, ok := getOrgMember(c)
+	if !ok {
+		return
+	}
+	userId, _ := strconv.Atoi(c.Param("user_id"))
+	// 成员可以自行退出，管理其他成员需要管理权限
+	if userId != member.UserId && !member.CanManage() {
+		common.ApiErrorMsg(c, "无权管理该组织")
+		return
+	}
+	target, err := model.GetOrganizationMember(org.Id, userId)
+	if err != nil {
+		common.ApiErrorMsg(c, "成员不存在")
+		return
+	}
+	if target.Role == model.OrgRoleOwner {
+		common.ApiErrorMsg(c, "不能移除组织所有者")
+		return
+	}
+	if target.Role == model.OrgRoleAdmin && member.Role != model.OrgRoleOwner && userId != member.UserId {
+		common.ApiErrorMsg(c, "只有组织所有者可以移除管理员")
+		return
+	}
+	if err := model.RemoveOrganizationMember(org.Id, userId); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+// TransferOrganizationQuota 成员将个人额度划转到组织钱包
+func TransferOrganizationQuota(c *gin.Context) {
+	org, _, ok := getOrgMember(c)
+	if !ok {
+		return
+	}
+	var req organizationQuotaRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Quota <= 0 {
+		common.ApiErrorMsg(c, "参数错误")
+		return
+	}
+	if err := model.TransferUserQuotaToOrganization(c.GetInt("id"), org.Id, req.Quota); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+func GetOrganizationTokens(c *gin.Context) {
+	org, member, ok := getOrgMember(c)
+	if !ok {
+		return
+	}
+	if !member.CanManage() && member.Role != model.OrgRoleBilling {
+		common.ApiErrorMsg(c, "无权查看组织令牌")
+		return
+	}
+	pageInfo := common.GetPageQuery(c)
+	tokens, total, err := model.GetOrganizationTokens(org.Id, pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	for _, token := range tokens {
+		token.MaskKey()
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(tokens)
+	common.ApiSuccess(c, pageInfo)
+}
+
+// GetOrganizationUsage 按成员汇总组织令牌的消费
+func GetOrganizationUsage(c *gin.Context) {
+	org, member, ok := getOrgMember(c)
+	if !ok {
+		return
+	}
+	if !member.CanManage() && member.Role != model.OrgRoleBilling {
+		common.ApiErrorMsg(c, "无权查看组织用量")
+		return
+	}
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	usages, err := model.GetOrganizationUsageByMember(org.Id, startTimestamp, endTimestamp)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, usages)
+}
+
+func AdminListOrganizations(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	orgs, total, err := model.GetAllOrganizations(pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(orgs)
+	common.ApiSuccess(c, pageInfo)
+}
+
+// AdminAdjustOrganizationQuota 管理员调整组织钱包额度，quota 可为负数
+func AdminAdjustOrganizationQuota(c *gin.Context) {
+	orgId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiErrorMsg(c, "参数错误")
+		return
+	}
+	var req organizationQuotaRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Quota == 0 {
+		common.ApiErrorMsg(c, "参数错误")
+		return
+	}
+	if _, err := model.GetOrganizationById(orgId); err != nil {
+		common.ApiErrorMsg(c, "组织不存在")
+		return
+	}
+	if err := model.AdjustOrganizationQuota(orgId, req.Quota); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
@@ -0,0 +1,125 @@
+package controller
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/QuantumNous/new-api/setting"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+// newPayPalMockServer 模拟 PayPal REST API：OAuth、创建订单、扣款与 webhook 验签
+func newPayPalMockServer(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/oauth2/token", func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		require.True(t, ok)
+		require.Equal(t, "client", user)
+		require.Equal(t, "secret", pass)
+		_, _ = io.WriteString(w, `{"access_token":"A21","expires_in":32400}`)
+	})
+	mux.HandleFunc("/v2/checkout/orders", func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "Bearer A21", r.Header.Get("Authorization"))
+		var body struct {
+			PurchaseUnits []struct {
+				CustomId string      `json:"custom_id"`
+				Amount   paypalMoney `json:"amount"`
+			} `json:"purchase_units"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		require.Equal(t, "ref_paypal", body.PurchaseUnits[0].CustomId)
+		require.Equal(t, paypalMoney{CurrencyCode: "USD", Value: "12.50"}, body.PurchaseUnits[0].Amount)
+		_, _ = io.WriteString(w, `{"id":"ORDER1","status":"CREATED","links":[
+			{"href":"https://mock/v2/checkout/orders/ORDER1","rel":"self"},
+			{"href":"https://mock/checkoutnow?token=ORDER1","rel":"approve"}]}`)
+	})
+	mux.HandleFunc("/v2/checkout/orders/ORDER1/capture", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, `{"id":"ORDER1","status":"COMPLETED","purchase_units":[{"payments":{"captures":[
+			{"id":"CAP1","status":"COMPLETED","custom_id":"ref_paypal","amount":{"currency_code":"USD","value":"12.50"}}]}}]}`)
+	})
+	mux.HandleFunc("/v1/notifications/verify-webhook-signature", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			TransmissionSig string          `json:"transmission_sig"`
+			WebhookId       string          `json:"webhook_id"`
+			WebhookEvent    json.RawMessage `json:"webhook_event"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		require.Equal(t, "WH1", body.WebhookId)
+		require.NotEmpty(t, body.WebhookEvent)
+		status := "FAILURE"
+		if body.TransmissionSig == "good" {
+			status = "SUCCESS"
+		}
+		_, _ = io.WriteString(w, `{"verification_status":"`+status+`"}`)
+	})
+	return httptest.NewServer(mux)
+}
+
+func newPayPalWebhookContext(event string, signature string) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/paypal/webhook", strings.NewReader(event))
+	c.Request.Header.Set("PAYPAL-TRANSMISSION-SIG", signature)
+	return c
+}
+
+// 修改 PayPal 全局配置，不能与其他测试并行
+func TestPayPalProvider(t *testing.T) {
+	server := newPayPalMockServer(t)
+	defer server.Close()
+
+	setting.PayPalClientId = "client"
+	setting.PayPalClientSecret = "secret"
+	setting.PayPalWebhookId = "WH1"
+	setting.PayPalApiBase = server.URL
+	setting.PayPalCurrency = "usd"
+	defer func() {
+		setting.PayPalClientId = ""
+		setting.PayPalClientSecret = ""
+		setting.PayPalWebhookId = ""
+		setting.PayPalApiBase = ""
+		setting.PayPalCurrency = "USD"
+	}()
+	adaptor := &PayPalAdaptor{}
+	require.True(t, adaptor.Enabled())
+
+	checkout, err := adaptor.CreateCheckout(&PaymentOrder{TradeNo: "ref_paypal", Title: "TUC10", Money: 12.5})
+	require.NoError(t, err)
+	require.Equal(t, "https://mock/checkoutnow?token=ORDER1", checkout.PayLink)
+
+	order, err := adaptor.captureOrder("ORDER1")
+	require.NoError(t, err)
+	unit := order.PurchaseUnits[0]
+	n := captureNotification(&unit.Payments.Captures[0], unit.CustomId)
+	require.Equal(t, PaymentActionComplete, n.Action)
+	require.Equal(t, "ref_paypal", n.TradeNo)
+	require.Equal(t, "CAP1", n.ProviderPaymentId)
+	require.EqualValues(t, 1250, n.TotalAmount)
+
+	refundEvent := `{"id":"WH-EVT-1","event_type":"PAYMENT.CAPTURE.REFUNDED","resource":{
+		"id":"REF1","status":"COMPLETED","amount":{"currency_code":"USD","value":"5.00"},
+		"seller_payable_breakdown":{"total_refunded_amount":{"currency_code":"USD","value":"7.25"}},
+		"links":[{"href":"https://mock/v2/payments/refunds/REF1","rel":"self"},
+			{"href":"https://mock/v2/payments/captures/CAP1","rel":"up"}]}}`
+	n, err = adaptor.VerifyWebhook(newPayPalWebhookContext(refundEvent, "good"))
+	require.NoError(t, err)
+	require.Equal(t, "WH-EVT-1", n.EventId)
+	require.Equal(t, PaymentActionRefund, n.Action)
+	require.Equal(t, "CAP1", n.ProviderPaymentId)
+	require.EqualValues(t, 725, n.RefundedAmount)
+
+	deniedEvent := `{"id":"WH-EVT-2","event_type":"PAYMENT.CAPTURE.DENIED","resource":{
+		"id":"CAP2","status":"DECLINED","custom_id":"ref_denied","amount":{"currency_code":"USD","value":"1.00"}}}`
+	n, err = adaptor.VerifyWebhook(newPayPalWebhookContext(deniedEvent, "good"))
+	require.NoError(t, err)
+	require.Equal(t, "WH-EVT-2", n.EventId)
+	require.Equal(t, PaymentActionExpire, n.Action)
+	require.Equal(t, "ref_denied", n.TradeNo)
+
+	_, err = adaptor.VerifyWebhook(newPayPalWebhookContext(refundEvent, "forged"))
+	require.ErrorIs(t, err, errInvalidPaymentWebhook)
+}
@@ -0,0 +1,347 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// PaymentProvider 支付渠道统一接口，钱包充值与订阅订单共用同一套下单、回调、完成/过期与退款流程
+type PaymentProvider interface {
+	// Name 渠道标识，同时作为订单的 payment_method 与回调事件去重的命名空间
+	Name() string
+	// Enabled 渠道是否已完成配置
+	Enabled() bool
+	// CreateCheckout 为本地订单创建支付，返回跳转链接或需要表单提交的参数
+	CreateCheckout(order *PaymentOrder) (*PaymentCheckout, error)
+	// VerifyWebhook 校验回调签名并解析为统一的支付通知，签名无效时返回 errInvalidPaymentWebhook
+	VerifyWebhook(c *gin.Context) (*PaymentNotification, error)
+	// CompleteTopUp 完成钱包充值订单并为用户入账
+	CompleteTopUp(n *PaymentNotification) error
+	// Refund 对已完成的订单发起退款，money 为 0 表示全额；额度在渠道的退款回调中扣回
+	Refund(topUp *model.TopUp, money float64) error
+	// Acknowledge 按渠道要求的格式回复回调请求
+	Acknowledge(c *gin.Context, err error)
+}
+
+// PaymentOrder 发起支付所需的本地订单信息
+type PaymentOrder struct {
+	TradeNo      string
+	UserId       int
+	Email        string
+	Username     string
+	CustomerId   string // 支付平台侧的客户标识，如 Stripe customer
+	Title        string
+	Money        float64 // 实际支付金额
+	Discount     float64 // 优惠券抵扣金额，已从 Money 中扣除
+	Quantity     int64   // 按渠道单价计费时的购买数量
+	ProductId    string  // 渠道侧的商品或价格标识
+	Method       string  // 渠道内的支付方式，如易支付的 alipay / wxpay
+	Subscription bool
+	SuccessURL   string
+	CancelURL    string
+}
+
+// PaymentCheckout 创建支付的结果，PayLink 用于跳转，Params 用于表单提交
+type PaymentCheckout struct {
+	PayLink string
+	Params  map[string]string
+}
+
+type PaymentAction int
+
+const (
+	PaymentActionIgnore PaymentAction = iota
+	PaymentActionComplete
+	PaymentActionExpire
+	PaymentActionRefund
+	PaymentActionCustom
+)
+
+// PaymentNotification 渠道回调解析后的统一通知
+type PaymentNotification struct {
+	EventId   string // 为空时不做事件级去重，依赖订单状态保证幂等
+	EventType string
+	Action    PaymentAction
+	TradeNo   string
+	// 支付平台侧的支付标识，完成时记录到充值订单，退款时据此定位订单
+	ProviderPaymentId string
+	// 需要与用户订阅关联的支付平台标识，后续续费、退款据此定位订阅
+	ProviderSubscriptionId string
+	RefundedAmount         int64 // 累计退款金额（最小货币单位）
+	TotalAmount            int64 // 订单总金额（最小货币单位），为 0 时按本地订单金额计算
+	Payload                string
+	Data                   any          // 渠道自定义的解析结果
+	Handle                 func() error // PaymentActionCustom 时调用
+}
+
+var errInvalidPaymentWebhook = errors.New("invalid payment webhook")
+
+// paymentError 可直接展示给用户的下单错误
+type paymentError struct {
+	msg string
+}
+
+func (e *paymentError) Error() string {
+	return e.msg
+}
+
+func newPaymentError(msg string) error {
+	return &paymentError{msg: msg}
+}
+
+// paymentErrorMessage 渠道调用失败时给用户的提示，渠道内部错误只记录日志并返回 fallback
+func paymentErrorMessage(p PaymentProvider, err error, fallback string) string {
+	var pe *paymentError
+	if errors.As(err, &pe) {
+		return pe.msg
+	}
+	log.Printf("%s %s: %v", p.Name(), fallback, err)
+	return fallback
+}
+
+var paymentProviders = map[string]PaymentProvider{
+	PaymentMethodStripe: stripeAdaptor,
+	PaymentMethodCreem:  creemAdaptor,
+	PaymentMethodPayPal: paypalAdaptor,
+	PaymentMethodEpay:   epayAdaptor,
+}
+
+// GetPaymentProvider 按订单的 payment_method 查找支付渠道，易支付订单记录的是具体支付方式
+func GetPaymentProvider(method string) PaymentProvider {
+	if p, ok := paymentProviders[method]; ok {
+		return p
+	}
+	if operation_setting.ContainsPayMethod(method) {
+		return epayAdaptor
+	}
+	return nil
+}
+
+// acknowledgePaymentWebhook 以 HTTP 状态码回复回调，签名无效返回 invalidStatus，处理失败返回 500 让渠道重试
+func acknowledgePaymentWebhook(c *gin.Context, err error, invalidStatus int) {
+	switch {
+	case err == nil:
+		c.Status(http.StatusOK)
+	case errors.Is(err, errInvalidPaymentWebhook):
+		c.AbortWithStatus(invalidStatus)
+	default:
+		c.AbortWithStatus(http.StatusInternalServerError)
+	}
+}
+
+// handlePaymentWebhook 渠道回调的统一入口：验签、按事件 id 去重、分发处理，失败时释放事件让渠道重试
+func handlePaymentWebhook(c *gin.Context, p PaymentProvider) {
+	n, err := p.VerifyWebhook(c)
+	if err != nil {
+		log.Printf("%s 回调校验失败: %v", p.Name(), err)
+		p.Acknowledge(c, err)
+		return
+	}
+
+	if n.EventId != "" {
+		claimed, err := model.ClaimPaymentEvent(p.Name(), n.EventId, n.EventType)
+		if err != nil {
+			log.Printf("记录 %s 回调事件失败: %v", p.Name(), err)
+			p.Acknowledge(c, err)
+			return
+		}
+		if !claimed {
+			log.Printf("%s 回调事件已处理过: %s", p.Name(), n.EventId)
+			p.Acknowledge(c, nil)
+			return
+		}
+	}
+
+	err = processPaymentNotification(p, n)
+	if err != nil {
+		log.Printf("处理 %s 回调事件失败: %s %s, %v", p.Name(), n.EventType, n.EventId, err)
+		if n.EventId != "" {
+			if err := model.ReleasePaymentEvent(p.Name(), n.EventId); err != nil {
+				log.Printf("释放 %s 回调事件失败: %v", p.Name(), err)
+			}
+		}
+	}
+	p.Acknowledge(c, err)
+}
+
+func processPaymentNotification(p PaymentProvider, n *PaymentNotification) error {
+	switch n.Action {
+	case PaymentActionComplete:
+		return completePaymentOrder(p, n)
+	case PaymentActionExpire:
+		return expirePaymentOrder(n.TradeNo)
+	case PaymentActionRefund:
+		return refundPaymentOrder(p, n)
+	case PaymentActionCustom:
+		if n.Handle == nil {
+			return nil
+		}
+		return n.Handle()
+	default:
+		return nil
+	}
+}
+
+// completePaymentOrder 支付成功：依次按订阅订单、账单还款订单处理，否则完成钱包充值订单
+func completePaymentOrder(p PaymentProvider, n *PaymentNotification) error {
+	if n.TradeNo == "" {
+		log.Printf("%s 支付通知缺少订单号: %s", p.Name(), n.EventId)
+		return nil
+	}
+	LockOrder(n.TradeNo)
+	defer UnlockOrder(n.TradeNo)
+
+	err := model.CompleteSubscriptionOrder(n.TradeNo, n.Payload)
+	if err == nil {
+		if err := model.SetTopUpProviderPaymentId(n.TradeNo, n.ProviderPaymentId); err != nil {
+			log.Printf("记录 %s 支付标识失败: %v, %s", p.Name(), err, n.TradeNo)
+		}
+		if err := model.BindUserSubscriptionProvider(n.TradeNo, n.ProviderSubscriptionId); err != nil {
+			log.Printf("关联 %s 订阅失败: %v, %s", p.Name(), err, n.TradeNo)
+		}
+		return nil
+	}
+	if !errors.Is(err, model.ErrSubscriptionOrderNotFound) {
+		return err
+	}
+
+	err = model.CompleteInvoicePayment(n.TradeNo, n.ProviderPaymentId)
+	if !errors.Is(err, model.ErrInvoicePaymentNotFound) {
+		return err
+	}
+
+	topUp := model.GetTopUpByTradeNo(n.TradeNo)
+	if topUp == nil {
+		log.Printf("%s 充值订单不存在: %s", p.Name(), n.TradeNo)
+		return nil
+	}
+	if topUp.Status != common.TopUpStatusPending {
+		log.Printf("%s 充值订单已处理: %s, 当前状态: %s", p.Name(), n.TradeNo, topUp.Status)
+		return nil
+	}
+	if err := p.CompleteTopUp(n); err != nil {
+		return err
+	}
+	if err := model.SetTopUpProviderPaymentId(n.TradeNo, n.ProviderPaymentId); err != nil {
+		log.Printf("记录 %s 支付标识失败: %v, %s", p.Name(), err, n.TradeNo)
+	}
+	return nil
+}
+
+// expirePaymentOrder 支付超时或被拒绝：将待支付的订阅订单或充值订单标记为过期
+func expirePaymentOrder(tradeNo string) error {
+	if tradeNo == "" {
+		return nil
+	}
+	LockOrder(tradeNo)
+	defer UnlockOrder(tradeNo)
+
+	err := model.ExpireSubscriptionOrder(tradeNo)
+	if err == nil || !errors.Is(err, model.ErrSubscriptionOrderNotFound) {
+		return err
+	}
+
+	topUp := model.GetTopUpByTradeNo(tradeNo)
+	if topUp == nil {
+		log.Println("充值订单不存在", tradeNo)
+		return nil
+	}
+	if topUp.Status != common.TopUpStatusPending {
+		log.Println("充值订单状态错误", tradeNo)
+		return nil
+	}
+	topUp.Status = common.TopUpStatusExpired
+	if err := topUp.Update(); err != nil {
+		return err
+	}
+	if err := model.ReleaseCouponUsage(tradeNo); err != nil {
+		common.SysError("failed to release coupon usage: " + err.Error())
+	}
+	log.Println("充值订单已过期", tradeNo)
+	return nil
+}
+
+// refundPaymentOrder 渠道退款回调：钱包充值按退款比例扣回额度，订阅订单全额退款时作废订阅
+func refundPaymentOrder(p PaymentProvider, n *PaymentNotification) error {
+	topUp := model.GetTopUpByProviderPaymentId(n.ProviderPaymentId)
+	if topUp == nil {
+		log.Printf("%s 退款未找到对应订单: %s", p.Name(), n.ProviderPaymentId)
+		return nil
+	}
+	total := n.TotalAmount
+	if total <= 0 {
+		total = int64(math.Round(topUp.Money * 100))
+	}
+	if model.GetSubscriptionOrderByTradeNo(topUp.TradeNo) != nil {
+		if n.RefundedAmount < total {
+			log.Printf("%s 订阅部分退款，不作废订阅: %s", p.Name(), topUp.TradeNo)
+			return nil
+		}
+		msg, err := model.CancelUserSubscriptionByProvider(n.ProviderPaymentId)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil
+			}
+			return err
+		}
+		reason := fmt.Sprintf("%s 订阅款项已全额退款，订阅已作废", p.Name())
+		if msg != "" {
+			reason += "，" + msg
+		}
+		model.RecordLog(topUp.UserId, model.LogTypeSystem, reason)
+		return nil
+	}
+	clawback, err := model.ClawbackTopUpQuota(n.ProviderPaymentId, n.RefundedAmount, total, p.Name()+" 退款")
+	if err != nil {
+		return err
+	}
+	log.Printf("%s 退款已处理: %s, 扣回额度 %d", p.Name(), topUp.TradeNo, clawback)
+	return nil
+}
+
+type AdminRefundTopUpRequest struct {
+	TradeNo string  `json:"trade_no"`
+	Money   float64 `json:"money"` // 退款金额，0 表示全额
+}
+
+// AdminRefundTopUp 管理员通过原支付渠道发起退款，额度在渠道退款回调到达后扣回
+func AdminRefundTopUp(c *gin.Context) {
+	var req AdminRefundTopUpRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.TradeNo == "" || req.Money < 0 {
+		common.ApiErrorMsg(c, "参数错误")
+		return
+	}
+	topUp := model.GetTopUpByTradeNo(req.TradeNo)
+	if topUp == nil {
+		common.ApiErrorMsg(c, "充值订单不存在")
+		return
+	}
+	if topUp.Status != common.TopUpStatusSuccess {
+		common.ApiErrorMsg(c, "只能对已完成的订单退款")
+		return
+	}
+	if req.Money > topUp.Money {
+		common.ApiErrorMsg(c, "退款金额不能大于支付金额")
+		return
+	}
+	p := GetPaymentProvider(topUp.PaymentMethod)
+	if p == nil || !p.Enabled() {
+		common.ApiErrorMsg(c, "订单的支付渠道不可用")
+		return
+	}
+	if err := p.Refund(topUp, req.Money); err != nil {
+		common.ApiErrorMsg(c, paymentErrorMessage(p, err, "发起退款失败"))
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
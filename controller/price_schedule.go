@@ -0,0 +1,124 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+func GetAllPriceSchedules(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	schedules, total, err := model.GetAllPriceSchedules(pageInfo)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(schedules)
+	common.ApiSuccess(c, pageInfo)
+}
+
+func GetPriceSchedule(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	schedule, err := model.GetPriceScheduleById(id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, schedule)
+}
+
+func AddPriceSchedule(c *gin.Context) {
+	schedule := model.PriceSchedule{}
+	if err := c.ShouldBindJSON(&schedule); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := schedule.Validate(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	schedule.Id = 0
+	if err := schedule.Insert(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, schedule)
+}
+
+// UpdatePriceSchedule 未生效的计划可任意修改；已生效的计划只能停用或设置不早于当前的结束时间，保证历史账单可追溯
+func UpdatePriceSchedule(c *gin.Context) {
+	schedule := model.PriceSchedule{}
+	if err := c.ShouldBindJSON(&schedule); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	origin, err := model.GetPriceScheduleById(schedule.Id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	started := origin.Started()
+	if started {
+		if schedule.EffectiveTo != origin.EffectiveTo && schedule.EffectiveTo != 0 && schedule.EffectiveTo < common.GetTimestamp() {
+			common.ApiErrorMsg(c, "已生效的价格计划不能将结束时间设置为过去的时间")
+			return
+		}
+		status, effectiveTo := schedule.Status, schedule.EffectiveTo
+		schedule = *origin
+		schedule.Status, schedule.EffectiveTo = status, effectiveTo
+	}
+	if err := schedule.Validate(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := schedule.Update(started); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, schedule)
+}
+
+func DeletePriceSchedule(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	schedule, err := model.GetPriceScheduleById(id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if schedule.Started() {
+		common.ApiErrorMsg(c, "已生效的价格计划不能删除，请停用或设置结束时间")
+		return
+	}
+	if err := schedule.Delete(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+// PreviewScheduledPrice 查询模型在指定时间（默认当前）生效的价格计划
+func PreviewScheduledPrice(c *gin.Context) {
+	modelName := c.Query("model")
+	if modelName == "" {
+		common.ApiErrorMsg(c, "参数错误")
+		return
+	}
+	at := time.Now()
+	if ts, err := strconv.ParseInt(c.Query("time"), 10, 64); err == nil && ts > 0 {
+		at = time.Unix(ts, 0)
+	}
+	common.ApiSuccess(c, model.ResolveScheduledPrice(modelName, at))
+}
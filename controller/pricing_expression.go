@@ -0,0 +1,80 @@
+package controller
+
+import (
+	"errors"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/pkg/billingexpr"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+type PricingExpressionDryRunRequest struct {
+	Model      string             `json:"model"`      // 未填写 expression 时使用该模型已配置的表达式
+	Expression string             `json:"expression"` // 待试算的表达式
+	Usage      *dto.Usage         `json:"usage"`      // 上游返回的用量，可直接粘贴日志中的 usage
+	Claude     bool               `json:"claude"`     // usage 是否为 Claude 语义（prompt_tokens 不含缓存）
+	Vars       map[string]float64 `json:"vars"`       // 直接指定变量，覆盖由 usage 计算的值
+	Params     map[string]any     `json:"params"`     // 请求参数
+	GroupRatio *float64           `json:"group_ratio"`
+}
+
+// DryRunPricingExpression 试算计费表达式，不产生扣费
+func DryRunPricingExpression(c *gin.Context) {
+	req := PricingExpressionDryRunRequest{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	var program *billingexpr.Program
+	if req.Expression != "" {
+		compiled, err := billingexpr.Compile(req.Expression)
+		if err != nil {
+			common.ApiError(c, err)
+			return
+		}
+		program = compiled
+	} else if program = ratio_setting.GetPricingExpression(req.Model); program == nil {
+		common.ApiError(c, errors.New("模型未配置计费表达式"))
+		return
+	}
+
+	vars := make(map[string]float64, len(billingexpr.Variables))
+	for _, name := range billingexpr.Variables {
+		vars[name] = 0
+	}
+	if req.Usage != nil {
+		for name, v := range service.PricingExpressionVars(req.Usage, req.Claude) {
+			vars[name] = v
+		}
+	}
+	for name, v := range req.Vars {
+		vars[name] = v
+	}
+	var body []byte
+	if req.Params != nil {
+		var err error
+		if body, err = common.Marshal(req.Params); err != nil {
+			common.ApiError(c, err)
+			return
+		}
+	}
+	cost, err := program.Eval(billingexpr.Env{Vars: vars, Param: service.PricingExpressionParams(body)})
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	groupRatio := 1.0
+	if req.GroupRatio != nil {
+		groupRatio = *req.GroupRatio
+	}
+	common.ApiSuccess(c, gin.H{
+		"expression": program.Source,
+		"vars":       vars,
+		"cost":       cost,
+		"quota":      service.PricingExpressionQuota(cost, groupRatio, 0),
+	})
+}
@@ -81,6 +81,10 @@ func AddRedemption(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"success": false, "message": msg})
 		return
 	}
+	if err := redemption.ValidateGrant(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
 	var keys []string
 	for i := 0; i < redemption.Count; i++ {
 		key := common.GetUUID()
@@ -91,6 +95,15 @@ func AddRedemption(c *gin.Context) {
 			CreatedTime: common.GetTimestamp(),
 			Quota:       redemption.Quota,
 			ExpiredTime: redemption.ExpiredTime,
+
+			MaxUses:          redemption.MaxUses,
+			MaxUsesPerUser:   redemption.MaxUsesPerUser,
+			NewUserOnly:      redemption.NewUserOnly,
+			Groups:           redemption.Groups,
+			RegisteredAfter:  redemption.RegisteredAfter,
+			PlanId:           redemption.PlanId,
+			UpgradeGroup:     redemption.UpgradeGroup,
+			UpgradeGroupDays: redemption.UpgradeGroupDays,
 		}
 		err = cleanRedemption.Insert()
 		if err != nil {
@@ -144,10 +157,22 @@ func UpdateRedemption(c *gin.Context) {
 			c.JSON(http.StatusOK, gin.H{"success": false, "message": msg})
 			return
 		}
+		if err := redemption.ValidateGrant(); err != nil {
+			common.ApiError(c, err)
+			return
+		}
 		// If you add more fields, please also update redemption.Update()
 		cleanRedemption.Name = redemption.Name
 		cleanRedemption.Quota = redemption.Quota
 		cleanRedemption.ExpiredTime = redemption.ExpiredTime
+		cleanRedemption.MaxUses = redemption.MaxUses
+		cleanRedemption.MaxUsesPerUser = redemption.MaxUsesPerUser
+		cleanRedemption.NewUserOnly = redemption.NewUserOnly
+		cleanRedemption.Groups = redemption.Groups
+		cleanRedemption.RegisteredAfter = redemption.RegisteredAfter
+		cleanRedemption.PlanId = redemption.PlanId
+		cleanRedemption.UpgradeGroup = redemption.UpgradeGroup
+		cleanRedemption.UpgradeGroupDays = redemption.UpgradeGroupDays
 	}
 	if statusOnly != "" {
 		cleanRedemption.Status = redemption.Status
@@ -165,6 +190,32 @@ func UpdateRedemption(c *gin.Context) {
 	return
 }
 
+// GetRedemptionStats 活动兑换码的兑换统计与兑换记录
+func GetRedemptionStats(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	stats, err := model.GetRedemptionStats(id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo := common.GetPageQuery(c)
+	usages, total, err := model.GetRedemptionUsages(id, pageInfo)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(usages)
+	common.ApiSuccess(c, gin.H{
+		"stats":  stats,
+		"usages": pageInfo,
+	})
+}
+
 func DeleteInvalidRedemption(c *gin.Context) {
 	rows, err := model.DeleteInvalidRedemptions()
 	if err != nil {
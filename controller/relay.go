@@ -188,6 +188,11 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 		if channelErr != nil {
 			logger.LogError(c, channelErr.Error())
 			newAPIError = channelErr
+			if switched, fallbackErr := switchVirtualModelFallback(c, relayInfo, retryParam, newAPIError, tokens, meta); switched {
+				continue
+			} else if fallbackErr != nil {
+				newAPIError = fallbackErr
+			}
 			break
 		}
 
@@ -223,9 +228,20 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 
 		processChannelError(c, *types.NewChannelError(channel.Id, channel.Type, channel.Name, channel.ChannelInfo.IsMultiKey, common.GetContextKeyString(c, constant.ContextKeyChannelKey), channel.GetAutoBan()), newAPIError)
 
-		if !shouldRetry(c, newAPIError, common.RetryTimes-retryParam.GetRetry()) {
-			break
+		if shouldRetry(c, newAPIError, common.RetryTimes-retryParam.GetRetry()) && retryParam.GetRetry() < common.RetryTimes {
+			continue
 		}
+		// 当前模型重试用尽，虚拟模型回退到下一个目标模型
+		if switched, fallbackErr := switchVirtualModelFallback(c, relayInfo, retryParam, newAPIError, tokens, meta); switched {
+			continue
+		} else if fallbackErr != nil {
+			newAPIError = fallbackErr
+		}
+		break
+	}
+
+	if newAPIError != nil && relayInfo.StructuredOutput != nil && relayInfo.StructuredOutput.Failures > 0 {
+		newAPIError = finishStructuredOutput(c, relayInfo)
 	}
 
 	useChannel := c.GetStringSlice("use_channel")
@@ -307,6 +323,40 @@ func getChannel(c *gin.Context, info *relaycommon.RelayInfo, retryParam *service
 	return channel, nil
 }
 
+// switchVirtualModelFallback 虚拟模型当前目标无可用渠道或重试用尽时切换到下一个目标模型，
+// 按新模型重新计算价格并重置重试次数。预扣费不变，结算时按实际服务的模型计费
+func switchVirtualModelFallback(c *gin.Context, relayInfo *relaycommon.RelayInfo, retryParam *service.RetryParam, apiErr *types.NewAPIError, promptTokens int, meta *types.TokenCountMeta) (bool, *types.NewAPIError) {
+	if apiErr.GetErrorCode() != types.ErrorCodeGetChannelFailed && !shouldRetry(c, apiErr, 1) {
+		return false, nil
+	}
+	previous := relayInfo.OriginModelName
+	for {
+		// 只会切换到令牌和客户端令牌允许使用的目标模型
+		modelName, ok := service.NextVirtualModelTarget(c)
+		if !ok {
+			relayInfo.OriginModelName = previous
+			return false, nil
+		}
+		relayInfo.OriginModelName = modelName
+		priceData, err := helper.ModelPriceHelper(c, relayInfo, promptTokens, meta)
+		if err != nil {
+			logger.LogWarn(c, fmt.Sprintf("virtual model fallback to %s skipped: %s", modelName, err.Error()))
+			continue
+		}
+		// 此前的目标为免费模型时尚未预扣费
+		if relayInfo.Billing == nil && !priceData.FreeModel {
+			if preErr := service.PreConsumeBilling(c, priceData.QuotaToPreConsume, relayInfo); preErr != nil {
+				return false, preErr
+			}
+		}
+		logger.LogInfo(c, fmt.Sprintf("虚拟模型回退：%s -> %s", previous, modelName))
+		retryParam.ModelName = modelName
+		retryParam.SetRetry(0)
+		retryParam.ResetRetryNextTry()
+		return true, nil
+	}
+}
+
 func shouldRetry(c *gin.Context, openaiErr *types.NewAPIError, retryTimes int) bool {
 	if openaiErr == nil {
 		return false
@@ -326,6 +376,10 @@ func shouldRetry(c *gin.Context, openaiErr *types.NewAPIError, retryTimes int) b
 	if _, ok := c.Get("specific_channel_id"); ok {
 		return false
 	}
+	// 结构化输出校验失败，切换到下一个渠道重试
+	if openaiErr.GetErrorCode() == types.ErrorCodeStructuredOutputInvalid {
+		return true
+	}
 	code := openaiErr.StatusCode
 	if code >= 200 && code < 300 {
 		return false
@@ -0,0 +1,114 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/model_setting"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeBillingSettler 表示请求已完成预扣费
+type fakeBillingSettler struct{}
+
+func (fakeBillingSettler) Settle(int) error         { return nil }
+func (fakeBillingSettler) Refund(*gin.Context)      {}
+func (fakeBillingSettler) NeedsRefund() bool        { return false }
+func (fakeBillingSettler) GetPreConsumedQuota() int { return 0 }
+
+func setupVirtualModelFallbackTest(t *testing.T) (*gin.Context, *relaycommon.RelayInfo, *service.RetryParam) {
+	t.Helper()
+	settings := model_setting.GetVirtualModelSettings()
+	oldModels := settings.Models
+	settings.Models = map[string]model_setting.VirtualModel{
+		"vm-smart": {Targets: []model_setting.VirtualModelTarget{
+			{Model: "vm-primary"},
+			{Model: "vm-unpriced"},
+			{Model: "vm-fallback", ParamOverride: map[string]interface{}{"temperature": 0.2}},
+		}},
+	}
+	oldPrices := ratio_setting.ModelPrice2JSONString()
+	require.NoError(t, ratio_setting.UpdateModelPriceByJSONString(`{"vm-primary":0.01,"vm-fallback":0.05}`))
+	t.Cleanup(func() {
+		settings.Models = oldModels
+		_ = ratio_setting.UpdateModelPriceByJSONString(oldPrices)
+	})
+
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	require.True(t, service.SetupVirtualModel(c, "vm-smart"))
+	common.SetContextKey(c, constant.ContextKeyVirtualModelIndex, 0)
+
+	info := &relaycommon.RelayInfo{
+		OriginModelName: "vm-primary",
+		UserGroup:       "default",
+		UsingGroup:      "default",
+		Billing:         fakeBillingSettler{},
+	}
+	retryParam := &service.RetryParam{Ctx: c, TokenGroup: "default", ModelName: "vm-primary", Retry: common.GetPointer(2)}
+	return c, info, retryParam
+}
+
+func TestSwitchVirtualModelFallback(t *testing.T) {
+	c, info, retryParam := setupVirtualModelFallbackTest(t)
+	apiErr := types.NewError(errors.New("no available channel"), types.ErrorCodeGetChannelFailed)
+
+	// 跳过未定价的目标，切换到下一个并按新模型重新定价
+	switched, fallbackErr := switchVirtualModelFallback(c, info, retryParam, apiErr, 100, &types.TokenCountMeta{})
+	require.True(t, switched)
+	require.Nil(t, fallbackErr)
+	require.Equal(t, "vm-fallback", info.OriginModelName)
+	require.Equal(t, "vm-fallback", retryParam.ModelName)
+	require.True(t, info.PriceData.UsePrice)
+	require.Equal(t, 0.05, info.PriceData.ModelPrice)
+	require.Equal(t, int(0.05*common.QuotaPerUnit), info.PriceData.QuotaToPreConsume)
+	require.Equal(t, 2, common.GetContextKeyInt(c, constant.ContextKeyVirtualModelIndex))
+	require.Equal(t, map[string]interface{}{"temperature": 0.2}, common.GetContextKeyStringMap(c, constant.ContextKeyVirtualModelParamOverride))
+
+	// 重试次数在下一轮循环递增前被重置
+	require.Equal(t, 0, retryParam.GetRetry())
+	retryParam.IncreaseRetry()
+	require.Equal(t, 0, retryParam.GetRetry())
+
+	// 目标用完后不再回退
+	switched, fallbackErr = switchVirtualModelFallback(c, info, retryParam, apiErr, 100, &types.TokenCountMeta{})
+	require.False(t, switched)
+	require.Nil(t, fallbackErr)
+	require.Equal(t, "vm-fallback", info.OriginModelName)
+}
+
+func TestSwitchVirtualModelFallbackNotRetryable(t *testing.T) {
+	c, info, retryParam := setupVirtualModelFallbackTest(t)
+	apiErr := types.NewErrorWithStatusCode(errors.New("bad request"), types.ErrorCodeInvalidRequest, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+
+	switched, fallbackErr := switchVirtualModelFallback(c, info, retryParam, apiErr, 100, &types.TokenCountMeta{})
+	require.False(t, switched)
+	require.Nil(t, fallbackErr)
+	require.Equal(t, "vm-primary", info.OriginModelName)
+	require.Equal(t, 0, common.GetContextKeyInt(c, constant.ContextKeyVirtualModelIndex))
+}
+
+func TestSwitchVirtualModelFallbackTokenModelLimit(t *testing.T) {
+	c, info, retryParam := setupVirtualModelFallbackTest(t)
+	apiErr := types.NewError(errors.New("no available channel"), types.ErrorCodeGetChannelFailed)
+	// 令牌（或客户端令牌）只允许虚拟模型和首个目标
+	common.SetContextKey(c, constant.ContextKeyTokenModelLimitEnabled, true)
+	common.SetContextKey(c, constant.ContextKeyTokenModelLimit, map[string]bool{"vm-smart": true, "vm-primary": true, "vm-unpriced": true})
+
+	switched, fallbackErr := switchVirtualModelFallback(c, info, retryParam, apiErr, 100, &types.TokenCountMeta{})
+	require.False(t, switched)
+	require.Nil(t, fallbackErr)
+	require.Equal(t, "vm-primary", info.OriginModelName)
+	require.Equal(t, "vm-primary", retryParam.ModelName)
+}
@@ -0,0 +1,136 @@
+package controller
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/middleware"
+	"github.com/QuantumNous/new-api/relay"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/model_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+var errStructuredOutputNoFixer = errors.New("structured output fixer model is not configured")
+
+// finishStructuredOutput 结构化输出重试用尽后尝试交给修复模型，并按计费策略结算失败尝试。
+// 修复成功时修复后的结果已写回客户端，返回 nil。
+func finishStructuredOutput(c *gin.Context, info *relaycommon.RelayInfo) *types.NewAPIError {
+	state := info.StructuredOutput
+	fixErr := fixStructuredOutput(c, info)
+	if fixErr != nil && !errors.Is(fixErr, errStructuredOutputNoFixer) {
+		logger.LogWarn(c, "structured output fixer failed: "+fixErr.Error())
+	}
+	relay.SettleStructuredOutputFailure(c, info)
+	if fixErr != nil {
+		return service.NewStructuredOutputError(state, false)
+	}
+	// 失败尝试不计费时退还预扣费，已结算时 Refund 为空操作
+	if info.Billing != nil {
+		info.Billing.Refund(c)
+	}
+	return nil
+}
+
+// fixStructuredOutput 使用修复模型修复最后一次未通过校验的输出，修复模型的调用作为独立请求计费
+func fixStructuredOutput(c *gin.Context, info *relaycommon.RelayInfo) error {
+	state := info.StructuredOutput
+	fixerModel := model_setting.GetStructuredOutputSettings().FixerModel
+	if fixerModel == "" || len(state.LastBody) == 0 {
+		return errStructuredOutputNoFixer
+	}
+	request, err := service.BuildStructuredOutputFixRequest(fixerModel, state)
+	if err != nil {
+		return err
+	}
+	requestBody, err := common.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	recorder := httptest.NewRecorder()
+	fixCtx, _ := gin.CreateTestContext(recorder)
+	fixCtx.Request = c.Request.Clone(c.Request.Context())
+	fixCtx.Request.Body = io.NopCloser(bytes.NewReader(requestBody))
+	fixCtx.Request.ContentLength = int64(len(requestBody))
+	for key, value := range c.Keys {
+		fixCtx.Set(key, value)
+	}
+	fixCtx.Set(common.KeyRequestBody, requestBody)
+	fixCtx.Set(common.KeyBodyStorage, nil)
+	fixCtx.Set("use_channel", []string{})
+	defer common.CleanupBodyStorage(fixCtx)
+
+	channel, _, err := service.CacheGetRandomSatisfiedChannel(&service.RetryParam{
+		Ctx:        fixCtx,
+		TokenGroup: info.TokenGroup,
+		ModelName:  fixerModel,
+		Retry:      common.GetPointer(0),
+	})
+	if err != nil {
+		return err
+	}
+	if channel == nil {
+		return fmt.Errorf("no available channel for fixer model %s", fixerModel)
+	}
+	if apiErr := middleware.SetupContextForSelectedChannel(fixCtx, channel, fixerModel); apiErr != nil {
+		return apiErr
+	}
+	addUsedChannel(fixCtx, channel.Id)
+
+	fixInfo, err := relaycommon.GenRelayInfo(fixCtx, types.RelayFormatOpenAI, request, nil)
+	if err != nil {
+		return err
+	}
+	fixInfo.RequestId = info.RequestId + "-fixer"
+	meta := request.GetTokenCountMeta()
+	tokens, err := service.EstimateRequestToken(fixCtx, meta, fixInfo)
+	if err != nil {
+		return err
+	}
+	fixInfo.SetEstimatePromptTokens(tokens)
+	priceData, err := helper.ModelPriceHelper(fixCtx, fixInfo, tokens, meta)
+	if err != nil {
+		return err
+	}
+	if !priceData.FreeModel {
+		if apiErr := service.PreConsumeBilling(fixCtx, priceData.QuotaToPreConsume, fixInfo); apiErr != nil {
+			return apiErr
+		}
+	}
+	if apiErr := relay.TextHelper(fixCtx, fixInfo); apiErr != nil {
+		if fixInfo.Billing != nil {
+			fixInfo.Billing.Refund(fixCtx)
+		}
+		return apiErr
+	}
+
+	content, err := service.ValidateStructuredOutputResponse(state.Schema, recorder.Body.Bytes())
+	if err != nil {
+		return fmt.Errorf("fixer output is still invalid: %w", err)
+	}
+	if content == "" {
+		return errors.New("fixer refused to repair the output")
+	}
+	body, err := service.ReplaceStructuredOutputContent(state.LastBody, content)
+	if err != nil {
+		return err
+	}
+	state.FixerModel = fixerModel
+	status := state.LastStatus
+	if status == 0 {
+		status = http.StatusOK
+	}
+	service.IOCopyBytesGracefully(c, &http.Response{StatusCode: status, Header: state.LastHeader}, body)
+	return nil
+}
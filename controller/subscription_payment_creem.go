@@ -9,13 +9,13 @@ import (
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/model"
 	"github.com/QuantumNous/new-api/setting"
-	"github.com/QuantumNous/new-api/setting/operation_setting"
 	"github.com/gin-gonic/gin"
 	"github.com/thanhpk/randstr"
 )
 
 type SubscriptionCreemPayRequest struct {
-	PlanId int `json:"plan_id"`
+	PlanId     int    `json:"plan_id"`
+	CouponCode string `json:"coupon_code"`
 }
 
 func SubscriptionRequestCreemPay(c *gin.Context) {
@@ -79,6 +79,30 @@ func SubscriptionRequestCreemPay(c *gin.Context) {
 	reference := "sub-creem-ref-" + randstr.String(6)
 	referenceId := "sub_ref_" + common.Sha1([]byte(reference+time.Now().String()+user.Username))
 
+	couponUsage, err := reserveOrderCoupon(req.CouponCode, &model.CouponTarget{
+		UserId:  userId,
+		Group:   user.Group,
+		Scope:   model.CouponScopeSubscription,
+		PlanId:  plan.Id,
+		Money:   plan.PriceAmount,
+		TradeNo: referenceId,
+	})
+	if err != nil {
+		common.ApiErrorMsg(c, err.Error())
+		return
+	}
+	paymentOrder := &PaymentOrder{
+		TradeNo:      referenceId,
+		UserId:       userId,
+		Email:        user.Email,
+		Username:     user.Username,
+		Title:        plan.Title,
+		Money:        plan.PriceAmount,
+		ProductId:    plan.CreemProductId,
+		Subscription: true,
+	}
+	applyOrderCoupon(paymentOrder, couponUsage)
+
 	// create pending order first
 	order := &model.SubscriptionOrder{
 		UserId:        userId,
@@ -89,40 +113,25 @@ func SubscriptionRequestCreemPay(c *gin.Context) {
 		CreateTime:    time.Now().Unix(),
 		Status:        common.TopUpStatusPending,
 	}
+	applySubscriptionCoupon(order, couponUsage)
 	if err := order.Insert(); err != nil {
+		releaseOrderCoupon(couponUsage)
 		c.JSON(200, gin.H{"message": "error", "data": "创建订单失败"})
 		return
 	}
 
-	// Reuse Creem checkout generator by building a lightweight product reference.
-	currency := "USD"
-	switch operation_setting.GetGeneralSetting().QuotaDisplayType {
-	case operation_setting.QuotaDisplayTypeCNY:
-		currency = "CNY"
-	case operation_setting.QuotaDisplayTypeUSD:
-		currency = "USD"
-	default:
-		currency = "USD"
-	}
-	product := &CreemProduct{
-		ProductId: plan.CreemProductId,
-		Name:      plan.Title,
-		Price:     plan.PriceAmount,
-		Currency:  currency,
-		Quota:     0,
-	}
-
-	checkoutUrl, err := genCreemLink(referenceId, product, user.Email, user.Username)
+	checkout, err := creemAdaptor.CreateCheckout(paymentOrder)
 	if err != nil {
+		releaseOrderCoupon(couponUsage)
 		log.Printf("获取Creem支付链接失败: %v", err)
-		c.JSON(200, gin.H{"message": "error", "data": "拉起支付失败"})
+		c.JSON(200, gin.H{"message": "error", "data": paymentErrorMessage(creemAdaptor, err, "拉起支付失败")})
 		return
 	}
 
 	c.JSON(200, gin.H{
 		"message": "success",
 		"data": gin.H{
-			"checkout_url": checkoutUrl,
+			"checkout_url": checkout.PayLink,
 			"order_id":     referenceId,
 		},
 	})
@@ -0,0 +1,120 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/gin-gonic/gin"
+	"github.com/thanhpk/randstr"
+)
+
+type SubscriptionPayPalPayRequest struct {
+	PlanId     int    `json:"plan_id"`
+	CouponCode string `json:"coupon_code"`
+}
+
+func SubscriptionRequestPayPalPay(c *gin.Context) {
+	var req SubscriptionPayPalPayRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.PlanId <= 0 {
+		common.ApiErrorMsg(c, "参数错误")
+		return
+	}
+
+	plan, err := model.GetSubscriptionPlanById(req.PlanId)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if !plan.Enabled {
+		common.ApiErrorMsg(c, "套餐未启用")
+		return
+	}
+	if plan.PriceAmount < 0.01 {
+		common.ApiErrorMsg(c, "套餐金额过低")
+		return
+	}
+	if !paypalAdaptor.Enabled() {
+		common.ApiErrorMsg(c, "PayPal 未配置")
+		return
+	}
+
+	userId := c.GetInt("id")
+	user, err := model.GetUserById(userId, false)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if user == nil {
+		common.ApiErrorMsg(c, "用户不存在")
+		return
+	}
+
+	if plan.MaxPurchasePerUser > 0 {
+		count, err := model.CountUserSubscriptionsByPlan(userId, plan.Id)
+		if err != nil {
+			common.ApiError(c, err)
+			return
+		}
+		if count >= int64(plan.MaxPurchasePerUser) {
+			common.ApiErrorMsg(c, "已达到该套餐购买上限")
+			return
+		}
+	}
+
+	reference := fmt.Sprintf("sub-paypal-ref-%d-%d-%s", user.Id, time.Now().UnixMilli(), randstr.String(4))
+	referenceId := "sub_ref_" + common.Sha1([]byte(reference))
+
+	couponUsage, err := reserveOrderCoupon(req.CouponCode, &model.CouponTarget{
+		UserId:  userId,
+		Group:   user.Group,
+		Scope:   model.CouponScopeSubscription,
+		PlanId:  plan.Id,
+		Money:   plan.PriceAmount,
+		TradeNo: referenceId,
+	})
+	if err != nil {
+		common.ApiErrorMsg(c, err.Error())
+		return
+	}
+	paymentOrder := &PaymentOrder{
+		TradeNo:      referenceId,
+		UserId:       userId,
+		Email:        user.Email,
+		Title:        plan.Title,
+		Money:        plan.PriceAmount,
+		Subscription: true,
+	}
+	applyOrderCoupon(paymentOrder, couponUsage)
+	checkout, err := paypalAdaptor.CreateCheckout(paymentOrder)
+	if err != nil {
+		releaseOrderCoupon(couponUsage)
+		c.JSON(http.StatusOK, gin.H{"message": "error", "data": paymentErrorMessage(paypalAdaptor, err, "拉起支付失败")})
+		return
+	}
+
+	order := &model.SubscriptionOrder{
+		UserId:        userId,
+		PlanId:        plan.Id,
+		Money:         plan.PriceAmount,
+		TradeNo:       referenceId,
+		PaymentMethod: PaymentMethodPayPal,
+		CreateTime:    time.Now().Unix(),
+		Status:        common.TopUpStatusPending,
+	}
+	applySubscriptionCoupon(order, couponUsage)
+	if err := order.Insert(); err != nil {
+		releaseOrderCoupon(couponUsage)
+		c.JSON(http.StatusOK, gin.H{"message": "error", "data": "创建订单失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "success",
+		"data": gin.H{
+			"pay_link": checkout.PayLink,
+		},
+	})
+}
@@ -18,7 +18,8 @@ import (
 )
 
 type SubscriptionStripePayRequest struct {
-	PlanId int `json:"plan_id"`
+	PlanId     int    `json:"plan_id"`
+	CouponCode string `json:"coupon_code"`
 }
 
 func SubscriptionRequestStripePay(c *gin.Context) {
@@ -76,8 +77,32 @@ func SubscriptionRequestStripePay(c *gin.Context) {
 	reference := fmt.Sprintf("sub-stripe-ref-%d-%d-%s", user.Id, time.Now().UnixMilli(), randstr.String(4))
 	referenceId := "sub_ref_" + common.Sha1([]byte(reference))
 
-	payLink, err := genStripeSubscriptionLink(referenceId, user.StripeCustomer, user.Email, plan.StripePriceId)
+	couponUsage, err := reserveOrderCoupon(req.CouponCode, &model.CouponTarget{
+		UserId:  userId,
+		Group:   user.Group,
+		Scope:   model.CouponScopeSubscription,
+		PlanId:  plan.Id,
+		Money:   plan.PriceAmount,
+		TradeNo: referenceId,
+	})
+	if err != nil {
+		common.ApiErrorMsg(c, err.Error())
+		return
+	}
+	paymentOrder := &PaymentOrder{
+		TradeNo:      referenceId,
+		UserId:       userId,
+		Email:        user.Email,
+		CustomerId:   user.StripeCustomer,
+		Title:        plan.Title,
+		Money:        plan.PriceAmount,
+		ProductId:    plan.StripePriceId,
+		Subscription: true,
+	}
+	applyOrderCoupon(paymentOrder, couponUsage)
+	checkout, err := stripeAdaptor.CreateCheckout(paymentOrder)
 	if err != nil {
+		releaseOrderCoupon(couponUsage)
 		log.Println("获取Stripe Checkout支付链接失败", err)
 		c.JSON(http.StatusOK, gin.H{"message": "error", "data": "拉起支付失败"})
 		return
@@ -92,7 +117,9 @@ func SubscriptionRequestStripePay(c *gin.Context) {
 		CreateTime:    time.Now().Unix(),
 		Status:        common.TopUpStatusPending,
 	}
+	applySubscriptionCoupon(order, couponUsage)
 	if err := order.Insert(); err != nil {
+		releaseOrderCoupon(couponUsage)
 		c.JSON(http.StatusOK, gin.H{"message": "error", "data": "创建订单失败"})
 		return
 	}
@@ -100,12 +127,12 @@ func SubscriptionRequestStripePay(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"message": "success",
 		"data": gin.H{
-			"pay_link": payLink,
+			"pay_link": checkout.PayLink,
 		},
 	})
 }
 
-func genStripeSubscriptionLink(referenceId string, customerId string, email string, priceId string) (string, error) {
+func genStripeSubscriptionLink(referenceId string, customerId string, email string, priceId string, couponId string) (string, error) {
 	stripe.Key = setting.StripeApiSecret
 
 	params := &stripe.CheckoutSessionParams{
@@ -120,6 +147,9 @@ func genStripeSubscriptionLink(referenceId string, customerId string, email stri
 		},
 		Mode: stripe.String(string(stripe.CheckoutSessionModeSubscription)),
 	}
+	if couponId != "" {
+		params.Discounts = []*stripe.CheckoutSessionDiscountParams{{Coupon: stripe.String(couponId)}}
+	}
 
 	if "" == customerId {
 		if "" != email {
@@ -15,7 +15,10 @@ import (
 	"github.com/QuantumNous/new-api/relay"
 	"github.com/QuantumNous/new-api/relay/channel"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/service"
 	"github.com/QuantumNous/new-api/setting/ratio_setting"
+
+	"github.com/shopspring/decimal"
 )
 
 func UpdateVideoTaskAll(ctx context.Context, platform constant.TaskPlatform, taskChannelM map[int][]string, taskM map[string]*model.Task) error {
@@ -149,6 +152,11 @@ func updateVideoSingleTask(ctx context.Context, adaptor channel.TaskAdaptor, cha
 			task.FailReason = taskResult.Url
 		}
 
+		// 按秒计费的任务按上游返回的实际时长结算
+		if preStatus != model.TaskStatusSuccess && task.Properties.BilledSeconds > 0 && taskResult.Seconds > 0 {
+			settleTaskBySeconds(ctx, task, taskResult.Seconds)
+		}
+
 		// 如果返回了 total_tokens 并且配置了模型倍率(非固定价格),则重新计费
 		if taskResult.TotalTokens > 0 {
 			// 获取模型名称
@@ -311,3 +319,38 @@ func truncateBase64(s string) string {
 	}
 	return s[:maxKeep] + "..."
 }
+
+// settleTaskBySeconds 按实际时长与预扣时长的比例补扣或退还额度
+func settleTaskBySeconds(ctx context.Context, task *model.Task, seconds float64) {
+	billedSeconds := task.Properties.BilledSeconds
+	preConsumedQuota := task.Quota
+	actualQuota := int(decimal.NewFromInt(int64(preConsumedQuota)).
+		Mul(decimal.NewFromFloat(seconds)).Div(decimal.NewFromFloat(billedSeconds)).Round(0).IntPart())
+	quotaDelta := actualQuota - preConsumedQuota
+	if quotaDelta == 0 {
+		return
+	}
+	// 按提交时的扣费来源（钱包、订阅或组织钱包）及令牌结算
+	funding := task.PrivateData
+	info := &relaycommon.RelayInfo{
+		UserId:         task.UserId,
+		TokenId:        funding.TokenId,
+		OrgId:          funding.OrgId,
+		ClientTokenId:  funding.ClientTokenId,
+		BillingSource:  funding.BillingSource,
+		SubscriptionId: funding.SubscriptionId,
+	}
+	if err := service.PostConsumeQuota(info, quotaDelta, 0, false); err != nil {
+		logger.LogError(ctx, fmt.Sprintf("视频任务 %s 按时长结算失败: %s", task.TaskID, err.Error()))
+		return
+	}
+	if quotaDelta > 0 {
+		model.UpdateUserUsedQuotaAndRequestCount(task.UserId, quotaDelta)
+	}
+	model.UpdateChannelUsedQuota(task.ChannelId, quotaDelta)
+	task.Quota = actualQuota
+	task.Properties.BilledSeconds = seconds
+	logContent := fmt.Sprintf("视频任务 %s 按实际时长结算，预扣时长 %g 秒，实际时长 %g 秒，预扣费 %s，实际扣费 %s",
+		task.TaskID, billedSeconds, seconds, logger.LogQuota(preConsumedQuota), logger.LogQuota(actualQuota))
+	model.RecordLog(task.UserId, model.LogTypeSystem, logContent)
+}
@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/i18n"
@@ -23,6 +24,9 @@ func GetAllTokens(c *gin.Context) {
 		return
 	}
 	total, _ := model.CountUserTokens(userId)
+	for _, token := range tokens {
+		token.MaskKey()
+	}
 	pageInfo.SetTotal(int(total))
 	pageInfo.SetItems(tokens)
 	common.ApiSuccess(c, pageInfo)
@@ -41,6 +45,9 @@ func SearchTokens(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	for _, t := range tokens {
+		t.MaskKey()
+	}
 	pageInfo.SetTotal(int(total))
 	pageInfo.SetItems(tokens)
 	common.ApiSuccess(c, pageInfo)
@@ -59,6 +66,7 @@ func GetToken(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	token.MaskKey()
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -133,10 +141,42 @@ func GetTokenUsage(c *gin.Context) {
 			"model_limits":         token.GetModelLimitsMap(),
 			"model_limits_enabled": token.ModelLimitsEnabled,
 			"expires_at":           expiredAt,
+			"budget":               tokenBudgetUsage(token),
+			"scopes":               token.Scopes,
+			"max_tokens":           token.MaxTokens,
 		},
 	})
 }
 
+// tokenBudgetUsage 返回令牌当前周期预算的使用情况，未启用时返回 nil
+func tokenBudgetUsage(token *model.Token) gin.H {
+	if !token.HasBudget() {
+		return nil
+	}
+	// 窗口已过期但尚未有请求触发重置时，按新窗口展示
+	used := token.BudgetUsed
+	resetAt := token.BudgetResetAt()
+	if token.BudgetResetTime != 0 && resetAt <= common.GetTimestamp() {
+		used = 0
+		resetAt = model.TokenBudgetWindowEnd(token.BudgetPeriod, model.TokenBudgetWindowStart(token.BudgetPeriod, time.Now())).Unix()
+	}
+	if used < 0 {
+		used = 0
+	}
+	remain := -1
+	if token.BudgetLimit > 0 {
+		remain = max(token.BudgetLimit-used, 0)
+	}
+	return gin.H{
+		"period":     token.BudgetPeriod,
+		"limit":      token.BudgetLimit,
+		"soft_limit": token.BudgetSoftLimit,
+		"used":       used,
+		"remaining":  remain,
+		"resets_at":  resetAt,
+	}
+}
+
 func AddToken(c *gin.Context) {
 	token := model.Token{}
 	err := c.ShouldBindJSON(&token)
@@ -160,6 +200,22 @@ func AddToken(c *gin.Context) {
 			return
 		}
 	}
+	if msg := validateTokenBudget(&token); msg != "" {
+		common.ApiErrorMsg(c, msg)
+		return
+	}
+	if msg := validateTokenScopes(&token); msg != "" {
+		common.ApiErrorMsg(c, msg)
+		return
+	}
+	// 组织令牌需要创建者是可使用令牌的组织成员
+	if token.OrgId != 0 {
+		member, err := model.GetOrganizationMember(token.OrgId, c.GetInt("id"))
+		if err != nil || !member.CanUseTokens() {
+			common.ApiErrorMsg(c, "无权创建该组织的令牌")
+			return
+		}
+	}
 	// 检查用户令牌数量是否已达上限
 	maxTokens := operation_setting.GetMaxUserTokens()
 	count, err := model.CountUserTokens(c.GetInt("id"))
@@ -194,15 +250,26 @@ func AddToken(c *gin.Context) {
 		AllowIps:           token.AllowIps,
 		Group:              token.Group,
 		CrossGroupRetry:    token.CrossGroupRetry,
+		OrgId:              token.OrgId,
+		BudgetPeriod:       token.BudgetPeriod,
+		BudgetLimit:        token.BudgetLimit,
+		BudgetSoftLimit:    token.BudgetSoftLimit,
+		Scopes:             token.Scopes,
+		MaxTokens:          token.MaxTokens,
 	}
 	err = cleanToken.Insert()
 	if err != nil {
 		common.ApiError(c, err)
 		return
 	}
+	// 令牌 key 仅以哈希保存，明文只在创建时返回一次
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
+		"data": gin.H{
+			"id":  cleanToken.Id,
+			"key": key,
+		},
 	})
 	return
 }
@@ -246,6 +313,16 @@ func UpdateToken(c *gin.Context) {
 			return
 		}
 	}
+	if statusOnly == "" {
+		if msg := validateTokenBudget(&token); msg != "" {
+			common.ApiErrorMsg(c, msg)
+			return
+		}
+		if msg := validateTokenScopes(&token); msg != "" {
+			common.ApiErrorMsg(c, msg)
+			return
+		}
+	}
 	cleanToken, err := model.GetTokenByIds(token.Id, userId)
 	if err != nil {
 		common.ApiError(c, err)
@@ -274,12 +351,22 @@ func UpdateToken(c *gin.Context) {
 		cleanToken.AllowIps = token.AllowIps
 		cleanToken.Group = token.Group
 		cleanToken.CrossGroupRetry = token.CrossGroupRetry
+		if cleanToken.BudgetPeriod != token.BudgetPeriod {
+			// 预算周期变更后从新窗口重新计算
+			cleanToken.BudgetResetTime = 0
+		}
+		cleanToken.BudgetPeriod = token.BudgetPeriod
+		cleanToken.BudgetLimit = token.BudgetLimit
+		cleanToken.BudgetSoftLimit = token.BudgetSoftLimit
+		cleanToken.Scopes = token.Scopes
+		cleanToken.MaxTokens = token.MaxTokens
 	}
 	err = cleanToken.Update()
 	if err != nil {
 		common.ApiError(c, err)
 		return
 	}
+	cleanToken.MaskKey()
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -287,6 +374,33 @@ func UpdateToken(c *gin.Context) {
 	})
 }
 
+// validateTokenBudget 校验周期预算参数，返回错误信息
+func validateTokenBudget(token *model.Token) string {
+	if !model.IsValidTokenBudgetPeriod(token.BudgetPeriod) {
+		return "无效的预算周期"
+	}
+	if token.BudgetLimit < 0 || token.BudgetSoftLimit < 0 {
+		return "预算额度不能为负数"
+	}
+	if token.BudgetLimit > 0 && token.BudgetSoftLimit > token.BudgetLimit {
+		return "预警额度不能超过预算上限"
+	}
+	return ""
+}
+
+// validateTokenScopes 校验并规范化令牌权限范围，返回错误信息
+func validateTokenScopes(token *model.Token) string {
+	scopes, unknown := model.NormalizeTokenScopes(token.Scopes)
+	if len(unknown) > 0 {
+		return fmt.Sprintf("未知的令牌权限: %s", strings.Join(unknown, ","))
+	}
+	token.Scopes = scopes
+	if token.MaxTokens < 0 {
+		return "max_tokens 上限不能为负数"
+	}
+	return ""
+}
+
 type TokenBatch struct {
 	Ids []int `json:"ids"`
 }
@@ -1,6 +1,7 @@
 package controller
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"net/url"
@@ -9,7 +10,6 @@ import (
 	"time"
 
 	"github.com/QuantumNous/new-api/common"
-	"github.com/QuantumNous/new-api/logger"
 	"github.com/QuantumNous/new-api/model"
 	"github.com/QuantumNous/new-api/service"
 	"github.com/QuantumNous/new-api/setting"
@@ -48,6 +48,25 @@ func GetTopUpInfo(c *gin.Context) {
 		}
 	}
 
+	enablePayPal := paypalAdaptor.Enabled()
+	if enablePayPal {
+		hasPayPal := false
+		for _, method := range payMethods {
+			if method["type"] == PaymentMethodPayPal {
+				hasPayPal = true
+				break
+			}
+		}
+		if !hasPayPal {
+			payMethods = append(payMethods, map[string]string{
+				"name":      "PayPal",
+				"type":      PaymentMethodPayPal,
+				"color":     "rgba(var(--semi-blue-5), 1)",
+				"min_topup": strconv.Itoa(setting.PayPalMinTopUp),
+			})
+		}
+	}
+
 	data := gin.H{
 		"enable_online_topup": operation_setting.PayAddress != "" && operation_setting.EpayId != "" && operation_setting.EpayKey != "",
 		"enable_stripe_topup": setting.StripeApiSecret != "" && setting.StripeWebhookSecret != "" && setting.StripePriceId != "",
@@ -56,6 +75,8 @@ func GetTopUpInfo(c *gin.Context) {
 		"pay_methods":         payMethods,
 		"min_topup":           operation_setting.MinTopUp,
 		"stripe_min_topup":    setting.StripeMinTopUp,
+		"enable_paypal_topup": enablePayPal,
+		"paypal_min_topup":    setting.PayPalMinTopUp,
 		"amount_options":      operation_setting.GetPaymentSetting().AmountOptions,
 		"discount":            operation_setting.GetPaymentSetting().AmountDiscount,
 	}
@@ -65,6 +86,7 @@ func GetTopUpInfo(c *gin.Context) {
 type EpayRequest struct {
 	Amount        int64  `json:"amount"`
 	PaymentMethod string `json:"payment_method"`
+	CouponCode    string `json:"coupon_code"`
 }
 
 type AmountRequest struct {
@@ -154,27 +176,31 @@ func RequestEpay(c *gin.Context) {
 		return
 	}
 
-	callBackAddress := service.GetCallbackAddress()
-	returnUrl, _ := url.Parse(system_setting.ServerAddress + "/console/log")
-	notifyUrl, _ := url.Parse(callBackAddress + "/api/user/epay/notify")
 	tradeNo := fmt.Sprintf("%s%d", common.GetRandomString(6), time.Now().Unix())
 	tradeNo = fmt.Sprintf("USR%dNO%s", id, tradeNo)
-	client := GetEpayClient()
-	if client == nil {
-		c.JSON(200, gin.H{"message": "error", "data": "当前管理员未配置支付信息"})
+	couponUsage, err := reserveOrderCoupon(req.CouponCode, &model.CouponTarget{
+		UserId:  id,
+		Group:   group,
+		Scope:   model.CouponScopeTopUp,
+		Money:   payMoney,
+		TradeNo: tradeNo,
+	})
+	if err != nil {
+		c.JSON(200, gin.H{"message": "error", "data": err.Error()})
 		return
 	}
-	uri, params, err := client.Purchase(&epay.PurchaseArgs{
-		Type:           req.PaymentMethod,
-		ServiceTradeNo: tradeNo,
-		Name:           fmt.Sprintf("TUC%d", req.Amount),
-		Money:          strconv.FormatFloat(payMoney, 'f', 2, 64),
-		Device:         epay.PC,
-		NotifyUrl:      notifyUrl,
-		ReturnUrl:      returnUrl,
-	})
+	order := &PaymentOrder{
+		TradeNo: tradeNo,
+		UserId:  id,
+		Title:   fmt.Sprintf("TUC%d", req.Amount),
+		Money:   payMoney,
+		Method:  req.PaymentMethod,
+	}
+	applyOrderCoupon(order, couponUsage)
+	checkout, err := epayAdaptor.CreateCheckout(order)
 	if err != nil {
-		c.JSON(200, gin.H{"message": "error", "data": "拉起支付失败"})
+		releaseOrderCoupon(couponUsage)
+		c.JSON(200, gin.H{"message": "error", "data": paymentErrorMessage(epayAdaptor, err, "拉起支付失败")})
 		return
 	}
 	amount := req.Amount
@@ -186,18 +212,20 @@ func RequestEpay(c *gin.Context) {
 	topUp := &model.TopUp{
 		UserId:        id,
 		Amount:        amount,
-		Money:         payMoney,
+		Money:         order.Money,
 		TradeNo:       tradeNo,
 		PaymentMethod: req.PaymentMethod,
 		CreateTime:    time.Now().Unix(),
 		Status:        "pending",
 	}
+	applyTopUpCoupon(topUp, couponUsage)
 	err = topUp.Insert()
 	if err != nil {
+		releaseOrderCoupon(couponUsage)
 		c.JSON(200, gin.H{"message": "error", "data": "创建订单失败"})
 		return
 	}
-	c.JSON(200, gin.H{"message": "success", "data": params, "url": uri})
+	c.JSON(200, gin.H{"message": "success", "data": checkout.Params, "url": checkout.PayLink})
 }
 
 // tradeNo lock
@@ -227,15 +255,59 @@ func UnlockOrder(tradeNo string) {
 	}
 }
 
-func EpayNotify(c *gin.Context) {
-	var params map[string]string
+const PaymentMethodEpay = "epay"
+
+var epayAdaptor = &EpayAdaptor{}
+
+// EpayAdaptor 易支付渠道，订单的 payment_method 记录具体支付方式（如 alipay / wxpay）
+type EpayAdaptor struct {
+}
+
+func (*EpayAdaptor) Name() string {
+	return PaymentMethodEpay
+}
+
+func (*EpayAdaptor) Enabled() bool {
+	return GetEpayClient() != nil
+}
+
+func (*EpayAdaptor) CreateCheckout(order *PaymentOrder) (*PaymentCheckout, error) {
+	client := GetEpayClient()
+	if client == nil {
+		return nil, newPaymentError("当前管理员未配置支付信息")
+	}
+	callBackAddress := service.GetCallbackAddress()
+	returnUrl, _ := url.Parse(system_setting.ServerAddress + "/console/log")
+	notifyUrl, err := url.Parse(callBackAddress + "/api/user/epay/notify")
+	if order.Subscription {
+		returnUrl, _ = url.Parse(callBackAddress + "/api/subscription/epay/return")
+		notifyUrl, err = url.Parse(callBackAddress + "/api/subscription/epay/notify")
+	}
+	if err != nil || returnUrl == nil {
+		return nil, newPaymentError("回调地址配置错误")
+	}
+	uri, params, err := client.Purchase(&epay.PurchaseArgs{
+		Type:           order.Method,
+		ServiceTradeNo: order.TradeNo,
+		Name:           order.Title,
+		Money:          strconv.FormatFloat(order.Money, 'f', 2, 64),
+		Device:         epay.PC,
+		NotifyUrl:      notifyUrl,
+		ReturnUrl:      returnUrl,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &PaymentCheckout{PayLink: uri, Params: params}, nil
+}
 
+// parseEpayParams 易支付回调参数可能通过 POST body 或 URL Query 传递
+func parseEpayParams(c *gin.Context) (map[string]string, error) {
+	var params map[string]string
 	if c.Request.Method == "POST" {
 		// POST 请求：从 POST body 解析参数
 		if err := c.Request.ParseForm(); err != nil {
-			log.Println("易支付回调POST解析失败:", err)
-			_, _ = c.Writer.Write([]byte("fail"))
-			return
+			return nil, err
 		}
 		params = lo.Reduce(lo.Keys(c.Request.PostForm), func(r map[string]string, t string, i int) map[string]string {
 			r[t] = c.Request.PostForm.Get(t)
@@ -248,68 +320,60 @@ func EpayNotify(c *gin.Context) {
 			return r
 		}, map[string]string{})
 	}
-
 	if len(params) == 0 {
-		log.Println("易支付回调参数为空")
-		_, _ = c.Writer.Write([]byte("fail"))
-		return
+		return nil, errors.New("易支付回调参数为空")
+	}
+	return params, nil
+}
+
+func (*EpayAdaptor) VerifyWebhook(c *gin.Context) (*PaymentNotification, error) {
+	params, err := parseEpayParams(c)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidPaymentWebhook, err)
 	}
 	client := GetEpayClient()
 	if client == nil {
-		log.Println("易支付回调失败 未找到配置信息")
-		_, err := c.Writer.Write([]byte("fail"))
-		if err != nil {
-			log.Println("易支付回调写入失败")
-		}
-		return
+		return nil, errors.New("易支付回调失败 未找到配置信息")
 	}
 	verifyInfo, err := client.Verify(params)
-	if err == nil && verifyInfo.VerifyStatus {
-		_, err := c.Writer.Write([]byte("success"))
-		if err != nil {
-			log.Println("易支付回调写入失败")
-		}
-	} else {
-		_, err := c.Writer.Write([]byte("fail"))
-		if err != nil {
-			log.Println("易支付回调写入失败")
-		}
-		log.Println("易支付回调签名验证失败")
-		return
+	if err != nil || !verifyInfo.VerifyStatus {
+		return nil, fmt.Errorf("%w: 易支付回调签名验证失败", errInvalidPaymentWebhook)
 	}
-
-	if verifyInfo.TradeStatus == epay.StatusTradeSuccess {
-		log.Println(verifyInfo)
-		LockOrder(verifyInfo.ServiceTradeNo)
-		defer UnlockOrder(verifyInfo.ServiceTradeNo)
-		topUp := model.GetTopUpByTradeNo(verifyInfo.ServiceTradeNo)
-		if topUp == nil {
-			log.Printf("易支付回调未找到订单: %v", verifyInfo)
-			return
-		}
-		if topUp.Status == "pending" {
-			topUp.Status = "success"
-			err := topUp.Update()
-			if err != nil {
-				log.Printf("易支付回调更新订单失败: %v", topUp)
-				return
-			}
-			//user, _ := model.GetUserById(topUp.UserId, false)
-			//user.Quota += topUp.Amount * 500000
-			dAmount := decimal.NewFromInt(int64(topUp.Amount))
-			dQuotaPerUnit := decimal.NewFromFloat(common.QuotaPerUnit)
-			quotaToAdd := int(dAmount.Mul(dQuotaPerUnit).IntPart())
-			err = model.IncreaseUserQuota(topUp.UserId, quotaToAdd, true)
-			if err != nil {
-				log.Printf("易支付回调更新用户失败: %v", topUp)
-				return
-			}
-			log.Printf("易支付回调更新用户成功 %v", topUp)
-			model.RecordLog(topUp.UserId, model.LogTypeTopup, fmt.Sprintf("使用在线充值成功，充值金额: %v，支付金额：%f", logger.LogQuota(quotaToAdd), topUp.Money))
-		}
-	} else {
+	n := &PaymentNotification{
+		EventType: verifyInfo.TradeStatus,
+		TradeNo:   verifyInfo.ServiceTradeNo,
+	}
+	if verifyInfo.TradeStatus != epay.StatusTradeSuccess {
 		log.Printf("易支付异常回调: %v", verifyInfo)
+		return n, nil
 	}
+	n.Action = PaymentActionComplete
+	n.ProviderPaymentId = verifyInfo.TradeNo
+	n.Payload = common.GetJsonString(verifyInfo)
+	return n, nil
+}
+
+func (*EpayAdaptor) CompleteTopUp(n *PaymentNotification) error {
+	return model.CompleteTopUp(n.TradeNo, n.ProviderPaymentId)
+}
+
+func (*EpayAdaptor) Refund(topUp *model.TopUp, money float64) error {
+	return newPaymentError("易支付暂不支持通过接口退款，请在支付平台后台操作")
+}
+
+// Acknowledge 易支付要求回复纯文本 success，否则会重复通知
+func (*EpayAdaptor) Acknowledge(c *gin.Context, err error) {
+	result := "success"
+	if err != nil {
+		result = "fail"
+	}
+	if _, err := c.Writer.Write([]byte(result)); err != nil {
+		log.Println("易支付回调写入失败")
+	}
+}
+
+func EpayNotify(c *gin.Context) {
+	handlePaymentWebhook(c, epayAdaptor)
 }
 
 func RequestAmount(c *gin.Context) {
@@ -404,7 +468,12 @@ func AdminCompleteTopUp(c *gin.Context) {
 	LockOrder(req.TradeNo)
 	defer UnlockOrder(req.TradeNo)
 
-	if err := model.ManualCompleteTopUp(req.TradeNo); err != nil {
+	// 账单还款订单补单时同时结清账单
+	err := model.CompleteInvoicePayment(req.TradeNo, "")
+	if errors.Is(err, model.ErrInvoicePaymentNotFound) {
+		err = model.ManualCompleteTopUp(req.TradeNo)
+	}
+	if err != nil {
 		common.ApiError(c, err)
 		return
 	}
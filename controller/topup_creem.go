@@ -52,6 +52,7 @@ func verifyCreemSignature(payload string, signature string, secret string) bool
 type CreemPayRequest struct {
 	ProductId     string `json:"product_id"`
 	PaymentMethod string `json:"payment_method"`
+	CouponCode    string `json:"coupon_code"`
 }
 
 type CreemProduct struct {
@@ -76,26 +77,9 @@ func (*CreemAdaptor) RequestPay(c *gin.Context, req *CreemPayRequest) {
 		return
 	}
 
-	// 解析产品列表
-	var products []CreemProduct
-	err := json.Unmarshal([]byte(setting.CreemProducts), &products)
+	selectedProduct, err := findCreemProduct(req.ProductId)
 	if err != nil {
-		log.Println("解析Creem产品列表失败", err)
-		c.JSON(200, gin.H{"message": "error", "data": "产品配置错误"})
-		return
-	}
-
-	// 查找对应的产品
-	var selectedProduct *CreemProduct
-	for _, product := range products {
-		if product.ProductId == req.ProductId {
-			selectedProduct = &product
-			break
-		}
-	}
-
-	if selectedProduct == nil {
-		c.JSON(200, gin.H{"message": "error", "data": "产品不存在"})
+		c.JSON(200, gin.H{"message": "error", "data": err.Error()})
 		return
 	}
 
@@ -106,27 +90,54 @@ func (*CreemAdaptor) RequestPay(c *gin.Context, req *CreemPayRequest) {
 	reference := fmt.Sprintf("creem-api-ref-%d-%d-%s", user.Id, time.Now().UnixMilli(), randstr.String(4))
 	referenceId := "ref_" + common.Sha1([]byte(reference))
 
+	couponUsage, err := reserveOrderCoupon(req.CouponCode, &model.CouponTarget{
+		UserId:  id,
+		Group:   user.Group,
+		Scope:   model.CouponScopeTopUp,
+		Money:   selectedProduct.Price,
+		TradeNo: referenceId,
+	})
+	if err != nil {
+		c.JSON(200, gin.H{"message": "error", "data": err.Error()})
+		return
+	}
+	order := &PaymentOrder{
+		TradeNo:   referenceId,
+		UserId:    id,
+		Email:     user.Email,
+		Username:  user.Username,
+		Title:     selectedProduct.Name,
+		Money:     selectedProduct.Price,
+		Quantity:  selectedProduct.Quota,
+		ProductId: selectedProduct.ProductId,
+	}
+	applyOrderCoupon(order, couponUsage)
+
 	// 先创建订单记录，使用产品配置的金额和充值额度
 	topUp := &model.TopUp{
-		UserId:     id,
-		Amount:     selectedProduct.Quota, // 充值额度
-		Money:      selectedProduct.Price, // 支付金额
-		TradeNo:    referenceId,
-		CreateTime: time.Now().Unix(),
-		Status:     common.TopUpStatusPending,
-	}
+		UserId:        id,
+		Amount:        selectedProduct.Quota, // 充值额度
+		Money:         selectedProduct.Price, // 支付金额
+		TradeNo:       referenceId,
+		PaymentMethod: PaymentMethodCreem,
+		CreateTime:    time.Now().Unix(),
+		Status:        common.TopUpStatusPending,
+	}
+	applyTopUpCoupon(topUp, couponUsage)
 	err = topUp.Insert()
 	if err != nil {
+		releaseOrderCoupon(couponUsage)
 		log.Printf("创建Creem订单失败: %v", err)
 		c.JSON(200, gin.H{"message": "error", "data": "创建订单失败"})
 		return
 	}
 
 	// 创建支付链接，传入用户邮箱
-	checkoutUrl, err := genCreemLink(referenceId, selectedProduct, user.Email, user.Username)
+	checkout, err := creemAdaptor.CreateCheckout(order)
 	if err != nil {
+		releaseOrderCoupon(couponUsage)
 		log.Printf("获取Creem支付链接失败: %v", err)
-		c.JSON(200, gin.H{"message": "error", "data": "拉起支付失败"})
+		c.JSON(200, gin.H{"message": "error", "data": paymentErrorMessage(creemAdaptor, err, "拉起支付失败")})
 		return
 	}
 
@@ -136,12 +147,27 @@ func (*CreemAdaptor) RequestPay(c *gin.Context, req *CreemPayRequest) {
 	c.JSON(200, gin.H{
 		"message": "success",
 		"data": gin.H{
-			"checkout_url": checkoutUrl,
+			"checkout_url": checkout.PayLink,
 			"order_id":     referenceId,
 		},
 	})
 }
 
+// findCreemProduct 在后台配置的 Creem 产品列表中查找产品
+func findCreemProduct(productId string) (*CreemProduct, error) {
+	var products []CreemProduct
+	if err := json.Unmarshal([]byte(setting.CreemProducts), &products); err != nil {
+		log.Println("解析Creem产品列表失败", err)
+		return nil, errors.New("产品配置错误")
+	}
+	for i := range products {
+		if products[i].ProductId == productId {
+			return &products[i], nil
+		}
+	}
+	return nil, errors.New("产品不存在")
+}
+
 func RequestCreemPay(c *gin.Context) {
 	var req CreemPayRequest
 
@@ -229,12 +255,39 @@ type CreemWebhookEvent struct {
 }
 
 func CreemWebhook(c *gin.Context) {
-	// 读取body内容用于打印，同时保留原始数据供后续使用
+	handlePaymentWebhook(c, creemAdaptor)
+}
+
+func (*CreemAdaptor) Name() string {
+	return PaymentMethodCreem
+}
+
+func (*CreemAdaptor) Enabled() bool {
+	return setting.CreemApiKey != "" && (setting.CreemWebhookSecret != "" || setting.CreemTestMode)
+}
+
+func (*CreemAdaptor) CreateCheckout(order *PaymentOrder) (*PaymentCheckout, error) {
+	// Creem 按产品配置的价格收款，无法在下单时改价
+	if order.Discount > 0 {
+		return nil, newPaymentError("Creem 支付不支持折扣类优惠券")
+	}
+	product := &CreemProduct{
+		ProductId: order.ProductId,
+		Name:      order.Title,
+		Price:     order.Money,
+		Quota:     order.Quantity,
+	}
+	checkoutUrl, err := genCreemLink(order.TradeNo, product, order.Email, order.Username)
+	if err != nil {
+		return nil, err
+	}
+	return &PaymentCheckout{PayLink: checkoutUrl}, nil
+}
+
+func (*CreemAdaptor) VerifyWebhook(c *gin.Context) (*PaymentNotification, error) {
 	bodyBytes, err := io.ReadAll(c.Request.Body)
 	if err != nil {
-		log.Printf("读取Creem Webhook请求body失败: %v", err)
-		c.AbortWithStatus(http.StatusBadRequest)
-		return
+		return nil, fmt.Errorf("%w: %v", errInvalidPaymentWebhook, err)
 	}
 
 	// 获取签名头
@@ -245,123 +298,94 @@ func CreemWebhook(c *gin.Context) {
 	if setting.CreemTestMode {
 		log.Printf("Creem Webhook - Signature: %s , Body: %s", signature, bodyBytes)
 	} else if signature == "" {
-		log.Printf("Creem Webhook缺少签名头")
-		c.AbortWithStatus(http.StatusUnauthorized)
-		return
+		return nil, fmt.Errorf("%w: Creem Webhook缺少签名头", errInvalidPaymentWebhook)
 	}
 
 	// 验证签名
 	if !verifyCreemSignature(string(bodyBytes), signature, setting.CreemWebhookSecret) {
-		log.Printf("Creem Webhook签名验证失败")
-		c.AbortWithStatus(http.StatusUnauthorized)
-		return
+		return nil, fmt.Errorf("%w: Creem Webhook签名验证失败", errInvalidPaymentWebhook)
 	}
 
-	log.Printf("Creem Webhook签名验证成功")
-
-	// 重新设置body供后续的ShouldBindJSON使用
-	c.Request.Body = io.NopCloser(bytes.NewReader(bodyBytes))
-
 	// 解析新格式的webhook数据
 	var webhookEvent CreemWebhookEvent
-	if err := c.ShouldBindJSON(&webhookEvent); err != nil {
-		log.Printf("解析Creem Webhook参数失败: %v", err)
-		c.AbortWithStatus(http.StatusBadRequest)
-		return
+	if err := json.Unmarshal(bodyBytes, &webhookEvent); err != nil {
+		return nil, fmt.Errorf("%w: 解析Creem Webhook参数失败: %v", errInvalidPaymentWebhook, err)
 	}
 
 	log.Printf("Creem Webhook解析成功 - EventType: %s, EventId: %s", webhookEvent.EventType, webhookEvent.Id)
 
-	// 根据事件类型处理不同的webhook
+	n := &PaymentNotification{
+		EventId:   webhookEvent.Id,
+		EventType: webhookEvent.EventType,
+		Data:      &webhookEvent,
+	}
 	switch webhookEvent.EventType {
 	case "checkout.completed":
-		handleCheckoutCompleted(c, &webhookEvent)
+		// 验证订单状态
+		if webhookEvent.Object.Order.Status != "paid" {
+			log.Printf("订单状态不是已支付: %s, 跳过处理", webhookEvent.Object.Order.Status)
+			return n, nil
+		}
+		// 引用ID是我们创建订单时传递的request_id
+		if webhookEvent.Object.RequestId == "" {
+			return nil, fmt.Errorf("%w: Creem Webhook缺少request_id字段", errInvalidPaymentWebhook)
+		}
+		n.Action = PaymentActionComplete
+		n.TradeNo = webhookEvent.Object.RequestId
+		n.ProviderPaymentId = webhookEvent.Object.Order.Id
+		n.Payload = common.GetJsonString(webhookEvent)
 	default:
 		log.Printf("忽略Creem Webhook事件类型: %s", webhookEvent.EventType)
-		c.Status(http.StatusOK)
 	}
+	return n, nil
 }
 
-// 处理支付完成事件
-func handleCheckoutCompleted(c *gin.Context, event *CreemWebhookEvent) {
-	// 验证订单状态
-	if event.Object.Order.Status != "paid" {
-		log.Printf("订单状态不是已支付: %s, 跳过处理", event.Object.Order.Status)
-		c.Status(http.StatusOK)
-		return
-	}
-
-	// 获取引用ID（这是我们创建订单时传递的request_id）
-	referenceId := event.Object.RequestId
-	if referenceId == "" {
-		log.Println("Creem Webhook缺少request_id字段")
-		c.AbortWithStatus(http.StatusBadRequest)
-		return
-	}
-
-	// Try complete subscription order first
-	LockOrder(referenceId)
-	defer UnlockOrder(referenceId)
-	if err := model.CompleteSubscriptionOrder(referenceId, common.GetJsonString(event)); err == nil {
-		c.Status(http.StatusOK)
-		return
-	} else if err != nil && !errors.Is(err, model.ErrSubscriptionOrderNotFound) {
-		log.Printf("Creem订阅订单处理失败: %s, 订单号: %s", err.Error(), referenceId)
-		c.AbortWithStatus(http.StatusInternalServerError)
-		return
+// CompleteTopUp 处理 Creem 充值订单的支付完成事件
+func (*CreemAdaptor) CompleteTopUp(n *PaymentNotification) error {
+	event, ok := n.Data.(*CreemWebhookEvent)
+	if !ok {
+		return errors.New("invalid creem webhook event")
 	}
 
 	// 验证订单类型，目前只处理一次性付款（充值）
 	if event.Object.Order.Type != "onetime" {
 		log.Printf("暂不支持的订单类型: %s, 跳过处理", event.Object.Order.Type)
-		c.Status(http.StatusOK)
-		return
+		return nil
 	}
 
 	// 记录详细的支付信息
 	log.Printf("处理Creem支付完成 - 订单号: %s, Creem订单ID: %s, 支付金额: %d %s, 客户邮箱: <redacted>, 产品: %s",
-		referenceId,
+		n.TradeNo,
 		event.Object.Order.Id,
 		event.Object.Order.AmountPaid,
 		event.Object.Order.Currency,
 		event.Object.Product.Name)
 
-	// 查询本地订单确认存在
-	topUp := model.GetTopUpByTradeNo(referenceId)
-	if topUp == nil {
-		log.Printf("Creem充值订单不存在: %s", referenceId)
-		c.AbortWithStatus(http.StatusBadRequest)
-		return
-	}
-
-	if topUp.Status != common.TopUpStatusPending {
-		log.Printf("Creem充值订单状态错误: %s, 当前状态: %s", referenceId, topUp.Status)
-		c.Status(http.StatusOK) // 已处理过的订单，返回成功避免重复处理
-		return
-	}
-
 	// 处理充值，传入客户邮箱和姓名信息
 	customerEmail := event.Object.Customer.Email
 	customerName := event.Object.Customer.Name
 
 	// 防护性检查，确保邮箱和姓名不为空字符串
 	if customerEmail == "" {
-		log.Printf("警告：Creem回调中客户邮箱为空 - 订单号: %s", referenceId)
+		log.Printf("警告：Creem回调中客户邮箱为空 - 订单号: %s", n.TradeNo)
 	}
 	if customerName == "" {
-		log.Printf("警告：Creem回调中客户姓名为空 - 订单号: %s", referenceId)
+		log.Printf("警告：Creem回调中客户姓名为空 - 订单号: %s", n.TradeNo)
 	}
 
-	err := model.RechargeCreem(referenceId, customerEmail, customerName)
-	if err != nil {
-		log.Printf("Creem充值处理失败: %s, 订单号: %s", err.Error(), referenceId)
-		c.AbortWithStatus(http.StatusInternalServerError)
-		return
+	if err := model.RechargeCreem(n.TradeNo, customerEmail, customerName); err != nil {
+		return err
 	}
+	log.Printf("Creem充值成功 - 订单号: %s", n.TradeNo)
+	return nil
+}
+
+func (*CreemAdaptor) Refund(topUp *model.TopUp, money float64) error {
+	return newPaymentError("Creem 暂不支持通过接口退款，请在 Creem 后台操作")
+}
 
-	log.Printf("Creem充值成功 - 订单号: %s, 充值额度: %d, 支付金额: %.2f",
-		referenceId, topUp.Amount, topUp.Money)
-	c.Status(http.StatusOK)
+func (*CreemAdaptor) Acknowledge(c *gin.Context, err error) {
+	acknowledgePaymentWebhook(c, err, http.StatusUnauthorized)
 }
 
 type CreemCheckoutRequest struct {
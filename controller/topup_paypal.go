@@ -0,0 +1,583 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+	"github.com/thanhpk/randstr"
+)
+
+const (
+	PaymentMethodPayPal = "paypal"
+)
+
+var paypalAdaptor = &PayPalAdaptor{}
+
+var paypalHttpClient = &http.Client{
+	Timeout: 30 * time.Second,
+}
+
+// PayPalAdaptor PayPal Checkout（Orders v2）渠道，缓存 OAuth access token
+type PayPalAdaptor struct {
+	mu          sync.Mutex
+	accessToken string
+	tokenOwner  string // 获取 token 时的 API 地址与 client id，配置变化后重新获取
+	expiresAt   time.Time
+}
+
+type PayPalPayRequest struct {
+	Amount        int64  `json:"amount"`
+	PaymentMethod string `json:"payment_method"`
+	CouponCode    string `json:"coupon_code"`
+}
+
+type paypalMoney struct {
+	CurrencyCode string `json:"currency_code"`
+	Value        string `json:"value"`
+}
+
+type paypalLink struct {
+	Href   string `json:"href"`
+	Rel    string `json:"rel"`
+	Method string `json:"method"`
+}
+
+type paypalCapture struct {
+	Id       string       `json:"id"`
+	Status   string       `json:"status"`
+	CustomId string       `json:"custom_id"`
+	Amount   paypalMoney  `json:"amount"`
+	Links    []paypalLink `json:"links"`
+}
+
+type paypalPurchaseUnit struct {
+	CustomId string `json:"custom_id"`
+	Payments struct {
+		Captures []paypalCapture `json:"captures"`
+	} `json:"payments"`
+}
+
+type paypalOrder struct {
+	Id            string               `json:"id"`
+	Status        string               `json:"status"`
+	PurchaseUnits []paypalPurchaseUnit `json:"purchase_units"`
+	Links         []paypalLink         `json:"links"`
+}
+
+type paypalRefund struct {
+	Id                     string       `json:"id"`
+	Status                 string       `json:"status"`
+	Amount                 paypalMoney  `json:"amount"`
+	Links                  []paypalLink `json:"links"`
+	SellerPayableBreakdown struct {
+		TotalRefundedAmount paypalMoney `json:"total_refunded_amount"`
+	} `json:"seller_payable_breakdown"`
+}
+
+type paypalWebhookEvent struct {
+	Id        string          `json:"id"`
+	EventType string          `json:"event_type"`
+	Resource  json.RawMessage `json:"resource"`
+}
+
+func paypalApiBase() string {
+	if setting.PayPalApiBase != "" {
+		return strings.TrimRight(setting.PayPalApiBase, "/")
+	}
+	if setting.PayPalSandbox {
+		return "https://api-m.sandbox.paypal.com"
+	}
+	return "https://api-m.paypal.com"
+}
+
+func paypalCurrency() string {
+	if setting.PayPalCurrency == "" {
+		return "USD"
+	}
+	return strings.ToUpper(setting.PayPalCurrency)
+}
+
+// parsePayPalAmount 将 PayPal 金额字符串转换为最小货币单位
+func parsePayPalAmount(value string) int64 {
+	amount, err := decimal.NewFromString(value)
+	if err != nil {
+		return 0
+	}
+	return amount.Mul(decimal.NewFromInt(100)).Round(0).IntPart()
+}
+
+func findPayPalLink(links []paypalLink, rels ...string) string {
+	for _, rel := range rels {
+		for _, link := range links {
+			if link.Rel == rel {
+				return link.Href
+			}
+		}
+	}
+	return ""
+}
+
+func (a *PayPalAdaptor) getAccessToken() (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	owner := paypalApiBase() + "|" + setting.PayPalClientId
+	if a.accessToken != "" && a.tokenOwner == owner && time.Now().Before(a.expiresAt) {
+		return a.accessToken, nil
+	}
+
+	req, err := http.NewRequest(http.MethodPost, paypalApiBase()+"/v1/oauth2/token", strings.NewReader("grant_type=client_credentials"))
+	if err != nil {
+		return "", err
+	}
+	req.SetBasicAuth(setting.PayPalClientId, setting.PayPalClientSecret)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := paypalHttpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode/100 != 2 {
+		return "", fmt.Errorf("PayPal oauth http status %d: %s", resp.StatusCode, body)
+	}
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &token); err != nil {
+		return "", err
+	}
+	if token.AccessToken == "" {
+		return "", errors.New("PayPal oauth resp no access token")
+	}
+	a.accessToken = token.AccessToken
+	a.tokenOwner = owner
+	// 提前一分钟过期，避免请求途中失效
+	a.expiresAt = time.Now().Add(time.Duration(token.ExpiresIn-60) * time.Second)
+	return a.accessToken, nil
+}
+
+// call 调用 PayPal REST API，body 为 nil 时不发送请求体
+func (a *PayPalAdaptor) call(method string, path string, body any, out any) error {
+	accessToken, err := a.getAccessToken()
+	if err != nil {
+		return err
+	}
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, paypalApiBase()+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := paypalHttpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("PayPal API %s %s http status %d: %s", method, path, resp.StatusCode, respBody)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(respBody, out)
+}
+
+func (*PayPalAdaptor) Name() string {
+	return PaymentMethodPayPal
+}
+
+func (*PayPalAdaptor) Enabled() bool {
+	return setting.PayPalClientId != "" && setting.PayPalClientSecret != "" && setting.PayPalWebhookId != ""
+}
+
+func (a *PayPalAdaptor) CreateCheckout(order *PaymentOrder) (*PaymentCheckout, error) {
+	if !a.Enabled() {
+		return nil, newPaymentError("PayPal 未配置")
+	}
+	cancelURL := order.CancelURL
+	if cancelURL == "" {
+		cancelURL = system_setting.ServerAddress + "/console/topup"
+	}
+	body := map[string]any{
+		"intent": "CAPTURE",
+		"purchase_units": []map[string]any{
+			{
+				"custom_id":   order.TradeNo,
+				"invoice_id":  order.TradeNo,
+				"description": order.Title,
+				"amount": paypalMoney{
+					CurrencyCode: paypalCurrency(),
+					Value:        strconv.FormatFloat(order.Money, 'f', 2, 64),
+				},
+			},
+		},
+		"application_context": map[string]any{
+			"brand_name":          common.SystemName,
+			"user_action":         "PAY_NOW",
+			"shipping_preference": "NO_SHIPPING",
+			"return_url":          service.GetCallbackAddress() + "/api/paypal/return",
+			"cancel_url":          cancelURL,
+		},
+	}
+	var result paypalOrder
+	if err := a.call(http.MethodPost, "/v2/checkout/orders", body, &result); err != nil {
+		return nil, err
+	}
+	payLink := findPayPalLink(result.Links, "approve", "payer-action")
+	if payLink == "" {
+		return nil, fmt.Errorf("PayPal order %s resp no approve link", result.Id)
+	}
+	return &PaymentCheckout{PayLink: payLink}, nil
+}
+
+// captureOrder 扣款已批准的 PayPal 订单；订单已被扣款时（如回跳与 webhook 并发）查询订单当前状态
+func (a *PayPalAdaptor) captureOrder(orderId string) (*paypalOrder, error) {
+	var order paypalOrder
+	err := a.call(http.MethodPost, "/v2/checkout/orders/"+orderId+"/capture", map[string]any{}, &order)
+	if err == nil {
+		return &order, nil
+	}
+	if getErr := a.call(http.MethodGet, "/v2/checkout/orders/"+orderId, nil, &order); getErr != nil {
+		return nil, err
+	}
+	if order.Status != "COMPLETED" {
+		return nil, err
+	}
+	return &order, nil
+}
+
+// captureNotification 将扣款结果转换为支付通知：完成则入账，被拒则过期订单
+func captureNotification(capture *paypalCapture, tradeNo string) *PaymentNotification {
+	if capture.CustomId != "" {
+		tradeNo = capture.CustomId
+	}
+	n := &PaymentNotification{
+		EventType:         "PAYMENT.CAPTURE." + capture.Status,
+		TradeNo:           tradeNo,
+		ProviderPaymentId: capture.Id,
+		// 订阅为一次性付款，记录扣款 id 以便退款时定位订阅
+		ProviderSubscriptionId: capture.Id,
+		TotalAmount:            parsePayPalAmount(capture.Amount.Value),
+		Payload:                common.GetJsonString(capture),
+	}
+	switch capture.Status {
+	case "COMPLETED":
+		n.Action = PaymentActionComplete
+	case "DECLINED", "FAILED":
+		n.Action = PaymentActionExpire
+	default:
+		log.Printf("PayPal 扣款状态 %s, 等待后续回调: %s", capture.Status, tradeNo)
+	}
+	return n
+}
+
+// captureAndComplete 扣款并完成本地订单，用于买家回跳与 CHECKOUT.ORDER.APPROVED 回调
+func (a *PayPalAdaptor) captureAndComplete(orderId string) (string, error) {
+	order, err := a.captureOrder(orderId)
+	if err != nil {
+		return "", err
+	}
+	if len(order.PurchaseUnits) == 0 || len(order.PurchaseUnits[0].Payments.Captures) == 0 {
+		return "", fmt.Errorf("PayPal order %s has no capture", orderId)
+	}
+	unit := order.PurchaseUnits[0]
+	n := captureNotification(&unit.Payments.Captures[0], unit.CustomId)
+	return n.TradeNo, processPaymentNotification(a, n)
+}
+
+func (a *PayPalAdaptor) VerifyWebhook(c *gin.Context) (*PaymentNotification, error) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidPaymentWebhook, err)
+	}
+	if setting.PayPalWebhookId == "" {
+		return nil, fmt.Errorf("%w: PayPal Webhook 未配置", errInvalidPaymentWebhook)
+	}
+
+	var verify struct {
+		VerificationStatus string `json:"verification_status"`
+	}
+	err = a.call(http.MethodPost, "/v1/notifications/verify-webhook-signature", map[string]any{
+		"auth_algo":         c.GetHeader("PAYPAL-AUTH-ALGO"),
+		"cert_url":          c.GetHeader("PAYPAL-CERT-URL"),
+		"transmission_id":   c.GetHeader("PAYPAL-TRANSMISSION-ID"),
+		"transmission_sig":  c.GetHeader("PAYPAL-TRANSMISSION-SIG"),
+		"transmission_time": c.GetHeader("PAYPAL-TRANSMISSION-TIME"),
+		"webhook_id":        setting.PayPalWebhookId,
+		"webhook_event":     json.RawMessage(body),
+	}, &verify)
+	if err != nil {
+		return nil, err
+	}
+	if verify.VerificationStatus != "SUCCESS" {
+		return nil, fmt.Errorf("%w: PayPal Webhook验签失败: %s", errInvalidPaymentWebhook, verify.VerificationStatus)
+	}
+
+	var event paypalWebhookEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		return nil, fmt.Errorf("%w: 解析PayPal Webhook失败: %v", errInvalidPaymentWebhook, err)
+	}
+	n := &PaymentNotification{
+		EventId:   event.Id,
+		EventType: event.EventType,
+		Payload:   string(event.Resource),
+	}
+	switch event.EventType {
+	case "CHECKOUT.ORDER.APPROVED":
+		// 买家批准后未回跳（如关闭了页面）时由回调完成扣款
+		var order paypalOrder
+		if err := json.Unmarshal(event.Resource, &order); err != nil {
+			return nil, fmt.Errorf("%w: %v", errInvalidPaymentWebhook, err)
+		}
+		n.Action = PaymentActionCustom
+		n.Handle = func() error {
+			_, err := a.captureAndComplete(order.Id)
+			return err
+		}
+	case "PAYMENT.CAPTURE.COMPLETED", "PAYMENT.CAPTURE.DENIED":
+		var capture paypalCapture
+		if err := json.Unmarshal(event.Resource, &capture); err != nil {
+			return nil, fmt.Errorf("%w: %v", errInvalidPaymentWebhook, err)
+		}
+		captured := captureNotification(&capture, "")
+		captured.EventId = n.EventId
+		captured.EventType = n.EventType
+		n = captured
+	case "PAYMENT.CAPTURE.REFUNDED":
+		var refund paypalRefund
+		if err := json.Unmarshal(event.Resource, &refund); err != nil {
+			return nil, fmt.Errorf("%w: %v", errInvalidPaymentWebhook, err)
+		}
+		// 退款对象通过 rel=up 链接指向原扣款
+		up := findPayPalLink(refund.Links, "up")
+		n.Action = PaymentActionRefund
+		n.ProviderPaymentId = up[strings.LastIndex(up, "/")+1:]
+		n.RefundedAmount = parsePayPalAmount(refund.SellerPayableBreakdown.TotalRefundedAmount.Value)
+		if n.RefundedAmount == 0 {
+			n.RefundedAmount = parsePayPalAmount(refund.Amount.Value)
+		}
+	default:
+		log.Printf("忽略PayPal Webhook事件类型: %s", event.EventType)
+	}
+	return n, nil
+}
+
+func (*PayPalAdaptor) CompleteTopUp(n *PaymentNotification) error {
+	return model.CompleteTopUp(n.TradeNo, n.ProviderPaymentId)
+}
+
+func (a *PayPalAdaptor) Refund(topUp *model.TopUp, money float64) error {
+	if topUp.ProviderPaymentId == "" {
+		return newPaymentError("订单缺少 PayPal 扣款标识，请在 PayPal 后台退款")
+	}
+	body := map[string]any{}
+	if money > 0 {
+		body["amount"] = paypalMoney{
+			CurrencyCode: paypalCurrency(),
+			Value:        strconv.FormatFloat(money, 'f', 2, 64),
+		}
+	}
+	return a.call(http.MethodPost, "/v2/payments/captures/"+topUp.ProviderPaymentId+"/refund", body, nil)
+}
+
+func (*PayPalAdaptor) Acknowledge(c *gin.Context, err error) {
+	acknowledgePaymentWebhook(c, err, http.StatusBadRequest)
+}
+
+func PayPalWebhook(c *gin.Context) {
+	handlePaymentWebhook(c, paypalAdaptor)
+}
+
+// PayPalReturn 买家在 PayPal 批准付款后回跳，立即扣款并跳转回控制台
+func PayPalReturn(c *gin.Context) {
+	orderId := c.Query("token")
+	if orderId == "" {
+		c.Redirect(http.StatusFound, system_setting.ServerAddress+"/console/topup?pay=fail")
+		return
+	}
+	tradeNo, err := paypalAdaptor.captureAndComplete(orderId)
+	if err != nil {
+		log.Printf("PayPal 扣款失败: %s, %v", orderId, err)
+		c.Redirect(http.StatusFound, system_setting.ServerAddress+"/console/topup?pay=fail")
+		return
+	}
+	if model.GetSubscriptionOrderByTradeNo(tradeNo) != nil {
+		c.Redirect(http.StatusFound, system_setting.ServerAddress+"/console/subscription?pay=success")
+		return
+	}
+	c.Redirect(http.StatusFound, system_setting.ServerAddress+"/console/log")
+}
+
+func getPayPalPayMoney(amount int64, group string) float64 {
+	dAmount := decimal.NewFromInt(amount)
+	if operation_setting.GetQuotaDisplayType() == operation_setting.QuotaDisplayTypeTokens {
+		dAmount = dAmount.Div(decimal.NewFromFloat(common.QuotaPerUnit))
+	}
+	topupGroupRatio := common.GetTopupGroupRatio(group)
+	if topupGroupRatio == 0 {
+		topupGroupRatio = 1
+	}
+	// apply optional preset discount by the original request amount (if configured), default 1.0
+	discount := 1.0
+	if ds, ok := operation_setting.GetPaymentSetting().AmountDiscount[int(amount)]; ok {
+		if ds > 0 {
+			discount = ds
+		}
+	}
+	payMoney := dAmount.Mul(decimal.NewFromFloat(setting.PayPalUnitPrice)).
+		Mul(decimal.NewFromFloat(topupGroupRatio)).
+		Mul(decimal.NewFromFloat(discount))
+	return payMoney.InexactFloat64()
+}
+
+func getPayPalMinTopup() int64 {
+	minTopup := setting.PayPalMinTopUp
+	if operation_setting.GetQuotaDisplayType() == operation_setting.QuotaDisplayTypeTokens {
+		minTopup = minTopup * int(common.QuotaPerUnit)
+	}
+	return int64(minTopup)
+}
+
+func RequestPayPalAmount(c *gin.Context) {
+	var req PayPalPayRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(200, gin.H{"message": "error", "data": "参数错误"})
+		return
+	}
+	if req.Amount < getPayPalMinTopup() {
+		c.JSON(200, gin.H{"message": "error", "data": fmt.Sprintf("充值数量不能小于 %d", getPayPalMinTopup())})
+		return
+	}
+	group, err := model.GetUserGroup(c.GetInt("id"), true)
+	if err != nil {
+		c.JSON(200, gin.H{"message": "error", "data": "获取用户分组失败"})
+		return
+	}
+	payMoney := getPayPalPayMoney(req.Amount, group)
+	if payMoney <= 0.01 {
+		c.JSON(200, gin.H{"message": "error", "data": "充值金额过低"})
+		return
+	}
+	c.JSON(200, gin.H{"message": "success", "data": strconv.FormatFloat(payMoney, 'f', 2, 64)})
+}
+
+func RequestPayPalPay(c *gin.Context) {
+	var req PayPalPayRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(200, gin.H{"message": "error", "data": "参数错误"})
+		return
+	}
+	if req.PaymentMethod != PaymentMethodPayPal {
+		c.JSON(200, gin.H{"message": "error", "data": "不支持的支付渠道"})
+		return
+	}
+	if req.Amount < getPayPalMinTopup() {
+		c.JSON(200, gin.H{"message": "error", "data": fmt.Sprintf("充值数量不能小于 %d", getPayPalMinTopup())})
+		return
+	}
+	if req.Amount > 10000 {
+		c.JSON(200, gin.H{"message": "error", "data": "充值数量不能大于 10000"})
+		return
+	}
+
+	id := c.GetInt("id")
+	user, err := model.GetUserById(id, false)
+	if err != nil {
+		c.JSON(200, gin.H{"message": "error", "data": "用户不存在"})
+		return
+	}
+	payMoney := getPayPalPayMoney(req.Amount, user.Group)
+	if payMoney < 0.01 {
+		c.JSON(200, gin.H{"message": "error", "data": "充值金额过低"})
+		return
+	}
+
+	reference := fmt.Sprintf("paypal-ref-%d-%d-%s", user.Id, time.Now().UnixMilli(), randstr.String(4))
+	referenceId := "ref_" + common.Sha1([]byte(reference))
+	couponUsage, err := reserveOrderCoupon(req.CouponCode, &model.CouponTarget{
+		UserId:  id,
+		Group:   user.Group,
+		Scope:   model.CouponScopeTopUp,
+		Money:   payMoney,
+		TradeNo: referenceId,
+	})
+	if err != nil {
+		c.JSON(200, gin.H{"message": "error", "data": err.Error()})
+		return
+	}
+	order := &PaymentOrder{
+		TradeNo: referenceId,
+		UserId:  id,
+		Email:   user.Email,
+		Title:   fmt.Sprintf("TUC%d", req.Amount),
+		Money:   payMoney,
+	}
+	applyOrderCoupon(order, couponUsage)
+	checkout, err := paypalAdaptor.CreateCheckout(order)
+	if err != nil {
+		releaseOrderCoupon(couponUsage)
+		c.JSON(200, gin.H{"message": "error", "data": paymentErrorMessage(paypalAdaptor, err, "拉起支付失败")})
+		return
+	}
+
+	// 与易支付一致，Amount 记录为美元数量，完成时按 Amount * QuotaPerUnit 入账
+	amount := req.Amount
+	if operation_setting.GetQuotaDisplayType() == operation_setting.QuotaDisplayTypeTokens {
+		amount = decimal.NewFromInt(amount).Div(decimal.NewFromFloat(common.QuotaPerUnit)).IntPart()
+	}
+	topUp := &model.TopUp{
+		UserId:        id,
+		Amount:        amount,
+		Money:         order.Money,
+		TradeNo:       referenceId,
+		PaymentMethod: PaymentMethodPayPal,
+		CreateTime:    time.Now().Unix(),
+		Status:        common.TopUpStatusPending,
+	}
+	applyTopUpCoupon(topUp, couponUsage)
+	if err := topUp.Insert(); err != nil {
+		releaseOrderCoupon(couponUsage)
+		c.JSON(200, gin.H{"message": "error", "data": "创建订单失败"})
+		return
+	}
+	c.JSON(200, gin.H{
+		"message": "success",
+		"data": gin.H{
+			"pay_link": checkout.PayLink,
+		},
+	})
+}
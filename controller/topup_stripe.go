@@ -1,10 +1,10 @@
 package controller
 
 import (
-	"errors"
 	"fmt"
 	"io"
 	"log"
+	"math"
 	"net/http"
 	"strconv"
 	"strings"
@@ -19,6 +19,8 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/stripe/stripe-go/v81"
 	"github.com/stripe/stripe-go/v81/checkout/session"
+	"github.com/stripe/stripe-go/v81/coupon"
+	"github.com/stripe/stripe-go/v81/refund"
 	"github.com/stripe/stripe-go/v81/webhook"
 	"github.com/thanhpk/randstr"
 )
@@ -35,6 +37,8 @@ type StripePayRequest struct {
 	Amount int64 `json:"amount"`
 	// PaymentMethod specifies the payment method (e.g., "stripe").
 	PaymentMethod string `json:"payment_method"`
+	// CouponCode is the optional coupon applied to this order.
+	CouponCode string `json:"coupon_code"`
 	// SuccessURL is the optional custom URL to redirect after successful payment.
 	// If empty, defaults to the server's console log page.
 	SuccessURL string `json:"success_url,omitempty"`
@@ -96,8 +100,33 @@ func (*StripeAdaptor) RequestPay(c *gin.Context, req *StripePayRequest) {
 	reference := fmt.Sprintf("new-api-ref-%d-%d-%s", user.Id, time.Now().UnixMilli(), randstr.String(4))
 	referenceId := "ref_" + common.Sha1([]byte(reference))
 
-	payLink, err := genStripeLink(referenceId, user.StripeCustomer, user.Email, req.Amount, req.SuccessURL, req.CancelURL)
+	// 优惠券按用户实际支付金额计算抵扣；订单 Money 仍为入账依据，不随优惠变化
+	payMoney := getStripePayMoney(float64(req.Amount), user.Group)
+	couponUsage, err := reserveOrderCoupon(req.CouponCode, &model.CouponTarget{
+		UserId:  id,
+		Group:   user.Group,
+		Scope:   model.CouponScopeTopUp,
+		Money:   payMoney,
+		TradeNo: referenceId,
+	})
+	if err != nil {
+		c.JSON(200, gin.H{"message": "error", "data": err.Error()})
+		return
+	}
+	order := &PaymentOrder{
+		TradeNo:    referenceId,
+		UserId:     id,
+		Email:      user.Email,
+		CustomerId: user.StripeCustomer,
+		Money:      payMoney,
+		Quantity:   req.Amount,
+		SuccessURL: req.SuccessURL,
+		CancelURL:  req.CancelURL,
+	}
+	applyOrderCoupon(order, couponUsage)
+	checkout, err := stripeAdaptor.CreateCheckout(order)
 	if err != nil {
+		releaseOrderCoupon(couponUsage)
 		log.Println("获取Stripe Checkout支付链接失败", err)
 		c.JSON(200, gin.H{"message": "error", "data": "拉起支付失败"})
 		return
@@ -112,15 +141,17 @@ func (*StripeAdaptor) RequestPay(c *gin.Context, req *StripePayRequest) {
 		CreateTime:    time.Now().Unix(),
 		Status:        common.TopUpStatusPending,
 	}
+	applyTopUpCoupon(topUp, couponUsage)
 	err = topUp.Insert()
 	if err != nil {
+		releaseOrderCoupon(couponUsage)
 		c.JSON(200, gin.H{"message": "error", "data": "创建订单失败"})
 		return
 	}
 	c.JSON(200, gin.H{
 		"message": "success",
 		"data": gin.H{
-			"pay_link": payLink,
+			"pay_link": checkout.PayLink,
 		},
 	})
 }
@@ -146,11 +177,39 @@ func RequestStripePay(c *gin.Context) {
 }
 
 func StripeWebhook(c *gin.Context) {
+	handlePaymentWebhook(c, stripeAdaptor)
+}
+
+func (*StripeAdaptor) Name() string {
+	return PaymentMethodStripe
+}
+
+func (*StripeAdaptor) Enabled() bool {
+	return (strings.HasPrefix(setting.StripeApiSecret, "sk_") || strings.HasPrefix(setting.StripeApiSecret, "rk_")) &&
+		setting.StripeWebhookSecret != ""
+}
+
+func (*StripeAdaptor) CreateCheckout(order *PaymentOrder) (*PaymentCheckout, error) {
+	couponId, err := genStripeCoupon(order)
+	if err != nil {
+		return nil, err
+	}
+	var payLink string
+	if order.Subscription {
+		payLink, err = genStripeSubscriptionLink(order.TradeNo, order.CustomerId, order.Email, order.ProductId, couponId)
+	} else {
+		payLink, err = genStripeLink(order.TradeNo, order.CustomerId, order.Email, order.Quantity, order.SuccessURL, order.CancelURL, couponId)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &PaymentCheckout{PayLink: payLink}, nil
+}
+
+func (*StripeAdaptor) VerifyWebhook(c *gin.Context) (*PaymentNotification, error) {
 	payload, err := io.ReadAll(c.Request.Body)
 	if err != nil {
-		log.Printf("解析Stripe Webhook参数失败: %v\n", err)
-		c.AbortWithStatus(http.StatusServiceUnavailable)
-		return
+		return nil, fmt.Errorf("%w: %v", errInvalidPaymentWebhook, err)
 	}
 
 	signature := c.GetHeader("Stripe-Signature")
@@ -158,102 +217,91 @@ func StripeWebhook(c *gin.Context) {
 	event, err := webhook.ConstructEventWithOptions(payload, signature, endpointSecret, webhook.ConstructEventOptions{
 		IgnoreAPIVersionMismatch: true,
 	})
-
 	if err != nil {
-		log.Printf("Stripe Webhook验签失败: %v\n", err)
-		c.AbortWithStatus(http.StatusBadRequest)
-		return
+		return nil, fmt.Errorf("%w: %v", errInvalidPaymentWebhook, err)
 	}
 
+	n := &PaymentNotification{
+		EventId:   event.ID,
+		EventType: string(event.Type),
+		Data:      event,
+	}
 	switch event.Type {
 	case stripe.EventTypeCheckoutSessionCompleted:
-		sessionCompleted(event)
+		n.TradeNo = event.GetObjectValue("client_reference_id")
+		if status := event.GetObjectValue("status"); status != "complete" {
+			log.Println("错误的Stripe Checkout完成状态:", status, ",", n.TradeNo)
+			return n, nil
+		}
+		n.Action = PaymentActionComplete
+		n.ProviderPaymentId = event.GetObjectValue("payment_intent")
+		// 周期订阅：记录 Stripe 订阅 id，后续 invoice.paid 据此自动续费
+		n.ProviderSubscriptionId = event.GetObjectValue("subscription")
+		n.Payload = common.GetJsonString(map[string]any{
+			"customer":     event.GetObjectValue("customer"),
+			"amount_total": event.GetObjectValue("amount_total"),
+			"currency":     strings.ToUpper(event.GetObjectValue("currency")),
+			"event_type":   string(event.Type),
+		})
 	case stripe.EventTypeCheckoutSessionExpired:
-		sessionExpired(event)
+		n.TradeNo = event.GetObjectValue("client_reference_id")
+		if status := event.GetObjectValue("status"); status != "expired" {
+			log.Println("错误的Stripe Checkout过期状态:", status, ",", n.TradeNo)
+			return n, nil
+		}
+		n.Action = PaymentActionExpire
+	case stripe.EventTypeChargeRefunded:
+		n.Action = PaymentActionCustom
+		n.Handle = func() error { return stripeChargeRefunded(event) }
+	case stripe.EventTypeChargeDisputeCreated:
+		n.Action = PaymentActionCustom
+		n.Handle = func() error { return stripeDisputeCreated(event) }
+	case stripe.EventTypeChargeDisputeClosed:
+		n.Action = PaymentActionCustom
+		n.Handle = func() error { return stripeDisputeClosed(event) }
+	case stripe.EventTypeInvoicePaid:
+		n.Action = PaymentActionCustom
+		n.Handle = func() error { return stripeInvoicePaid(event) }
+	case stripe.EventTypeCustomerSubscriptionDeleted, stripe.EventTypeCustomerSubscriptionUpdated:
+		n.Action = PaymentActionCustom
+		n.Handle = func() error {
+			stripeSubscriptionChanged(event)
+			return nil
+		}
 	default:
 		log.Printf("不支持的Stripe Webhook事件类型: %s\n", event.Type)
 	}
-
-	c.Status(http.StatusOK)
+	return n, nil
 }
 
-func sessionCompleted(event stripe.Event) {
-	customerId := event.GetObjectValue("customer")
-	referenceId := event.GetObjectValue("client_reference_id")
-	status := event.GetObjectValue("status")
-	if "complete" != status {
-		log.Println("错误的Stripe Checkout完成状态:", status, ",", referenceId)
-		return
-	}
-
-	// Try complete subscription order first
-	LockOrder(referenceId)
-	defer UnlockOrder(referenceId)
-	payload := map[string]any{
-		"customer":     customerId,
-		"amount_total": event.GetObjectValue("amount_total"),
-		"currency":     strings.ToUpper(event.GetObjectValue("currency")),
-		"event_type":   string(event.Type),
-	}
-	if err := model.CompleteSubscriptionOrder(referenceId, common.GetJsonString(payload)); err == nil {
-		return
-	} else if err != nil && !errors.Is(err, model.ErrSubscriptionOrderNotFound) {
-		log.Println("complete subscription order failed:", err.Error(), referenceId)
-		return
-	}
-
-	err := model.Recharge(referenceId, customerId)
-	if err != nil {
-		log.Println(err.Error(), referenceId)
-		return
+func (*StripeAdaptor) CompleteTopUp(n *PaymentNotification) error {
+	event, _ := n.Data.(stripe.Event)
+	if err := model.Recharge(n.TradeNo, event.GetObjectValue("customer")); err != nil {
+		return err
 	}
-
 	total, _ := strconv.ParseFloat(event.GetObjectValue("amount_total"), 64)
 	currency := strings.ToUpper(event.GetObjectValue("currency"))
-	log.Printf("收到款项：%s, %.2f(%s)", referenceId, total/100, currency)
+	log.Printf("收到款项：%s, %.2f(%s)", n.TradeNo, total/100, currency)
+	return nil
 }
 
-func sessionExpired(event stripe.Event) {
-	referenceId := event.GetObjectValue("client_reference_id")
-	status := event.GetObjectValue("status")
-	if "expired" != status {
-		log.Println("错误的Stripe Checkout过期状态:", status, ",", referenceId)
-		return
-	}
-
-	if len(referenceId) == 0 {
-		log.Println("未提供支付单号")
-		return
-	}
-
-	// Subscription order expiration
-	LockOrder(referenceId)
-	defer UnlockOrder(referenceId)
-	if err := model.ExpireSubscriptionOrder(referenceId); err == nil {
-		return
-	} else if err != nil && !errors.Is(err, model.ErrSubscriptionOrderNotFound) {
-		log.Println("过期订阅订单失败", referenceId, ", err:", err.Error())
-		return
-	}
-
-	topUp := model.GetTopUpByTradeNo(referenceId)
-	if topUp == nil {
-		log.Println("充值订单不存在", referenceId)
-		return
+func (*StripeAdaptor) Refund(topUp *model.TopUp, money float64) error {
+	if topUp.ProviderPaymentId == "" {
+		return newPaymentError("订单缺少 Stripe 支付标识，请在 Stripe 后台退款")
 	}
-
-	if topUp.Status != common.TopUpStatusPending {
-		log.Println("充值订单状态错误", referenceId)
+	stripe.Key = setting.StripeApiSecret
+	params := &stripe.RefundParams{
+		PaymentIntent: stripe.String(topUp.ProviderPaymentId),
 	}
-
-	topUp.Status = common.TopUpStatusExpired
-	err := topUp.Update()
-	if err != nil {
-		log.Println("过期充值订单失败", referenceId, ", err:", err.Error())
-		return
+	if money > 0 {
+		params.Amount = stripe.Int64(int64(math.Round(money * 100)))
 	}
+	_, err := refund.New(params)
+	return err
+}
 
-	log.Println("充值订单已过期", referenceId)
+func (*StripeAdaptor) Acknowledge(c *gin.Context, err error) {
+	acknowledgePaymentWebhook(c, err, http.StatusBadRequest)
 }
 
 // genStripeLink generates a Stripe Checkout session URL for payment.
@@ -266,9 +314,10 @@ func sessionExpired(event stripe.Event) {
 //   - amount: quantity of units to purchase
 //   - successURL: custom URL to redirect after successful payment (empty for default)
 //   - cancelURL: custom URL to redirect when payment is canceled (empty for default)
+//   - couponId: Stripe coupon applied to the session (empty for none)
 //
 // Returns the checkout session URL or an error if the session creation fails.
-func genStripeLink(referenceId string, customerId string, email string, amount int64, successURL string, cancelURL string) (string, error) {
+func genStripeLink(referenceId string, customerId string, email string, amount int64, successURL string, cancelURL string, couponId string) (string, error) {
 	if !strings.HasPrefix(setting.StripeApiSecret, "sk_") && !strings.HasPrefix(setting.StripeApiSecret, "rk_") {
 		return "", fmt.Errorf("无效的Stripe API密钥")
 	}
@@ -296,6 +345,11 @@ func genStripeLink(referenceId string, customerId string, email string, amount i
 		Mode:                stripe.String(string(stripe.CheckoutSessionModePayment)),
 		AllowPromotionCodes: stripe.Bool(setting.StripePromotionCodesEnabled),
 	}
+	// Stripe 不允许同时指定折扣与开放促销码输入
+	if couponId != "" {
+		params.AllowPromotionCodes = nil
+		params.Discounts = []*stripe.CheckoutSessionDiscountParams{{Coupon: stripe.String(couponId)}}
+	}
 
 	if "" == customerId {
 		if "" != email {
@@ -315,6 +369,30 @@ func genStripeLink(referenceId string, customerId string, email string, amount i
 	return result.URL, nil
 }
 
+// genStripeCoupon 为使用了本站优惠券的订单创建一次性的 Stripe 折扣券。
+// Stripe 按价格与数量计费，这里把抵扣金额换算成折扣比例，周期订阅仅首期生效。
+func genStripeCoupon(order *PaymentOrder) (string, error) {
+	if order.Discount <= 0 {
+		return "", nil
+	}
+	origin := order.Money + order.Discount
+	percentOff := math.Round(order.Discount/origin*10000) / 100
+	if percentOff <= 0 {
+		return "", nil
+	}
+	stripe.Key = setting.StripeApiSecret
+	result, err := coupon.New(&stripe.CouponParams{
+		Name:           stripe.String(order.TradeNo),
+		PercentOff:     stripe.Float64(math.Min(percentOff, 100)),
+		Duration:       stripe.String(string(stripe.CouponDurationOnce)),
+		MaxRedemptions: stripe.Int64(1),
+	})
+	if err != nil {
+		return "", err
+	}
+	return result.ID, nil
+}
+
 func GetChargedAmount(count float64, user model.User) float64 {
 	topUpGroupRatio := common.GetTopupGroupRatio(user.Group)
 	if topUpGroupRatio == 0 {
@@ -0,0 +1,208 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting"
+
+	"github.com/stripe/stripe-go/v81"
+	"github.com/stripe/stripe-go/v81/charge"
+	"github.com/stripe/stripe-go/v81/invoice"
+	"gorm.io/gorm"
+)
+
+// stripeChargeTarget 一笔 Stripe 扣款对应的本地订单：钱包充值订单或周期订阅
+type stripeChargeTarget struct {
+	topUp          *model.TopUp
+	subscriptionId string
+	userId         int
+}
+
+// findStripeChargeTarget 依次按 PaymentIntent（钱包充值）、Invoice（周期订阅）、Customer 定位扣款所属的用户
+func findStripeChargeTarget(paymentIntentId string, invoiceId string, customerId string) (*stripeChargeTarget, error) {
+	target := &stripeChargeTarget{}
+	if topUp := model.GetTopUpByProviderPaymentId(paymentIntentId); topUp != nil {
+		target.topUp = topUp
+		target.userId = topUp.UserId
+		return target, nil
+	}
+	if invoiceId != "" {
+		stripe.Key = setting.StripeApiSecret
+		inv, err := invoice.Get(invoiceId, nil)
+		if err != nil {
+			return nil, err
+		}
+		if inv.Subscription != nil {
+			target.subscriptionId = inv.Subscription.ID
+			if userId, err := model.GetUserIdBySubscriptionProvider(target.subscriptionId); err == nil {
+				target.userId = userId
+			}
+		}
+	}
+	if target.userId == 0 && customerId != "" {
+		if userId, err := model.GetUserIdByStripeCustomer(customerId); err == nil {
+			target.userId = userId
+		}
+	}
+	return target, nil
+}
+
+func parseStripeAmount(value string) int64 {
+	amount, _ := strconv.ParseFloat(value, 64)
+	return int64(amount)
+}
+
+// stripeChargeRefunded 退款：钱包充值按退款比例扣回额度，周期订阅全额退款时作废当前订阅
+func stripeChargeRefunded(event stripe.Event) error {
+	paymentIntentId := event.GetObjectValue("payment_intent")
+	amount := parseStripeAmount(event.GetObjectValue("amount"))
+	refunded := parseStripeAmount(event.GetObjectValue("amount_refunded"))
+	target, err := findStripeChargeTarget(paymentIntentId, event.GetObjectValue("invoice"), "")
+	if err != nil {
+		return err
+	}
+	if target.topUp != nil {
+		clawback, err := model.ClawbackTopUpQuota(paymentIntentId, refunded, amount, "Stripe 退款")
+		if err != nil {
+			return err
+		}
+		log.Printf("Stripe 退款已处理：%s，扣回额度 %d\n", target.topUp.TradeNo, clawback)
+		return nil
+	}
+	if target.subscriptionId != "" {
+		if refunded < amount {
+			log.Printf("Stripe 订阅部分退款，不作废订阅：%s\n", target.subscriptionId)
+			return nil
+		}
+		return cancelStripeSubscription(target, "Stripe 订阅款项已全额退款，订阅已作废")
+	}
+	log.Printf("Stripe 退款未找到对应订单：%s\n", paymentIntentId)
+	return nil
+}
+
+func cancelStripeSubscription(target *stripeChargeTarget, reason string) error {
+	msg, err := model.CancelUserSubscriptionByProvider(target.subscriptionId)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("Stripe 订阅没有有效的本地订阅：%s\n", target.subscriptionId)
+			return nil
+		}
+		return err
+	}
+	if target.userId > 0 {
+		if msg != "" {
+			reason += "，" + msg
+		}
+		model.RecordLog(target.userId, model.LogTypeSystem, reason)
+	}
+	return nil
+}
+
+// findStripeDisputeTarget 争议对象只带 charge 和 payment_intent，定位不到充值订单时查询 charge 详情
+func findStripeDisputeTarget(event stripe.Event) (*stripeChargeTarget, error) {
+	paymentIntentId := event.GetObjectValue("payment_intent")
+	if topUp := model.GetTopUpByProviderPaymentId(paymentIntentId); topUp != nil {
+		return &stripeChargeTarget{topUp: topUp, userId: topUp.UserId}, nil
+	}
+	stripe.Key = setting.StripeApiSecret
+	ch, err := charge.Get(event.GetObjectValue("charge"), nil)
+	if err != nil {
+		return nil, err
+	}
+	invoiceId := ""
+	if ch.Invoice != nil {
+		invoiceId = ch.Invoice.ID
+	}
+	customerId := ""
+	if ch.Customer != nil {
+		customerId = ch.Customer.ID
+	}
+	return findStripeChargeTarget(paymentIntentId, invoiceId, customerId)
+}
+
+// stripeDisputeCreated 发起争议（拒付）时暂停用户账户
+func stripeDisputeCreated(event stripe.Event) error {
+	target, err := findStripeDisputeTarget(event)
+	if err != nil {
+		return err
+	}
+	if target.userId == 0 {
+		log.Printf("Stripe 争议未找到对应用户：%s\n", event.GetObjectValue("id"))
+		return nil
+	}
+	disabled, err := model.DisableUserById(target.userId)
+	if err != nil {
+		return err
+	}
+	reason := event.GetObjectValue("reason")
+	common.SysLog(fmt.Sprintf("Stripe 争议 %s（%s），用户 %d 已暂停: %t", event.GetObjectValue("id"), reason, target.userId, disabled))
+	model.RecordLog(target.userId, model.LogTypeSystem, fmt.Sprintf("Stripe 支付发生争议（%s），账户已暂停", reason))
+	return nil
+}
+
+// stripeDisputeClosed 争议败诉时扣回充值额度或作废订阅；胜诉时不自动恢复账户，由管理员确认
+func stripeDisputeClosed(event stripe.Event) error {
+	status := event.GetObjectValue("status")
+	disputeId := event.GetObjectValue("id")
+	switch status {
+	case "lost":
+		target, err := findStripeDisputeTarget(event)
+		if err != nil {
+			return err
+		}
+		if target.topUp != nil {
+			_, err := model.ClawbackTopUpQuota(target.topUp.ProviderPaymentId, 1, 1, "Stripe 争议败诉")
+			return err
+		}
+		if target.subscriptionId != "" {
+			return cancelStripeSubscription(target, "Stripe 争议败诉，订阅已作废")
+		}
+		log.Printf("Stripe 争议未找到对应订单：%s\n", disputeId)
+	case "won":
+		common.SysLog(fmt.Sprintf("Stripe 争议 %s 已胜诉，如需恢复用户账户请手动启用", disputeId))
+	default:
+		log.Printf("Stripe 争议 %s 已关闭，状态: %s\n", disputeId, status)
+	}
+	return nil
+}
+
+// stripeInvoicePaid 周期订阅续费成功时续期本地订阅，首期账单由 checkout.session.completed 处理
+func stripeInvoicePaid(event stripe.Event) error {
+	if event.GetObjectValue("billing_reason") != string(stripe.InvoiceBillingReasonSubscriptionCycle) {
+		return nil
+	}
+	subscriptionId := event.GetObjectValue("subscription")
+	invoiceId := event.GetObjectValue("id")
+	money := float64(parseStripeAmount(event.GetObjectValue("amount_paid"))) / 100
+	err := model.RenewUserSubscriptionByProvider(subscriptionId, "sub_renew_"+invoiceId, money, PaymentMethodStripe)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		log.Printf("Stripe 续费未找到关联的订阅：%s\n", subscriptionId)
+		return nil
+	}
+	return err
+}
+
+// stripeSubscriptionChanged 周期订阅取消时通知用户，已支付的订阅周期保持有效直到到期
+func stripeSubscriptionChanged(event stripe.Event) {
+	subscriptionId := event.GetObjectValue("id")
+	var content string
+	switch {
+	case event.Type == stripe.EventTypeCustomerSubscriptionDeleted:
+		content = "Stripe 周期订阅已取消，当前订阅到期后将不再自动续费"
+	case event.GetObjectValue("cancel_at_period_end") == "true" && event.GetPreviousValue("cancel_at_period_end") == "false":
+		content = "Stripe 周期订阅已设置为到期取消"
+	default:
+		return
+	}
+	userId, err := model.GetUserIdBySubscriptionProvider(subscriptionId)
+	if err != nil {
+		log.Printf("Stripe 订阅变更未找到关联的订阅：%s\n", subscriptionId)
+		return
+	}
+	model.RecordLog(userId, model.LogTypeSystem, content)
+}
@@ -24,14 +24,56 @@ const (
 )
 
 type ChannelOtherSettings struct {
-	AzureResponsesVersion string        `json:"azure_responses_version,omitempty"`
-	VertexKeyType         VertexKeyType `json:"vertex_key_type,omitempty"` // "json" or "api_key"
-	OpenRouterEnterprise  *bool         `json:"openrouter_enterprise,omitempty"`
-	ClaudeBetaQuery       bool          `json:"claude_beta_query,omitempty"`      // Claude 渠道是否强制追加 ?beta=true
-	AllowServiceTier      bool          `json:"allow_service_tier,omitempty"`      // 是否允许 service_tier 透传（默认过滤以避免额外计费）
-	DisableStore          bool          `json:"disable_store,omitempty"`           // 是否禁用 store 透传（默认允许透传，禁用后可能导致 Codex 无法使用）
-	AllowSafetyIdentifier bool          `json:"allow_safety_identifier,omitempty"` // 是否允许 safety_identifier 透传（默认过滤以保护用户隐私）
-	AwsKeyType            AwsKeyType    `json:"aws_key_type,omitempty"`
+	AzureResponsesVersion   string           `json:"azure_responses_version,omitempty"`
+	VertexKeyType           VertexKeyType    `json:"vertex_key_type,omitempty"` // "json" or "api_key"
+	OpenRouterEnterprise    *bool            `json:"openrouter_enterprise,omitempty"`
+	ClaudeBetaQuery         bool             `json:"claude_beta_query,omitempty"`       // Claude 渠道是否强制追加 ?beta=true
+	AllowServiceTier        bool             `json:"allow_service_tier,omitempty"`      // 是否允许 service_tier 透传（默认过滤以避免额外计费）
+	DisableStore            bool             `json:"disable_store,omitempty"`           // 是否禁用 store 透传（默认允许透传，禁用后可能导致 Codex 无法使用）
+	AllowSafetyIdentifier   bool             `json:"allow_safety_identifier,omitempty"` // 是否允许 safety_identifier 透传（默认过滤以保护用户隐私）
+	AwsKeyType              AwsKeyType       `json:"aws_key_type,omitempty"`
+	PromptCache             *PromptCacheRule `json:"prompt_cache,omitempty"`              // 渠道级提示词缓存规则，优先于分组和全局规则
+	EnforceStructuredOutput bool             `json:"enforce_structured_output,omitempty"` // 上游会忽略 json_schema 时，强制由网关校验结构化输出
+	EmulateTools            bool             `json:"emulate_tools,omitempty"`             // 上游不支持原生工具调用时，通过提示词模拟 tools 并解析回 tool_calls / tool_use
+	AwsGuardrail            *AwsGuardrail    `json:"aws_guardrail,omitempty"`             // Bedrock Converse 请求使用的护栏
+	// 上游成本相对于本站模型价格（不含分组倍率）的比例，如上游 7 折为 0.7；CostModelRatio 按模型覆盖 CostRatio
+	CostRatio      *float64           `json:"cost_ratio,omitempty"`
+	CostModelRatio map[string]float64 `json:"cost_model_ratio,omitempty"`
+	BalanceAlert   *BalanceAlert      `json:"balance_alert,omitempty"` // 余额告警与低余额处理
+}
+
+const (
+	BalanceAlertActionNone          = ""
+	BalanceAlertActionDisable       = "disable"
+	BalanceAlertActionLowerPriority = "lower_priority"
+)
+
+// BalanceAlert 渠道余额阈值，余额单位与渠道余额一致（美元）。
+// 余额跌破 NotifyBelow 时通知管理员；跌破 Floor 时按 Action 禁用渠道或将优先级降为 Priority，余额回升后自动恢复
+type BalanceAlert struct {
+	NotifyBelow float64 `json:"notify_below,omitempty"` // 0 表示不通知
+	Floor       float64 `json:"floor,omitempty"`
+	Action      string  `json:"action,omitempty"`
+	Priority    int64   `json:"priority,omitempty"`
+}
+
+// AwsGuardrail Bedrock 护栏配置，仅对走 Converse API 的模型生效
+type AwsGuardrail struct {
+	Identifier           string `json:"identifier"`
+	Version              string `json:"version,omitempty"`                // 为空时使用 DRAFT
+	Trace                string `json:"trace,omitempty"`                  // enabled / disabled / enabled_full
+	StreamProcessingMode string `json:"stream_processing_mode,omitempty"` // 流式请求的护栏处理模式：sync / async
+}
+
+// PromptCacheRule 描述网关自动为长且稳定的前缀（系统提示词、工具定义）开启上游提示词缓存的规则。
+// Claude / Bedrock 通过插入 cache_control 断点实现，Gemini 通过创建 cachedContents 实现。
+type PromptCacheRule struct {
+	Enabled         bool     `json:"enabled"`
+	CacheSystem     bool     `json:"cache_system"`
+	CacheTools      bool     `json:"cache_tools"`
+	MinPrefixTokens int      `json:"min_prefix_tokens,omitempty"` // 可缓存前缀的估算 token 数低于该值时不启用缓存
+	TTL             string   `json:"ttl,omitempty"`               // "5m"（默认）或 "1h"
+	ModelPatterns   []string `json:"model_patterns,omitempty"`    // 模型名正则，为空表示匹配所有模型
 }
 
 func (s *ChannelOtherSettings) IsOpenRouterEnterprise() bool {
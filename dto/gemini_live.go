@@ -0,0 +1,114 @@
+package dto
+
+import "encoding/json"
+
+// Gemini Live API (BidiGenerateContent) websocket 消息
+
+type GeminiLiveClientMessage struct {
+	Setup         *GeminiLiveSetup         `json:"setup,omitempty"`
+	ClientContent *GeminiLiveClientContent `json:"clientContent,omitempty"`
+	RealtimeInput *GeminiLiveRealtimeInput `json:"realtimeInput,omitempty"`
+	ToolResponse  *GeminiLiveToolResponse  `json:"toolResponse,omitempty"`
+}
+
+type GeminiLiveSetup struct {
+	Model                    string                         `json:"model"`
+	GenerationConfig         *GeminiLiveGenerationConfig    `json:"generationConfig,omitempty"`
+	SystemInstruction        *GeminiChatContent             `json:"systemInstruction,omitempty"`
+	Tools                    []GeminiChatTool               `json:"tools,omitempty"`
+	RealtimeInputConfig      *GeminiLiveRealtimeInputConfig `json:"realtimeInputConfig,omitempty"`
+	InputAudioTranscription  *struct{}                      `json:"inputAudioTranscription,omitempty"`
+	OutputAudioTranscription *struct{}                      `json:"outputAudioTranscription,omitempty"`
+}
+
+type GeminiLiveGenerationConfig struct {
+	ResponseModalities []string        `json:"responseModalities,omitempty"`
+	Temperature        *float64        `json:"temperature,omitempty"`
+	SpeechConfig       json.RawMessage `json:"speechConfig,omitempty"`
+}
+
+type GeminiLiveRealtimeInputConfig struct {
+	AutomaticActivityDetection *GeminiLiveActivityDetection `json:"automaticActivityDetection,omitempty"`
+}
+
+type GeminiLiveActivityDetection struct {
+	Disabled bool `json:"disabled"`
+}
+
+type GeminiLiveClientContent struct {
+	Turns        []GeminiChatContent `json:"turns,omitempty"`
+	TurnComplete bool                `json:"turnComplete"`
+}
+
+type GeminiLiveRealtimeInput struct {
+	Audio          *GeminiInlineData `json:"audio,omitempty"`
+	Text           string            `json:"text,omitempty"`
+	AudioStreamEnd bool              `json:"audioStreamEnd,omitempty"`
+	ActivityStart  *struct{}         `json:"activityStart,omitempty"`
+	ActivityEnd    *struct{}         `json:"activityEnd,omitempty"`
+}
+
+type GeminiLiveToolResponse struct {
+	FunctionResponses []GeminiLiveFunctionResponse `json:"functionResponses"`
+}
+
+type GeminiLiveFunctionResponse struct {
+	Id       string         `json:"id,omitempty"`
+	Name     string         `json:"name"`
+	Response map[string]any `json:"response"`
+}
+
+type GeminiLiveServerMessage struct {
+	SetupComplete        *struct{}                       `json:"setupComplete,omitempty"`
+	ServerContent        *GeminiLiveServerContent        `json:"serverContent,omitempty"`
+	ToolCall             *GeminiLiveToolCall             `json:"toolCall,omitempty"`
+	ToolCallCancellation *GeminiLiveToolCallCancellation `json:"toolCallCancellation,omitempty"`
+	UsageMetadata        *GeminiLiveUsageMetadata        `json:"usageMetadata,omitempty"`
+	GoAway               *struct {
+		TimeLeft string `json:"timeLeft"`
+	} `json:"goAway,omitempty"`
+	Error *GeminiLiveError `json:"error,omitempty"`
+}
+
+type GeminiLiveServerContent struct {
+	ModelTurn           *GeminiChatContent       `json:"modelTurn,omitempty"`
+	TurnComplete        bool                     `json:"turnComplete,omitempty"`
+	GenerationComplete  bool                     `json:"generationComplete,omitempty"`
+	Interrupted         bool                     `json:"interrupted,omitempty"`
+	InputTranscription  *GeminiLiveTranscription `json:"inputTranscription,omitempty"`
+	OutputTranscription *GeminiLiveTranscription `json:"outputTranscription,omitempty"`
+}
+
+type GeminiLiveTranscription struct {
+	Text string `json:"text"`
+}
+
+type GeminiLiveToolCall struct {
+	FunctionCalls []GeminiLiveFunctionCall `json:"functionCalls"`
+}
+
+type GeminiLiveFunctionCall struct {
+	Id   string         `json:"id"`
+	Name string         `json:"name"`
+	Args map[string]any `json:"args"`
+}
+
+type GeminiLiveToolCallCancellation struct {
+	Ids []string `json:"ids"`
+}
+
+type GeminiLiveUsageMetadata struct {
+	PromptTokenCount        int                         `json:"promptTokenCount"`
+	ResponseTokenCount      int                         `json:"responseTokenCount"`
+	TotalTokenCount         int                         `json:"totalTokenCount"`
+	CachedContentTokenCount int                         `json:"cachedContentTokenCount"`
+	ThoughtsTokenCount      int                         `json:"thoughtsTokenCount"`
+	PromptTokensDetails     []GeminiPromptTokensDetails `json:"promptTokensDetails"`
+	ResponseTokensDetails   []GeminiPromptTokensDetails `json:"responseTokensDetails"`
+}
+
+type GeminiLiveError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Status  string `json:"status"`
+}
@@ -153,6 +153,11 @@ func (i *ImageRequest) GetTokenCountMeta() *types.TokenCountMeta {
 		CombineText:     i.Prompt,
 		MaxTokens:       1584,
 		ImagePriceRatio: sizeRatio * qualityRatio * float64(i.N),
+		Media: &types.MediaParams{
+			Size:    i.Size,
+			Quality: i.Quality,
+			Count:   int(i.N),
+		},
 	}
 }
 
@@ -230,6 +230,8 @@ type Usage struct {
 	InputTokens            int                `json:"input_tokens"`
 	OutputTokens           int                `json:"output_tokens"`
 	InputTokensDetails     *InputTokenDetails `json:"input_tokens_details"`
+	// Responses API 的输出明细，含 reasoning_tokens
+	OutputTokensDetails *OutputTokenDetails `json:"output_tokens_details,omitempty"`
 
 	// claude cache 1h
 	ClaudeCacheCreation5mTokens int `json:"claude_cache_creation_5_m_tokens"`
@@ -239,6 +241,17 @@ type Usage struct {
 	Cost any `json:"cost,omitempty"`
 }
 
+// ReasoningTokenCount 兼容 Chat Completions 的 completion_tokens_details 与 Responses API 的 output_tokens_details
+func (u *Usage) ReasoningTokenCount() int {
+	if u.CompletionTokenDetails.ReasoningTokens != 0 {
+		return u.CompletionTokenDetails.ReasoningTokens
+	}
+	if u.OutputTokensDetails != nil {
+		return u.OutputTokensDetails.ReasoningTokens
+	}
+	return 0
+}
+
 type OpenAIVideoResponse struct {
 	Id        string `json:"id" example:"file-abc123"`
 	Object    string `json:"object" example:"file"`
@@ -359,11 +372,16 @@ type ResponsesReasoningSummaryPart struct {
 
 const (
 	BuildInToolWebSearchPreview = "web_search_preview"
+	BuildInToolWebSearch        = "web_search"
 	BuildInToolFileSearch       = "file_search"
+	BuildInToolCodeInterpreter  = "code_interpreter"
+	BuildInToolClaudeWebSearch  = "claude_web_search" // 仅用于计费配置，对应 Claude server_tool_use.web_search_requests
 )
 
 const (
-	BuildInCallWebSearchCall = "web_search_call"
+	BuildInCallWebSearchCall       = "web_search_call"
+	BuildInCallFileSearchCall      = "file_search_call"
+	BuildInCallCodeInterpreterCall = "code_interpreter_call"
 )
 
 const (
@@ -48,6 +48,16 @@ func main() {
 		return
 	}
 
+	if *common.MigrateChannelKeys {
+		count, err := model.MigrateChannelKeys()
+		_ = model.CloseDB()
+		if err != nil {
+			common.FatalLog("failed to migrate channel keys: " + err.Error())
+		}
+		common.SysLog(fmt.Sprintf("migrated %d channel keys", count))
+		return
+	}
+
 	common.SysLog("New API " + common.Version + " started")
 	if os.Getenv("GIN_MODE") != "debug" {
 		gin.SetMode(gin.ReleaseMode)
@@ -111,6 +121,9 @@ func main() {
 	// Subscription quota reset task (daily/weekly/monthly/custom)
 	service.StartSubscriptionQuotaResetTask()
 
+	// Credit account monthly invoicing and overdue suspension
+	service.StartInvoiceTask()
+
 	if common.IsMasterNode && constant.UpdateTask {
 		gopool.Go(func() {
 			controller.UpdateMidjourneyTaskBulk()
@@ -283,7 +283,14 @@ func TokenAuth() func(c *gin.Context) {
 			parts = strings.Split(key, "-")
 			key = parts[0]
 		}
-		token, err := model.ValidateUserToken(key)
+		var token *model.Token
+		var clientToken *model.ClientToken
+		var err error
+		if model.IsClientTokenKey(key) {
+			clientToken, token, err = model.ValidateClientToken(key)
+		} else {
+			token, err = model.ValidateUserToken(key)
+		}
 		if token != nil {
 			id := c.GetInt("id")
 			if id == 0 {
@@ -324,6 +331,14 @@ func TokenAuth() func(c *gin.Context) {
 
 		userCache.WriteContext(c)
 
+		// 组织令牌：令牌创建者必须仍是组织成员且组织未被禁用
+		if token.OrgId != 0 {
+			if err := checkOrganizationToken(token); err != nil {
+				abortWithOpenAiMessage(c, http.StatusForbidden, err.Error())
+				return
+			}
+		}
+
 		userGroup := userCache.Group
 		tokenGroup := token.Group
 		if tokenGroup != "" {
@@ -343,14 +358,54 @@ func TokenAuth() func(c *gin.Context) {
 		}
 		common.SetContextKey(c, constant.ContextKeyUsingGroup, userGroup)
 
-		err = SetupContextForToken(c, token, parts...)
+		scope, known := requiredTokenScope(c.Request.Method, c.Request.URL.Path)
+		if !known && token.Scopes != "" {
+			abortWithOpenAiMessage(c, http.StatusForbidden, "该令牌无权访问此接口", types.ErrorCodeAccessDenied)
+			return
+		}
+		if !token.HasScope(scope) {
+			abortWithOpenAiMessage(c, http.StatusForbidden, fmt.Sprintf("该令牌无权访问此接口，需要权限: %s", scope), types.ErrorCodeAccessDenied)
+			return
+		}
+
+		if clientToken != nil {
+			// 客户端令牌发放给终端用户，不能继承父令牌的指定渠道权限
+			err = SetupContextForToken(c, token)
+		} else {
+			err = SetupContextForToken(c, token, parts...)
+		}
 		if err != nil {
 			return
 		}
+		if clientToken != nil {
+			setupContextForClientToken(c, clientToken, key)
+		}
 		c.Next()
 	}
 }
 
+// setupContextForClientToken 客户端令牌沿用父令牌的上下文，可用模型取父令牌与客户端令牌限制的交集
+func setupContextForClientToken(c *gin.Context, clientToken *model.ClientToken, key string) {
+	c.Set("token_key", key)
+	common.SetContextKey(c, constant.ContextKeyClientTokenId, clientToken.Id)
+	common.SetContextKey(c, constant.ContextKeyClientTokenEndUserId, clientToken.EndUserId)
+	models := clientToken.GetModelList()
+	if len(models) == 0 {
+		return
+	}
+	parentLimitEnabled := c.GetBool("token_model_limit_enabled")
+	parentLimit, _ := c.Get("token_model_limit")
+	parentModels, _ := parentLimit.(map[string]bool)
+	limit := make(map[string]bool, len(models))
+	for _, m := range models {
+		if !parentLimitEnabled || parentModels[m] {
+			limit[m] = true
+		}
+	}
+	c.Set("token_model_limit_enabled", true)
+	c.Set("token_model_limit", limit)
+}
+
 func SetupContextForToken(c *gin.Context, token *model.Token, parts ...string) error {
 	if token == nil {
 		return fmt.Errorf("token is nil")
@@ -371,6 +426,9 @@ func SetupContextForToken(c *gin.Context, token *model.Token, parts ...string) e
 	}
 	common.SetContextKey(c, constant.ContextKeyTokenGroup, token.Group)
 	common.SetContextKey(c, constant.ContextKeyTokenCrossGroupRetry, token.CrossGroupRetry)
+	common.SetContextKey(c, constant.ContextKeyTokenOrgId, token.OrgId)
+	common.SetContextKey(c, constant.ContextKeyTokenBudgetEnabled, token.HasBudget())
+	common.SetContextKey(c, constant.ContextKeyTokenMaxTokens, token.MaxTokens)
 	if len(parts) > 1 {
 		if model.IsAdmin(token.UserId) {
 			c.Set("specific_channel_id", parts[1])
@@ -382,3 +440,15 @@ func SetupContextForToken(c *gin.Context, token *model.Token, parts ...string) e
 	}
 	return nil
 }
+
+func checkOrganizationToken(token *model.Token) error {
+	org, err := model.GetOrganizationById(token.OrgId)
+	if err != nil || org.Status != common.UserStatusEnabled {
+		return fmt.Errorf("令牌所属组织不可用")
+	}
+	member, err := model.GetOrganizationMember(token.OrgId, token.UserId)
+	if err != nil || !member.CanUseTokens() {
+		return fmt.Errorf("令牌创建者已不是组织成员")
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package middleware
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	relayconstant "github.com/QuantumNous/new-api/relay/constant"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/sjson"
+)
+
+// tokenScopeFreePaths 无需令牌权限即可访问的接口前缀
+var tokenScopeFreePaths = []string{
+	"/dashboard/billing/",
+	"/v1/dashboard/billing/",
+	"/v1/client_tokens",
+}
+
+// requiredTokenScope 根据请求路径和方法返回访问该接口所需的令牌权限，返回空表示无需校验；
+// ok 为 false 表示接口未归类，设置了权限范围的令牌一律拒绝
+func requiredTokenScope(method string, path string) (scope string, ok bool) {
+	for _, prefix := range tokenScopeFreePaths {
+		if strings.HasPrefix(path, prefix) {
+			return "", true
+		}
+	}
+	// 模型列表与模型详情
+	if method == http.MethodGet && !strings.Contains(path, ":") &&
+		(strings.HasPrefix(path, "/v1/models") || strings.HasPrefix(path, "/v1beta/models") || strings.HasPrefix(path, "/v1beta/openai/models")) {
+		return model.TokenScopeModelsRead, true
+	}
+	// 异步任务：Midjourney、Suno、视频
+	if strings.Contains(path, "/mj/") || strings.HasPrefix(path, "/mj") || strings.HasPrefix(path, "/suno") ||
+		strings.HasPrefix(path, "/v1/videos") || strings.HasPrefix(path, "/v1/video/") ||
+		strings.HasPrefix(path, "/kling/") || strings.HasPrefix(path, "/jimeng") {
+		return model.TokenScopeTasks, true
+	}
+	if strings.HasPrefix(path, "/v1/messages") {
+		return model.TokenScopeChat, true
+	}
+	switch relayconstant.Path2RelayMode(path) {
+	case relayconstant.RelayModeChatCompletions, relayconstant.RelayModeCompletions,
+		relayconstant.RelayModeResponses, relayconstant.RelayModeResponsesCompact,
+		relayconstant.RelayModeEdits, relayconstant.RelayModeModerations:
+		return model.TokenScopeChat, true
+	case relayconstant.RelayModeEmbeddings, relayconstant.RelayModeRerank:
+		return model.TokenScopeEmbeddings, true
+	case relayconstant.RelayModeImagesGenerations, relayconstant.RelayModeImagesEdits:
+		return model.TokenScopeImages, true
+	case relayconstant.RelayModeAudioSpeech, relayconstant.RelayModeAudioTranscription, relayconstant.RelayModeAudioTranslation:
+		return model.TokenScopeAudio, true
+	case relayconstant.RelayModeRealtime:
+		return model.TokenScopeRealtime, true
+	case relayconstant.RelayModeGemini:
+		if strings.HasSuffix(path, "embedContent") || strings.HasSuffix(path, "batchEmbedContents") {
+			return model.TokenScopeEmbeddings, true
+		}
+		if strings.HasSuffix(path, ":predict") || strings.HasSuffix(path, ":predictLongRunning") {
+			return model.TokenScopeImages, true
+		}
+		return model.TokenScopeChat, true
+	}
+	return "", false
+}
+
+// maxTokensRequest 用于读取各格式请求中的输出长度上限
+type maxTokensRequest struct {
+	MaxTokens           int `json:"max_tokens"`
+	MaxCompletionTokens int `json:"max_completion_tokens"`
+	MaxOutputTokens     int `json:"max_output_tokens"`
+	GenerationConfig    *struct {
+		MaxOutputTokens int `json:"maxOutputTokens"`
+	} `json:"generationConfig"`
+}
+
+func (r *maxTokensRequest) requested() int {
+	requested := max(r.MaxTokens, r.MaxCompletionTokens, r.MaxOutputTokens)
+	if r.GenerationConfig != nil {
+		requested = max(requested, r.GenerationConfig.MaxOutputTokens)
+	}
+	return requested
+}
+
+// checkTokenMaxTokens 校验请求的输出长度上限不超过令牌允许的上限。
+// 文本生成接口未指定上限时按令牌上限写入请求体，请求体无法解析时拒绝
+func checkTokenMaxTokens(c *gin.Context, limit int) error {
+	if limit <= 0 {
+		return nil
+	}
+	scope, _ := requiredTokenScope(c.Request.Method, c.Request.URL.Path)
+	generation := scope == model.TokenScopeChat && c.Request.Method == http.MethodPost
+	if !strings.Contains(c.Request.Header.Get("Content-Type"), "application/json") {
+		if generation {
+			return fmt.Errorf("令牌限制了 max_tokens 上限 %d，仅支持 JSON 请求", limit)
+		}
+		return nil
+	}
+	var req maxTokensRequest
+	if err := common.UnmarshalBodyReusable(c, &req); err != nil {
+		return fmt.Errorf("无法解析请求中的 max_tokens: %v", err)
+	}
+	requested := req.requested()
+	if requested > limit {
+		return fmt.Errorf("请求的 max_tokens %d 超过令牌允许的上限 %d", requested, limit)
+	}
+	if requested <= 0 && generation {
+		return setRequestMaxTokens(c, limit)
+	}
+	return nil
+}
+
+// setRequestMaxTokens 按请求格式把输出长度上限写入请求体
+func setRequestMaxTokens(c *gin.Context, limit int) error {
+	field := "max_tokens"
+	switch relayconstant.Path2RelayMode(c.Request.URL.Path) {
+	case relayconstant.RelayModeGemini:
+		field = "generationConfig.maxOutputTokens"
+	case relayconstant.RelayModeResponses:
+		field = "max_output_tokens"
+	}
+	storage, err := common.GetBodyStorage(c)
+	if err != nil {
+		return err
+	}
+	body, err := storage.Bytes()
+	if err != nil {
+		return err
+	}
+	body, err = sjson.SetBytes(body, field, limit)
+	if err != nil {
+		return fmt.Errorf("无法写入 max_tokens: %v", err)
+	}
+	newStorage, err := common.CreateBodyStorage(body)
+	if err != nil {
+		return err
+	}
+	_ = storage.Close()
+	c.Set(common.KeyBodyStorage, newStorage)
+	c.Request.Body = io.NopCloser(newStorage)
+	c.Request.ContentLength = int64(len(body))
+	return nil
+}
@@ -0,0 +1,108 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/QuantumNous/new-api/model"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+func TestRequiredTokenScope(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		method string
+		path   string
+		scope  string
+		known  bool
+	}{
+		{http.MethodGet, "/v1/models", model.TokenScopeModelsRead, true},
+		{http.MethodGet, "/v1beta/models", model.TokenScopeModelsRead, true},
+		{http.MethodPost, "/v1/chat/completions", model.TokenScopeChat, true},
+		{http.MethodPost, "/v1/messages", model.TokenScopeChat, true},
+		{http.MethodPost, "/v1/responses", model.TokenScopeChat, true},
+		{http.MethodPost, "/v1beta/models/gemini-2.0-flash:generateContent", model.TokenScopeChat, true},
+		{http.MethodPost, "/v1beta/models/text-embedding-004:embedContent", model.TokenScopeEmbeddings, true},
+		{http.MethodPost, "/v1/embeddings", model.TokenScopeEmbeddings, true},
+		{http.MethodPost, "/v1/rerank", model.TokenScopeEmbeddings, true},
+		{http.MethodPost, "/v1/images/generations", model.TokenScopeImages, true},
+		{http.MethodPost, "/v1/audio/speech", model.TokenScopeAudio, true},
+		{http.MethodGet, "/v1/realtime", model.TokenScopeRealtime, true},
+		{http.MethodPost, "/mj/submit/imagine", model.TokenScopeTasks, true},
+		{http.MethodPost, "/suno/submit/music", model.TokenScopeTasks, true},
+		{http.MethodPost, "/v1/video/generations", model.TokenScopeTasks, true},
+		{http.MethodGet, "/v1/dashboard/billing/usage", "", true},
+		{http.MethodPost, "/v1/client_tokens", "", true},
+		// 未归类的接口只允许未设置权限范围的令牌访问
+		{http.MethodGet, "/v1/files", "", false},
+		{http.MethodPost, "/v1/fine-tunes", "", false},
+	}
+	for _, tc := range cases {
+		scope, known := requiredTokenScope(tc.method, tc.path)
+		require.Equal(t, tc.scope, scope, tc.path)
+		require.Equal(t, tc.known, known, tc.path)
+	}
+
+	token := &model.Token{Scopes: "chat,models:read"}
+	require.True(t, token.HasScope(model.TokenScopeChat))
+	require.False(t, token.HasScope(model.TokenScopeImages))
+	require.True(t, token.HasScope(""))
+
+	scopes, unknown := model.NormalizeTokenScopes(" Chat, images ,chat,foo")
+	require.Equal(t, "chat,images", scopes)
+	require.Equal(t, []string{"foo"}, unknown)
+}
+
+func newMaxTokensTestContext(path string, contentType string, body string) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	c.Request.Header.Set("Content-Type", contentType)
+	return c
+}
+
+func TestCheckTokenMaxTokens(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	c := newMaxTokensTestContext("/v1/chat/completions", "application/json", `{"model":"gpt-4o","max_tokens":2048}`)
+	require.ErrorContains(t, checkTokenMaxTokens(c, 1024), "2048")
+
+	c = newMaxTokensTestContext("/v1/chat/completions", "application/json", `{"model":"gpt-4o","max_completion_tokens":512}`)
+	require.NoError(t, checkTokenMaxTokens(c, 1024))
+
+	// 未指定上限时按令牌上限写入请求体
+	cases := []struct {
+		path  string
+		body  string
+		field string
+	}{
+		{"/v1/chat/completions", `{"model":"gpt-4o"}`, "max_tokens"},
+		{"/v1/responses", `{"model":"gpt-4o","input":"hi"}`, "max_output_tokens"},
+		{"/v1beta/models/gemini-2.0-flash:generateContent", `{"contents":[]}`, "generationConfig.maxOutputTokens"},
+	}
+	for _, tc := range cases {
+		c = newMaxTokensTestContext(tc.path, "application/json", tc.body)
+		require.NoError(t, checkTokenMaxTokens(c, 1024), tc.path)
+		body, err := io.ReadAll(c.Request.Body)
+		require.NoError(t, err)
+		require.Equal(t, int64(1024), gjson.GetBytes(body, tc.field).Int(), tc.path)
+	}
+
+	// 非文本生成接口不写入
+	c = newMaxTokensTestContext("/v1/embeddings", "application/json", `{"model":"text-embedding-3-small","input":"hi"}`)
+	require.NoError(t, checkTokenMaxTokens(c, 1024))
+	body, err := io.ReadAll(c.Request.Body)
+	require.NoError(t, err)
+	require.False(t, gjson.GetBytes(body, "max_tokens").Exists())
+
+	// 无法确认上限的请求直接拒绝
+	c = newMaxTokensTestContext("/v1/chat/completions", "application/json", `{"model":"gpt-4o","max_tokens":"all"}`)
+	require.Error(t, checkTokenMaxTokens(c, 1024))
+	c = newMaxTokensTestContext("/v1/chat/completions", "multipart/form-data; boundary=x", "--x--")
+	require.Error(t, checkTokenMaxTokens(c, 1024))
+}
@@ -55,6 +55,11 @@ type Channel struct {
 
 	// cache info
 	Keys []string `json:"-" gorm:"-"`
+
+	// 写入数据库期间暂存的明文密钥，见 BeforeSave
+	plainKey string
+	// 无法解密的密钥密文，Key 置空后保存渠道时写回原密文，见 AfterFind
+	undecryptableKey string
 }
 
 type ChannelInfo struct {
@@ -521,7 +526,9 @@ func (channel *Channel) UpdateBalance(balance float64) {
 	}).Error
 	if err != nil {
 		common.SysLog(fmt.Sprintf("failed to update balance: channel_id=%d, error=%v", channel.Id, err))
+		return
 	}
+	RecordChannelBalance(channel.Id, balance)
 }
 
 func (channel *Channel) Delete() error {
@@ -0,0 +1,133 @@
+package model
+
+import (
+	"fmt"
+
+	"github.com/QuantumNous/new-api/common"
+)
+
+// 余额降级时记录的原优先级
+const channelBalanceOriginalPriorityKey = "balance_original_priority"
+
+// ChannelBalanceHistoryRetention 余额历史保留时长（秒）
+const ChannelBalanceHistoryRetention = 90 * 24 * 3600
+
+// ChannelBalanceHistory 渠道余额快照，每次刷新余额时记录一条，用于预测上游账户耗尽时间
+type ChannelBalanceHistory struct {
+	Id          int     `json:"id"`
+	ChannelId   int     `json:"channel_id" gorm:"index:idx_channel_balance_channel_time,priority:1"`
+	Balance     float64 `json:"balance"`
+	CreatedTime int64   `json:"created_time" gorm:"bigint;index:idx_channel_balance_channel_time,priority:2;index"`
+}
+
+// ChannelBalanceForecast 根据余额历史估算的消耗速度与耗尽时间
+type ChannelBalanceForecast struct {
+	Balance            float64 `json:"balance"`
+	DailyBurn          float64 `json:"daily_burn"`           // 每天消耗的余额，充值引起的上涨不计入
+	DaysLeft           float64 `json:"days_left"`            // 0 表示无法估算
+	EstimatedEmptyTime int64   `json:"estimated_empty_time"` // 0 表示无法估算
+}
+
+func RecordChannelBalance(channelId int, balance float64) {
+	history := &ChannelBalanceHistory{
+		ChannelId:   channelId,
+		Balance:     balance,
+		CreatedTime: common.GetTimestamp(),
+	}
+	if err := DB.Create(history).Error; err != nil {
+		common.SysLog(fmt.Sprintf("failed to record channel balance: channel_id=%d, error=%v", channelId, err))
+	}
+}
+
+// GetChannelBalanceHistory 按时间升序返回 startTime 之后的余额历史
+func GetChannelBalanceHistory(channelId int, startTime int64) ([]*ChannelBalanceHistory, error) {
+	var histories []*ChannelBalanceHistory
+	err := DB.Where("channel_id = ? AND created_time >= ?", channelId, startTime).
+		Order("created_time asc, id asc").Find(&histories).Error
+	return histories, err
+}
+
+func DeleteChannelBalanceHistoryBefore(timestamp int64) (int64, error) {
+	result := DB.Where("created_time < ?", timestamp).Delete(&ChannelBalanceHistory{})
+	return result.RowsAffected, result.Error
+}
+
+// ForecastChannelBalance 以历史中的余额下降量计算平均每日消耗，充值（余额上涨）不计入消耗但保留其时间跨度
+func ForecastChannelBalance(histories []*ChannelBalanceHistory) ChannelBalanceForecast {
+	forecast := ChannelBalanceForecast{}
+	if len(histories) == 0 {
+		return forecast
+	}
+	last := histories[len(histories)-1]
+	forecast.Balance = last.Balance
+	if len(histories) < 2 {
+		return forecast
+	}
+	span := last.CreatedTime - histories[0].CreatedTime
+	if span <= 0 {
+		return forecast
+	}
+	consumed := 0.0
+	for i := 1; i < len(histories); i++ {
+		if diff := histories[i-1].Balance - histories[i].Balance; diff > 0 {
+			consumed += diff
+		}
+	}
+	if consumed <= 0 {
+		return forecast
+	}
+	forecast.DailyBurn = consumed / float64(span) * 86400
+	if last.Balance <= 0 {
+		forecast.EstimatedEmptyTime = last.CreatedTime
+		return forecast
+	}
+	forecast.DaysLeft = last.Balance / forecast.DailyBurn
+	forecast.EstimatedEmptyTime = last.CreatedTime + int64(forecast.DaysLeft*86400)
+	return forecast
+}
+
+// IsPriorityLoweredByBalance 渠道优先级是否因余额不足被降低
+func (channel *Channel) IsPriorityLoweredByBalance() bool {
+	_, ok := channel.GetOtherInfo()[channelBalanceOriginalPriorityKey]
+	return ok
+}
+
+// LowerChannelPriorityByBalance 余额不足时将渠道优先级降为 priority，原优先级记录在 OtherInfo 中以便恢复
+func LowerChannelPriorityByBalance(channelId int, priority int64) (bool, error) {
+	channel, err := GetChannelById(channelId, true)
+	if err != nil {
+		return false, err
+	}
+	info := channel.GetOtherInfo()
+	if _, ok := info[channelBalanceOriginalPriorityKey]; ok {
+		return false, nil
+	}
+	info[channelBalanceOriginalPriorityKey] = channel.GetPriority()
+	channel.SetOtherInfo(info)
+	return true, saveChannelPriority(channel, priority)
+}
+
+// RestoreChannelPriorityByBalance 余额恢复后还原被降低的优先级
+func RestoreChannelPriorityByBalance(channelId int) (bool, error) {
+	channel, err := GetChannelById(channelId, true)
+	if err != nil {
+		return false, err
+	}
+	info := channel.GetOtherInfo()
+	original, ok := info[channelBalanceOriginalPriorityKey]
+	if !ok {
+		return false, nil
+	}
+	delete(info, channelBalanceOriginalPriorityKey)
+	channel.SetOtherInfo(info)
+	priority, _ := original.(float64)
+	return true, saveChannelPriority(channel, int64(priority))
+}
+
+func saveChannelPriority(channel *Channel, priority int64) error {
+	channel.Priority = &priority
+	if err := channel.SaveWithoutKey(); err != nil {
+		return err
+	}
+	return DB.Model(&Ability{}).Where("channel_id = ?", channel.Id).Update("priority", priority).Error
+}
@@ -0,0 +1,31 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestForecastChannelBalance(t *testing.T) {
+	require.Zero(t, ForecastChannelBalance(nil).DailyBurn)
+
+	day := int64(86400)
+	histories := []*ChannelBalanceHistory{
+		{Balance: 100, CreatedTime: 0},
+		{Balance: 90, CreatedTime: day},
+		{Balance: 150, CreatedTime: 2 * day}, // 充值不计入消耗
+		{Balance: 130, CreatedTime: 3 * day},
+	}
+	forecast := ForecastChannelBalance(histories)
+	require.Equal(t, float64(130), forecast.Balance)
+	require.InDelta(t, 10, forecast.DailyBurn, 1e-9)
+	require.InDelta(t, 13, forecast.DaysLeft, 1e-9)
+	require.Equal(t, 16*day, forecast.EstimatedEmptyTime)
+
+	flat := ForecastChannelBalance([]*ChannelBalanceHistory{
+		{Balance: 50, CreatedTime: 0},
+		{Balance: 60, CreatedTime: day},
+	})
+	require.Zero(t, flat.DailyBurn)
+	require.Zero(t, flat.EstimatedEmptyTime)
+}
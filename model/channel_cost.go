@@ -0,0 +1,120 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+)
+
+// GetCostRatio 返回渠道上游成本相对于本站模型价格的比例：模型级配置 > 渠道配置 > 标签配置，均未配置时返回 false
+func (channel *Channel) GetCostRatio(modelName string) (float64, bool) {
+	setting := channel.GetOtherSettings()
+	if ratio, ok := setting.CostModelRatio[modelName]; ok && ratio >= 0 {
+		return ratio, true
+	}
+	if ratio, ok := setting.CostModelRatio[ratio_setting.FormatMatchingModelName(modelName)]; ok && ratio >= 0 {
+		return ratio, true
+	}
+	if setting.CostRatio != nil && *setting.CostRatio >= 0 {
+		return *setting.CostRatio, true
+	}
+	return ratio_setting.GetChannelTagCostRatio(channel.GetTag())
+}
+
+// ChannelCostReportItem 按渠道、模型、日期汇总的收入与上游成本，金额单位均为额度
+type ChannelCostReportItem struct {
+	ChannelId   int    `json:"channel_id"`
+	ChannelName string `json:"channel_name" gorm:"-"`
+	ModelName   string `json:"model_name"`
+	Day         int64  `json:"day"` // 当日零点的时间戳
+	Count       int64  `json:"count"`
+	Revenue     int64  `json:"revenue"`
+	Cost        int64  `json:"cost"`
+	Margin      int64  `json:"margin" gorm:"-"`
+}
+
+type ChannelCostReportQuery struct {
+	StartTimestamp int64
+	EndTimestamp   int64
+	ChannelId      int
+	ModelName      string
+	GroupBy        []string // channel / model / day，为空时按渠道汇总
+	UtcOffset      int      // 按天汇总时所用时区相对 UTC 的分钟数
+}
+
+// GetChannelCostReport 从消费日志汇总收入、上游成本与毛利
+func GetChannelCostReport(query ChannelCostReportQuery) (items []*ChannelCostReportItem, err error) {
+	if query.UtcOffset < -12*60 || query.UtcOffset > 14*60 {
+		return nil, errors.New("无效的时区")
+	}
+	if len(query.GroupBy) == 0 {
+		query.GroupBy = []string{"channel"}
+	}
+	fields := []string{"count(*) as count", "sum(quota) as revenue", "sum(upstream_cost) as cost"}
+	var groups []string
+	var orders []string
+	for _, dimension := range query.GroupBy {
+		switch strings.TrimSpace(dimension) {
+		case "channel":
+			groups = append(groups, "channel_id")
+		case "model":
+			groups = append(groups, "model_name")
+		case "day":
+			// 时区偏移为校验过的整数，直接拼入表达式以便 SELECT 与 GROUP BY 使用同一表达式
+			dayExpr := fmt.Sprintf("(created_at - (created_at + %d) %% 86400)", query.UtcOffset*60)
+			fields = append(fields, dayExpr+" as day")
+			groups = append(groups, dayExpr)
+			orders = append(orders, dayExpr)
+		default:
+			return nil, fmt.Errorf("不支持的汇总维度 %s", dimension)
+		}
+	}
+	for _, group := range groups {
+		if group == "channel_id" || group == "model_name" {
+			fields = append(fields, group)
+		}
+	}
+
+	tx := LOG_DB.Table("logs").Select(strings.Join(fields, ", ")).Where("type = ?", LogTypeConsume)
+	if query.StartTimestamp != 0 {
+		tx = tx.Where("created_at >= ?", query.StartTimestamp)
+	}
+	if query.EndTimestamp != 0 {
+		tx = tx.Where("created_at <= ?", query.EndTimestamp)
+	}
+	if query.ChannelId != 0 {
+		tx = tx.Where("channel_id = ?", query.ChannelId)
+	}
+	if query.ModelName != "" {
+		tx = tx.Where("model_name = ?", query.ModelName)
+	}
+	orders = append(orders, "revenue desc")
+	if err = tx.Group(strings.Join(groups, ", ")).Order(strings.Join(orders, ", ")).Scan(&items).Error; err != nil {
+		common.SysError("failed to query channel cost report: " + err.Error())
+		return nil, errors.New("查询成本报表失败")
+	}
+
+	channelIds := make([]int, 0, len(items))
+	for _, item := range items {
+		item.Margin = item.Revenue - item.Cost
+		if item.ChannelId != 0 {
+			channelIds = append(channelIds, item.ChannelId)
+		}
+	}
+	if len(channelIds) > 0 {
+		var channels []*Channel
+		if err := DB.Select("id", "name").Where("id IN ?", channelIds).Find(&channels).Error; err == nil {
+			names := make(map[int]string, len(channels))
+			for _, channel := range channels {
+				names[channel.Id] = channel.Name
+			}
+			for _, item := range items {
+				item.ChannelName = names[item.ChannelId]
+			}
+		}
+	}
+	return items, nil
+}
@@ -0,0 +1,136 @@
+package model
+
+import (
+	"fmt"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+)
+
+// 渠道密钥在数据库中以信封加密存储（配置主密钥时），读取时在 AfterFind 中透明解密，
+// 写入时在 BeforeSave 中加密、AfterSave 中恢复内存中的明文
+
+// channelKeyWritten 本次写入是否包含 key 列
+func channelKeyWritten(tx *gorm.DB) bool {
+	for _, column := range tx.Statement.Omits {
+		if column == "key" || column == "Key" {
+			return false
+		}
+	}
+	if len(tx.Statement.Selects) == 0 {
+		return true
+	}
+	for _, column := range tx.Statement.Selects {
+		if column == "*" || column == "key" || column == "Key" {
+			return true
+		}
+	}
+	return false
+}
+
+// channelKeyDecryptFailedReason 密钥无法解密时渠道的状态原因
+const channelKeyDecryptFailedReason = "failed to decrypt channel key"
+
+func (channel *Channel) BeforeSave(tx *gorm.DB) error {
+	if channel.Key == "" && channel.undecryptableKey != "" {
+		// 无法解密的渠道保存时保留原密文，避免覆盖为空
+		channel.Key = channel.undecryptableKey
+		return nil
+	}
+	if !common.SecretEncryptionEnabled() || !channelKeyWritten(tx) {
+		return nil
+	}
+	// DB.Model(&Channel{}).Update("key", value) 形式的更新
+	if values, ok := tx.Statement.Dest.(map[string]interface{}); ok {
+		if key, ok := values["key"].(string); ok {
+			encrypted, err := common.EncryptSecret(key)
+			if err != nil {
+				return fmt.Errorf("failed to encrypt channel key: %w", err)
+			}
+			values["key"] = encrypted
+		}
+		return nil
+	}
+	if channel.Key == "" || common.IsEncryptedSecret(channel.Key) {
+		return nil
+	}
+	encrypted, err := common.EncryptSecret(channel.Key)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt channel key: %w", err)
+	}
+	channel.plainKey = channel.Key
+	channel.Key = encrypted
+	return nil
+}
+
+func (channel *Channel) AfterSave(tx *gorm.DB) error {
+	if channel.undecryptableKey != "" && channel.Key == channel.undecryptableKey {
+		channel.Key = ""
+		return nil
+	}
+	if channel.plainKey != "" {
+		channel.Key = channel.plainKey
+		channel.plainKey = ""
+	}
+	return nil
+}
+
+func (channel *Channel) AfterFind(tx *gorm.DB) error {
+	if !common.IsEncryptedSecret(channel.Key) {
+		return nil
+	}
+	key, err := common.DecryptSecret(channel.Key)
+	if err != nil {
+		// 不中断查询，避免单个渠道无法解密导致渠道列表和缓存整体加载失败；
+		// 密钥置空并将渠道标记为自动禁用，避免把密文当作密钥发送到上游
+		common.SysError(fmt.Sprintf("failed to decrypt channel key: channel_id=%d, error=%v", channel.Id, err))
+		channel.undecryptableKey = channel.Key
+		channel.Key = ""
+		channel.Status = common.ChannelStatusAutoDisabled
+		info := channel.GetOtherInfo()
+		info["status_reason"] = channelKeyDecryptFailedReason
+		channel.SetOtherInfo(info)
+		return nil
+	}
+	channel.Key = key
+	return nil
+}
+
+// MigrateChannelKeys 将所有渠道密钥迁移到当前主密钥：加密明文密钥，轮换后重新加密旧主密钥加密的数据密钥；
+// 未配置当前主密钥时将密钥解密为明文。返回更新的渠道数量
+func MigrateChannelKeys() (int, error) {
+	type channelKeyRow struct {
+		Id  int
+		Key string
+	}
+	const batchSize = 100
+	migrated := 0
+	lastId := 0
+	for {
+		var rows []channelKeyRow
+		err := DB.Model(&Channel{}).Select("id", "key").Where("id > ?", lastId).
+			Order("id").Limit(batchSize).Find(&rows).Error
+		if err != nil {
+			return migrated, err
+		}
+		for _, row := range rows {
+			lastId = row.Id
+			key, changed, err := common.RewrapSecret(row.Key)
+			if err != nil {
+				return migrated, fmt.Errorf("channel %d: %w", row.Id, err)
+			}
+			if !changed {
+				continue
+			}
+			// UpdateColumn 不触发钩子，写入的即为迁移后的值
+			if err := DB.Model(&Channel{}).Where("id = ?", row.Id).UpdateColumn("key", key).Error; err != nil {
+				return migrated, fmt.Errorf("channel %d: %w", row.Id, err)
+			}
+			migrated++
+		}
+		if len(rows) < batchSize {
+			return migrated, nil
+		}
+	}
+}
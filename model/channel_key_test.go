@@ -0,0 +1,35 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChannelKeyDecryptFailure(t *testing.T) {
+	require.NoError(t, common.SetSecretMasterKeys("master-key-a"))
+	t.Cleanup(func() {
+		_ = common.SetSecretMasterKeys("")
+	})
+	encrypted, err := common.EncryptSecret("sk-upstream")
+	require.NoError(t, err)
+
+	channel := &Channel{Id: 1, Key: encrypted, Status: common.ChannelStatusEnabled}
+	require.NoError(t, channel.AfterFind(nil))
+	require.Equal(t, "sk-upstream", channel.Key)
+
+	// 主密钥丢失后渠道不可用，且不会把密文当作密钥
+	require.NoError(t, common.SetSecretMasterKeys("master-key-b"))
+	channel = &Channel{Id: 1, Key: encrypted, Status: common.ChannelStatusEnabled}
+	require.NoError(t, channel.AfterFind(nil))
+	require.Empty(t, channel.Key)
+	require.Equal(t, common.ChannelStatusAutoDisabled, channel.Status)
+	require.Equal(t, channelKeyDecryptFailedReason, channel.GetOtherInfo()["status_reason"])
+
+	// 保存时写回原密文
+	require.NoError(t, channel.BeforeSave(nil))
+	require.Equal(t, encrypted, channel.Key)
+	require.NoError(t, channel.AfterSave(nil))
+	require.Empty(t, channel.Key)
+}
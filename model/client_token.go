@@ -0,0 +1,198 @@
+package model
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"gorm.io/gorm"
+)
+
+// 客户端令牌：由持有正式令牌的后端签发给浏览器/移动端的短期子令牌，
+// 计费记在父令牌上，可限制可用模型、最大消费额度并携带终端用户标识。
+const (
+	ClientTokenKeyPrefix  = "ct_"
+	ClientTokenDefaultTTL = 3600
+	ClientTokenMaxTTL     = 86400
+)
+
+var ErrClientTokenQuotaExceeded = errors.New("client token quota exceeded")
+
+type ClientToken struct {
+	Id          int    `json:"id"`
+	TokenId     int    `json:"token_id" gorm:"index"`
+	UserId      int    `json:"user_id" gorm:"index"`
+	KeyHash     string `json:"-" gorm:"type:char(64);uniqueIndex"`
+	EndUserId   string `json:"end_user_id" gorm:"type:varchar(128);default:''"`
+	Models      string `json:"models" gorm:"type:varchar(1024);default:''"` // 逗号分隔，空表示沿用父令牌的模型限制
+	MaxQuota    int    `json:"max_quota" gorm:"default:0"`                  // 0 表示只受父令牌额度限制
+	UsedQuota   int    `json:"used_quota" gorm:"default:0"`
+	ExpiredTime int64  `json:"expired_time" gorm:"bigint;index"`
+	CreatedTime int64  `json:"created_time" gorm:"bigint"`
+}
+
+// 客户端令牌为 48 位随机字符，熵足够高，直接保存 sha256 即可按哈希查找
+func hashClientTokenKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// 客户端令牌缓存以 key 哈希为键，缓存时间不超过令牌有效期。
+// 缓存中的已用额度可能滞后，额度上限以预扣时数据库的条件更新为准
+func clientTokenCacheKey(keyHash string) string {
+	return "client_token:" + keyHash
+}
+
+func cacheSetClientToken(ct ClientToken) error {
+	expiration := time.Duration(common.RedisKeyCacheSeconds()) * time.Second
+	if remain := time.Duration(ct.ExpiredTime-common.GetTimestamp()) * time.Second; remain < expiration {
+		expiration = remain
+	}
+	if expiration <= 0 {
+		return nil
+	}
+	return common.RedisHSetObj(clientTokenCacheKey(ct.KeyHash), &ct, expiration)
+}
+
+func cacheGetClientToken(keyHash string) (*ClientToken, error) {
+	var ct ClientToken
+	if err := common.RedisHGetObj(clientTokenCacheKey(keyHash), &ct); err != nil {
+		return nil, err
+	}
+	return &ct, nil
+}
+
+func cacheDeleteClientToken(keyHash string) error {
+	return common.RedisDelKey(clientTokenCacheKey(keyHash))
+}
+
+func IsClientTokenKey(key string) bool {
+	return strings.HasPrefix(key, ClientTokenKeyPrefix)
+}
+
+// GetModelList 返回客户端令牌允许的模型，空表示不额外限制
+func (ct *ClientToken) GetModelList() []string {
+	models := make([]string, 0)
+	for _, m := range strings.Split(ct.Models, ",") {
+		m = strings.TrimSpace(m)
+		if m != "" {
+			models = append(models, m)
+		}
+	}
+	return models
+}
+
+// CreateClientToken 生成客户端令牌并返回明文 key，明文不落库
+func CreateClientToken(ct *ClientToken) (string, error) {
+	random, err := common.GenerateKey()
+	if err != nil {
+		return "", err
+	}
+	key := ClientTokenKeyPrefix + random
+	ct.KeyHash = hashClientTokenKey(key)
+	ct.CreatedTime = common.GetTimestamp()
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		// 顺带清理该父令牌下已过期的客户端令牌
+		if err := tx.Where("token_id = ? AND expired_time < ?", ct.TokenId, ct.CreatedTime).Delete(&ClientToken{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(ct).Error
+	})
+	if err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// ValidateClientToken 校验客户端令牌，返回客户端令牌及其父令牌
+func ValidateClientToken(key string) (*ClientToken, *Token, error) {
+	ct, err := getClientTokenByKeyHash(hashClientTokenKey(key))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, errors.New("无效的令牌")
+		}
+		return nil, nil, errors.New("无效的令牌，数据库查询出错，请联系管理员")
+	}
+	if ct.ExpiredTime < common.GetTimestamp() {
+		return nil, nil, errors.New("该令牌已过期")
+	}
+	if ct.MaxQuota > 0 && ct.UsedQuota >= ct.MaxQuota {
+		return nil, nil, errors.New("该令牌额度已用尽")
+	}
+	token, err := GetCachedTokenById(ct.TokenId)
+	if err != nil {
+		return nil, nil, errors.New("父令牌不存在")
+	}
+	if token.Status != common.TokenStatusEnabled ||
+		(token.ExpiredTime != -1 && token.ExpiredTime < common.GetTimestamp()) ||
+		(!token.UnlimitedQuota && token.RemainQuota <= 0) {
+		return nil, nil, errors.New("父令牌不可用")
+	}
+	return ct, token, nil
+}
+
+// getClientTokenByKeyHash 优先从缓存读取客户端令牌，未命中时查询数据库并异步写入缓存
+func getClientTokenByKeyHash(keyHash string) (*ClientToken, error) {
+	if common.RedisEnabled {
+		if ct, err := cacheGetClientToken(keyHash); err == nil {
+			return ct, nil
+		}
+	}
+	var ct ClientToken
+	if err := DB.Where("key_hash = ?", keyHash).First(&ct).Error; err != nil {
+		return nil, err
+	}
+	if common.RedisEnabled {
+		gopool.Go(func() {
+			if err := cacheSetClientToken(ct); err != nil {
+				common.SysLog("failed to update client token cache: " + err.Error())
+			}
+		})
+	}
+	return &ct, nil
+}
+
+// RevokeClientToken 吊销父令牌签发的客户端令牌并清除缓存
+func RevokeClientToken(tokenId int, id int) error {
+	var ct ClientToken
+	if err := DB.Where("id = ? AND token_id = ?", id, tokenId).First(&ct).Error; err != nil {
+		return err
+	}
+	if err := DB.Delete(&ct).Error; err != nil {
+		return err
+	}
+	if common.RedisEnabled {
+		if err := cacheDeleteClientToken(ct.KeyHash); err != nil {
+			common.SysLog("failed to delete client token cache: " + err.Error())
+		}
+	}
+	return nil
+}
+
+// PreConsumeClientTokenQuota 预扣客户端令牌额度，超过 max_quota 时返回 ErrClientTokenQuotaExceeded
+func PreConsumeClientTokenQuota(id int, quota int) error {
+	res := DB.Model(&ClientToken{}).
+		Where("id = ? AND (max_quota = 0 OR used_quota + ? <= max_quota)", id, quota).
+		Update("used_quota", gorm.Expr("used_quota + ?", quota))
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrClientTokenQuotaExceeded
+	}
+	return nil
+}
+
+// DeltaUpdateClientTokenQuota 结算或退款时调整客户端令牌已用额度，delta 可为负数
+func DeltaUpdateClientTokenQuota(id int, delta int) error {
+	if delta == 0 {
+		return nil
+	}
+	return DB.Model(&ClientToken{}).Where("id = ?", id).
+		Update("used_quota", gorm.Expr("used_quota + ?", delta)).Error
+}
@@ -0,0 +1,238 @@
+package model
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"sync/atomic"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+)
+
+const (
+	ContractPriceTypeMultiplier = "multiplier"  // 在本站原价上乘以 Value
+	ContractPriceTypeRatio      = "model_ratio" // 按量计费，Value 为模型倍率
+	ContractPriceTypePrice      = "model_price" // 按次计费，Value 为每次价格（美元）
+
+	ContractPriceStatusEnabled  = 1
+	ContractPriceStatusDisabled = 2
+)
+
+// ContractPrice 用户或用户分组的合同价，Model 支持精确名称或以 * 开头/结尾的通配。
+// 优先级：用户合同价 > 分组合同价 > 价格计划 > 全局价格；命中合同价时不再叠加分组倍率与价格计划
+type ContractPrice struct {
+	Id              int     `json:"id"`
+	UserId          int     `json:"user_id" gorm:"index;default:0"`
+	UserGroup       string  `json:"user_group" gorm:"type:varchar(64);index;default:''"`
+	Model           string  `json:"model" gorm:"type:varchar(128)"`
+	Type            string  `json:"type" gorm:"type:varchar(16)"`
+	Value           float64 `json:"value"`
+	CompletionRatio float64 `json:"completion_ratio" gorm:"default:0"` // 仅 model_ratio 类型使用，0 表示沿用全局补全倍率
+	Remark          string  `json:"remark" gorm:"type:varchar(255);default:''"`
+	Status          int     `json:"status" gorm:"type:int;default:1"`
+	CreatedTime     int64   `json:"created_time" gorm:"bigint"`
+	UpdatedTime     int64   `json:"updated_time" gorm:"bigint"`
+}
+
+type contractPriceIndex struct {
+	users  map[int][]*ContractPrice
+	groups map[string][]*ContractPrice
+}
+
+var contractPrices atomic.Pointer[contractPriceIndex]
+
+// Multiplier 倍率类型返回 Value，其余类型返回 1
+func (price *ContractPrice) Multiplier() float64 {
+	if price.Type == ContractPriceTypeMultiplier {
+		return price.Value
+	}
+	return 1
+}
+
+func (price *ContractPrice) Validate() error {
+	price.Model = strings.TrimSpace(price.Model)
+	price.UserGroup = strings.TrimSpace(price.UserGroup)
+	if (price.UserId > 0) == (price.UserGroup != "") {
+		return errors.New("合同价需要指定用户或分组其中之一")
+	}
+	if price.Model == "" || strings.Contains(strings.Trim(price.Model, "*"), "*") {
+		return errors.New("模型只支持精确名称或以 * 开头/结尾的通配")
+	}
+	switch price.Type {
+	case ContractPriceTypeMultiplier, ContractPriceTypeRatio, ContractPriceTypePrice:
+	default:
+		return errors.New("无效的合同价类型")
+	}
+	if price.Value < 0 || price.CompletionRatio < 0 {
+		return errors.New("价格不能为负数")
+	}
+	if price.Status == 0 {
+		price.Status = ContractPriceStatusEnabled
+	}
+	if price.Status != ContractPriceStatusEnabled && price.Status != ContractPriceStatusDisabled {
+		return errors.New("无效的状态")
+	}
+	return nil
+}
+
+func (price *ContractPrice) Insert() error {
+	now := common.GetTimestamp()
+	price.CreatedTime = now
+	price.UpdatedTime = now
+	if err := DB.Create(price).Error; err != nil {
+		return err
+	}
+	return LoadContractPrices()
+}
+
+func (price *ContractPrice) Update() error {
+	price.UpdatedTime = common.GetTimestamp()
+	err := DB.Model(price).Select("user_id", "user_group", "model", "type", "value", "completion_ratio",
+		"remark", "status", "updated_time").Updates(price).Error
+	if err != nil {
+		return err
+	}
+	return LoadContractPrices()
+}
+
+func (price *ContractPrice) Delete() error {
+	if err := DB.Delete(price).Error; err != nil {
+		return err
+	}
+	return LoadContractPrices()
+}
+
+func GetContractPriceById(id int) (*ContractPrice, error) {
+	var price ContractPrice
+	if err := DB.Where("id = ?", id).First(&price).Error; err != nil {
+		return nil, err
+	}
+	return &price, nil
+}
+
+func GetContractPrices(userId int, userGroup string, pageInfo *common.PageInfo) (prices []*ContractPrice, total int64, err error) {
+	query := DB.Model(&ContractPrice{})
+	if userId > 0 {
+		query = query.Where("user_id = ?", userId)
+	}
+	if userGroup != "" {
+		query = query.Where("user_group = ?", userGroup)
+	}
+	if err = query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = query.Order("id desc").Limit(pageInfo.GetPageSize()).Offset(pageInfo.GetStartIdx()).Find(&prices).Error
+	return prices, total, err
+}
+
+// LoadContractPrices 从数据库加载启用中的合同价到内存
+func LoadContractPrices() error {
+	var prices []*ContractPrice
+	if err := DB.Where("status = ?", ContractPriceStatusEnabled).Find(&prices).Error; err != nil {
+		return err
+	}
+	index := &contractPriceIndex{
+		users:  make(map[int][]*ContractPrice),
+		groups: make(map[string][]*ContractPrice),
+	}
+	for _, price := range prices {
+		if price.UserId > 0 {
+			index.users[price.UserId] = append(index.users[price.UserId], price)
+		} else if price.UserGroup != "" {
+			index.groups[price.UserGroup] = append(index.groups[price.UserGroup], price)
+		}
+	}
+	contractPrices.Store(index)
+	return nil
+}
+
+func loadContractPrices() {
+	if err := LoadContractPrices(); err != nil {
+		common.SysError("failed to load contract prices: " + err.Error())
+	}
+}
+
+// matchContractModel 返回模式对模型的匹配精确度，精确匹配最高，未匹配返回 -1
+func matchContractModel(pattern string, modelName string) int {
+	switch {
+	case pattern == modelName:
+		return math.MaxInt
+	case pattern == "*":
+		return 0
+	case strings.HasSuffix(pattern, "*") && strings.HasPrefix(modelName, strings.TrimSuffix(pattern, "*")):
+		return len(pattern) - 1
+	case strings.HasPrefix(pattern, "*") && strings.HasSuffix(modelName, strings.TrimPrefix(pattern, "*")):
+		return len(pattern) - 1
+	}
+	return -1
+}
+
+// matchContractPrice 返回匹配最精确的合同价，精确度相同时取 id 较大（较新）的
+func matchContractPrice(prices []*ContractPrice, modelName string) *ContractPrice {
+	matchName := ratio_setting.FormatMatchingModelName(modelName)
+	var best *ContractPrice
+	bestScore := -1
+	for _, price := range prices {
+		score := matchContractModel(price.Model, modelName)
+		if matchName != modelName {
+			score = max(score, matchContractModel(price.Model, matchName))
+		}
+		if score < 0 {
+			continue
+		}
+		if score > bestScore || (score == bestScore && price.Id > best.Id) {
+			best, bestScore = price, score
+		}
+	}
+	return best
+}
+
+// ResolveContractPrice 按用户、用户分组的顺序查找模型的合同价，没有时返回 nil
+func ResolveContractPrice(userId int, userGroup string, modelName string) *ContractPrice {
+	index := contractPrices.Load()
+	if index == nil {
+		return nil
+	}
+	if price := matchContractPrice(index.users[userId], modelName); price != nil {
+		return price
+	}
+	if userGroup != "" {
+		return matchContractPrice(index.groups[userGroup], modelName)
+	}
+	return nil
+}
+
+// ApplyContractPricing 返回套用用户合同价后的价格列表副本，供 /api/pricing 展示
+func ApplyContractPricing(pricing []Pricing, userId int, userGroup string) []Pricing {
+	index := contractPrices.Load()
+	if index == nil || (len(index.users[userId]) == 0 && len(index.groups[userGroup]) == 0) {
+		return pricing
+	}
+	result := make([]Pricing, len(pricing))
+	copy(result, pricing)
+	for i := range result {
+		item := &result[i]
+		price := ResolveContractPrice(userId, userGroup, item.ModelName)
+		if price == nil {
+			continue
+		}
+		switch price.Type {
+		case ContractPriceTypeMultiplier:
+			item.ModelRatio *= price.Value
+			item.ModelPrice *= price.Value
+		case ContractPriceTypeRatio:
+			item.QuotaType = 0
+			item.ModelRatio = price.Value
+			item.CompletionRatio = ratio_setting.GetCompletionRatio(item.ModelName)
+			if price.CompletionRatio > 0 {
+				item.CompletionRatio = price.CompletionRatio
+			}
+		case ContractPriceTypePrice:
+			item.QuotaType = 1
+			item.ModelPrice = price.Value
+		}
+		item.ContractPrice = true
+	}
+	return result
+}
@@ -0,0 +1,37 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchContractPrice(t *testing.T) {
+	prices := []*ContractPrice{
+		{Id: 1, Model: "*", Type: ContractPriceTypeMultiplier, Value: 0.9},
+		{Id: 2, Model: "claude-*", Type: ContractPriceTypeMultiplier, Value: 0.8},
+		{Id: 3, Model: "gpt-4o", Type: ContractPriceTypeRatio, Value: 1},
+		{Id: 4, Model: "claude-sonnet-*", Type: ContractPriceTypeMultiplier, Value: 0.7},
+	}
+	require.Equal(t, 4, matchContractPrice(prices, "claude-sonnet-4-20250514").Id)
+	require.Equal(t, 2, matchContractPrice(prices, "claude-3-5-haiku-20241022").Id)
+	require.Equal(t, 3, matchContractPrice(prices, "gpt-4o").Id)
+	require.Equal(t, 1, matchContractPrice(prices, "gpt-4o-mini").Id)
+	require.Nil(t, matchContractPrice(prices[1:], "gemini-2.5-pro"))
+}
+
+func TestResolveContractPricePrecedence(t *testing.T) {
+	userPrice := &ContractPrice{Id: 1, UserId: 7, Model: "claude-*", Type: ContractPriceTypeMultiplier, Value: 0.8}
+	groupPrice := &ContractPrice{Id: 2, UserGroup: "vip", Model: "*", Type: ContractPriceTypeMultiplier, Value: 0.9}
+	old := contractPrices.Load()
+	contractPrices.Store(&contractPriceIndex{
+		users:  map[int][]*ContractPrice{7: {userPrice}},
+		groups: map[string][]*ContractPrice{"vip": {groupPrice}},
+	})
+	defer contractPrices.Store(old)
+
+	require.Equal(t, userPrice, ResolveContractPrice(7, "vip", "claude-opus-4-1"))
+	require.Equal(t, groupPrice, ResolveContractPrice(7, "vip", "gpt-4o"))
+	require.Equal(t, groupPrice, ResolveContractPrice(8, "vip", "claude-opus-4-1"))
+	require.Nil(t, ResolveContractPrice(8, "default", "gpt-4o"))
+}
@@ -0,0 +1,390 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	CouponStatusEnabled  = 1
+	CouponStatusDisabled = 2
+
+	CouponDiscountPercent = "percent" // 按比例折扣，DiscountValue 为 0-100 的百分比
+	CouponDiscountFixed   = "fixed"   // 固定金额立减，DiscountValue 为金额
+
+	CouponScopeAll          = "all"
+	CouponScopeTopUp        = "topup"
+	CouponScopeSubscription = "subscription"
+
+	// 待支付订单占用优惠券名额的时长，超时未支付的订单不再计入使用次数
+	couponHoldSeconds = 30 * 60
+)
+
+// Coupon 优惠券：下单时抵扣支付金额，充值订单可额外赠送额度
+type Coupon struct {
+	Id                int            `json:"id"`
+	Code              string         `json:"code" gorm:"type:varchar(64);uniqueIndex"`
+	Name              string         `json:"name" gorm:"index"`
+	Status            int            `json:"status" gorm:"default:1"`
+	DiscountType      string         `json:"discount_type" gorm:"type:varchar(16);default:''"` // 为空表示仅赠送额度
+	DiscountValue     float64        `json:"discount_value" gorm:"default:0"`
+	MaxDiscount       float64        `json:"max_discount" gorm:"default:0"` // 比例折扣的最高抵扣金额，0 表示不限
+	MinMoney          float64        `json:"min_money" gorm:"default:0"`    // 订单原价门槛
+	BonusQuota        int            `json:"bonus_quota" gorm:"default:0"`  // 充值成功后额外赠送的额度
+	Scope             string         `json:"scope" gorm:"type:varchar(16);default:'all'"`
+	PlanIds           string         `json:"plan_ids" gorm:"type:varchar(255);default:''"` // 逗号分隔，为空表示不限套餐
+	Groups            string         `json:"groups" gorm:"type:varchar(255);default:''"`   // 逗号分隔，为空表示不限分组
+	FirstPurchaseOnly bool           `json:"first_purchase_only" gorm:"default:false"`
+	MaxUses           int            `json:"max_uses" gorm:"default:0"`          // 总使用次数上限，0 表示不限
+	MaxUsesPerUser    int            `json:"max_uses_per_user" gorm:"default:0"` // 单用户使用次数上限，0 表示不限
+	UsedCount         int            `json:"used_count" gorm:"default:0"`
+	StartTime         int64          `json:"start_time" gorm:"bigint;default:0"`
+	EndTime           int64          `json:"end_time" gorm:"bigint;default:0"` // 0 表示不过期
+	CreatedTime       int64          `json:"created_time" gorm:"bigint"`
+	DeletedAt         gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// CouponUsage 优惠券在某个订单上的使用记录，下单时以 pending 状态占用名额，支付完成后转为 success
+type CouponUsage struct {
+	Id           int     `json:"id"`
+	CouponId     int     `json:"coupon_id" gorm:"index"`
+	UserId       int     `json:"user_id" gorm:"index"`
+	TradeNo      string  `json:"trade_no" gorm:"type:varchar(255);uniqueIndex"`
+	Scope        string  `json:"scope" gorm:"type:varchar(16)"`
+	OriginMoney  float64 `json:"origin_money"`
+	Discount     float64 `json:"discount"`
+	BonusQuota   int     `json:"bonus_quota"`
+	Status       string  `json:"status" gorm:"type:varchar(16);index"`
+	CreatedTime  int64   `json:"created_time" gorm:"bigint;index"`
+	CompleteTime int64   `json:"complete_time" gorm:"bigint"`
+}
+
+// CouponTarget 使用优惠券的订单信息
+type CouponTarget struct {
+	UserId  int
+	Group   string
+	Scope   string // CouponScopeTopUp / CouponScopeSubscription
+	PlanId  int
+	Money   float64 // 优惠前的应付金额
+	TradeNo string
+}
+
+// PayMoney 扣除优惠后的支付金额
+func (usage *CouponUsage) PayMoney() float64 {
+	return decimal.NewFromFloat(usage.OriginMoney).Sub(decimal.NewFromFloat(usage.Discount)).Round(2).InexactFloat64()
+}
+
+func (coupon *Coupon) Insert() error {
+	coupon.CreatedTime = common.GetTimestamp()
+	return DB.Create(coupon).Error
+}
+
+// Update 更新可编辑字段，Code 与使用次数不随之修改
+func (coupon *Coupon) Update() error {
+	return DB.Model(coupon).Select("name", "status", "discount_type", "discount_value", "max_discount", "min_money",
+		"bonus_quota", "scope", "plan_ids", "groups", "first_purchase_only", "max_uses", "max_uses_per_user",
+		"start_time", "end_time").Updates(coupon).Error
+}
+
+func (coupon *Coupon) Delete() error {
+	return DB.Delete(coupon).Error
+}
+
+// Validate 检查管理员提交的优惠券配置
+func (coupon *Coupon) Validate() error {
+	coupon.Code = strings.TrimSpace(coupon.Code)
+	if coupon.Code == "" || len(coupon.Code) > 64 {
+		return errors.New("优惠码长度必须在 1-64 之间")
+	}
+	switch coupon.DiscountType {
+	case "":
+		coupon.DiscountValue = 0
+	case CouponDiscountPercent:
+		if coupon.DiscountValue <= 0 || coupon.DiscountValue > 100 {
+			return errors.New("折扣比例必须在 0-100 之间")
+		}
+	case CouponDiscountFixed:
+		if coupon.DiscountValue <= 0 {
+			return errors.New("立减金额必须大于 0")
+		}
+	default:
+		return errors.New("不支持的折扣类型")
+	}
+	if coupon.DiscountType == "" && coupon.BonusQuota <= 0 {
+		return errors.New("优惠券必须设置折扣或赠送额度")
+	}
+	if coupon.MaxDiscount < 0 || coupon.MinMoney < 0 || coupon.BonusQuota < 0 || coupon.MaxUses < 0 || coupon.MaxUsesPerUser < 0 {
+		return errors.New("优惠券参数不能为负数")
+	}
+	if coupon.Scope == "" {
+		coupon.Scope = CouponScopeAll
+	}
+	if coupon.Scope != CouponScopeAll && coupon.Scope != CouponScopeTopUp && coupon.Scope != CouponScopeSubscription {
+		return errors.New("不支持的适用范围")
+	}
+	for _, id := range splitCouponList(coupon.PlanIds) {
+		if _, err := strconv.Atoi(id); err != nil {
+			return fmt.Errorf("无效的套餐 ID: %s", id)
+		}
+	}
+	if coupon.EndTime != 0 && coupon.EndTime <= coupon.StartTime {
+		return errors.New("结束时间必须晚于开始时间")
+	}
+	return nil
+}
+
+func splitCouponList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func couponListContains(value string, target string) bool {
+	items := splitCouponList(value)
+	if len(items) == 0 {
+		return true
+	}
+	for _, item := range items {
+		if item == target {
+			return true
+		}
+	}
+	return false
+}
+
+// DiscountFor 计算订单原价 money 可抵扣的金额，保留两位小数且不超过原价
+func (coupon *Coupon) DiscountFor(money float64) float64 {
+	dMoney := decimal.NewFromFloat(money)
+	var discount decimal.Decimal
+	switch coupon.DiscountType {
+	case CouponDiscountPercent:
+		discount = dMoney.Mul(decimal.NewFromFloat(coupon.DiscountValue)).Div(decimal.NewFromInt(100))
+		if coupon.MaxDiscount > 0 {
+			discount = decimal.Min(discount, decimal.NewFromFloat(coupon.MaxDiscount))
+		}
+	case CouponDiscountFixed:
+		discount = decimal.NewFromFloat(coupon.DiscountValue)
+	default:
+		return 0
+	}
+	return decimal.Min(discount, dMoney).Round(2).InexactFloat64()
+}
+
+// checkTarget 检查优惠券状态、有效期与适用范围，不涉及使用次数
+func (coupon *Coupon) checkTarget(target *CouponTarget, now int64) error {
+	if coupon.Status != CouponStatusEnabled {
+		return errors.New("优惠券已停用")
+	}
+	if coupon.StartTime != 0 && now < coupon.StartTime {
+		return errors.New("优惠券尚未生效")
+	}
+	if coupon.EndTime != 0 && now >= coupon.EndTime {
+		return errors.New("优惠券已过期")
+	}
+	if coupon.Scope != CouponScopeAll && coupon.Scope != target.Scope {
+		if coupon.Scope == CouponScopeTopUp {
+			return errors.New("该优惠券仅适用于充值")
+		}
+		return errors.New("该优惠券仅适用于订阅套餐")
+	}
+	if target.Scope == CouponScopeSubscription && !couponListContains(coupon.PlanIds, strconv.Itoa(target.PlanId)) {
+		return errors.New("该优惠券不适用于此套餐")
+	}
+	if !couponListContains(coupon.Groups, target.Group) {
+		return errors.New("当前分组不可使用该优惠券")
+	}
+	if coupon.MinMoney > 0 && target.Money < coupon.MinMoney {
+		return fmt.Errorf("订单金额满 %.2f 才可使用该优惠券", coupon.MinMoney)
+	}
+	return nil
+}
+
+// couponUsageActiveQuery 已完成或仍在占用期内的使用记录
+func couponUsageActiveQuery(tx *gorm.DB, now int64) *gorm.DB {
+	return tx.Model(&CouponUsage{}).Where("status = ? OR (status = ? AND created_time > ?)",
+		common.TopUpStatusSuccess, common.TopUpStatusPending, now-couponHoldSeconds)
+}
+
+func getCouponByCodeTx(tx *gorm.DB, code string, forUpdate bool) (*Coupon, error) {
+	code = strings.TrimSpace(code)
+	if code == "" {
+		return nil, errors.New("未提供优惠码")
+	}
+	coupon := &Coupon{}
+	if forUpdate {
+		// SQLite 不支持 FOR UPDATE，驱动会忽略该子句，写事务本身已串行执行
+		tx = tx.Clauses(clause.Locking{Strength: "UPDATE"})
+	}
+	if err := tx.Where("code = ?", code).First(coupon).Error; err != nil {
+		return nil, errors.New("无效的优惠码")
+	}
+	return coupon, nil
+}
+
+func checkCouponUsageTx(tx *gorm.DB, coupon *Coupon, target *CouponTarget, now int64) error {
+	if coupon.MaxUses > 0 {
+		var used int64
+		if err := couponUsageActiveQuery(tx, now).Where("coupon_id = ?", coupon.Id).Count(&used).Error; err != nil {
+			return err
+		}
+		if used >= int64(coupon.MaxUses) {
+			return errors.New("优惠券已被领完")
+		}
+	}
+	if coupon.MaxUsesPerUser > 0 {
+		var used int64
+		if err := couponUsageActiveQuery(tx, now).Where("coupon_id = ? AND user_id = ?", coupon.Id, target.UserId).Count(&used).Error; err != nil {
+			return err
+		}
+		if used >= int64(coupon.MaxUsesPerUser) {
+			return errors.New("已达到该优惠券的使用次数上限")
+		}
+	}
+	if coupon.FirstPurchaseOnly {
+		var paid int64
+		if err := tx.Model(&TopUp{}).Where("user_id = ? AND status = ?", target.UserId, common.TopUpStatusSuccess).Count(&paid).Error; err != nil {
+			return err
+		}
+		if paid > 0 {
+			return errors.New("该优惠券仅限首次购买使用")
+		}
+	}
+	return nil
+}
+
+func newCouponUsage(coupon *Coupon, target *CouponTarget, now int64) *CouponUsage {
+	usage := &CouponUsage{
+		CouponId:    coupon.Id,
+		UserId:      target.UserId,
+		TradeNo:     target.TradeNo,
+		Scope:       target.Scope,
+		OriginMoney: target.Money,
+		Discount:    coupon.DiscountFor(target.Money),
+		Status:      common.TopUpStatusPending,
+		CreatedTime: now,
+	}
+	// 赠送额度只发放到钱包充值订单
+	if target.Scope == CouponScopeTopUp {
+		usage.BonusQuota = coupon.BonusQuota
+	}
+	return usage
+}
+
+// PreviewCoupon 试算优惠券对订单的优惠，不占用名额
+func PreviewCoupon(code string, target *CouponTarget) (*CouponUsage, error) {
+	now := common.GetTimestamp()
+	coupon, err := getCouponByCodeTx(DB, code, false)
+	if err != nil {
+		return nil, err
+	}
+	if err := coupon.checkTarget(target, now); err != nil {
+		return nil, err
+	}
+	if err := checkCouponUsageTx(DB, coupon, target, now); err != nil {
+		return nil, err
+	}
+	return newCouponUsage(coupon, target, now), nil
+}
+
+// ReserveCoupon 下单时校验并占用优惠券名额，返回本单的优惠。订单创建失败时需调用 ReleaseCouponUsage。
+func ReserveCoupon(code string, target *CouponTarget) (*CouponUsage, error) {
+	if target.TradeNo == "" || target.UserId == 0 {
+		return nil, errors.New("invalid coupon target")
+	}
+	var usage *CouponUsage
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		now := common.GetTimestamp()
+		// 锁定优惠券行，串行化同一优惠券的并发下单，保证次数限制准确
+		coupon, err := getCouponByCodeTx(tx, code, true)
+		if err != nil {
+			return err
+		}
+		if err := coupon.checkTarget(target, now); err != nil {
+			return err
+		}
+		if err := checkCouponUsageTx(tx, coupon, target, now); err != nil {
+			return err
+		}
+		usage = newCouponUsage(coupon, target, now)
+		return tx.Create(usage).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
+
+// ReleaseCouponUsage 订单未能创建或已过期时释放待支付订单占用的优惠券
+func ReleaseCouponUsage(tradeNo string) error {
+	if tradeNo == "" {
+		return nil
+	}
+	return DB.Where("trade_no = ? AND status = ?", tradeNo, common.TopUpStatusPending).Delete(&CouponUsage{}).Error
+}
+
+// completeCouponUsageTx 订单支付完成时确认优惠券使用并累计使用次数
+func completeCouponUsageTx(tx *gorm.DB, couponId int, tradeNo string) error {
+	if couponId == 0 {
+		return nil
+	}
+	res := tx.Model(&CouponUsage{}).Where("trade_no = ? AND status = ?", tradeNo, common.TopUpStatusPending).
+		Updates(map[string]interface{}{"status": common.TopUpStatusSuccess, "complete_time": common.GetTimestamp()})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil
+	}
+	// 使用次数不超过总次数上限：占用期过后名额可能已被他人占用，此时订单已支付，只记录日志
+	res = tx.Model(&Coupon{}).Where("id = ? AND (max_uses = 0 OR used_count < max_uses)", couponId).
+		Update("used_count", gorm.Expr("used_count + 1"))
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		common.SysLog(fmt.Sprintf("coupon %d exceeded max uses after hold expired, trade_no: %s", couponId, tradeNo))
+	}
+	return nil
+}
+
+func GetCouponById(id int) (*Coupon, error) {
+	if id == 0 {
+		return nil, errors.New("id 为空！")
+	}
+	coupon := &Coupon{}
+	err := DB.First(coupon, "id = ?", id).Error
+	return coupon, err
+}
+
+func GetAllCoupons(keyword string, pageInfo *common.PageInfo) (coupons []*Coupon, total int64, err error) {
+	query := DB.Model(&Coupon{})
+	if keyword != "" {
+		query = query.Where("code LIKE ? OR name LIKE ?", keyword+"%", keyword+"%")
+	}
+	if err = query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = query.Order("id desc").Limit(pageInfo.GetPageSize()).Offset(pageInfo.GetStartIdx()).Find(&coupons).Error
+	return coupons, total, err
+}
+
+func GetCouponUsages(couponId int, pageInfo *common.PageInfo) (usages []*CouponUsage, total int64, err error) {
+	query := DB.Model(&CouponUsage{}).Where("coupon_id = ?", couponId)
+	if err = query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = query.Order("id desc").Limit(pageInfo.GetPageSize()).Offset(pageInfo.GetStartIdx()).Find(&usages).Error
+	return usages, total, err
+}
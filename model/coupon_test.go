@@ -0,0 +1,93 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCouponDiscount(t *testing.T) {
+	t.Parallel()
+
+	percent := &Coupon{DiscountType: CouponDiscountPercent, DiscountValue: 15}
+	require.Equal(t, 1.5, percent.DiscountFor(10))
+	require.Equal(t, 0.19, percent.DiscountFor(1.25))
+
+	percent.MaxDiscount = 5
+	require.Equal(t, 5.0, percent.DiscountFor(100))
+
+	fixed := &Coupon{DiscountType: CouponDiscountFixed, DiscountValue: 20}
+	require.Equal(t, 20.0, fixed.DiscountFor(30))
+	require.Equal(t, 8.0, fixed.DiscountFor(8))
+
+	bonus := &Coupon{BonusQuota: 1000}
+	require.Zero(t, bonus.DiscountFor(30))
+
+	usage := &CouponUsage{OriginMoney: 9.99, Discount: 1.5}
+	require.Equal(t, 8.49, usage.PayMoney())
+}
+
+func TestCouponValidateAndTarget(t *testing.T) {
+	t.Parallel()
+
+	require.Error(t, (&Coupon{Code: "A"}).Validate())
+	require.Error(t, (&Coupon{Code: "A", DiscountType: CouponDiscountPercent, DiscountValue: 120}).Validate())
+	require.Error(t, (&Coupon{Code: "A", BonusQuota: 1, PlanIds: "1,x"}).Validate())
+	require.Error(t, (&Coupon{Code: "A", BonusQuota: 1, StartTime: 100, EndTime: 50}).Validate())
+
+	coupon := &Coupon{
+		Code:          " SPRING ",
+		DiscountType:  CouponDiscountPercent,
+		DiscountValue: 10,
+		Scope:         CouponScopeSubscription,
+		PlanIds:       "2, 3",
+		Groups:        "vip",
+		MinMoney:      5,
+		StartTime:     100,
+		EndTime:       200,
+		Status:        CouponStatusEnabled,
+	}
+	require.NoError(t, coupon.Validate())
+	require.Equal(t, "SPRING", coupon.Code)
+
+	target := &CouponTarget{UserId: 1, Group: "vip", Scope: CouponScopeSubscription, PlanId: 3, Money: 10}
+	require.NoError(t, coupon.checkTarget(target, 150))
+	require.Error(t, coupon.checkTarget(target, 99))
+	require.Error(t, coupon.checkTarget(target, 200))
+
+	require.Error(t, coupon.checkTarget(&CouponTarget{Group: "vip", Scope: CouponScopeTopUp, Money: 10}, 150))
+	require.Error(t, coupon.checkTarget(&CouponTarget{Group: "vip", Scope: CouponScopeSubscription, PlanId: 1, Money: 10}, 150))
+	require.Error(t, coupon.checkTarget(&CouponTarget{Group: "default", Scope: CouponScopeSubscription, PlanId: 2, Money: 10}, 150))
+	require.Error(t, coupon.checkTarget(&CouponTarget{Group: "vip", Scope: CouponScopeSubscription, PlanId: 2, Money: 4}, 150))
+
+	coupon.Status = CouponStatusDisabled
+	require.Error(t, coupon.checkTarget(target, 150))
+}
+
+func TestCouponMaxUses(t *testing.T) {
+	setupTestDB(t, &Coupon{}, &CouponUsage{}, &TopUp{})
+
+	coupon := &Coupon{Code: "ONCE", DiscountType: CouponDiscountFixed, DiscountValue: 1, MaxUses: 1, Status: CouponStatusEnabled}
+	require.NoError(t, coupon.Insert())
+
+	target := &CouponTarget{UserId: 1, TradeNo: "T1", Scope: CouponScopeTopUp, Money: 10}
+	_, err := ReserveCoupon("ONCE", target)
+	require.NoError(t, err)
+	_, err = ReserveCoupon("ONCE", &CouponTarget{UserId: 2, TradeNo: "T2", Scope: CouponScopeTopUp, Money: 10})
+	require.Error(t, err)
+
+	// 占用过期后名额被他人占用，先前的订单仍完成支付，使用次数不超过上限
+	require.NoError(t, DB.Model(&CouponUsage{}).Where("trade_no = ?", "T1").
+		Update("created_time", common.GetTimestamp()-couponHoldSeconds-1).Error)
+	_, err = ReserveCoupon("ONCE", &CouponTarget{UserId: 2, TradeNo: "T2", Scope: CouponScopeTopUp, Money: 10})
+	require.NoError(t, err)
+	require.NoError(t, completeCouponUsageTx(DB, coupon.Id, "T2"))
+	require.NoError(t, completeCouponUsageTx(DB, coupon.Id, "T1"))
+	// 重复回调不重复计数
+	require.NoError(t, completeCouponUsageTx(DB, coupon.Id, "T2"))
+
+	saved, err := GetCouponById(coupon.Id)
+	require.NoError(t, err)
+	require.Equal(t, 1, saved.UsedCount)
+}
@@ -0,0 +1,15 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// setupTestDB 为测试创建独立的内存 SQLite 数据库并迁移所需的表，不能与其他数据库测试并行
+func setupTestDB(t *testing.T, models ...interface{}) {
+	t.Helper()
+	restore, err := UseTestDB(t.Name(), models...)
+	require.NoError(t, err)
+	t.Cleanup(restore)
+}
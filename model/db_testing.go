@@ -0,0 +1,42 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+// UseTestDB 将全局 DB 替换为以 name 命名的内存 SQLite 数据库并迁移所需的表，返回恢复原数据库的函数。
+// 仅供测试使用，使用期间不能与其他数据库测试并行
+func UseTestDB(name string, models ...interface{}) (func(), error) {
+	dsn := fmt.Sprintf("file:%s?mode=memory&cache=shared", strings.ReplaceAll(name, "/", "_"))
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
+	if err != nil {
+		return nil, err
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+
+	oldDB, oldLogDB, oldSQLite, oldRedis := DB, LOG_DB, common.UsingSQLite, common.RedisEnabled
+	DB, LOG_DB = db, db
+	common.UsingSQLite = true
+	common.RedisEnabled = false
+	initCol()
+	restore := func() {
+		_ = sqlDB.Close()
+		DB, LOG_DB = oldDB, oldLogDB
+		common.UsingSQLite, common.RedisEnabled = oldSQLite, oldRedis
+		initCol()
+	}
+	if err := db.AutoMigrate(models...); err != nil {
+		restore()
+		return nil, err
+	}
+	return restore, nil
+}
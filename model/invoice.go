@@ -0,0 +1,319 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	InvoiceStatusPending = "pending"
+	InvoiceStatusOverdue = "overdue"
+	InvoiceStatusPaid    = "paid"
+)
+
+var ErrInvoicePaymentNotFound = errors.New("invoice payment not found")
+
+// Invoice 信用账户的月度账单。Quota 为本期应还额度，即出账时尚未出账的透支部分；
+// UsedQuota 为账期内的消耗，仅供对账展示
+type Invoice struct {
+	Id            int     `json:"id"`
+	UserId        int     `json:"user_id" gorm:"uniqueIndex:idx_invoice_user_period"`
+	PeriodStart   int64   `json:"period_start" gorm:"bigint"`
+	PeriodEnd     int64   `json:"period_end" gorm:"bigint;uniqueIndex:idx_invoice_user_period"`
+	UsedQuota     int     `json:"used_quota" gorm:"default:0"`
+	Quota         int     `json:"quota"`
+	Money         float64 `json:"money"` // 按 QuotaPerUnit 折算的美元金额
+	Status        string  `json:"status" gorm:"type:varchar(32);index"`
+	DueTime       int64   `json:"due_time" gorm:"bigint;index"`
+	PaidTime      int64   `json:"paid_time" gorm:"bigint;default:0"`
+	PaymentMethod string  `json:"payment_method" gorm:"type:varchar(50);default:''"`
+	TradeNo       string  `json:"trade_no" gorm:"type:varchar(255);default:''"`
+	CreatedTime   int64   `json:"created_time" gorm:"bigint"`
+}
+
+func (invoice *Invoice) IsOpen() bool {
+	return invoice.Status == InvoiceStatusPending || invoice.Status == InvoiceStatusOverdue
+}
+
+// InvoicePeriodEnd 返回 now 之前最近一个出账日的零点（本地时区），billingDay 超出 1-28 时按 1 处理
+func InvoicePeriodEnd(now time.Time, billingDay int) time.Time {
+	if billingDay < 1 || billingDay > 28 {
+		billingDay = 1
+	}
+	end := time.Date(now.Year(), now.Month(), billingDay, 0, 0, 0, 0, now.Location())
+	if end.After(now) {
+		end = end.AddDate(0, -1, 0)
+	}
+	return end
+}
+
+// invoiceMoney 将额度折算为美元金额，保留两位小数
+func invoiceMoney(quota int) float64 {
+	if common.QuotaPerUnit <= 0 {
+		return 0
+	}
+	money, _ := decimal.NewFromInt(int64(quota)).Div(decimal.NewFromFloat(common.QuotaPerUnit)).Round(2).Float64()
+	return money
+}
+
+// GenerateInvoices 为上次出账早于 periodEnd 的信用账户出具账单，返回处理的账户数。
+// 应还额度 = 当前透支额度 - 未结清账单额度，没有新增透支时只推进账期不出账单
+func GenerateInvoices(periodEnd int64, limit int) (int, error) {
+	if limit <= 0 {
+		limit = 200
+	}
+	var credits []UserCredit
+	if err := DB.Where("last_invoice_time < ?", periodEnd).
+		Order("id asc").Limit(limit).Find(&credits).Error; err != nil {
+		return 0, err
+	}
+	for _, item := range credits {
+		var invoice *Invoice
+		err := DB.Transaction(func(tx *gorm.DB) error {
+			var credit UserCredit
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", item.Id).First(&credit).Error; err != nil {
+				return err
+			}
+			if credit.LastInvoiceTime >= periodEnd {
+				return nil
+			}
+			var user User
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "quota", "used_quota").
+				Where("id = ?", credit.UserId).First(&user).Error; err != nil {
+				return err
+			}
+			var openQuota int64
+			if err := tx.Model(&Invoice{}).
+				Where("user_id = ? AND status IN ?", credit.UserId, []string{InvoiceStatusPending, InvoiceStatusOverdue}).
+				Select("COALESCE(SUM(quota), 0)").Scan(&openQuota).Error; err != nil {
+				return err
+			}
+			due := -user.Quota - int(openQuota)
+			if due > 0 {
+				termDays := credit.PaymentTermDays
+				if termDays <= 0 {
+					termDays = setting.InvoicePaymentTermDays
+				}
+				invoice = &Invoice{
+					UserId:      credit.UserId,
+					PeriodStart: credit.LastInvoiceTime,
+					PeriodEnd:   periodEnd,
+					UsedQuota:   max(user.UsedQuota-credit.LastUsedQuota, 0),
+					Quota:       due,
+					Money:       invoiceMoney(due),
+					Status:      InvoiceStatusPending,
+					DueTime:     periodEnd + int64(termDays)*86400,
+					CreatedTime: common.GetTimestamp(),
+				}
+				if err := tx.Create(invoice).Error; err != nil {
+					return err
+				}
+			}
+			return tx.Model(&credit).Updates(map[string]interface{}{
+				"last_invoice_time": periodEnd,
+				"last_used_quota":   user.UsedQuota,
+			}).Error
+		})
+		if err != nil {
+			return 0, err
+		}
+		if invoice != nil {
+			RecordLog(invoice.UserId, LogTypeSystem, fmt.Sprintf("已出具账单 #%d，应还额度: %s，最后付款日: %s",
+				invoice.Id, logger.FormatQuota(invoice.Quota), time.Unix(invoice.DueTime, 0).Format("2006-01-02")))
+		}
+	}
+	return len(credits), nil
+}
+
+// MarkOverdueInvoices 将超过付款期限的账单标记为逾期，开启自动暂停时同时暂停用户的信用额度
+func MarkOverdueInvoices(limit int) (int, error) {
+	if limit <= 0 {
+		limit = 200
+	}
+	now := common.GetTimestamp()
+	var invoices []Invoice
+	if err := DB.Where("status = ? AND due_time <= ?", InvoiceStatusPending, now).
+		Order("due_time asc, id asc").Limit(limit).Find(&invoices).Error; err != nil {
+		return 0, err
+	}
+	marked := 0
+	for _, invoice := range invoices {
+		suspended := false
+		err := DB.Transaction(func(tx *gorm.DB) error {
+			res := tx.Model(&Invoice{}).Where("id = ? AND status = ?", invoice.Id, InvoiceStatusPending).
+				Update("status", InvoiceStatusOverdue)
+			if res.Error != nil || res.RowsAffected == 0 {
+				return res.Error
+			}
+			marked++
+			if !setting.InvoiceOverdueSuspend {
+				return nil
+			}
+			res = tx.Model(&UserCredit{}).Where("user_id = ? AND status = ?", invoice.UserId, UserCreditStatusActive).
+				Updates(map[string]interface{}{
+					"status":         UserCreditStatusSuspended,
+					"suspended_time": now,
+				})
+			suspended = res.RowsAffected > 0
+			return res.Error
+		})
+		if err != nil {
+			return marked, err
+		}
+		msg := fmt.Sprintf("账单 #%d 已逾期", invoice.Id)
+		if suspended {
+			msg += "，信用额度已暂停，结清逾期账单后自动恢复"
+		}
+		RecordLog(invoice.UserId, LogTypeSystem, msg)
+	}
+	return marked, nil
+}
+
+// payInvoiceTx 结清账单并将应还额度计入用户余额；账单已结清时（如重复支付）只入账不改账单。
+// 用户没有其他逾期账单时恢复被暂停的信用额度
+func payInvoiceTx(tx *gorm.DB, invoiceId int, quota int, paymentMethod string, tradeNo string) (resumed bool, err error) {
+	var invoice Invoice
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", invoiceId).First(&invoice).Error; err != nil {
+		return false, err
+	}
+	if invoice.IsOpen() {
+		invoice.Status = InvoiceStatusPaid
+		invoice.PaidTime = common.GetTimestamp()
+		invoice.PaymentMethod = paymentMethod
+		invoice.TradeNo = tradeNo
+		if err := tx.Save(&invoice).Error; err != nil {
+			return false, err
+		}
+	}
+	if err := tx.Model(&User{}).Where("id = ?", invoice.UserId).Update("quota", gorm.Expr("quota + ?", quota)).Error; err != nil {
+		return false, err
+	}
+	var overdue int64
+	if err := tx.Model(&Invoice{}).Where("user_id = ? AND status = ?", invoice.UserId, InvoiceStatusOverdue).
+		Count(&overdue).Error; err != nil {
+		return false, err
+	}
+	if overdue > 0 {
+		return false, nil
+	}
+	res := tx.Model(&UserCredit{}).Where("user_id = ? AND status = ?", invoice.UserId, UserCreditStatusSuspended).
+		Updates(map[string]interface{}{
+			"status":         UserCreditStatusActive,
+			"suspended_time": 0,
+		})
+	return res.RowsAffected > 0, res.Error
+}
+
+func afterInvoicePaid(invoiceId int, userId int, quota int, resumed bool, msg string) {
+	gopool.Go(func() {
+		if err := cacheIncrUserQuota(userId, int64(quota)); err != nil {
+			common.SysLog("failed to increase user quota cache: " + err.Error())
+		}
+	})
+	msg = fmt.Sprintf("账单 #%d %s，还款额度: %s", invoiceId, msg, logger.FormatQuota(quota))
+	if resumed {
+		msg += "，信用额度已恢复"
+	}
+	RecordLog(userId, LogTypeTopup, msg)
+}
+
+// CompleteInvoicePayment 支付平台确认到账后完成账单还款订单，订单不是账单还款时返回 ErrInvoicePaymentNotFound
+func CompleteInvoicePayment(tradeNo string, providerPaymentId string) error {
+	if tradeNo == "" {
+		return errors.New("未提供支付单号")
+	}
+	refCol := "`trade_no`"
+	if common.UsingPostgreSQL {
+		refCol = `"trade_no"`
+	}
+	var topUp TopUp
+	credited := false
+	resumed := false
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where(refCol+" = ?", tradeNo).First(&topUp).Error; err != nil || topUp.InvoiceId == 0 {
+			return ErrInvoicePaymentNotFound
+		}
+		if topUp.Status == common.TopUpStatusSuccess {
+			return nil
+		}
+		if topUp.Status != common.TopUpStatusPending {
+			return errors.New("充值订单状态错误")
+		}
+		topUp.Status = common.TopUpStatusSuccess
+		topUp.CompleteTime = common.GetTimestamp()
+		if providerPaymentId != "" {
+			topUp.ProviderPaymentId = providerPaymentId
+		}
+		if err := tx.Save(&topUp).Error; err != nil {
+			return err
+		}
+		var err error
+		resumed, err = payInvoiceTx(tx, topUp.InvoiceId, topUp.CreditQuota(), topUp.PaymentMethod, topUp.TradeNo)
+		credited = err == nil
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if credited {
+		afterInvoicePaid(topUp.InvoiceId, topUp.UserId, topUp.CreditQuota(), resumed,
+			fmt.Sprintf("在线还款成功，支付金额: %.2f，支付方式: %s", topUp.Money, topUp.PaymentMethod))
+	}
+	return nil
+}
+
+// SettleInvoice 管理员确认线下收款后结清账单
+func SettleInvoice(invoiceId int) error {
+	var invoice Invoice
+	resumed := false
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", invoiceId).First(&invoice).Error; err != nil {
+			return errors.New("账单不存在")
+		}
+		if !invoice.IsOpen() {
+			return errors.New("账单已结清")
+		}
+		var err error
+		resumed, err = payInvoiceTx(tx, invoice.Id, invoice.Quota, "manual", "")
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	afterInvoicePaid(invoice.Id, invoice.UserId, invoice.Quota, resumed, "已由管理员确认收款")
+	return nil
+}
+
+func GetInvoiceById(id int) (*Invoice, error) {
+	var invoice Invoice
+	if err := DB.Where("id = ?", id).First(&invoice).Error; err != nil {
+		return nil, err
+	}
+	return &invoice, nil
+}
+
+// GetInvoices 分页查询账单，userId 为 0 时查询全部用户
+func GetInvoices(userId int, status string, pageInfo *common.PageInfo) (invoices []*Invoice, total int64, err error) {
+	query := DB.Model(&Invoice{})
+	if userId > 0 {
+		query = query.Where("user_id = ?", userId)
+	}
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if err = query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = query.Order("id desc").Limit(pageInfo.GetPageSize()).Offset(pageInfo.GetStartIdx()).Find(&invoices).Error
+	return invoices, total, err
+}
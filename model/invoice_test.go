@@ -0,0 +1,31 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestInvoicePeriodEnd(t *testing.T) {
+	t.Parallel()
+
+	loc := time.FixedZone("UTC+8", 8*3600)
+	now := time.Date(2026, 3, 15, 10, 0, 0, 0, loc)
+	require.Equal(t, time.Date(2026, 3, 1, 0, 0, 0, 0, loc), InvoicePeriodEnd(now, 1))
+	require.Equal(t, time.Date(2026, 2, 20, 0, 0, 0, 0, loc), InvoicePeriodEnd(now, 20))
+	require.Equal(t, time.Date(2026, 3, 15, 0, 0, 0, 0, loc), InvoicePeriodEnd(now, 15))
+	require.Equal(t, time.Date(2025, 12, 10, 0, 0, 0, 0, loc), InvoicePeriodEnd(time.Date(2026, 1, 5, 0, 0, 0, 0, loc), 10))
+	require.Equal(t, time.Date(2026, 3, 1, 0, 0, 0, 0, loc), InvoicePeriodEnd(now, 31))
+}
+
+func TestUserCreditAvailable(t *testing.T) {
+	t.Parallel()
+
+	var missing *UserCredit
+	require.Zero(t, missing.Available())
+	credit := &UserCredit{CreditLimit: 5000, Status: UserCreditStatusActive}
+	require.Equal(t, 5000, credit.Available())
+	credit.Status = UserCreditStatusSuspended
+	require.Zero(t, credit.Available())
+}
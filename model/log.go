@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/logger"
 	"github.com/QuantumNous/new-api/types"
 
@@ -37,6 +38,7 @@ type Log struct {
 	Ip               string `json:"ip" gorm:"index;default:''"`
 	RequestId        string `json:"request_id,omitempty" gorm:"type:varchar(64);index:idx_logs_request_id;default:''"`
 	Other            string `json:"other"`
+	UpstreamCost     int    `json:"upstream_cost" gorm:"default:0"` // 上游成本额度，未配置渠道成本时为 0
 }
 
 // don't use iota, avoid change log type value
@@ -53,6 +55,7 @@ const (
 func formatUserLogs(logs []*Log, startIdx int) {
 	for i := range logs {
 		logs[i].ChannelName = ""
+		logs[i].UpstreamCost = 0
 		var otherMap map[string]interface{}
 		otherMap, _ = common.StrToMap(logs[i].Other)
 		if otherMap != nil {
@@ -145,6 +148,8 @@ type RecordConsumeLogParams struct {
 	UseTimeSeconds   int                    `json:"use_time_seconds"`
 	IsStream         bool                   `json:"is_stream"`
 	Group            string                 `json:"group"`
+	UpstreamCost     int                    `json:"upstream_cost"`
+	ReasoningTokens  int                    `json:"reasoning_tokens"` // 仅用于数据看板统计
 	Other            map[string]interface{} `json:"other"`
 }
 
@@ -155,6 +160,16 @@ func RecordConsumeLog(c *gin.Context, userId int, params RecordConsumeLogParams)
 	logger.LogInfo(c, fmt.Sprintf("record consume log: userId=%d, params=%s", userId, common.GetJsonString(params)))
 	username := c.GetString("username")
 	requestId := c.GetString(common.RequestIdKey)
+	// 客户端令牌发起的请求在各类消费日志中统一记录客户端令牌与终端用户
+	if clientTokenId := common.GetContextKeyInt(c, constant.ContextKeyClientTokenId); clientTokenId != 0 {
+		if params.Other == nil {
+			params.Other = make(map[string]interface{})
+		}
+		params.Other["client_token_id"] = clientTokenId
+		if endUserId := common.GetContextKeyString(c, constant.ContextKeyClientTokenEndUserId); endUserId != "" {
+			params.Other["end_user_id"] = endUserId
+		}
+	}
 	otherStr := common.MapToJsonStr(params.Other)
 	// 判断是否需要记录 IP
 	needRecordIp := false
@@ -185,8 +200,9 @@ func RecordConsumeLog(c *gin.Context, userId int, params RecordConsumeLogParams)
 			}
 			return ""
 		}(),
-		RequestId: requestId,
-		Other:     otherStr,
+		RequestId:    requestId,
+		Other:        otherStr,
+		UpstreamCost: params.UpstreamCost,
 	}
 	err := LOG_DB.Create(log).Error
 	if err != nil {
@@ -194,7 +210,7 @@ func RecordConsumeLog(c *gin.Context, userId int, params RecordConsumeLogParams)
 	}
 	if common.DataExportEnabled {
 		gopool.Go(func() {
-			LogQuotaData(userId, username, params.ModelName, params.Quota, common.GetTimestamp(), params.PromptTokens+params.CompletionTokens)
+			LogQuotaData(userId, username, params.ModelName, params.Quota, common.GetTimestamp(), params.PromptTokens+params.CompletionTokens, params.ReasoningTokens)
 		})
 	}
 }
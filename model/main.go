@@ -196,6 +196,9 @@ func InitDB() (err error) {
 		sqlDB.SetConnMaxLifetime(time.Second * time.Duration(common.GetEnvOrDefault("SQL_MAX_LIFETIME", 60)))
 
 		if !common.IsMasterNode {
+			if err := checkTokenKeyHashMigrated(); err != nil {
+				common.SysLog("failed to check token key migration: " + err.Error())
+			}
 			return nil
 		}
 		if common.UsingMySQL {
@@ -203,7 +206,10 @@ func InitDB() (err error) {
 		}
 		common.SysLog("database migration started")
 		err = migrateDB()
-		return err
+		if err != nil {
+			return err
+		}
+		return migrateTokenKeyHash()
 	} else {
 		common.FatalLog(err)
 	}
@@ -258,6 +264,13 @@ func migrateDB() error {
 		&PasskeyCredential{},
 		&Option{},
 		&Redemption{},
+		&RedemptionUsage{},
+		&UserGroupGrant{},
+		&UserCredit{},
+		&Invoice{},
+		&PriceSchedule{},
+		&ContractPrice{},
+		&ChannelBalanceHistory{},
 		&Ability{},
 		&Log{},
 		&Midjourney{},
@@ -276,6 +289,12 @@ func migrateDB() error {
 		&SubscriptionPreConsumeRecord{},
 		&CustomOAuthProvider{},
 		&UserOAuthBinding{},
+		&Organization{},
+		&OrganizationMember{},
+		&ClientToken{},
+		&PaymentEvent{},
+		&Coupon{},
+		&CouponUsage{},
 	)
 	if err != nil {
 		return err
@@ -306,6 +325,13 @@ func migrateDBFast() error {
 		{&PasskeyCredential{}, "PasskeyCredential"},
 		{&Option{}, "Option"},
 		{&Redemption{}, "Redemption"},
+		{&RedemptionUsage{}, "RedemptionUsage"},
+		{&UserGroupGrant{}, "UserGroupGrant"},
+		{&UserCredit{}, "UserCredit"},
+		{&Invoice{}, "Invoice"},
+		{&PriceSchedule{}, "PriceSchedule"},
+		{&ContractPrice{}, "ContractPrice"},
+		{&ChannelBalanceHistory{}, "ChannelBalanceHistory"},
 		{&Ability{}, "Ability"},
 		{&Log{}, "Log"},
 		{&Midjourney{}, "Midjourney"},
@@ -324,6 +350,12 @@ func migrateDBFast() error {
 		{&SubscriptionPreConsumeRecord{}, "SubscriptionPreConsumeRecord"},
 		{&CustomOAuthProvider{}, "CustomOAuthProvider"},
 		{&UserOAuthBinding{}, "UserOAuthBinding"},
+		{&Organization{}, "Organization"},
+		{&OrganizationMember{}, "OrganizationMember"},
+		{&ClientToken{}, "ClientToken"},
+		{&PaymentEvent{}, "PaymentEvent"},
+		{&Coupon{}, "Coupon"},
+		{&CouponUsage{}, "CouponUsage"},
 	}
 	// 动态计算migration数量，确保errChan缓冲区足够大
 	errChan := make(chan error, len(migrations))
@@ -89,6 +89,17 @@ func InitOptionMap() {
 	common.OptionMap["CreemProducts"] = setting.CreemProducts
 	common.OptionMap["CreemTestMode"] = strconv.FormatBool(setting.CreemTestMode)
 	common.OptionMap["CreemWebhookSecret"] = setting.CreemWebhookSecret
+	common.OptionMap["PayPalClientId"] = setting.PayPalClientId
+	common.OptionMap["PayPalClientSecret"] = setting.PayPalClientSecret
+	common.OptionMap["PayPalWebhookId"] = setting.PayPalWebhookId
+	common.OptionMap["PayPalSandbox"] = strconv.FormatBool(setting.PayPalSandbox)
+	common.OptionMap["PayPalApiBase"] = setting.PayPalApiBase
+	common.OptionMap["PayPalCurrency"] = setting.PayPalCurrency
+	common.OptionMap["PayPalUnitPrice"] = strconv.FormatFloat(setting.PayPalUnitPrice, 'f', -1, 64)
+	common.OptionMap["PayPalMinTopUp"] = strconv.Itoa(setting.PayPalMinTopUp)
+	common.OptionMap["InvoiceBillingDay"] = strconv.Itoa(setting.InvoiceBillingDay)
+	common.OptionMap["InvoicePaymentTermDays"] = strconv.Itoa(setting.InvoicePaymentTermDays)
+	common.OptionMap["InvoiceOverdueSuspend"] = strconv.FormatBool(setting.InvoiceOverdueSuspend)
 	common.OptionMap["TopupGroupRatio"] = common.TopupGroupRatio2JSONString()
 	common.OptionMap["Chats"] = setting.Chats2JsonString()
 	common.OptionMap["AutoGroups"] = setting.AutoGroups2JsonString()
@@ -116,6 +127,12 @@ func InitOptionMap() {
 	common.OptionMap["ModelPrice"] = ratio_setting.ModelPrice2JSONString()
 	common.OptionMap["CacheRatio"] = ratio_setting.CacheRatio2JSONString()
 	common.OptionMap["CreateCacheRatio"] = ratio_setting.CreateCacheRatio2JSONString()
+	common.OptionMap["ModelPricingTiers"] = ratio_setting.ModelPricingTiers2JSONString()
+	common.OptionMap["MediaPricing"] = ratio_setting.MediaPricing2JSONString()
+	common.OptionMap["PricingExpression"] = ratio_setting.PricingExpression2JSONString()
+	common.OptionMap["ReasoningRatio"] = ratio_setting.ReasoningRatio2JSONString()
+	common.OptionMap["ToolCallPrice"] = ratio_setting.ToolCallPrice2JSONString()
+	common.OptionMap["ChannelTagCostRatio"] = ratio_setting.ChannelTagCostRatio2JSONString()
 	common.OptionMap["GroupRatio"] = ratio_setting.GroupRatio2JSONString()
 	common.OptionMap["GroupGroupRatio"] = ratio_setting.GroupGroupRatio2JSONString()
 	common.OptionMap["UserUsableGroups"] = setting.UserUsableGroups2JSONString()
@@ -157,6 +174,8 @@ func InitOptionMap() {
 
 	common.OptionMapRWMutex.Unlock()
 	loadOptionsFromDatabase()
+	loadPriceSchedules()
+	loadContractPrices()
 }
 
 func loadOptionsFromDatabase() {
@@ -174,6 +193,13 @@ func SyncOptions(frequency int) {
 		time.Sleep(time.Duration(frequency) * time.Second)
 		common.SysLog("syncing options from database")
 		loadOptionsFromDatabase()
+		loadPriceSchedules()
+		loadContractPrices()
+		if !common.IsMasterNode {
+			if err := checkTokenKeyHashMigrated(); err != nil {
+				common.SysLog("failed to check token key migration: " + err.Error())
+			}
+		}
 	}
 }
 
@@ -358,6 +384,28 @@ func updateOptionMap(key string, value string) (err error) {
 		setting.CreemTestMode = value == "true"
 	case "CreemWebhookSecret":
 		setting.CreemWebhookSecret = value
+	case "PayPalClientId":
+		setting.PayPalClientId = value
+	case "PayPalClientSecret":
+		setting.PayPalClientSecret = value
+	case "PayPalWebhookId":
+		setting.PayPalWebhookId = value
+	case "PayPalSandbox":
+		setting.PayPalSandbox = value == "true"
+	case "PayPalApiBase":
+		setting.PayPalApiBase = value
+	case "PayPalCurrency":
+		setting.PayPalCurrency = value
+	case "PayPalUnitPrice":
+		setting.PayPalUnitPrice, _ = strconv.ParseFloat(value, 64)
+	case "PayPalMinTopUp":
+		setting.PayPalMinTopUp, _ = strconv.Atoi(value)
+	case "InvoiceBillingDay":
+		setting.InvoiceBillingDay, _ = strconv.Atoi(value)
+	case "InvoicePaymentTermDays":
+		setting.InvoicePaymentTermDays, _ = strconv.Atoi(value)
+	case "InvoiceOverdueSuspend":
+		setting.InvoiceOverdueSuspend = value == "true"
 	case "TopupGroupRatio":
 		err = common.UpdateTopupGroupRatioByJSONString(value)
 	case "GitHubClientId":
@@ -430,6 +478,18 @@ func updateOptionMap(key string, value string) (err error) {
 		err = ratio_setting.UpdateCacheRatioByJSONString(value)
 	case "CreateCacheRatio":
 		err = ratio_setting.UpdateCreateCacheRatioByJSONString(value)
+	case "ModelPricingTiers":
+		err = ratio_setting.UpdateModelPricingTiersByJSONString(value)
+	case "MediaPricing":
+		err = ratio_setting.UpdateMediaPricingByJSONString(value)
+	case "PricingExpression":
+		err = ratio_setting.UpdatePricingExpressionByJSONString(value)
+	case "ReasoningRatio":
+		err = ratio_setting.UpdateReasoningRatioByJSONString(value)
+	case "ToolCallPrice":
+		err = ratio_setting.UpdateToolCallPriceByJSONString(value)
+	case "ChannelTagCostRatio":
+		err = ratio_setting.UpdateChannelTagCostRatioByJSONString(value)
 	case "ImageRatio":
 		err = ratio_setting.UpdateImageRatioByJSONString(value)
 	case "AudioRatio":
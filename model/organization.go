@@ -0,0 +1,337 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"gorm.io/gorm"
+)
+
+// 组织成员角色
+const (
+	OrgRoleOwner     = "owner"
+	OrgRoleAdmin     = "admin"
+	OrgRoleDeveloper = "developer"
+	OrgRoleBilling   = "billing"
+)
+
+var (
+	ErrOrgQuotaInsufficient    = errors.New("organization quota insufficient")
+	ErrOrgMemberBudgetExceeded = errors.New("organization member budget exceeded")
+	ErrOrgMemberNotFound       = errors.New("organization member not found")
+)
+
+// Organization 组织，拥有共享额度钱包和组织令牌
+type Organization struct {
+	Id          int    `json:"id"`
+	Name        string `json:"name" gorm:"type:varchar(64);index"`
+	OwnerId     int    `json:"owner_id" gorm:"index"`
+	Quota       int    `json:"quota" gorm:"type:int;default:0"`
+	UsedQuota   int    `json:"used_quota" gorm:"type:int;default:0"`
+	Status      int    `json:"status" gorm:"type:int;default:1"`
+	CreatedTime int64  `json:"created_time" gorm:"bigint"`
+}
+
+// OrganizationMember 组织成员，QuotaLimit 为成员在组织钱包上的消费上限（0 表示不限制）
+type OrganizationMember struct {
+	Id          int    `json:"id"`
+	OrgId       int    `json:"org_id" gorm:"uniqueIndex:idx_org_member,priority:1"`
+	UserId      int    `json:"user_id" gorm:"uniqueIndex:idx_org_member,priority:2;index"`
+	Role        string `json:"role" gorm:"type:varchar(16);default:'developer'"`
+	QuotaLimit  int    `json:"quota_limit" gorm:"type:int;default:0"`
+	UsedQuota   int    `json:"used_quota" gorm:"type:int;default:0"`
+	CreatedTime int64  `json:"created_time" gorm:"bigint"`
+	Username    string `json:"username" gorm:"-"`
+}
+
+// OrganizationMemberUsage 组织按成员汇总的用量
+type OrganizationMemberUsage struct {
+	UserId           int    `json:"user_id"`
+	Username         string `json:"username"`
+	Quota            int    `json:"quota"`
+	PromptTokens     int    `json:"prompt_tokens"`
+	CompletionTokens int    `json:"completion_tokens"`
+	Count            int    `json:"count"`
+}
+
+func IsValidOrgRole(role string) bool {
+	switch role {
+	case OrgRoleOwner, OrgRoleAdmin, OrgRoleDeveloper, OrgRoleBilling:
+		return true
+	}
+	return false
+}
+
+// CanManage 是否可以管理成员、预算和组织令牌
+func (m *OrganizationMember) CanManage() bool {
+	return m.Role == OrgRoleOwner || m.Role == OrgRoleAdmin
+}
+
+// CanUseTokens 是否可以创建和使用组织令牌（账单查看者不可以）
+func (m *OrganizationMember) CanUseTokens() bool {
+	return m.Role != OrgRoleBilling
+}
+
+// CreateOrganization 创建组织并把创建者设为 owner
+func CreateOrganization(name string, ownerId int) (*Organization, error) {
+	org := &Organization{
+		Name:        name,
+		OwnerId:     ownerId,
+		Status:      common.UserStatusEnabled,
+		CreatedTime: common.GetTimestamp(),
+	}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(org).Error; err != nil {
+			return err
+		}
+		return tx.Create(&OrganizationMember{
+			OrgId:       org.Id,
+			UserId:      ownerId,
+			Role:        OrgRoleOwner,
+			CreatedTime: org.CreatedTime,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return org, nil
+}
+
+func GetOrganizationById(id int) (*Organization, error) {
+	if id == 0 {
+		return nil, errors.New("id 为空！")
+	}
+	var org Organization
+	err := DB.First(&org, "id = ?", id).Error
+	return &org, err
+}
+
+func GetUserOrganizations(userId int) ([]*Organization, error) {
+	var orgs []*Organization
+	err := DB.Where("id IN (?)", DB.Model(&OrganizationMember{}).Select("org_id").Where("user_id = ?", userId)).
+		Order("id desc").Find(&orgs).Error
+	return orgs, err
+}
+
+func GetAllOrganizations(startIdx int, num int) ([]*Organization, int64, error) {
+	var orgs []*Organization
+	var total int64
+	if err := DB.Model(&Organization{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err := DB.Order("id desc").Limit(num).Offset(startIdx).Find(&orgs).Error
+	return orgs, total, err
+}
+
+func (org *Organization) Update() error {
+	return DB.Model(org).Select("name", "status").Updates(org).Error
+}
+
+func DeleteOrganization(id int) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("org_id = ?", id).Delete(&OrganizationMember{}).Error; err != nil {
+			return err
+		}
+		// 组织令牌随组织一起失效
+		if err := tx.Model(&Token{}).Where("org_id = ?", id).Update("status", common.TokenStatusDisabled).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&Organization{}, "id = ?", id).Error
+	})
+}
+
+func GetOrganizationMember(orgId int, userId int) (*OrganizationMember, error) {
+	var member OrganizationMember
+	err := DB.First(&member, "org_id = ? AND user_id = ?", orgId, userId).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrOrgMemberNotFound
+	}
+	return &member, err
+}
+
+func GetOrganizationMembers(orgId int) ([]*OrganizationMember, error) {
+	var members []*OrganizationMember
+	if err := DB.Where("org_id = ?", orgId).Order("id asc").Find(&members).Error; err != nil {
+		return nil, err
+	}
+	userIds := make([]int, 0, len(members))
+	for _, m := range members {
+		userIds = append(userIds, m.UserId)
+	}
+	var users []User
+	if len(userIds) > 0 {
+		if err := DB.Select("id", "username").Where("id IN ?", userIds).Find(&users).Error; err != nil {
+			return nil, err
+		}
+	}
+	names := make(map[int]string, len(users))
+	for _, u := range users {
+		names[u.Id] = u.Username
+	}
+	for _, m := range members {
+		m.Username = names[m.UserId]
+	}
+	return members, nil
+}
+
+func AddOrganizationMember(member *OrganizationMember) error {
+	member.CreatedTime = common.GetTimestamp()
+	return DB.Create(member).Error
+}
+
+// UpdateOrganizationMember 更新成员角色与预算，resetUsed 为 true 时清零已用额度
+func UpdateOrganizationMember(member *OrganizationMember, resetUsed bool) error {
+	fields := []string{"role", "quota_limit"}
+	if resetUsed {
+		member.UsedQuota = 0
+		fields = append(fields, "used_quota")
+	}
+	return DB.Model(member).Select(fields).Updates(member).Error
+}
+
+func RemoveOrganizationMember(orgId int, userId int) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("org_id = ? AND user_id = ?", orgId, userId).Delete(&OrganizationMember{}).Error; err != nil {
+			return err
+		}
+		// 移除成员后其创建的组织令牌一并禁用
+		return tx.Model(&Token{}).Where("org_id = ? AND user_id = ?", orgId, userId).
+			Update("status", common.TokenStatusDisabled).Error
+	})
+}
+
+func GetOrganizationTokens(orgId int, startIdx int, num int) ([]*Token, int64, error) {
+	var tokens []*Token
+	var total int64
+	if err := DB.Model(&Token{}).Where("org_id = ?", orgId).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err := DB.Where("org_id = ?", orgId).Order("id desc").Limit(num).Offset(startIdx).Find(&tokens).Error
+	return tokens, total, err
+}
+
+// PreConsumeOrganizationQuota 从组织钱包预扣额度，同时校验并累加成员预算
+func PreConsumeOrganizationQuota(orgId int, userId int, amount int) error {
+	if amount <= 0 {
+		return nil
+	}
+	return DB.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&OrganizationMember{}).
+			Where("org_id = ? AND user_id = ? AND (quota_limit = 0 OR used_quota + ? <= quota_limit)", orgId, userId, amount).
+			Update("used_quota", gorm.Expr("used_quota + ?", amount))
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			var count int64
+			if err := tx.Model(&OrganizationMember{}).Where("org_id = ? AND user_id = ?", orgId, userId).Count(&count).Error; err != nil {
+				return err
+			}
+			if count == 0 {
+				return ErrOrgMemberNotFound
+			}
+			return ErrOrgMemberBudgetExceeded
+		}
+		res = tx.Model(&Organization{}).
+			Where("id = ? AND status = ? AND quota >= ?", orgId, common.UserStatusEnabled, amount).
+			Updates(map[string]interface{}{
+				"quota":      gorm.Expr("quota - ?", amount),
+				"used_quota": gorm.Expr("used_quota + ?", amount),
+			})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrOrgQuotaInsufficient
+		}
+		return nil
+	})
+}
+
+// DeltaUpdateOrganizationQuota 按差额调整组织钱包和成员已用额度（正数补扣，负数退还）。
+// 结算阶段不再校验余额和预算，与钱包的后结算行为保持一致。
+func DeltaUpdateOrganizationQuota(orgId int, userId int, delta int) error {
+	if delta == 0 {
+		return nil
+	}
+	return DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&OrganizationMember{}).Where("org_id = ? AND user_id = ?", orgId, userId).
+			Update("used_quota", gorm.Expr("used_quota + ?", delta)).Error
+		if err != nil {
+			return err
+		}
+		return tx.Model(&Organization{}).Where("id = ?", orgId).
+			Updates(map[string]interface{}{
+				"quota":      gorm.Expr("quota - ?", delta),
+				"used_quota": gorm.Expr("used_quota + ?", delta),
+			}).Error
+	})
+}
+
+// TransferUserQuotaToOrganization 将个人额度划转到组织钱包
+func TransferUserQuotaToOrganization(userId int, orgId int, amount int) error {
+	if amount <= 0 {
+		return errors.New("划转额度必须大于 0")
+	}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&User{}).Where("id = ? AND quota >= ?", userId, amount).
+			Update("quota", gorm.Expr("quota - ?", amount))
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errors.New("用户额度不足")
+		}
+		return tx.Model(&Organization{}).Where("id = ?", orgId).
+			Update("quota", gorm.Expr("quota + ?", amount)).Error
+	})
+	if err != nil {
+		return err
+	}
+	gopool.Go(func() {
+		if err := cacheDecrUserQuota(userId, int64(amount)); err != nil {
+			common.SysLog("failed to decrease user quota cache: " + err.Error())
+		}
+	})
+	RecordLog(userId, LogTypeManage, fmt.Sprintf("向组织 %d 划转额度 %s", orgId, logger.LogQuota(amount)))
+	return nil
+}
+
+// AdjustOrganizationQuota 管理员直接调整组织钱包额度
+func AdjustOrganizationQuota(orgId int, delta int) error {
+	return DB.Model(&Organization{}).Where("id = ?", orgId).
+		Update("quota", gorm.Expr("quota + ?", delta)).Error
+}
+
+// GetOrganizationUsageByMember 统计组织令牌在时间范围内按成员汇总的消费
+func GetOrganizationUsageByMember(orgId int, startTimestamp int64, endTimestamp int64) ([]*OrganizationMemberUsage, error) {
+	var tokenIds []int
+	if err := DB.Unscoped().Model(&Token{}).Where("org_id = ?", orgId).Pluck("id", &tokenIds).Error; err != nil {
+		return nil, err
+	}
+	usages := make([]*OrganizationMemberUsage, 0)
+	if len(tokenIds) == 0 {
+		return usages, nil
+	}
+	tx := LOG_DB.Table("logs").
+		Select("user_id, username, sum(quota) as quota, sum(prompt_tokens) as prompt_tokens, sum(completion_tokens) as completion_tokens, count(*) as count").
+		Where("type = ? AND token_id IN ?", LogTypeConsume, tokenIds)
+	if startTimestamp != 0 {
+		tx = tx.Where("created_at >= ?", startTimestamp)
+	}
+	if endTimestamp != 0 {
+		tx = tx.Where("created_at <= ?", endTimestamp)
+	}
+	err := tx.Group("user_id, username").Order("quota desc").Scan(&usages).Error
+	return usages, err
+}
+
+func GetUserIdByUsername(username string) (int, error) {
+	var user User
+	err := DB.Select("id").Where("username = ?", username).First(&user).Error
+	return user.Id, err
+}
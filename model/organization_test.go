@@ -0,0 +1,73 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/stretchr/testify/require"
+)
+
+func setupTestOrganization(t *testing.T, quota int, quotaLimit int) (*Organization, int) {
+	t.Helper()
+	setupTestDB(t, &Organization{}, &OrganizationMember{})
+	org, err := CreateOrganization("acme", 1)
+	require.NoError(t, err)
+	require.NoError(t, AdjustOrganizationQuota(org.Id, quota))
+	userId := 2
+	require.NoError(t, AddOrganizationMember(&OrganizationMember{OrgId: org.Id, UserId: userId, Role: OrgRoleDeveloper, QuotaLimit: quotaLimit}))
+	return org, userId
+}
+
+func requireOrganizationQuota(t *testing.T, orgId int, userId int, quota int, orgUsed int, memberUsed int) {
+	t.Helper()
+	org, err := GetOrganizationById(orgId)
+	require.NoError(t, err)
+	require.Equal(t, quota, org.Quota)
+	require.Equal(t, orgUsed, org.UsedQuota)
+	member, err := GetOrganizationMember(orgId, userId)
+	require.NoError(t, err)
+	require.Equal(t, memberUsed, member.UsedQuota)
+}
+
+func TestPreConsumeOrganizationQuota(t *testing.T) {
+	org, userId := setupTestOrganization(t, 1000, 500)
+
+	require.NoError(t, PreConsumeOrganizationQuota(org.Id, userId, 300))
+	requireOrganizationQuota(t, org.Id, userId, 700, 300, 300)
+
+	// 超出成员预算
+	require.ErrorIs(t, PreConsumeOrganizationQuota(org.Id, userId, 201), ErrOrgMemberBudgetExceeded)
+	requireOrganizationQuota(t, org.Id, userId, 700, 300, 300)
+
+	require.NoError(t, PreConsumeOrganizationQuota(org.Id, userId, 200))
+	requireOrganizationQuota(t, org.Id, userId, 500, 500, 500)
+
+	// 不是组织成员
+	require.ErrorIs(t, PreConsumeOrganizationQuota(org.Id, 3, 1), ErrOrgMemberNotFound)
+}
+
+func TestPreConsumeOrganizationQuotaInsufficient(t *testing.T) {
+	org, userId := setupTestOrganization(t, 100, 0)
+
+	// 组织余额不足时回滚成员已用额度
+	require.ErrorIs(t, PreConsumeOrganizationQuota(org.Id, userId, 101), ErrOrgQuotaInsufficient)
+	requireOrganizationQuota(t, org.Id, userId, 100, 0, 0)
+
+	// 组织被禁用
+	org.Status = common.UserStatusDisabled
+	require.NoError(t, org.Update())
+	require.ErrorIs(t, PreConsumeOrganizationQuota(org.Id, userId, 10), ErrOrgQuotaInsufficient)
+	requireOrganizationQuota(t, org.Id, userId, 100, 0, 0)
+}
+
+func TestDeltaUpdateOrganizationQuota(t *testing.T) {
+	org, userId := setupTestOrganization(t, 1000, 400)
+	require.NoError(t, PreConsumeOrganizationQuota(org.Id, userId, 400))
+
+	// 结算补扣不再校验预算
+	require.NoError(t, DeltaUpdateOrganizationQuota(org.Id, userId, 50))
+	requireOrganizationQuota(t, org.Id, userId, 550, 450, 450)
+
+	require.NoError(t, DeltaUpdateOrganizationQuota(org.Id, userId, -450))
+	requireOrganizationQuota(t, org.Id, userId, 1000, 0, 0)
+}
@@ -0,0 +1,35 @@
+package model
+
+import (
+	"github.com/QuantumNous/new-api/common"
+	"gorm.io/gorm/clause"
+)
+
+// PaymentEvent 记录已处理的支付回调事件，用于 webhook 幂等
+type PaymentEvent struct {
+	Id          int    `json:"id"`
+	Provider    string `json:"provider" gorm:"type:varchar(32);uniqueIndex:idx_payment_event"`
+	EventId     string `json:"event_id" gorm:"type:varchar(255);uniqueIndex:idx_payment_event"`
+	EventType   string `json:"event_type" gorm:"type:varchar(64)"`
+	CreatedTime int64  `json:"created_time" gorm:"bigint"`
+}
+
+// ClaimPaymentEvent 占用一个回调事件，返回 false 表示该事件已处理过
+func ClaimPaymentEvent(provider string, eventId string, eventType string) (bool, error) {
+	event := &PaymentEvent{
+		Provider:    provider,
+		EventId:     eventId,
+		EventType:   eventType,
+		CreatedTime: common.GetTimestamp(),
+	}
+	res := DB.Clauses(clause.OnConflict{DoNothing: true}).Create(event)
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected > 0, nil
+}
+
+// ReleasePaymentEvent 事件处理失败时释放占用，允许支付平台重试
+func ReleasePaymentEvent(provider string, eventId string) error {
+	return DB.Where("provider = ? AND event_id = ?", provider, eventId).Delete(&PaymentEvent{}).Error
+}
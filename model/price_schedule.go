@@ -0,0 +1,312 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+)
+
+const (
+	PriceScheduleStatusEnabled  = 1
+	PriceScheduleStatusDisabled = 2
+)
+
+// PriceSchedule 定时生效的价格计划，在 [EffectiveFrom, EffectiveTo) 内且处于每日时段内时生效：
+//   - ModelRatio / CompletionRatio / ModelPrice 覆盖对应模型的基础配置，多个计划同时覆盖同一模型时以生效时间最晚的为准
+//   - Multiplier 作用于 Models 内模型的最终价格，如闲时 5 折为 0.5，多个计划同时生效时相乘
+//
+// 已生效的计划只能停用或设置结束时间，调整价格需新建计划，以便按消费日志中记录的计划 id 追溯账单
+type PriceSchedule struct {
+	Id              int     `json:"id"`
+	Name            string  `json:"name" gorm:"type:varchar(128)"`
+	Models          string  `json:"models" gorm:"type:text"`                        // 逗号分隔，Multiplier 的适用模型，为空表示全部模型
+	ModelRatio      string  `json:"model_ratio" gorm:"type:text"`                   // JSON，模型 -> 模型倍率
+	CompletionRatio string  `json:"completion_ratio" gorm:"type:text"`              // JSON，模型 -> 补全倍率
+	ModelPrice      string  `json:"model_price" gorm:"type:text"`                   // JSON，模型 -> 按次价格
+	Multiplier      float64 `json:"multiplier" gorm:"default:0"`                    // 0 表示不调整
+	WindowStart     string  `json:"window_start" gorm:"type:varchar(8);default:''"` // 每日时段 HH:MM，为空表示全天
+	WindowEnd       string  `json:"window_end" gorm:"type:varchar(8);default:''"`
+	UtcOffset       int     `json:"utc_offset" gorm:"default:0"` // 时段所在时区相对 UTC 的分钟数，如 UTC+8 为 480
+	EffectiveFrom   int64   `json:"effective_from" gorm:"bigint;index"`
+	EffectiveTo     int64   `json:"effective_to" gorm:"bigint;default:0"` // 0 表示长期有效
+	Status          int     `json:"status" gorm:"type:int;default:1"`
+	CreatedTime     int64   `json:"created_time" gorm:"bigint"`
+	UpdatedTime     int64   `json:"updated_time" gorm:"bigint"`
+}
+
+// priceScheduleEntry 解析后的价格计划，供请求时查询
+type priceScheduleEntry struct {
+	id              int
+	models          map[string]bool
+	modelRatio      map[string]float64
+	completionRatio map[string]float64
+	modelPrice      map[string]float64
+	multiplier      float64
+	windowStart     int // 每日时段的起止分钟，相等表示全天
+	windowEnd       int
+	utcOffset       int
+	effectiveFrom   int64
+	effectiveTo     int64
+}
+
+var priceSchedules atomic.Pointer[[]*priceScheduleEntry]
+
+// ScheduledPrice 请求时生效的价格计划
+type ScheduledPrice struct {
+	ModelRatio         float64 `json:"model_ratio"`
+	HasModelRatio      bool    `json:"has_model_ratio"`
+	CompletionRatio    float64 `json:"completion_ratio"`
+	HasCompletionRatio bool    `json:"has_completion_ratio"`
+	ModelPrice         float64 `json:"model_price"`
+	HasModelPrice      bool    `json:"has_model_price"`
+	Multiplier         float64 `json:"multiplier"`
+	ScheduleIds        []int   `json:"schedule_ids"`
+}
+
+func parseWindowMinute(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("无效的时段 %s，格式应为 HH:MM", value)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func parsePriceMap(value string) (map[string]float64, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+	var m map[string]float64
+	if err := common.Unmarshal([]byte(value), &m); err != nil {
+		return nil, err
+	}
+	for name, v := range m {
+		if v < 0 {
+			return nil, fmt.Errorf("模型 %s 的价格不能为负数", name)
+		}
+	}
+	return m, nil
+}
+
+func (schedule *PriceSchedule) parse() (*priceScheduleEntry, error) {
+	entry := &priceScheduleEntry{
+		id:            schedule.Id,
+		multiplier:    schedule.Multiplier,
+		utcOffset:     schedule.UtcOffset,
+		effectiveFrom: schedule.EffectiveFrom,
+		effectiveTo:   schedule.EffectiveTo,
+	}
+	var err error
+	if entry.modelRatio, err = parsePriceMap(schedule.ModelRatio); err != nil {
+		return nil, fmt.Errorf("模型倍率: %w", err)
+	}
+	if entry.completionRatio, err = parsePriceMap(schedule.CompletionRatio); err != nil {
+		return nil, fmt.Errorf("补全倍率: %w", err)
+	}
+	if entry.modelPrice, err = parsePriceMap(schedule.ModelPrice); err != nil {
+		return nil, fmt.Errorf("模型价格: %w", err)
+	}
+	if entry.windowStart, err = parseWindowMinute(schedule.WindowStart); err != nil {
+		return nil, err
+	}
+	if entry.windowEnd, err = parseWindowMinute(schedule.WindowEnd); err != nil {
+		return nil, err
+	}
+	for _, name := range strings.Split(schedule.Models, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			if entry.models == nil {
+				entry.models = make(map[string]bool)
+			}
+			entry.models[name] = true
+		}
+	}
+	return entry, nil
+}
+
+// Validate 检查管理员提交的价格计划
+func (schedule *PriceSchedule) Validate() error {
+	schedule.Name = strings.TrimSpace(schedule.Name)
+	if schedule.Name == "" {
+		return errors.New("名称不能为空")
+	}
+	if schedule.Multiplier < 0 {
+		return errors.New("价格倍数不能为负数")
+	}
+	if schedule.UtcOffset < -12*60 || schedule.UtcOffset > 14*60 {
+		return errors.New("无效的时区")
+	}
+	if (schedule.WindowStart == "") != (schedule.WindowEnd == "") {
+		return errors.New("时段需要同时设置开始和结束时间")
+	}
+	if schedule.EffectiveTo != 0 && schedule.EffectiveTo <= schedule.EffectiveFrom {
+		return errors.New("结束时间必须晚于生效时间")
+	}
+	entry, err := schedule.parse()
+	if err != nil {
+		return err
+	}
+	if entry.multiplier == 0 && len(entry.modelRatio) == 0 && len(entry.completionRatio) == 0 && len(entry.modelPrice) == 0 {
+		return errors.New("价格计划必须设置价格或价格倍数")
+	}
+	if schedule.Status == 0 {
+		schedule.Status = PriceScheduleStatusEnabled
+	}
+	if schedule.Status != PriceScheduleStatusEnabled && schedule.Status != PriceScheduleStatusDisabled {
+		return errors.New("无效的状态")
+	}
+	return nil
+}
+
+// Started 计划是否已到生效时间
+func (schedule *PriceSchedule) Started() bool {
+	return schedule.EffectiveFrom <= common.GetTimestamp()
+}
+
+func (schedule *PriceSchedule) Insert() error {
+	now := common.GetTimestamp()
+	schedule.CreatedTime = now
+	schedule.UpdatedTime = now
+	if err := DB.Create(schedule).Error; err != nil {
+		return err
+	}
+	return LoadPriceSchedules()
+}
+
+// Update 保存修改，started 为 true 时只更新状态与结束时间
+func (schedule *PriceSchedule) Update(started bool) error {
+	schedule.UpdatedTime = common.GetTimestamp()
+	fields := []string{"status", "effective_to", "updated_time"}
+	if !started {
+		fields = append(fields, "name", "models", "model_ratio", "completion_ratio", "model_price", "multiplier",
+			"window_start", "window_end", "utc_offset", "effective_from")
+	}
+	if err := DB.Model(schedule).Select(fields).Updates(schedule).Error; err != nil {
+		return err
+	}
+	return LoadPriceSchedules()
+}
+
+func (schedule *PriceSchedule) Delete() error {
+	if err := DB.Delete(schedule).Error; err != nil {
+		return err
+	}
+	return LoadPriceSchedules()
+}
+
+func GetPriceScheduleById(id int) (*PriceSchedule, error) {
+	var schedule PriceSchedule
+	if err := DB.Where("id = ?", id).First(&schedule).Error; err != nil {
+		return nil, err
+	}
+	return &schedule, nil
+}
+
+func GetAllPriceSchedules(pageInfo *common.PageInfo) (schedules []*PriceSchedule, total int64, err error) {
+	query := DB.Model(&PriceSchedule{})
+	if err = query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = query.Order("effective_from desc, id desc").Limit(pageInfo.GetPageSize()).Offset(pageInfo.GetStartIdx()).Find(&schedules).Error
+	return schedules, total, err
+}
+
+// LoadPriceSchedules 从数据库加载启用中且未结束的价格计划到内存
+func LoadPriceSchedules() error {
+	var schedules []*PriceSchedule
+	now := common.GetTimestamp()
+	if err := DB.Where("status = ? AND (effective_to = 0 OR effective_to > ?)", PriceScheduleStatusEnabled, now).
+		Order("effective_from asc, id asc").Find(&schedules).Error; err != nil {
+		return err
+	}
+	entries := make([]*priceScheduleEntry, 0, len(schedules))
+	for _, schedule := range schedules {
+		entry, err := schedule.parse()
+		if err != nil {
+			common.SysError(fmt.Sprintf("invalid price schedule %d: %s", schedule.Id, err.Error()))
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	priceSchedules.Store(&entries)
+	return nil
+}
+
+func loadPriceSchedules() {
+	if err := LoadPriceSchedules(); err != nil {
+		common.SysError("failed to load price schedules: " + err.Error())
+	}
+}
+
+func (entry *priceScheduleEntry) activeAt(now time.Time) bool {
+	ts := now.Unix()
+	if ts < entry.effectiveFrom || (entry.effectiveTo != 0 && ts >= entry.effectiveTo) {
+		return false
+	}
+	if entry.windowStart == entry.windowEnd {
+		return true
+	}
+	minute := int(((ts+int64(entry.utcOffset)*60)%86400+86400)%86400) / 60
+	if entry.windowStart < entry.windowEnd {
+		return minute >= entry.windowStart && minute < entry.windowEnd
+	}
+	// 跨零点的时段，如 22:00-06:00
+	return minute >= entry.windowStart || minute < entry.windowEnd
+}
+
+// resolveScheduledPrice 按生效时间升序遍历，后生效的计划覆盖先生效的
+func resolveScheduledPrice(entries []*priceScheduleEntry, modelName string, now time.Time) *ScheduledPrice {
+	matchName := ratio_setting.FormatMatchingModelName(modelName)
+	var result *ScheduledPrice
+	for _, entry := range entries {
+		if !entry.activeAt(now) {
+			continue
+		}
+		applied := false
+		lookup := func(m map[string]float64) (float64, bool) {
+			if v, ok := m[modelName]; ok {
+				return v, true
+			}
+			v, ok := m[matchName]
+			return v, ok
+		}
+		if result == nil {
+			result = &ScheduledPrice{Multiplier: 1}
+		}
+		if v, ok := lookup(entry.modelRatio); ok {
+			result.ModelRatio, result.HasModelRatio, applied = v, true, true
+		}
+		if v, ok := lookup(entry.completionRatio); ok {
+			result.CompletionRatio, result.HasCompletionRatio, applied = v, true, true
+		}
+		if v, ok := lookup(entry.modelPrice); ok {
+			result.ModelPrice, result.HasModelPrice, applied = v, true, true
+		}
+		if entry.multiplier > 0 && (entry.models == nil || entry.models[modelName] || entry.models[matchName]) {
+			result.Multiplier *= entry.multiplier
+			applied = true
+		}
+		if applied {
+			result.ScheduleIds = append(result.ScheduleIds, entry.id)
+		}
+	}
+	if result == nil || len(result.ScheduleIds) == 0 {
+		return nil
+	}
+	return result
+}
+
+// ResolveScheduledPrice 返回模型在 now 时刻生效的价格计划，没有计划生效时返回 nil
+func ResolveScheduledPrice(modelName string, now time.Time) *ScheduledPrice {
+	entries := priceSchedules.Load()
+	if entries == nil || len(*entries) == 0 {
+		return nil
+	}
+	return resolveScheduledPrice(*entries, modelName, now)
+}
@@ -0,0 +1,64 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveScheduledPrice(t *testing.T) {
+	t.Parallel()
+
+	base := time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC).Unix()
+	v1, err := (&PriceSchedule{Id: 1, ModelRatio: `{"deepseek-chat":0.135}`, EffectiveFrom: base}).parse()
+	require.NoError(t, err)
+	v2, err := (&PriceSchedule{Id: 2, ModelRatio: `{"deepseek-chat":0.2}`, CompletionRatio: `{"deepseek-chat":4}`, EffectiveFrom: base + 12*3600}).parse()
+	require.NoError(t, err)
+	// 00:30-08:30 UTC+8 闲时 5 折
+	offPeak, err := (&PriceSchedule{Id: 3, Models: "deepseek-chat,deepseek-reasoner", Multiplier: 0.5,
+		WindowStart: "00:30", WindowEnd: "08:30", UtcOffset: 480, EffectiveFrom: base}).parse()
+	require.NoError(t, err)
+	entries := []*priceScheduleEntry{v1, offPeak, v2}
+
+	// 2026-05-01 12:00 UTC+8，只有第一个版本生效
+	at := time.Date(2026, 5, 1, 4, 0, 0, 0, time.UTC)
+	price := resolveScheduledPrice(entries, "deepseek-chat", at)
+	require.NotNil(t, price)
+	require.True(t, price.HasModelRatio)
+	require.Equal(t, 0.135, price.ModelRatio)
+	require.False(t, price.HasCompletionRatio)
+	require.Equal(t, 1.0, price.Multiplier)
+	require.Equal(t, []int{1}, price.ScheduleIds)
+
+	// 2026-05-02 01:00 UTC+8，新版本覆盖旧版本并叠加闲时折扣
+	at = time.Date(2026, 5, 1, 17, 0, 0, 0, time.UTC)
+	price = resolveScheduledPrice(entries, "deepseek-chat", at)
+	require.Equal(t, 0.2, price.ModelRatio)
+	require.Equal(t, 4.0, price.CompletionRatio)
+	require.Equal(t, 0.5, price.Multiplier)
+	require.Equal(t, []int{1, 3, 2}, price.ScheduleIds)
+
+	// 08:30 为时段结束，不再打折
+	at = time.Date(2026, 5, 2, 0, 30, 0, 0, time.UTC)
+	require.Equal(t, 1.0, resolveScheduledPrice(entries, "deepseek-chat", at).Multiplier)
+
+	require.Nil(t, resolveScheduledPrice(entries, "gpt-4o", at))
+	require.Nil(t, resolveScheduledPrice(entries, "deepseek-chat", time.Unix(base-1, 0)))
+}
+
+func TestPriceScheduleWindowAcrossMidnight(t *testing.T) {
+	t.Parallel()
+
+	entry, err := (&PriceSchedule{Multiplier: 0.8, WindowStart: "22:00", WindowEnd: "06:00"}).parse()
+	require.NoError(t, err)
+	require.True(t, entry.activeAt(time.Date(2026, 5, 1, 23, 0, 0, 0, time.UTC)))
+	require.True(t, entry.activeAt(time.Date(2026, 5, 1, 5, 59, 0, 0, time.UTC)))
+	require.False(t, entry.activeAt(time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)))
+
+	require.Error(t, (&PriceSchedule{Name: "x", Multiplier: 0.5, WindowStart: "25:00", WindowEnd: "06:00"}).Validate())
+	require.Error(t, (&PriceSchedule{Name: "x", Multiplier: 0.5, WindowStart: "22:00"}).Validate())
+	require.Error(t, (&PriceSchedule{Name: "x"}).Validate())
+	require.Error(t, (&PriceSchedule{Name: "x", ModelRatio: `{"a":-1}`}).Validate())
+	require.NoError(t, (&PriceSchedule{Name: "x", ModelPrice: `{"mj_imagine":0.05}`}).Validate())
+}
@@ -28,6 +28,7 @@ type Pricing struct {
 	EnableGroup            []string                `json:"enable_groups"`
 	SupportedEndpointTypes []constant.EndpointType `json:"supported_endpoint_types"`
 	PricingVersion         string                  `json:"pricing_version,omitempty"`
+	ContractPrice          bool                    `json:"contract_price,omitempty"` // 当前用户的合同价，不再叠加分组倍率
 }
 
 type PricingVendor struct {
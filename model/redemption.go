@@ -4,11 +4,13 @@ import (
 	"errors"
 	"fmt"
 	"strconv"
+	"strings"
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/logger"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // ErrRedeemFailed is returned when redemption fails due to database error
@@ -27,6 +29,143 @@ type Redemption struct {
 	UsedUserId   int            `json:"used_user_id"`
 	DeletedAt    gorm.DeletedAt `gorm:"index"`
 	ExpiredTime  int64          `json:"expired_time" gorm:"bigint"` // 过期时间，0 表示不过期
+
+	// 活动兑换码：MaxUses 大于 1 时可被多人兑换，UsedUserId 仅记录单次兑换码的使用者
+	MaxUses        int `json:"max_uses" gorm:"default:0"`          // 总兑换次数，0 或 1 为单次兑换码
+	MaxUsesPerUser int `json:"max_uses_per_user" gorm:"default:0"` // 单用户兑换次数上限，0 表示不限
+	UsedCount      int `json:"used_count" gorm:"default:0"`
+
+	// 兑换条件
+	NewUserOnly     bool   `json:"new_user_only" gorm:"default:false"`         // 仅限从未充值、兑换过的用户
+	Groups          string `json:"groups" gorm:"type:varchar(255);default:''"` // 逗号分隔的可兑换分组，为空表示不限
+	RegisteredAfter int64  `json:"registered_after" gorm:"bigint;default:0"`   // 仅限该时间之后注册的用户
+
+	// 兑换内容：除额度外还可赠送订阅套餐或临时分组升级
+	PlanId           int    `json:"plan_id" gorm:"default:0"`
+	UpgradeGroup     string `json:"upgrade_group" gorm:"type:varchar(64);default:''"`
+	UpgradeGroupDays int    `json:"upgrade_group_days" gorm:"default:0"`
+}
+
+// RedemptionUsage 兑换码的兑换记录，用于多次兑换码的次数限制与活动统计
+type RedemptionUsage struct {
+	Id                 int    `json:"id"`
+	RedemptionId       int    `json:"redemption_id" gorm:"index"`
+	UserId             int    `json:"user_id" gorm:"index"`
+	Quota              int    `json:"quota"`
+	PlanId             int    `json:"plan_id"`
+	UserSubscriptionId int    `json:"user_subscription_id"`
+	UpgradeGroup       string `json:"upgrade_group" gorm:"type:varchar(64);default:''"`
+	CreatedTime        int64  `json:"created_time" gorm:"bigint"`
+}
+
+// RedeemRejectedError 兑换码有效但当前用户不满足兑换条件，错误信息可直接展示给用户
+type RedeemRejectedError struct {
+	Reason string
+}
+
+func (e *RedeemRejectedError) Error() string {
+	return e.Reason
+}
+
+// IsCampaign 是否为可多次兑换的活动兑换码
+func (redemption *Redemption) IsCampaign() bool {
+	return redemption.MaxUses > 1
+}
+
+// ValidateGrant 检查兑换码的兑换内容与条件配置
+func (redemption *Redemption) ValidateGrant() error {
+	if redemption.Quota < 0 || redemption.MaxUses < 0 || redemption.MaxUsesPerUser < 0 || redemption.UpgradeGroupDays < 0 {
+		return errors.New("兑换码参数不能为负数")
+	}
+	redemption.UpgradeGroup = strings.TrimSpace(redemption.UpgradeGroup)
+	if redemption.UpgradeGroup != "" && redemption.UpgradeGroupDays == 0 {
+		return errors.New("请设置分组升级的有效天数")
+	}
+	if redemption.Quota == 0 && redemption.PlanId == 0 && redemption.UpgradeGroup == "" {
+		return errors.New("兑换码必须赠送额度、套餐或分组")
+	}
+	if redemption.PlanId > 0 {
+		if _, err := GetSubscriptionPlanById(redemption.PlanId); err != nil {
+			return errors.New("赠送的套餐不存在")
+		}
+	}
+	return nil
+}
+
+// checkEligibleTx 检查用户是否满足兑换条件
+func (redemption *Redemption) checkEligibleTx(tx *gorm.DB, userId int) error {
+	var user User
+	if err := tx.Where("id = ?", userId).First(&user).Error; err != nil {
+		return err
+	}
+	if groups := strings.TrimSpace(redemption.Groups); groups != "" {
+		allowed := false
+		for _, group := range strings.Split(groups, ",") {
+			if strings.TrimSpace(group) == user.Group {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return &RedeemRejectedError{Reason: "当前分组不可使用该兑换码"}
+		}
+	}
+	if redemption.RegisteredAfter > 0 && user.CreatedTime < redemption.RegisteredAfter {
+		return &RedeemRejectedError{Reason: "该兑换码仅限新注册用户使用"}
+	}
+	if redemption.NewUserOnly {
+		var paid, redeemed int64
+		if err := tx.Model(&TopUp{}).Where("user_id = ? AND status = ?", userId, common.TopUpStatusSuccess).Count(&paid).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&RedemptionUsage{}).Where("user_id = ?", userId).Count(&redeemed).Error; err != nil {
+			return err
+		}
+		if paid > 0 || redeemed > 0 {
+			return &RedeemRejectedError{Reason: "该兑换码仅限新用户使用"}
+		}
+	}
+	if redemption.MaxUsesPerUser > 0 {
+		var used int64
+		if err := tx.Model(&RedemptionUsage{}).Where("redemption_id = ? AND user_id = ?", redemption.Id, userId).Count(&used).Error; err != nil {
+			return err
+		}
+		if used >= int64(redemption.MaxUsesPerUser) {
+			return &RedeemRejectedError{Reason: "已达到该兑换码的兑换次数上限"}
+		}
+	}
+	return nil
+}
+
+// RedemptionStats 活动兑换码的兑换统计
+type RedemptionStats struct {
+	UsedCount   int64 `json:"used_count"`
+	UserCount   int64 `json:"user_count"`
+	TotalQuota  int64 `json:"total_quota"`
+	PlanGrants  int64 `json:"plan_grants"`
+	GroupGrants int64 `json:"group_grants"`
+	FirstTime   int64 `json:"first_time"`
+	LastTime    int64 `json:"last_time"`
+}
+
+func GetRedemptionStats(redemptionId int) (*RedemptionStats, error) {
+	stats := &RedemptionStats{}
+	err := DB.Model(&RedemptionUsage{}).Where("redemption_id = ?", redemptionId).
+		Select("COUNT(*) AS used_count, COUNT(DISTINCT user_id) AS user_count, COALESCE(SUM(quota), 0) AS total_quota, " +
+			"COALESCE(SUM(CASE WHEN plan_id > 0 THEN 1 ELSE 0 END), 0) AS plan_grants, " +
+			"COALESCE(SUM(CASE WHEN upgrade_group <> '' THEN 1 ELSE 0 END), 0) AS group_grants, " +
+			"COALESCE(MIN(created_time), 0) AS first_time, COALESCE(MAX(created_time), 0) AS last_time").
+		Scan(stats).Error
+	return stats, err
+}
+
+func GetRedemptionUsages(redemptionId int, pageInfo *common.PageInfo) (usages []*RedemptionUsage, total int64, err error) {
+	query := DB.Model(&RedemptionUsage{}).Where("redemption_id = ?", redemptionId)
+	if err = query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = query.Order("id desc").Limit(pageInfo.GetPageSize()).Offset(pageInfo.GetStartIdx()).Find(&usages).Error
+	return usages, total, err
 }
 
 func GetAllRedemptions(startIdx int, num int) (redemptions []*Redemption, total int64, err error) {
@@ -123,6 +262,8 @@ func Redeem(key string, userId int) (quota int, err error) {
 		return 0, errors.New("无效的 user id")
 	}
 	redemption := &Redemption{}
+	var planTitle string
+	var groupChanged bool
 
 	keyCol := "`key`"
 	if common.UsingPostgreSQL {
@@ -130,38 +271,112 @@ func Redeem(key string, userId int) (quota int, err error) {
 	}
 	common.RandomSleep()
 	err = DB.Transaction(func(tx *gorm.DB) error {
-		err := tx.Set("gorm:query_option", "FOR UPDATE").Where(keyCol+" = ?", key).First(redemption).Error
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where(keyCol+" = ?", key).First(redemption).Error
 		if err != nil {
 			return errors.New("无效的兑换码")
 		}
 		if redemption.Status != common.RedemptionCodeStatusEnabled {
 			return errors.New("该兑换码已被使用")
 		}
-		if redemption.ExpiredTime != 0 && redemption.ExpiredTime < common.GetTimestamp() {
+		now := common.GetTimestamp()
+		if redemption.ExpiredTime != 0 && redemption.ExpiredTime < now {
 			return errors.New("该兑换码已过期")
 		}
-		err = tx.Model(&User{}).Where("id = ?", userId).Update("quota", gorm.Expr("quota + ?", redemption.Quota)).Error
-		if err != nil {
+		if err := redemption.checkEligibleTx(tx, userId); err != nil {
 			return err
 		}
-		redemption.RedeemedTime = common.GetTimestamp()
-		redemption.Status = common.RedemptionCodeStatusUsed
-		redemption.UsedUserId = userId
-		err = tx.Save(redemption).Error
-		return err
+		if redemption.Quota > 0 {
+			err = tx.Model(&User{}).Where("id = ?", userId).Update("quota", gorm.Expr("quota + ?", redemption.Quota)).Error
+			if err != nil {
+				return err
+			}
+		}
+		usage := &RedemptionUsage{
+			RedemptionId: redemption.Id,
+			UserId:       userId,
+			Quota:        redemption.Quota,
+			CreatedTime:  now,
+		}
+		if redemption.PlanId > 0 {
+			plan, err := getSubscriptionPlanByIdTx(tx, redemption.PlanId)
+			if err != nil {
+				return err
+			}
+			sub, err := CreateUserSubscriptionFromPlanTx(tx, userId, plan, "redemption")
+			if err != nil {
+				return &RedeemRejectedError{Reason: err.Error()}
+			}
+			usage.PlanId = plan.Id
+			usage.UserSubscriptionId = sub.Id
+			planTitle = plan.Title
+			groupChanged = strings.TrimSpace(plan.UpgradeGroup) != ""
+		}
+		if redemption.UpgradeGroup != "" {
+			changed, err := grantUserGroupTx(tx, userId, redemption.UpgradeGroup, int64(redemption.UpgradeGroupDays)*86400, "redemption")
+			if err != nil {
+				return err
+			}
+			usage.UpgradeGroup = redemption.UpgradeGroup
+			groupChanged = groupChanged || changed
+		}
+		if err := tx.Create(usage).Error; err != nil {
+			return err
+		}
+		updates := map[string]interface{}{"used_count": gorm.Expr("used_count + 1")}
+		if !redemption.IsCampaign() {
+			updates["used_user_id"] = userId
+		}
+		if !redemption.IsCampaign() || redemption.UsedCount+1 >= redemption.MaxUses {
+			updates["redeemed_time"] = now
+			updates["status"] = common.RedemptionCodeStatusUsed
+		}
+		// 以读到的兑换次数为条件递增，并发兑换时只有一个成功，总次数与单用户次数都不会超限
+		res := tx.Model(&Redemption{}).
+			Where("id = ? AND status = ? AND used_count = ?", redemption.Id, common.RedemptionCodeStatusEnabled, redemption.UsedCount).
+			Updates(updates)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return &RedeemRejectedError{Reason: "兑换人数较多，请稍后重试"}
+		}
+		return nil
 	})
 	if err != nil {
+		var rejected *RedeemRejectedError
+		if errors.As(err, &rejected) {
+			return 0, err
+		}
 		common.SysError("redemption failed: " + err.Error())
 		return 0, ErrRedeemFailed
 	}
-	RecordLog(userId, LogTypeTopup, fmt.Sprintf("通过兑换码充值 %s，兑换码ID %d", logger.LogQuota(redemption.Quota), redemption.Id))
+	if groupChanged {
+		if group, err := getUserGroupByIdTx(DB, userId); err == nil {
+			_ = UpdateUserGroupCache(userId, group)
+		}
+	}
+	content := fmt.Sprintf("通过兑换码充值 %s，兑换码ID %d", logger.LogQuota(redemption.Quota), redemption.Id)
+	if planTitle != "" {
+		content += fmt.Sprintf("，获得套餐 %s", planTitle)
+	}
+	if redemption.UpgradeGroup != "" {
+		content += fmt.Sprintf("，分组升级为 %s（%d 天）", redemption.UpgradeGroup, redemption.UpgradeGroupDays)
+	}
+	RecordLog(userId, LogTypeTopup, content)
 	return redemption.Quota, nil
 }
 
 func (redemption *Redemption) Insert() error {
-	var err error
-	err = DB.Create(redemption).Error
-	return err
+	zeroQuota := redemption.Quota == 0
+	if err := DB.Create(redemption).Error; err != nil {
+		return err
+	}
+	// quota 列带有默认值，只赠送套餐或分组的兑换码需要显式写回 0
+	if zeroQuota {
+		redemption.Quota = 0
+		return DB.Model(redemption).Update("quota", 0).Error
+	}
+	return nil
 }
 
 func (redemption *Redemption) SelectUpdate() error {
@@ -172,7 +387,9 @@ func (redemption *Redemption) SelectUpdate() error {
 // Update Make sure your token's fields is completed, because this will update non-zero values
 func (redemption *Redemption) Update() error {
 	var err error
-	err = DB.Model(redemption).Select("name", "status", "quota", "redeemed_time", "expired_time").Updates(redemption).Error
+	err = DB.Model(redemption).Select("name", "status", "quota", "redeemed_time", "expired_time",
+		"max_uses", "max_uses_per_user", "new_user_only", "groups", "registered_after",
+		"plan_id", "upgrade_group", "upgrade_group_days").Updates(redemption).Error
 	return err
 }
 
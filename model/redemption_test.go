@@ -0,0 +1,22 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedemptionValidateGrant(t *testing.T) {
+	t.Parallel()
+
+	require.Error(t, (&Redemption{}).ValidateGrant())
+	require.Error(t, (&Redemption{Quota: -1}).ValidateGrant())
+	require.Error(t, (&Redemption{UpgradeGroup: "vip"}).ValidateGrant())
+	require.NoError(t, (&Redemption{Quota: 500}).ValidateGrant())
+
+	grant := &Redemption{UpgradeGroup: " vip ", UpgradeGroupDays: 7, MaxUses: 100, MaxUsesPerUser: 1}
+	require.NoError(t, grant.ValidateGrant())
+	require.Equal(t, "vip", grant.UpgradeGroup)
+	require.True(t, grant.IsCampaign())
+	require.False(t, (&Redemption{Quota: 500, MaxUses: 1}).IsCampaign())
+}
@@ -205,6 +205,11 @@ type SubscriptionOrder struct {
 	CompleteTime  int64  `json:"complete_time"`
 
 	ProviderPayload string `json:"provider_payload" gorm:"type:text"`
+
+	UserSubscriptionId int `json:"user_subscription_id" gorm:"default:0"` // 订单完成后创建的用户订阅
+
+	CouponId int     `json:"coupon_id" gorm:"index;default:0"` // 下单时使用的优惠券
+	Discount float64 `json:"discount" gorm:"default:0"`        // 优惠券抵扣金额，Money 为抵扣后的实付金额
 }
 
 func (o *SubscriptionOrder) Insert() error {
@@ -250,6 +255,9 @@ type UserSubscription struct {
 	UpgradeGroup  string `json:"upgrade_group" gorm:"type:varchar(64);default:''"`
 	PrevUserGroup string `json:"prev_user_group" gorm:"type:varchar(64);default:''"`
 
+	// 支付平台侧的周期订阅 id（如 Stripe Subscription），用于自动续费
+	ProviderSubscriptionId string `json:"provider_subscription_id" gorm:"type:varchar(128);index;default:''"`
+
 	CreatedAt int64 `json:"created_at" gorm:"bigint"`
 	UpdatedAt int64 `json:"updated_at" gorm:"bigint"`
 }
@@ -537,10 +545,14 @@ func CompleteSubscriptionOrder(tradeNo string, providerPayload string) error {
 			// still allow completion for already purchased orders
 		}
 		upgradeGroup = strings.TrimSpace(plan.UpgradeGroup)
-		_, err = CreateUserSubscriptionFromPlanTx(tx, order.UserId, plan, "order")
+		sub, err := CreateUserSubscriptionFromPlanTx(tx, order.UserId, plan, "order")
 		if err != nil {
 			return err
 		}
+		order.UserSubscriptionId = sub.Id
+		if err := completeCouponUsageTx(tx, order.CouponId, order.TradeNo); err != nil {
+			return err
+		}
 		if err := upsertSubscriptionTopUpTx(tx, &order); err != nil {
 			return err
 		}
@@ -623,7 +635,10 @@ func ExpireSubscriptionOrder(tradeNo string) error {
 		}
 		order.Status = common.TopUpStatusExpired
 		order.CompleteTime = common.GetTimestamp()
-		return tx.Save(&order).Error
+		if err := tx.Save(&order).Error; err != nil {
+			return err
+		}
+		return tx.Where("trade_no = ? AND status = ?", tradeNo, common.TopUpStatusPending).Delete(&CouponUsage{}).Error
 	})
 }
 
@@ -1190,3 +1205,145 @@ func PostConsumeUserSubscriptionDelta(userSubscriptionId int, delta int64) error
 		return tx.Save(&sub).Error
 	})
 }
+
+// BindUserSubscriptionProvider 将订单创建的用户订阅与支付平台的周期订阅关联
+func BindUserSubscriptionProvider(tradeNo string, providerSubscriptionId string) error {
+	if tradeNo == "" || providerSubscriptionId == "" {
+		return nil
+	}
+	order := GetSubscriptionOrderByTradeNo(tradeNo)
+	if order == nil {
+		return ErrSubscriptionOrderNotFound
+	}
+	if order.UserSubscriptionId == 0 {
+		return errors.New("subscription order has no user subscription")
+	}
+	return DB.Model(&UserSubscription{}).Where("id = ?", order.UserSubscriptionId).
+		Update("provider_subscription_id", providerSubscriptionId).Error
+}
+
+// RenewUserSubscriptionByProvider 支付平台周期扣款成功后续期用户订阅（幂等，按 tradeNo 去重）。
+// 订阅仍有效时从原到期时间顺延，已过期则从当前时间重新开始，并重置已用额度。
+func RenewUserSubscriptionByProvider(providerSubscriptionId string, tradeNo string, money float64, paymentMethod string) error {
+	if providerSubscriptionId == "" || tradeNo == "" {
+		return errors.New("invalid renew args")
+	}
+	var logUserId int
+	var logPlanTitle string
+	cacheGroup := ""
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var existing int64
+		if err := tx.Model(&TopUp{}).Where("trade_no = ?", tradeNo).Count(&existing).Error; err != nil {
+			return err
+		}
+		if existing > 0 {
+			return nil
+		}
+		var sub UserSubscription
+		if err := tx.Set("gorm:query_option", "FOR UPDATE").
+			Where("provider_subscription_id = ?", providerSubscriptionId).
+			Order("id desc").First(&sub).Error; err != nil {
+			return err
+		}
+		plan, err := getSubscriptionPlanByIdTx(tx, sub.PlanId)
+		if err != nil {
+			return err
+		}
+		nowUnix := GetDBTimestamp()
+		now := time.Unix(nowUnix, 0)
+		base := now
+		if sub.Status == "active" && sub.EndTime > nowUnix {
+			base = time.Unix(sub.EndTime, 0)
+		}
+		endUnix, err := calcPlanEndTime(base, plan)
+		if err != nil {
+			return err
+		}
+		nextReset := calcNextResetTime(now, plan, endUnix)
+		lastReset := int64(0)
+		if nextReset > 0 {
+			lastReset = nowUnix
+		}
+		updates := map[string]interface{}{
+			"status":          "active",
+			"end_time":        endUnix,
+			"amount_total":    plan.TotalAmount,
+			"amount_used":     0,
+			"last_reset_time": lastReset,
+			"next_reset_time": nextReset,
+		}
+		if sub.Status != "active" {
+			// 已过期的订阅重新激活时恢复分组升级
+			upgradeGroup := strings.TrimSpace(plan.UpgradeGroup)
+			if upgradeGroup != "" {
+				currentGroup, err := getUserGroupByIdTx(tx, sub.UserId)
+				if err != nil {
+					return err
+				}
+				if currentGroup != upgradeGroup {
+					if err := tx.Model(&User{}).Where("id = ?", sub.UserId).
+						Update("group", upgradeGroup).Error; err != nil {
+						return err
+					}
+					updates["prev_user_group"] = currentGroup
+					cacheGroup = upgradeGroup
+				}
+			}
+			updates["start_time"] = nowUnix
+			updates["upgrade_group"] = upgradeGroup
+		}
+		if err := tx.Model(&sub).Updates(updates).Error; err != nil {
+			return err
+		}
+		topUp := &TopUp{
+			UserId:        sub.UserId,
+			Money:         money,
+			TradeNo:       tradeNo,
+			PaymentMethod: paymentMethod,
+			CreateTime:    nowUnix,
+			CompleteTime:  nowUnix,
+			Status:        common.TopUpStatusSuccess,
+		}
+		if err := tx.Create(topUp).Error; err != nil {
+			return err
+		}
+		logUserId = sub.UserId
+		logPlanTitle = plan.Title
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if cacheGroup != "" && logUserId > 0 {
+		_ = UpdateUserGroupCache(logUserId, cacheGroup)
+	}
+	if logUserId > 0 {
+		RecordLog(logUserId, LogTypeTopup, fmt.Sprintf("订阅自动续费成功，套餐: %s，支付金额: %.2f，支付方式: %s", logPlanTitle, money, paymentMethod))
+	}
+	return nil
+}
+
+// CancelUserSubscriptionByProvider 作废与支付平台周期订阅关联的当前有效订阅（如全额退款、争议败诉）
+func CancelUserSubscriptionByProvider(providerSubscriptionId string) (string, error) {
+	if providerSubscriptionId == "" {
+		return "", errors.New("provider subscription id is empty")
+	}
+	var sub UserSubscription
+	if err := DB.Where("provider_subscription_id = ? AND status = ?", providerSubscriptionId, "active").
+		Order("id desc").First(&sub).Error; err != nil {
+		return "", err
+	}
+	return AdminInvalidateUserSubscription(sub.Id)
+}
+
+func GetUserIdBySubscriptionProvider(providerSubscriptionId string) (int, error) {
+	if providerSubscriptionId == "" {
+		return 0, errors.New("provider subscription id is empty")
+	}
+	var sub UserSubscription
+	if err := DB.Select("user_id").Where("provider_subscription_id = ?", providerSubscriptionId).
+		Order("id desc").First(&sub).Error; err != nil {
+		return 0, err
+	}
+	return sub.UserId, nil
+}
@@ -77,6 +77,8 @@ type Properties struct {
 	Input             string `json:"input"`
 	UpstreamModelName string `json:"upstream_model_name,omitempty"`
 	OriginModelName   string `json:"origin_model_name,omitempty"`
+	// 按秒计费的任务预扣时使用的时长，任务完成后按上游返回的实际时长结算
+	BilledSeconds float64 `json:"billed_seconds,omitempty"`
 }
 
 func (m *Properties) Scan(val interface{}) error {
@@ -97,6 +99,12 @@ func (m Properties) Value() (driver.Value, error) {
 
 type TaskPrivateData struct {
 	Key string `json:"key,omitempty"`
+	// 提交任务时的扣费来源，按实际用量结算时补扣或退还到同一来源
+	TokenId        int    `json:"token_id,omitempty"`
+	OrgId          int    `json:"org_id,omitempty"`
+	ClientTokenId  int    `json:"client_token_id,omitempty"`
+	BillingSource  string `json:"billing_source,omitempty"`
+	SubscriptionId int    `json:"subscription_id,omitempty"`
 }
 
 func (p *TaskPrivateData) Scan(val interface{}) error {
@@ -130,6 +138,13 @@ type SyncTaskQueryParams struct {
 func InitTask(platform constant.TaskPlatform, relayInfo *commonRelay.RelayInfo) *Task {
 	properties := Properties{}
 	privateData := TaskPrivateData{}
+	if relayInfo != nil {
+		privateData.TokenId = relayInfo.TokenId
+		privateData.OrgId = relayInfo.OrgId
+		privateData.ClientTokenId = relayInfo.ClientTokenId
+		privateData.BillingSource = relayInfo.BillingSource
+		privateData.SubscriptionId = relayInfo.SubscriptionId
+	}
 	if relayInfo != nil && relayInfo.ChannelMeta != nil {
 		if relayInfo.ChannelMeta.ChannelType == constant.ChannelTypeGemini {
 			privateData.Key = relayInfo.ChannelMeta.ApiKey
@@ -14,7 +14,9 @@ import (
 type Token struct {
 	Id                 int            `json:"id"`
 	UserId             int            `json:"user_id" gorm:"index"`
-	Key                string         `json:"key" gorm:"type:char(48);uniqueIndex"`
+	Key                string         `json:"key" gorm:"type:char(48);uniqueIndex"` // 加盐哈希，见 token_key.go
+	KeyPrefix          string         `json:"key_prefix" gorm:"type:varchar(16);index;default:''"`
+	KeySalt            string         `json:"-" gorm:"type:varchar(32);default:''"`
 	Status             int            `json:"status" gorm:"default:1"`
 	Name               string         `json:"name" gorm:"index" `
 	CreatedTime        int64          `json:"created_time" gorm:"bigint"`
@@ -27,12 +29,22 @@ type Token struct {
 	AllowIps           *string        `json:"allow_ips" gorm:"default:''"`
 	UsedQuota          int            `json:"used_quota" gorm:"default:0"` // used quota
 	Group              string         `json:"group" gorm:"default:''"`
-	CrossGroupRetry    bool           `json:"cross_group_retry"` // 跨分组重试，仅auto分组有效
+	CrossGroupRetry    bool           `json:"cross_group_retry"`                                // 跨分组重试，仅auto分组有效
+	OrgId              int            `json:"org_id" gorm:"default:0;index"`                    // 组织令牌，计费走组织钱包
+	BudgetPeriod       string         `json:"budget_period" gorm:"type:varchar(16);default:''"` // 周期预算：daily / weekly / monthly，空表示不启用
+	BudgetLimit        int            `json:"budget_limit" gorm:"default:0"`                    // 周期内硬上限，0 表示不限制
+	BudgetSoftLimit    int            `json:"budget_soft_limit" gorm:"default:0"`               // 周期内软上限，超过时发送通知
+	BudgetUsed         int            `json:"budget_used" gorm:"default:0"`
+	BudgetResetTime    int64          `json:"budget_reset_time" gorm:"bigint;default:0"`  // 当前预算窗口开始时间
+	BudgetNotified     bool           `json:"budget_notified"`                            // 当前窗口是否已发送软上限通知
+	Scopes             string         `json:"scopes" gorm:"type:varchar(255);default:''"` // 逗号分隔的权限范围，空表示不限制
+	MaxTokens          int            `json:"max_tokens" gorm:"default:0"`                // 单次请求允许的最大 max_tokens，0 表示不限制
 	DeletedAt          gorm.DeletedAt `gorm:"index"`
 }
 
 func (token *Token) Clean() {
 	token.Key = ""
+	token.KeySalt = ""
 }
 
 func (token *Token) GetIpLimits() []string {
@@ -141,11 +153,15 @@ func SearchUserTokens(userId int, keyword string, token string, offset int, limi
 		baseQuery = baseQuery.Where("name LIKE ? ESCAPE '!'", keywordPattern)
 	}
 	if token != "" {
+		// 只保存了 key 的前缀，按前缀匹配
+		if !strings.Contains(token, "%") && len(token) > TokenKeyPrefixLength {
+			token = token[:TokenKeyPrefixLength]
+		}
 		tokenPattern, err := sanitizeLikePattern(token)
 		if err != nil {
 			return nil, 0, err
 		}
-		baseQuery = baseQuery.Where(commonKeyCol+" LIKE ? ESCAPE '!'", tokenPattern)
+		baseQuery = baseQuery.Where("key_prefix LIKE ? ESCAPE '!'", tokenPattern)
 	}
 
 	// 先查匹配总数（用于分页，受 maxTokens 上限保护，避免全表 COUNT）
@@ -232,7 +248,7 @@ func GetTokenById(id int) (*Token, error) {
 	err = DB.First(&token, "id = ?", id).Error
 	if shouldUpdateRedis(true, err) {
 		gopool.Go(func() {
-			if err := cacheSetToken(token); err != nil {
+			if err := cacheSetToken(token, ""); err != nil {
 				common.SysLog("failed to update user status cache: " + err.Error())
 			}
 		})
@@ -240,12 +256,23 @@ func GetTokenById(id int) (*Token, error) {
 	return &token, err
 }
 
+// GetCachedTokenById 优先从缓存读取令牌，用于计费等只持有令牌 id 的场景
+func GetCachedTokenById(id int) (*Token, error) {
+	if common.RedisEnabled {
+		if token, err := cacheGetTokenById(id); err == nil {
+			return token, nil
+		}
+	}
+	return GetTokenById(id)
+}
+
+// GetTokenByKey 通过明文 key 获取令牌，返回的 token.Key 为调用方传入的明文（仅存在于内存中）
 func GetTokenByKey(key string, fromDB bool) (token *Token, err error) {
 	defer func() {
 		// Update Redis cache asynchronously on successful DB read
 		if shouldUpdateRedis(fromDB, err) && token != nil {
 			gopool.Go(func() {
-				if err := cacheSetToken(*token); err != nil {
+				if err := cacheSetToken(*token, key); err != nil {
 					common.SysLog("failed to update user status cache: " + err.Error())
 				}
 			})
@@ -260,14 +287,22 @@ func GetTokenByKey(key string, fromDB bool) (token *Token, err error) {
 		// Don't return error - fall through to DB
 	}
 	fromDB = true
-	err = DB.Where(commonKeyCol+" = ?", key).First(&token).Error
-	return token, err
+	token, err = getTokenByKeyFromDB(key)
+	if err != nil {
+		return nil, err
+	}
+	token.Key = key
+	return token, nil
 }
 
+// Insert 插入令牌，明文 key 在写库前转换为加盐哈希
 func (token *Token) Insert() error {
-	var err error
-	err = DB.Create(token).Error
-	return err
+	if !token.IsHashed() {
+		if err := token.SetKey(token.Key); err != nil {
+			return err
+		}
+	}
+	return DB.Create(token).Error
 }
 
 // Update Make sure your token's fields is completed, because this will update non-zero values
@@ -275,7 +310,7 @@ func (token *Token) Update() (err error) {
 	defer func() {
 		if shouldUpdateRedis(true, err) {
 			gopool.Go(func() {
-				err := cacheSetToken(*token)
+				err := cacheSetToken(*token, "")
 				if err != nil {
 					common.SysLog("failed to update token cache: " + err.Error())
 				}
@@ -283,7 +318,9 @@ func (token *Token) Update() (err error) {
 		}
 	}()
 	err = DB.Model(token).Select("name", "status", "expired_time", "remain_quota", "unlimited_quota",
-		"model_limits_enabled", "model_limits", "allow_ips", "group", "cross_group_retry").Updates(token).Error
+		"model_limits_enabled", "model_limits", "allow_ips", "group", "cross_group_retry",
+		"budget_period", "budget_limit", "budget_soft_limit", "budget_reset_time",
+		"scopes", "max_tokens").Updates(token).Error
 	return err
 }
 
@@ -291,7 +328,7 @@ func (token *Token) SelectUpdate() (err error) {
 	defer func() {
 		if shouldUpdateRedis(true, err) {
 			gopool.Go(func() {
-				err := cacheSetToken(*token)
+				err := cacheSetToken(*token, "")
 				if err != nil {
 					common.SysLog("failed to update token cache: " + err.Error())
 				}
@@ -306,7 +343,7 @@ func (token *Token) Delete() (err error) {
 	defer func() {
 		if shouldUpdateRedis(true, err) {
 			gopool.Go(func() {
-				err := cacheDeleteToken(token.Key)
+				err := cacheDeleteToken(token.Id)
 				if err != nil {
 					common.SysLog("failed to delete token cache: " + err.Error())
 				}
@@ -366,10 +403,13 @@ func IncreaseTokenQuota(id int, key string, quota int) (err error) {
 	}
 	if common.RedisEnabled {
 		gopool.Go(func() {
-			err := cacheIncrTokenQuota(key, int64(quota))
+			err := cacheIncrTokenQuota(id, int64(quota))
 			if err != nil {
 				common.SysLog("failed to increase token quota: " + err.Error())
 			}
+			if err := cacheIncrTokenBudgetUsed(id, -int64(quota)); err != nil {
+				common.SysLog("failed to update token budget cache: " + err.Error())
+			}
 		})
 	}
 	if common.BatchUpdateEnabled {
@@ -384,6 +424,7 @@ func increaseTokenQuota(id int, quota int) (err error) {
 		map[string]interface{}{
 			"remain_quota":  gorm.Expr("remain_quota + ?", quota),
 			"used_quota":    gorm.Expr("used_quota - ?", quota),
+			"budget_used":   gorm.Expr("CASE WHEN budget_used > ? THEN budget_used - ? ELSE 0 END", quota, quota),
 			"accessed_time": common.GetTimestamp(),
 		},
 	).Error
@@ -396,10 +437,13 @@ func DecreaseTokenQuota(id int, key string, quota int) (err error) {
 	}
 	if common.RedisEnabled {
 		gopool.Go(func() {
-			err := cacheDecrTokenQuota(key, int64(quota))
+			err := cacheDecrTokenQuota(id, int64(quota))
 			if err != nil {
 				common.SysLog("failed to decrease token quota: " + err.Error())
 			}
+			if err := cacheIncrTokenBudgetUsed(id, int64(quota)); err != nil {
+				common.SysLog("failed to update token budget cache: " + err.Error())
+			}
 		})
 	}
 	if common.BatchUpdateEnabled {
@@ -414,12 +458,46 @@ func decreaseTokenQuota(id int, quota int) (err error) {
 		map[string]interface{}{
 			"remain_quota":  gorm.Expr("remain_quota - ?", quota),
 			"used_quota":    gorm.Expr("used_quota + ?", quota),
+			"budget_used":   gorm.Expr("budget_used + ?", quota),
 			"accessed_time": common.GetTimestamp(),
 		},
 	).Error
 	return err
 }
 
+// DecreaseTokenQuotaWithinBudget 预扣令牌额度，同时以 budget_used + quota <= budget_limit 为条件累加周期用量，
+// 并发请求不会超过硬上限。超出时返回 ErrTokenBudgetExceeded
+func DecreaseTokenQuotaWithinBudget(id int, quota int) error {
+	if quota < 0 {
+		return errors.New("quota 不能为负数！")
+	}
+	res := DB.Model(&Token{}).Where("id = ? AND budget_used + ? <= budget_limit", id, quota).Updates(
+		map[string]interface{}{
+			"remain_quota":  gorm.Expr("remain_quota - ?", quota),
+			"used_quota":    gorm.Expr("used_quota + ?", quota),
+			"budget_used":   gorm.Expr("budget_used + ?", quota),
+			"accessed_time": common.GetTimestamp(),
+		},
+	)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrTokenBudgetExceeded
+	}
+	if common.RedisEnabled {
+		gopool.Go(func() {
+			if err := cacheDecrTokenQuota(id, int64(quota)); err != nil {
+				common.SysLog("failed to decrease token quota: " + err.Error())
+			}
+			if err := cacheIncrTokenBudgetUsed(id, int64(quota)); err != nil {
+				common.SysLog("failed to update token budget cache: " + err.Error())
+			}
+		})
+	}
+	return nil
+}
+
 // CountUserTokens returns total number of tokens for the given user, used for pagination
 func CountUserTokens(userId int) (int64, error) {
 	var total int64
@@ -453,7 +531,7 @@ func BatchDeleteTokens(ids []int, userId int) (int, error) {
 	if common.RedisEnabled {
 		gopool.Go(func() {
 			for _, t := range tokens {
-				_ = cacheDeleteToken(t.Key)
+				_ = cacheDeleteToken(t.Id)
 			}
 		})
 	}
@@ -0,0 +1,150 @@
+package model
+
+import (
+	"errors"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+// 令牌周期预算
+const (
+	TokenBudgetPeriodDaily   = "daily"
+	TokenBudgetPeriodWeekly  = "weekly"
+	TokenBudgetPeriodMonthly = "monthly"
+)
+
+// ErrTokenBudgetExceeded 本次预扣会超过令牌周期预算的硬上限
+var ErrTokenBudgetExceeded = errors.New("token budget exceeded")
+
+func IsValidTokenBudgetPeriod(period string) bool {
+	switch period {
+	case "", TokenBudgetPeriodDaily, TokenBudgetPeriodWeekly, TokenBudgetPeriodMonthly:
+		return true
+	}
+	return false
+}
+
+// TokenBudgetWindowStart 返回 now 所在预算窗口的开始时间（服务器本地时区，周一为一周开始）
+func TokenBudgetWindowStart(period string, now time.Time) time.Time {
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	switch period {
+	case TokenBudgetPeriodWeekly:
+		offset := (int(day.Weekday()) + 6) % 7
+		return day.AddDate(0, 0, -offset)
+	case TokenBudgetPeriodMonthly:
+		return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	default:
+		return day
+	}
+}
+
+// TokenBudgetWindowEnd 返回以 start 开始的预算窗口的结束时间
+func TokenBudgetWindowEnd(period string, start time.Time) time.Time {
+	switch period {
+	case TokenBudgetPeriodWeekly:
+		return start.AddDate(0, 0, 7)
+	case TokenBudgetPeriodMonthly:
+		return start.AddDate(0, 1, 0)
+	default:
+		return start.AddDate(0, 0, 1)
+	}
+}
+
+// HasBudget 令牌是否启用了周期预算
+func (token *Token) HasBudget() bool {
+	return token.BudgetPeriod != "" && (token.BudgetLimit > 0 || token.BudgetSoftLimit > 0)
+}
+
+// BudgetRemain 当前窗口剩余预算，未设置硬上限时返回 -1
+func (token *Token) BudgetRemain() int {
+	if token.BudgetLimit <= 0 {
+		return -1
+	}
+	used := token.BudgetUsed
+	if used < 0 {
+		used = 0
+	}
+	remain := token.BudgetLimit - used
+	if remain < 0 {
+		return 0
+	}
+	return remain
+}
+
+// BudgetResetAt 当前预算窗口的重置时间
+func (token *Token) BudgetResetAt() int64 {
+	if !token.HasBudget() {
+		return 0
+	}
+	start := time.Unix(token.BudgetResetTime, 0)
+	if token.BudgetResetTime == 0 {
+		start = TokenBudgetWindowStart(token.BudgetPeriod, time.Now())
+	}
+	return TokenBudgetWindowEnd(token.BudgetPeriod, start).Unix()
+}
+
+// RefreshTokenBudgetWindow 当前时间已超出令牌的预算窗口时重置窗口内用量。
+// 使用 budget_reset_time 做条件更新，并发请求只会有一个生效。
+func RefreshTokenBudgetWindow(token *Token) error {
+	if !token.HasBudget() {
+		return nil
+	}
+	now := time.Now()
+	if token.BudgetResetTime != 0 &&
+		now.Before(TokenBudgetWindowEnd(token.BudgetPeriod, time.Unix(token.BudgetResetTime, 0))) {
+		return nil
+	}
+	windowStart := TokenBudgetWindowStart(token.BudgetPeriod, now).Unix()
+	res := DB.Model(&Token{}).Where("id = ? AND budget_reset_time = ?", token.Id, token.BudgetResetTime).
+		Updates(map[string]interface{}{
+			"budget_used":       0,
+			"budget_reset_time": windowStart,
+			"budget_notified":   false,
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		// 窗口已被其他请求重置，以数据库中的用量为准
+		var current Token
+		if err := DB.Select("budget_used", "budget_reset_time", "budget_notified").
+			Where("id = ?", token.Id).First(&current).Error; err != nil {
+			return err
+		}
+		token.BudgetUsed = current.BudgetUsed
+		token.BudgetResetTime = current.BudgetResetTime
+		token.BudgetNotified = current.BudgetNotified
+	} else {
+		token.BudgetUsed = 0
+		token.BudgetResetTime = windowStart
+		token.BudgetNotified = false
+	}
+	if common.RedisEnabled {
+		gopool.Go(func() {
+			if err := cacheDeleteToken(token.Id); err != nil {
+				common.SysLog("failed to delete token cache: " + err.Error())
+			}
+		})
+	}
+	return nil
+}
+
+// MarkTokenBudgetNotified 标记当前窗口已发送软上限通知，返回是否由本次调用标记成功
+func MarkTokenBudgetNotified(token *Token) (bool, error) {
+	res := DB.Model(&Token{}).Where("id = ? AND budget_notified = ?", token.Id, false).
+		Update("budget_notified", true)
+	if res.Error != nil {
+		return false, res.Error
+	}
+	token.BudgetNotified = true
+	if common.RedisEnabled {
+		gopool.Go(func() {
+			if err := cacheDeleteToken(token.Id); err != nil {
+				common.SysLog("failed to delete token cache: " + err.Error())
+			}
+		})
+	}
+	return res.RowsAffected > 0, nil
+}
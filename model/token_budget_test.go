@@ -0,0 +1,78 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenBudgetWindow(t *testing.T) {
+	t.Parallel()
+
+	// 2025-03-13 是周四
+	now := time.Date(2025, 3, 13, 15, 30, 0, 0, time.UTC)
+
+	daily := TokenBudgetWindowStart(TokenBudgetPeriodDaily, now)
+	require.Equal(t, time.Date(2025, 3, 13, 0, 0, 0, 0, time.UTC), daily)
+	require.Equal(t, time.Date(2025, 3, 14, 0, 0, 0, 0, time.UTC), TokenBudgetWindowEnd(TokenBudgetPeriodDaily, daily))
+
+	weekly := TokenBudgetWindowStart(TokenBudgetPeriodWeekly, now)
+	require.Equal(t, time.Date(2025, 3, 10, 0, 0, 0, 0, time.UTC), weekly)
+	require.Equal(t, time.Date(2025, 3, 17, 0, 0, 0, 0, time.UTC), TokenBudgetWindowEnd(TokenBudgetPeriodWeekly, weekly))
+
+	sunday := time.Date(2025, 3, 16, 23, 0, 0, 0, time.UTC)
+	require.Equal(t, weekly, TokenBudgetWindowStart(TokenBudgetPeriodWeekly, sunday))
+
+	monthly := TokenBudgetWindowStart(TokenBudgetPeriodMonthly, now)
+	require.Equal(t, time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC), monthly)
+	require.Equal(t, time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC), TokenBudgetWindowEnd(TokenBudgetPeriodMonthly, monthly))
+}
+
+func TestTokenBudgetRemain(t *testing.T) {
+	t.Parallel()
+
+	token := &Token{BudgetPeriod: TokenBudgetPeriodDaily, BudgetLimit: 100, BudgetUsed: 30}
+	require.True(t, token.HasBudget())
+	require.Equal(t, 70, token.BudgetRemain())
+
+	token.BudgetUsed = 150
+	require.Equal(t, 0, token.BudgetRemain())
+
+	require.False(t, (&Token{BudgetLimit: 100}).HasBudget())
+	require.Equal(t, -1, (&Token{BudgetPeriod: TokenBudgetPeriodDaily, BudgetSoftLimit: 10}).BudgetRemain())
+}
+
+func TestTokenBudgetUsage(t *testing.T) {
+	setupTestDB(t, &Token{})
+	windowStart := TokenBudgetWindowStart(TokenBudgetPeriodDaily, time.Now()).Unix()
+	token := &Token{
+		UserId: 1, Name: "budget", Key: "budget-key", RemainQuota: 1000,
+		BudgetPeriod: TokenBudgetPeriodDaily, BudgetLimit: 100, BudgetResetTime: windowStart,
+	}
+	require.NoError(t, DB.Create(token).Error)
+	budgetUsed := func() int {
+		var got Token
+		require.NoError(t, DB.First(&got, token.Id).Error)
+		return got.BudgetUsed
+	}
+
+	// 预扣以硬上限为条件，不会因并发超出预算
+	require.NoError(t, DecreaseTokenQuotaWithinBudget(token.Id, 60))
+	require.ErrorIs(t, DecreaseTokenQuotaWithinBudget(token.Id, 41), ErrTokenBudgetExceeded)
+	require.NoError(t, DecreaseTokenQuotaWithinBudget(token.Id, 40))
+	require.Equal(t, 100, budgetUsed())
+
+	// 窗口重置后到达的退款不会让用量变为负数
+	require.NoError(t, DB.Model(token).Update("budget_used", 10).Error)
+	require.NoError(t, increaseTokenQuota(token.Id, 30))
+	require.Equal(t, 0, budgetUsed())
+
+	// 其他请求已重置窗口时以数据库中的用量为准
+	stale := &Token{Id: token.Id, BudgetPeriod: TokenBudgetPeriodDaily, BudgetLimit: 100, BudgetUsed: 80, BudgetResetTime: windowStart - 86400}
+	require.NoError(t, DB.Model(token).Update("budget_used", 25).Error)
+	require.NoError(t, RefreshTokenBudgetWindow(stale))
+	require.Equal(t, 25, stale.BudgetUsed)
+	require.Equal(t, windowStart, stale.BudgetResetTime)
+	require.Equal(t, 25, budgetUsed())
+}
@@ -2,64 +2,87 @@ package model
 
 import (
 	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/constant"
 )
 
-func cacheSetToken(token Token) error {
-	key := common.GenerateHMAC(token.Key)
+// 令牌缓存按 id 存储，另以明文 key 的 HMAC 记录 key -> id 的索引。
+// 数据库中只保存 key 的哈希，更新/删除令牌时拿不到明文，因此缓存不能以明文 key 作为主键。
+
+func tokenCacheKey(id int) string {
+	return fmt.Sprintf("token:%d", id)
+}
+
+func tokenKeyIndexCacheKey(key string) string {
+	return fmt.Sprintf("token_key:%s", common.GenerateHMAC(key))
+}
+
+// cacheSetToken 写入令牌缓存，key 为明文令牌时同时写入 key -> id 索引
+func cacheSetToken(token Token, key string) error {
 	token.Clean()
-	err := common.RedisHSetObj(fmt.Sprintf("token:%s", key), &token, time.Duration(common.RedisKeyCacheSeconds())*time.Second)
+	expiration := time.Duration(common.RedisKeyCacheSeconds()) * time.Second
+	err := common.RedisHSetObj(tokenCacheKey(token.Id), &token, expiration)
 	if err != nil {
 		return err
 	}
+	if key != "" {
+		return common.RedisSet(tokenKeyIndexCacheKey(key), strconv.Itoa(token.Id), expiration)
+	}
 	return nil
 }
 
-func cacheDeleteToken(key string) error {
-	key = common.GenerateHMAC(key)
-	err := common.RedisDelKey(fmt.Sprintf("token:%s", key))
-	if err != nil {
-		return err
-	}
-	return nil
+func cacheDeleteToken(id int) error {
+	return common.RedisDelKey(tokenCacheKey(id))
 }
 
-func cacheIncrTokenQuota(key string, increment int64) error {
-	key = common.GenerateHMAC(key)
-	err := common.RedisHIncrBy(fmt.Sprintf("token:%s", key), constant.TokenFiledRemainQuota, increment)
-	if err != nil {
-		return err
-	}
-	return nil
+func cacheIncrTokenQuota(id int, increment int64) error {
+	return common.RedisHIncrBy(tokenCacheKey(id), constant.TokenFiledRemainQuota, increment)
 }
 
-func cacheDecrTokenQuota(key string, decrement int64) error {
-	return cacheIncrTokenQuota(key, -decrement)
+func cacheDecrTokenQuota(id int, decrement int64) error {
+	return cacheIncrTokenQuota(id, -decrement)
 }
 
-func cacheSetTokenField(key string, field string, value string) error {
-	key = common.GenerateHMAC(key)
-	err := common.RedisHSetField(fmt.Sprintf("token:%s", key), field, value)
-	if err != nil {
-		return err
-	}
-	return nil
+func cacheIncrTokenBudgetUsed(id int, increment int64) error {
+	return common.RedisHIncrBy(tokenCacheKey(id), constant.TokenFieldBudgetUsed, increment)
+}
+
+func cacheSetTokenField(id int, field string, value string) error {
+	return common.RedisHSetField(tokenCacheKey(id), field, value)
 }
 
-// CacheGetTokenByKey 从缓存中获取 token，如果缓存中不存在，则从数据库中获取
+// cacheGetTokenByKey 通过明文 key 从缓存中获取 token，未命中时返回错误
 func cacheGetTokenByKey(key string) (*Token, error) {
-	hmacKey := common.GenerateHMAC(key)
 	if !common.RedisEnabled {
 		return nil, fmt.Errorf("redis is not enabled")
 	}
-	var token Token
-	err := common.RedisHGetObj(fmt.Sprintf("token:%s", hmacKey), &token)
+	idStr, err := common.RedisGet(tokenKeyIndexCacheKey(key))
+	if err != nil {
+		return nil, err
+	}
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return nil, err
+	}
+	token, err := cacheGetTokenById(id)
 	if err != nil {
 		return nil, err
 	}
 	token.Key = key
+	return token, nil
+}
+
+func cacheGetTokenById(id int) (*Token, error) {
+	var token Token
+	err := common.RedisHGetObj(tokenCacheKey(id), &token)
+	if err != nil {
+		return nil, err
+	}
+	if token.Id != id {
+		return nil, fmt.Errorf("token cache mismatch")
+	}
 	return &token, nil
 }
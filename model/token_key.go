@@ -0,0 +1,160 @@
+package model
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"github.com/QuantumNous/new-api/common"
+	"gorm.io/gorm"
+)
+
+// 令牌 key 只以加盐哈希保存：key 列存放 "$" + base64(sha256(salt + key))，
+// key_prefix 保存明文前缀用于索引查找和展示。令牌 key 为 48 位随机字符，
+// 单次 sha256 已足以抵抗穷举，同时保证鉴权路径的开销可以忽略。
+const (
+	TokenKeyPrefixLength = 8
+	tokenKeyHashMarker   = "$"
+	tokenKeySaltLength   = 16
+)
+
+// legacyTokenKeys 标记数据库中是否可能仍存在明文 key，迁移完成后不再按明文回查
+var legacyTokenKeys atomic.Bool
+
+func init() {
+	legacyTokenKeys.Store(true)
+}
+
+func hashTokenKey(salt string, key string) string {
+	sum := sha256.Sum256([]byte(salt + key))
+	return tokenKeyHashMarker + base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func tokenKeyPrefix(key string) string {
+	if len(key) <= TokenKeyPrefixLength {
+		return key
+	}
+	return key[:TokenKeyPrefixLength]
+}
+
+// IsHashed 令牌 key 是否已以哈希形式保存
+func (token *Token) IsHashed() bool {
+	return strings.HasPrefix(token.Key, tokenKeyHashMarker)
+}
+
+// SetKey 为令牌生成盐并以哈希形式保存 key，明文只在创建时返回给用户一次
+func (token *Token) SetKey(key string) error {
+	salt, err := common.GenerateRandomCharsKey(tokenKeySaltLength)
+	if err != nil {
+		return err
+	}
+	token.KeySalt = salt
+	token.KeyPrefix = tokenKeyPrefix(key)
+	token.Key = hashTokenKey(salt, key)
+	return nil
+}
+
+// MatchKey 校验明文 key 是否与令牌匹配
+func (token *Token) MatchKey(key string) bool {
+	expected := token.Key
+	if token.IsHashed() {
+		key = hashTokenKey(token.KeySalt, key)
+	}
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(key)) == 1
+}
+
+// MaskKey 返回给前端前替换为只含前缀的掩码，避免泄露哈希或明文
+func (token *Token) MaskKey() {
+	prefix := token.KeyPrefix
+	if prefix == "" {
+		prefix = tokenKeyPrefix(token.Key)
+	}
+	token.Key = prefix + "********"
+	token.KeySalt = ""
+}
+
+// getTokenByKeyFromDB 通过前缀索引查找候选令牌并校验哈希
+func getTokenByKeyFromDB(key string) (*Token, error) {
+	// 拒绝以哈希标记开头的 key，避免直接使用数据库中保存的哈希鉴权
+	if strings.HasPrefix(key, tokenKeyHashMarker) {
+		return nil, gorm.ErrRecordNotFound
+	}
+	var candidates []*Token
+	if err := DB.Where("key_prefix = ?", tokenKeyPrefix(key)).Find(&candidates).Error; err != nil {
+		return nil, err
+	}
+	for _, candidate := range candidates {
+		if candidate.MatchKey(key) {
+			return candidate, nil
+		}
+	}
+	if legacyTokenKeys.Load() {
+		// 只回查尚未迁移的明文行
+		var token Token
+		err := DB.Where(commonKeyCol+" = ? AND "+commonKeyCol+" NOT LIKE ?", key, tokenKeyHashMarker+"%").First(&token).Error
+		if err != nil {
+			return nil, err
+		}
+		return &token, nil
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+// migrateTokenKeyHash 将明文保存的令牌 key 迁移为加盐哈希，可重复执行
+func migrateTokenKeyHash() error {
+	const batchSize = 500
+	migrated := 0
+	for {
+		var tokens []*Token
+		err := DB.Unscoped().Select("id", commonKeyCol).
+			Where(commonKeyCol+" NOT LIKE ?", tokenKeyHashMarker+"%").
+			Order("id").Limit(batchSize).Find(&tokens).Error
+		if err != nil {
+			return err
+		}
+		if len(tokens) == 0 {
+			break
+		}
+		for _, token := range tokens {
+			plain := token.Key
+			if err := token.SetKey(plain); err != nil {
+				return err
+			}
+			err := DB.Unscoped().Model(&Token{}).Where("id = ? AND "+commonKeyCol+" = ?", token.Id, plain).
+				Updates(map[string]interface{}{
+					"key":        token.Key,
+					"key_prefix": token.KeyPrefix,
+					"key_salt":   token.KeySalt,
+				}).Error
+			if err != nil {
+				return err
+			}
+			migrated++
+		}
+	}
+	if migrated > 0 {
+		common.SysLog(fmt.Sprintf("migrated %d plaintext token keys to hashed storage", migrated))
+	}
+	legacyTokenKeys.Store(false)
+	return nil
+}
+
+// checkTokenKeyHashMigrated 非主节点只检测迁移状态，迁移由主节点负责。
+// 启动时主节点可能尚未完成迁移，因此在同步配置时重复检测直到迁移完成
+func checkTokenKeyHashMigrated() error {
+	if !legacyTokenKeys.Load() {
+		return nil
+	}
+	var count int64
+	err := DB.Unscoped().Model(&Token{}).Where(commonKeyCol+" NOT LIKE ?", tokenKeyHashMarker+"%").Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		legacyTokenKeys.Store(false)
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestTokenKeyHash(t *testing.T) {
+	t.Parallel()
+
+	key, err := common.GenerateKey()
+	require.NoError(t, err)
+
+	token := &Token{}
+	require.NoError(t, token.SetKey(key))
+	require.True(t, token.IsHashed())
+	require.NotEqual(t, key, token.Key)
+	require.LessOrEqual(t, len(token.Key), 48)
+	require.Equal(t, key[:TokenKeyPrefixLength], token.KeyPrefix)
+	require.True(t, token.MatchKey(key))
+	require.False(t, token.MatchKey(key[:len(key)-1]+"x"))
+
+	// 相同 key 使用不同盐得到不同哈希
+	other := &Token{}
+	require.NoError(t, other.SetKey(key))
+	require.NotEqual(t, token.Key, other.Key)
+
+	// 不能直接使用保存的哈希鉴权
+	_, err = getTokenByKeyFromDB(token.Key)
+	require.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+	token.MaskKey()
+	require.Equal(t, key[:TokenKeyPrefixLength]+"********", token.Key)
+	require.Empty(t, token.KeySalt)
+
+	legacy := &Token{Key: key}
+	require.False(t, legacy.IsHashed())
+	require.True(t, legacy.MatchKey(key))
+}
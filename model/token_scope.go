@@ -0,0 +1,64 @@
+package model
+
+import "strings"
+
+// 令牌权限范围
+const (
+	TokenScopeChat       = "chat"
+	TokenScopeEmbeddings = "embeddings"
+	TokenScopeImages     = "images"
+	TokenScopeAudio      = "audio"
+	TokenScopeRealtime   = "realtime"
+	TokenScopeTasks      = "tasks"
+	TokenScopeModelsRead = "models:read"
+)
+
+var TokenScopes = []string{
+	TokenScopeChat,
+	TokenScopeEmbeddings,
+	TokenScopeImages,
+	TokenScopeAudio,
+	TokenScopeRealtime,
+	TokenScopeTasks,
+	TokenScopeModelsRead,
+}
+
+// NormalizeTokenScopes 校验并规范化逗号分隔的权限范围，返回未知的 scope
+func NormalizeTokenScopes(scopes string) (string, []string) {
+	normalized := make([]string, 0)
+	unknown := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, scope := range strings.Split(scopes, ",") {
+		scope = strings.ToLower(strings.TrimSpace(scope))
+		if scope == "" || seen[scope] {
+			continue
+		}
+		seen[scope] = true
+		valid := false
+		for _, s := range TokenScopes {
+			if s == scope {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			unknown = append(unknown, scope)
+			continue
+		}
+		normalized = append(normalized, scope)
+	}
+	return strings.Join(normalized, ","), unknown
+}
+
+// HasScope 令牌是否拥有指定权限，未配置 scopes 的令牌拥有全部权限
+func (token *Token) HasScope(scope string) bool {
+	if token.Scopes == "" || scope == "" {
+		return true
+	}
+	for _, s := range strings.Split(token.Scopes, ",") {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
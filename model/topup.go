@@ -7,8 +7,10 @@ import (
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/logger"
 
+	"github.com/bytedance/gopkg/util/gopool"
 	"github.com/shopspring/decimal"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type TopUp struct {
@@ -21,6 +23,38 @@ type TopUp struct {
 	CreateTime    int64   `json:"create_time"`
 	CompleteTime  int64   `json:"complete_time"`
 	Status        string  `json:"status"`
+	// 支付平台侧的支付标识（如 Stripe PaymentIntent），用于退款、争议回调定位订单
+	ProviderPaymentId string `json:"provider_payment_id" gorm:"type:varchar(255);index;default:''"`
+	RefundedQuota     int    `json:"refunded_quota" gorm:"default:0"` // 因退款/争议已扣回的额度
+	// 下单时使用的优惠券，Discount 为抵扣的支付金额，BonusQuota 为充值成功后额外赠送的额度
+	CouponId   int     `json:"coupon_id" gorm:"index;default:0"`
+	Discount   float64 `json:"discount" gorm:"default:0"`
+	BonusQuota int     `json:"bonus_quota" gorm:"default:0"`
+	// 账单还款订单对应的账单，Amount 为还款额度
+	InvoiceId int `json:"invoice_id" gorm:"index;default:0"`
+}
+
+// CreditQuota 计算充值订单应发放的额度：
+// - Stripe 订单：Money 代表经分组倍率换算后的美元数量，直接 * QuotaPerUnit
+// - Creem 订单：Amount 即产品配置的充值额度
+// - 其他订单（如易支付、PayPal）：Amount 为美元数量，* QuotaPerUnit
+// - 账单还款订单：Amount 即账单的应还额度
+// 使用优惠券的订单另加赠送额度；优惠券抵扣的金额不影响入账额度。
+func (topUp *TopUp) CreditQuota() int {
+	if topUp.InvoiceId > 0 {
+		return int(topUp.Amount)
+	}
+	dQuotaPerUnit := decimal.NewFromFloat(common.QuotaPerUnit)
+	var quota int
+	switch topUp.PaymentMethod {
+	case "stripe":
+		quota = int(decimal.NewFromFloat(topUp.Money).Mul(dQuotaPerUnit).IntPart())
+	case "creem":
+		quota = int(topUp.Amount)
+	default:
+		quota = int(decimal.NewFromInt(topUp.Amount).Mul(dQuotaPerUnit).IntPart())
+	}
+	return quota + topUp.BonusQuota
 }
 
 func (topUp *TopUp) Insert() error {
@@ -85,7 +119,11 @@ func Recharge(referenceId string, customerId string) (err error) {
 			return err
 		}
 
-		quota = topUp.Money * common.QuotaPerUnit
+		if err := completeCouponUsageTx(tx, topUp.CouponId, topUp.TradeNo); err != nil {
+			return err
+		}
+
+		quota = float64(topUp.CreditQuota())
 		err = tx.Model(&User{}).Where("id = ?", topUp.UserId).Updates(map[string]interface{}{"stripe_customer": customerId, "quota": gorm.Expr("quota + ?", quota)}).Error
 		if err != nil {
 			return err
@@ -266,17 +304,7 @@ func ManualCompleteTopUp(tradeNo string) error {
 			return errors.New("订单状态不是待支付，无法补单")
 		}
 
-		// 计算应充值额度：
-		// - Stripe 订单：Money 代表经分组倍率换算后的美元数量，直接 * QuotaPerUnit
-		// - 其他订单（如易支付）：Amount 为美元数量，* QuotaPerUnit
-		if topUp.PaymentMethod == "stripe" {
-			dQuotaPerUnit := decimal.NewFromFloat(common.QuotaPerUnit)
-			quotaToAdd = int(decimal.NewFromFloat(topUp.Money).Mul(dQuotaPerUnit).IntPart())
-		} else {
-			dAmount := decimal.NewFromInt(topUp.Amount)
-			dQuotaPerUnit := decimal.NewFromFloat(common.QuotaPerUnit)
-			quotaToAdd = int(dAmount.Mul(dQuotaPerUnit).IntPart())
-		}
+		quotaToAdd = topUp.CreditQuota()
 		if quotaToAdd <= 0 {
 			return errors.New("无效的充值额度")
 		}
@@ -288,6 +316,10 @@ func ManualCompleteTopUp(tradeNo string) error {
 			return err
 		}
 
+		if err := completeCouponUsageTx(tx, topUp.CouponId, topUp.TradeNo); err != nil {
+			return err
+		}
+
 		// 增加用户额度（立即写库，保持一致性）
 		if err := tx.Model(&User{}).Where("id = ?", topUp.UserId).Update("quota", gorm.Expr("quota + ?", quotaToAdd)).Error; err != nil {
 			return err
@@ -306,6 +338,71 @@ func ManualCompleteTopUp(tradeNo string) error {
 	RecordLog(userId, LogTypeTopup, fmt.Sprintf("管理员补单成功，充值金额: %v，支付金额：%f", logger.FormatQuota(quotaToAdd), payMoney))
 	return nil
 }
+
+// CompleteTopUp 支付平台确认到账后完成充值订单并按 CreditQuota 为用户入账，
+// 同时记录支付平台侧的支付标识。订单已完成时直接返回，保证回调幂等。
+func CompleteTopUp(tradeNo string, providerPaymentId string) error {
+	if tradeNo == "" {
+		return errors.New("未提供支付单号")
+	}
+
+	refCol := "`trade_no`"
+	if common.UsingPostgreSQL {
+		refCol = `"trade_no"`
+	}
+
+	topUp := &TopUp{}
+	quotaToAdd := 0
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where(refCol+" = ?", tradeNo).First(topUp).Error; err != nil {
+			return errors.New("充值订单不存在")
+		}
+		if topUp.Status == common.TopUpStatusSuccess {
+			return nil
+		}
+		if topUp.Status != common.TopUpStatusPending {
+			return errors.New("充值订单状态错误")
+		}
+		credit := topUp.CreditQuota()
+		if credit <= 0 {
+			return errors.New("无效的充值额度")
+		}
+		updates := map[string]interface{}{
+			"status":        common.TopUpStatusSuccess,
+			"complete_time": common.GetTimestamp(),
+		}
+		if providerPaymentId != "" {
+			updates["provider_payment_id"] = providerPaymentId
+		}
+		// 只有把订单从 pending 改为 success 的请求入账，避免跳转回调与 webhook 在多节点上重复入账
+		res := tx.Model(&TopUp{}).Where("id = ? AND status = ?", topUp.Id, common.TopUpStatusPending).Updates(updates)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return nil
+		}
+		quotaToAdd = credit
+		if err := completeCouponUsageTx(tx, topUp.CouponId, topUp.TradeNo); err != nil {
+			return err
+		}
+		return tx.Model(&User{}).Where("id = ?", topUp.UserId).Update("quota", gorm.Expr("quota + ?", quotaToAdd)).Error
+	})
+	if err != nil {
+		common.SysError("topup failed: " + err.Error())
+		return err
+	}
+	if quotaToAdd > 0 {
+		gopool.Go(func() {
+			if err := cacheIncrUserQuota(topUp.UserId, int64(quotaToAdd)); err != nil {
+				common.SysLog("failed to increase user quota cache: " + err.Error())
+			}
+		})
+		RecordLog(topUp.UserId, LogTypeTopup, fmt.Sprintf("使用在线充值成功，充值金额: %v，支付金额：%f", logger.FormatQuota(quotaToAdd), topUp.Money))
+	}
+	return nil
+}
+
 func RechargeCreem(referenceId string, customerEmail string, customerName string) (err error) {
 	if referenceId == "" {
 		return errors.New("未提供支付单号")
@@ -336,8 +433,12 @@ func RechargeCreem(referenceId string, customerEmail string, customerName string
 			return err
 		}
 
-		// Creem 直接使用 Amount 作为充值额度（整数）
-		quota = topUp.Amount
+		if err := completeCouponUsageTx(tx, topUp.CouponId, topUp.TradeNo); err != nil {
+			return err
+		}
+
+		// Creem 直接使用 Amount 作为充值额度（整数），另加优惠券赠送额度
+		quota = int64(topUp.CreditQuota())
 
 		// 构建更新字段，优先使用邮箱，如果邮箱为空则使用用户名
 		updateFields := map[string]interface{}{
@@ -376,3 +477,77 @@ func RechargeCreem(referenceId string, customerEmail string, customerName string
 
 	return nil
 }
+
+func GetTopUpByProviderPaymentId(paymentId string) *TopUp {
+	if paymentId == "" {
+		return nil
+	}
+	var topUp TopUp
+	if err := DB.Where("provider_payment_id = ?", paymentId).First(&topUp).Error; err != nil {
+		return nil
+	}
+	return &topUp
+}
+
+// SetTopUpProviderPaymentId 记录充值订单在支付平台侧的支付标识
+func SetTopUpProviderPaymentId(tradeNo string, paymentId string) error {
+	if tradeNo == "" || paymentId == "" {
+		return nil
+	}
+	return DB.Model(&TopUp{}).Where("trade_no = ?", tradeNo).Update("provider_payment_id", paymentId).Error
+}
+
+// ClawbackTopUpQuota 按累计退款比例（refunded / total）扣回充值订单发放的额度，可重复调用，
+// 只扣回与上次相比新增的部分。用户额度允许被扣为负数。返回本次扣回的额度。
+func ClawbackTopUpQuota(paymentId string, refunded int64, total int64, reason string) (int, error) {
+	if paymentId == "" || total <= 0 || refunded <= 0 {
+		return 0, errors.New("invalid refund args")
+	}
+	if refunded > total {
+		refunded = total
+	}
+	var topUp TopUp
+	clawback := 0
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("provider_payment_id = ?", paymentId).First(&topUp).Error; err != nil {
+			return err
+		}
+		if topUp.Status != common.TopUpStatusSuccess && topUp.Status != common.TopUpStatusRefunded {
+			return errors.New("充值订单状态错误")
+		}
+		credited := topUp.CreditQuota()
+		target := int(int64(credited) * refunded / total)
+		clawback = target - topUp.RefundedQuota
+		if clawback <= 0 {
+			clawback = 0
+			return nil
+		}
+		status := topUp.Status
+		if refunded >= total {
+			status = common.TopUpStatusRefunded
+		}
+		// 以读到的已扣回额度为条件更新，退款与争议事件并发到达时只有一个生效，另一个返回错误等待重推
+		res := tx.Model(&TopUp{}).Where("id = ? AND refunded_quota = ?", topUp.Id, topUp.RefundedQuota).
+			Updates(map[string]interface{}{"refunded_quota": target, "status": status})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errors.New("充值订单退款状态已变更，请重试")
+		}
+		return tx.Model(&User{}).Where("id = ?", topUp.UserId).
+			Update("quota", gorm.Expr("quota - ?", clawback)).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+	if clawback > 0 {
+		gopool.Go(func() {
+			if err := cacheDecrUserQuota(topUp.UserId, int64(clawback)); err != nil {
+				common.SysLog("failed to decrease user quota cache: " + err.Error())
+			}
+		})
+		RecordLog(topUp.UserId, LogTypeTopup, fmt.Sprintf("%s，扣回额度: %s，订单号: %s", reason, logger.FormatQuota(clawback), topUp.TradeNo))
+	}
+	return clawback, nil
+}
@@ -0,0 +1,90 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClawbackTopUpQuota(t *testing.T) {
+	setupTestDB(t, &User{}, &TopUp{}, &Log{})
+	credited := int(10*common.QuotaPerUnit) + 1000
+	user := &User{Username: "alice", Quota: credited}
+	require.NoError(t, DB.Create(user).Error)
+	topUp := &TopUp{
+		UserId:            user.Id,
+		Money:             10,
+		BonusQuota:        1000,
+		TradeNo:           "ref_stripe",
+		PaymentMethod:     "stripe",
+		Status:            common.TopUpStatusSuccess,
+		ProviderPaymentId: "pi_1",
+	}
+	require.NoError(t, topUp.Insert())
+
+	requireClawback := func(refunded int64, total int64, want int, wantRefunded int, wantStatus string) {
+		t.Helper()
+		clawback, err := ClawbackTopUpQuota("pi_1", refunded, total, "Stripe 退款")
+		require.NoError(t, err)
+		require.Equal(t, want, clawback)
+		var got TopUp
+		require.NoError(t, DB.First(&got, topUp.Id).Error)
+		require.Equal(t, wantRefunded, got.RefundedQuota)
+		require.Equal(t, wantStatus, got.Status)
+		quota, err := GetUserQuota(user.Id, true)
+		require.NoError(t, err)
+		require.Equal(t, credited-wantRefunded, quota)
+	}
+
+	// 部分退款按累计退款比例扣回，赠送额度一并按比例扣回
+	first := credited / 4
+	requireClawback(250, 1000, first, first, common.TopUpStatusSuccess)
+	// 重复推送同一事件不会重复扣回
+	requireClawback(250, 1000, 0, first, common.TopUpStatusSuccess)
+
+	second := credited * 600 / 1000
+	requireClawback(600, 1000, second-first, second, common.TopUpStatusSuccess)
+	// 乱序到达的旧事件不会退回已扣额度
+	requireClawback(300, 1000, 0, second, common.TopUpStatusSuccess)
+
+	// 争议败诉扣回剩余全部额度
+	requireClawback(1, 1, credited-second, credited, common.TopUpStatusRefunded)
+	requireClawback(1, 1, 0, credited, common.TopUpStatusRefunded)
+	// 退款金额超过订单金额时按全额处理
+	requireClawback(2000, 1000, 0, credited, common.TopUpStatusRefunded)
+}
+
+func TestClawbackTopUpQuotaRejected(t *testing.T) {
+	setupTestDB(t, &User{}, &TopUp{}, &Log{})
+	require.NoError(t, (&TopUp{UserId: 1, Amount: 10, TradeNo: "ref_pending", Status: common.TopUpStatusPending, ProviderPaymentId: "pi_pending"}).Insert())
+
+	_, err := ClawbackTopUpQuota("", 1, 1, "Stripe 退款")
+	require.Error(t, err)
+	_, err = ClawbackTopUpQuota("pi_pending", 0, 1000, "Stripe 退款")
+	require.Error(t, err)
+	_, err = ClawbackTopUpQuota("pi_missing", 1, 1, "Stripe 退款")
+	require.Error(t, err)
+	// 未支付成功的订单没有发放额度
+	_, err = ClawbackTopUpQuota("pi_pending", 1, 1, "Stripe 退款")
+	require.Error(t, err)
+}
+
+func TestCompleteTopUpOnce(t *testing.T) {
+	setupTestDB(t, &User{}, &TopUp{}, &Log{})
+	user := &User{Username: "alice"}
+	require.NoError(t, DB.Create(user).Error)
+	require.NoError(t, (&TopUp{UserId: user.Id, Amount: 10, TradeNo: "ref_paypal", PaymentMethod: "paypal", Status: common.TopUpStatusPending}).Insert())
+
+	// 跳转回调与 webhook 先后到达，只入账一次
+	require.NoError(t, CompleteTopUp("ref_paypal", "CAP1"))
+	require.NoError(t, CompleteTopUp("ref_paypal", "CAP1"))
+	quota, err := GetUserQuota(user.Id, true)
+	require.NoError(t, err)
+	require.Equal(t, int(10*common.QuotaPerUnit), quota)
+
+	topUp := GetTopUpByTradeNo("ref_paypal")
+	require.Equal(t, common.TopUpStatusSuccess, topUp.Status)
+	require.Equal(t, "CAP1", topUp.ProviderPaymentId)
+	require.NotZero(t, topUp.CompleteTime)
+}
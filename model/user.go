@@ -47,6 +47,14 @@ type User struct {
 	Setting          string         `json:"setting" gorm:"type:text;column:setting"`
 	Remark           string         `json:"remark,omitempty" gorm:"type:varchar(255)" validate:"max=255"`
 	StripeCustomer   string         `json:"stripe_customer" gorm:"type:varchar(64);column:stripe_customer;index"`
+	CreatedTime      int64          `json:"created_time" gorm:"bigint;default:0"` // 注册时间，早期用户为 0
+}
+
+func (user *User) BeforeCreate(tx *gorm.DB) error {
+	if user.CreatedTime == 0 {
+		user.CreatedTime = common.GetTimestamp()
+	}
+	return nil
 }
 
 func (user *User) ToBaseUser() *UserBase {
@@ -996,3 +1004,30 @@ func RootUserExists() bool {
 	}
 	return true
 }
+
+// DisableUserById 封禁用户（如支付争议），不会封禁超级管理员，返回是否实际封禁
+func DisableUserById(id int) (bool, error) {
+	res := DB.Model(&User{}).Where("id = ? AND role <> ? AND status = ?", id, common.RoleRootUser, common.UserStatusEnabled).
+		Update("status", common.UserStatusDisabled)
+	if res.Error != nil {
+		return false, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return false, nil
+	}
+	if err := updateUserStatusCache(id, false); err != nil {
+		common.SysLog("failed to update user status cache: " + err.Error())
+	}
+	return true, nil
+}
+
+func GetUserIdByStripeCustomer(customerId string) (int, error) {
+	if customerId == "" {
+		return 0, errors.New("customer id is empty")
+	}
+	var user User
+	if err := DB.Select("id").Where("stripe_customer = ?", customerId).First(&user).Error; err != nil {
+		return 0, err
+	}
+	return user.Id, nil
+}
@@ -0,0 +1,127 @@
+package model
+
+import (
+	"errors"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	UserCreditStatusActive    = "active"
+	UserCreditStatusSuspended = "suspended" // 账单逾期，信用额度暂不可用
+)
+
+// UserCredit 后付费信用账户：允许用户余额透支到 -CreditLimit，按月出具账单结算
+type UserCredit struct {
+	Id              int    `json:"id"`
+	UserId          int    `json:"user_id" gorm:"uniqueIndex"`
+	CreditLimit     int    `json:"credit_limit" gorm:"default:0"`      // 可透支的额度
+	PaymentTermDays int    `json:"payment_term_days" gorm:"default:0"` // 付款期限（天），0 表示使用全局设置
+	Status          string `json:"status" gorm:"type:varchar(32);index"`
+	SuspendedTime   int64  `json:"suspended_time" gorm:"bigint;default:0"`
+	// 上次出账的截止时间与当时的累计已用额度，用于计算下一账期
+	LastInvoiceTime int64  `json:"last_invoice_time" gorm:"bigint;index;default:0"`
+	LastUsedQuota   int    `json:"last_used_quota" gorm:"default:0"`
+	Remark          string `json:"remark" gorm:"type:varchar(255);default:''"`
+	CreatedTime     int64  `json:"created_time" gorm:"bigint"`
+	UpdatedTime     int64  `json:"updated_time" gorm:"bigint"`
+}
+
+// Available 当前可透支的额度，暂停时为 0
+func (credit *UserCredit) Available() int {
+	if credit == nil || credit.Status != UserCreditStatusActive || credit.CreditLimit <= 0 {
+		return 0
+	}
+	return credit.CreditLimit
+}
+
+func GetUserCredit(userId int) (*UserCredit, error) {
+	var credit UserCredit
+	err := DB.Where("user_id = ?", userId).First(&credit).Error
+	if err != nil {
+		return nil, err
+	}
+	return &credit, nil
+}
+
+// GetUserCreditLimit 返回用户当前可透支的额度，未开通信用账户时为 0
+func GetUserCreditLimit(userId int) int {
+	credit, err := GetUserCredit(userId)
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			common.SysError("failed to get user credit: " + err.Error())
+		}
+		return 0
+	}
+	return credit.Available()
+}
+
+// UserQuotaSufficient 用户余额加上可透支的信用额度是否足够支付 quota，余额充足时不查询信用账户
+func UserQuotaSufficient(userId int, userQuota int, quota int) bool {
+	if userQuota >= quota {
+		return true
+	}
+	return userQuota+GetUserCreditLimit(userId) >= quota
+}
+
+// SaveUserCredit 开通或修改用户的信用账户。新开通的账户从当前时间开始计算账期
+func SaveUserCredit(input *UserCredit) (*UserCredit, error) {
+	if input.UserId <= 0 {
+		return nil, errors.New("无效的用户")
+	}
+	if input.CreditLimit < 0 || input.PaymentTermDays < 0 {
+		return nil, errors.New("信用额度和付款期限不能为负数")
+	}
+	if input.Status != "" && input.Status != UserCreditStatusActive && input.Status != UserCreditStatusSuspended {
+		return nil, errors.New("无效的状态")
+	}
+	var credit UserCredit
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var user User
+		if err := tx.Select("id", "used_quota").Where("id = ?", input.UserId).First(&user).Error; err != nil {
+			return errors.New("用户不存在")
+		}
+		now := common.GetTimestamp()
+		query := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("user_id = ?", input.UserId).Limit(1).Find(&credit)
+		if query.Error != nil {
+			return query.Error
+		}
+		if query.RowsAffected == 0 {
+			credit = UserCredit{
+				UserId:          input.UserId,
+				Status:          UserCreditStatusActive,
+				LastInvoiceTime: now,
+				LastUsedQuota:   user.UsedQuota,
+				CreatedTime:     now,
+			}
+		}
+		credit.CreditLimit = input.CreditLimit
+		credit.PaymentTermDays = input.PaymentTermDays
+		credit.Remark = input.Remark
+		if input.Status != "" && input.Status != credit.Status {
+			credit.Status = input.Status
+			credit.SuspendedTime = 0
+			if input.Status == UserCreditStatusSuspended {
+				credit.SuspendedTime = now
+			}
+		}
+		credit.UpdatedTime = now
+		return tx.Save(&credit).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &credit, nil
+}
+
+func GetAllUserCredits(pageInfo *common.PageInfo) (credits []*UserCredit, total int64, err error) {
+	query := DB.Model(&UserCredit{})
+	if err = query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = query.Order("id desc").Limit(pageInfo.GetPageSize()).Offset(pageInfo.GetStartIdx()).Find(&credits).Error
+	return credits, total, err
+}
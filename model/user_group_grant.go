@@ -0,0 +1,124 @@
+package model
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// UserGroupGrant 临时分组升级（如兑换码赠送），到期后恢复为升级前的分组
+type UserGroupGrant struct {
+	Id           int    `json:"id"`
+	UserId       int    `json:"user_id" gorm:"index"`
+	UpgradeGroup string `json:"upgrade_group" gorm:"type:varchar(64)"`
+	PrevGroup    string `json:"prev_group" gorm:"type:varchar(64);default:''"`
+	Source       string `json:"source" gorm:"type:varchar(32);default:''"`
+	StartTime    int64  `json:"start_time" gorm:"bigint"`
+	EndTime      int64  `json:"end_time" gorm:"bigint;index"`
+	Status       string `json:"status" gorm:"type:varchar(32);index"` // active/expired
+}
+
+// grantUserGroupTx 将用户临时升级到 group，持续 duration 秒。
+// 已有同分组的有效升级时顺延到期时间；用户本身就在该分组时不做处理，返回 false。
+func grantUserGroupTx(tx *gorm.DB, userId int, group string, duration int64, source string) (bool, error) {
+	group = strings.TrimSpace(group)
+	if userId <= 0 || group == "" || duration <= 0 {
+		return false, errors.New("invalid group grant")
+	}
+	now := common.GetTimestamp()
+	var existing UserGroupGrant
+	query := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("user_id = ? AND status = ? AND upgrade_group = ?", userId, "active", group).
+		Order("end_time desc").Limit(1).Find(&existing)
+	if query.Error != nil {
+		return false, query.Error
+	}
+	if query.RowsAffected > 0 {
+		base := existing.EndTime
+		if base < now {
+			base = now
+		}
+		return false, tx.Model(&existing).Update("end_time", base+duration).Error
+	}
+	currentGroup, err := getUserGroupByIdTx(tx, userId)
+	if err != nil {
+		return false, err
+	}
+	if currentGroup == group {
+		return false, nil
+	}
+	grant := &UserGroupGrant{
+		UserId:       userId,
+		UpgradeGroup: group,
+		PrevGroup:    currentGroup,
+		Source:       source,
+		StartTime:    now,
+		EndTime:      now + duration,
+		Status:       "active",
+	}
+	if err := tx.Create(grant).Error; err != nil {
+		return false, err
+	}
+	if err := tx.Model(&User{}).Where("id = ?", userId).Update("group", group).Error; err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// ExpireDueUserGroupGrants 处理到期的临时分组升级：用户仍在升级分组且没有其他升级来源时恢复原分组
+func ExpireDueUserGroupGrants(limit int) (int, error) {
+	if limit <= 0 {
+		limit = 200
+	}
+	now := common.GetTimestamp()
+	var grants []UserGroupGrant
+	if err := DB.Where("status = ? AND end_time <= ?", "active", now).
+		Order("end_time asc, id asc").Limit(limit).Find(&grants).Error; err != nil {
+		return 0, err
+	}
+	expired := 0
+	for _, grant := range grants {
+		restoreGroup := ""
+		err := DB.Transaction(func(tx *gorm.DB) error {
+			res := tx.Model(&UserGroupGrant{}).Where("id = ? AND status = ?", grant.Id, "active").Update("status", "expired")
+			if res.Error != nil || res.RowsAffected == 0 {
+				return res.Error
+			}
+			expired++
+			currentGroup, err := getUserGroupByIdTx(tx, grant.UserId)
+			if err != nil {
+				return err
+			}
+			if currentGroup != grant.UpgradeGroup || grant.PrevGroup == "" || grant.PrevGroup == currentGroup {
+				return nil
+			}
+			// 有效订阅同样升级到该分组时，交由订阅到期处理
+			var subCount int64
+			if err := tx.Model(&UserSubscription{}).
+				Where("user_id = ? AND status = ? AND end_time > ? AND upgrade_group = ?", grant.UserId, "active", now, currentGroup).
+				Count(&subCount).Error; err != nil {
+				return err
+			}
+			if subCount > 0 {
+				return nil
+			}
+			if err := tx.Model(&User{}).Where("id = ?", grant.UserId).Update("group", grant.PrevGroup).Error; err != nil {
+				return err
+			}
+			restoreGroup = grant.PrevGroup
+			return nil
+		})
+		if err != nil {
+			return expired, err
+		}
+		if restoreGroup != "" {
+			_ = UpdateUserGroupCache(grant.UserId, restoreGroup)
+			RecordLog(grant.UserId, LogTypeSystem, "临时分组升级已到期，恢复为分组 "+restoreGroup)
+		}
+	}
+	return expired, nil
+}
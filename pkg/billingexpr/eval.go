@@ -0,0 +1,240 @@
+package billingexpr
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+type node interface {
+	eval(env *Env) (value, error)
+}
+
+type literalNode struct {
+	v value
+}
+
+func (n *literalNode) eval(*Env) (value, error) {
+	return n.v, nil
+}
+
+type varNode struct {
+	name string
+}
+
+func (n *varNode) eval(env *Env) (value, error) {
+	return numberValue(env.Vars[n.name]), nil
+}
+
+type unaryNode struct {
+	op      string
+	operand node
+}
+
+func (n *unaryNode) eval(env *Env) (value, error) {
+	v, err := n.operand.eval(env)
+	if err != nil {
+		return value{}, err
+	}
+	if n.op == "!" {
+		return boolValue(!v.truthy()), nil
+	}
+	num, err := v.number()
+	if err != nil {
+		return value{}, err
+	}
+	return numberValue(-num), nil
+}
+
+type binaryNode struct {
+	op          string
+	left, right node
+}
+
+func (n *binaryNode) eval(env *Env) (value, error) {
+	left, err := n.left.eval(env)
+	if err != nil {
+		return value{}, err
+	}
+	// 逻辑运算短路求值
+	switch n.op {
+	case "&&":
+		if !left.truthy() {
+			return boolValue(false), nil
+		}
+		right, err := n.right.eval(env)
+		if err != nil {
+			return value{}, err
+		}
+		return boolValue(right.truthy()), nil
+	case "||":
+		if left.truthy() {
+			return boolValue(true), nil
+		}
+		right, err := n.right.eval(env)
+		if err != nil {
+			return value{}, err
+		}
+		return boolValue(right.truthy()), nil
+	}
+	right, err := n.right.eval(env)
+	if err != nil {
+		return value{}, err
+	}
+	switch n.op {
+	case "==":
+		return boolValue(equal(left, right)), nil
+	case "!=":
+		return boolValue(!equal(left, right)), nil
+	}
+	a, err := left.number()
+	if err != nil {
+		return value{}, err
+	}
+	b, err := right.number()
+	if err != nil {
+		return value{}, err
+	}
+	switch n.op {
+	case "+":
+		return numberValue(a + b), nil
+	case "-":
+		return numberValue(a - b), nil
+	case "*":
+		return numberValue(a * b), nil
+	case "/":
+		if b == 0 {
+			return value{}, errors.New("division by zero")
+		}
+		return numberValue(a / b), nil
+	case "%":
+		if b == 0 {
+			return value{}, errors.New("division by zero")
+		}
+		return numberValue(math.Mod(a, b)), nil
+	case "<":
+		return boolValue(a < b), nil
+	case "<=":
+		return boolValue(a <= b), nil
+	case ">":
+		return boolValue(a > b), nil
+	case ">=":
+		return boolValue(a >= b), nil
+	}
+	return value{}, fmt.Errorf("unknown operator %q", n.op)
+}
+
+// equal 字符串与数值比较时按字符串比较，如 param("n") == "2" 与 param("n") == 2 均可
+func equal(a, b value) bool {
+	if a.isStr || b.isStr {
+		return a.String() == b.String()
+	}
+	return a.num == b.num
+}
+
+func (v value) String() string {
+	if v.isStr {
+		return v.str
+	}
+	return fmt.Sprint(v.num)
+}
+
+type condNode struct {
+	cond, then, otherwise node
+}
+
+func (n *condNode) eval(env *Env) (value, error) {
+	c, err := n.cond.eval(env)
+	if err != nil {
+		return value{}, err
+	}
+	if c.truthy() {
+		return n.then.eval(env)
+	}
+	return n.otherwise.eval(env)
+}
+
+type callNode struct {
+	name string
+	fn   function
+	args []node
+}
+
+func (n *callNode) eval(env *Env) (value, error) {
+	if n.fn.raw != nil {
+		return n.fn.raw(env, n.args)
+	}
+	nums := make([]float64, len(n.args))
+	for i, arg := range n.args {
+		v, err := arg.eval(env)
+		if err != nil {
+			return value{}, err
+		}
+		if nums[i], err = v.number(); err != nil {
+			return value{}, fmt.Errorf("%s: %w", n.name, err)
+		}
+	}
+	return numberValue(n.fn.numeric(nums)), nil
+}
+
+type function struct {
+	minArgs int
+	maxArgs int // -1 表示不限
+	numeric func(args []float64) float64
+	raw     func(env *Env, args []node) (value, error)
+}
+
+var functions = map[string]function{
+	"min": {minArgs: 1, maxArgs: -1, numeric: func(args []float64) float64 {
+		r := args[0]
+		for _, a := range args[1:] {
+			r = math.Min(r, a)
+		}
+		return r
+	}},
+	"max": {minArgs: 1, maxArgs: -1, numeric: func(args []float64) float64 {
+		r := args[0]
+		for _, a := range args[1:] {
+			r = math.Max(r, a)
+		}
+		return r
+	}},
+	"abs":   {minArgs: 1, maxArgs: 1, numeric: func(args []float64) float64 { return math.Abs(args[0]) }},
+	"ceil":  {minArgs: 1, maxArgs: 1, numeric: func(args []float64) float64 { return math.Ceil(args[0]) }},
+	"floor": {minArgs: 1, maxArgs: 1, numeric: func(args []float64) float64 { return math.Floor(args[0]) }},
+	"round": {minArgs: 1, maxArgs: 2, numeric: func(args []float64) float64 {
+		if len(args) == 1 {
+			return math.Round(args[0])
+		}
+		scale := math.Pow(10, math.Trunc(args[1]))
+		return math.Round(args[0]*scale) / scale
+	}},
+	"clamp": {minArgs: 3, maxArgs: 3, numeric: func(args []float64) float64 {
+		return math.Min(math.Max(args[0], args[1]), args[2])
+	}},
+	// per_million(tokens, price) 以每百万 tokens 价格计费
+	"per_million": {minArgs: 2, maxArgs: 2, numeric: func(args []float64) float64 { return args[0] * args[1] / 1e6 }},
+	// param(path) 读取请求参数，不存在时为空字符串；param(path, default) 不存在时返回默认值
+	"param": {minArgs: 1, maxArgs: 2, raw: func(env *Env, args []node) (value, error) {
+		path, err := args[0].eval(env)
+		if err != nil {
+			return value{}, err
+		}
+		var raw any
+		if env.Param != nil {
+			raw = env.Param(path.String())
+		}
+		if raw == nil && len(args) == 2 {
+			return args[1].eval(env)
+		}
+		return valueOf(raw), nil
+	}},
+	// has(path) 请求中是否包含该参数
+	"has": {minArgs: 1, maxArgs: 1, raw: func(env *Env, args []node) (value, error) {
+		path, err := args[0].eval(env)
+		if err != nil {
+			return value{}, err
+		}
+		return boolValue(env.Param != nil && env.Param(path.String()) != nil), nil
+	}},
+}
@@ -0,0 +1,440 @@
+// Package billingexpr 实现计费表达式：只包含算术、比较、逻辑、三元运算和少量内置函数，
+// 不支持赋值、循环和任意函数调用，表达式结果为本次请求的美元价格。
+package billingexpr
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	maxSourceLength = 4096
+	maxDepth        = 64
+)
+
+// 可在表达式中使用的用量变量
+const (
+	VarPromptTokens         = "prompt_tokens"          // 未命中缓存的文本输入 tokens（不含缓存读写、图片、音频输入）
+	VarInputTokens          = "input_tokens"           // 全部输入 tokens
+	VarCompletionTokens     = "completion_tokens"      // 全部输出 tokens，包含推理 tokens
+	VarReasoningTokens      = "reasoning_tokens"       // 输出中的推理 tokens
+	VarCachedTokens         = "cached_tokens"          // 缓存命中 tokens
+	VarCacheWriteTokens     = "cache_write_tokens"     // 缓存写入 tokens
+	VarCacheWrite1hTokens   = "cache_write_1h_tokens"  // 其中 1h 缓存写入 tokens
+	VarAudioInputTokens     = "audio_input_tokens"     // 音频输入 tokens
+	VarAudioOutputTokens    = "audio_output_tokens"    // 音频输出 tokens
+	VarImageTokens          = "image_tokens"           // 图片输入 tokens
+	VarWebSearchCalls       = "web_search_calls"       // 联网搜索调用次数
+	VarFileSearchCalls      = "file_search_calls"      // 文件搜索调用次数
+	VarCodeInterpreterCalls = "code_interpreter_calls" // 代码解释器调用次数
+	VarImageGenerationCalls = "image_generation_calls" // 图片生成工具调用次数
+	VarStream               = "stream"                 // 流式请求为 1
+	VarPreConsume           = "pre_consume"            // 预扣估算时为 1，结算时为 0
+)
+
+var Variables = []string{
+	VarPromptTokens, VarInputTokens, VarCompletionTokens, VarReasoningTokens,
+	VarCachedTokens, VarCacheWriteTokens, VarCacheWrite1hTokens,
+	VarAudioInputTokens, VarAudioOutputTokens, VarImageTokens,
+	VarWebSearchCalls, VarFileSearchCalls, VarCodeInterpreterCalls, VarImageGenerationCalls,
+	VarStream, VarPreConsume,
+}
+
+var knownVariables = func() map[string]bool {
+	m := make(map[string]bool, len(Variables))
+	for _, v := range Variables {
+		m[v] = true
+	}
+	return m
+}()
+
+// Env 表达式求值环境，Param 按 JSON 路径读取请求参数，返回 string / float64 / bool 或 nil
+type Env struct {
+	Vars  map[string]float64
+	Param func(path string) any
+}
+
+// Program 已编译的表达式
+type Program struct {
+	Source string
+	root   node
+}
+
+func (p *Program) String() string {
+	return p.Source
+}
+
+// Compile 解析并校验表达式，未知变量和函数在编译时报错
+func Compile(source string) (*Program, error) {
+	source = strings.TrimSpace(source)
+	if source == "" {
+		return nil, errors.New("expression is empty")
+	}
+	if len(source) > maxSourceLength {
+		return nil, fmt.Errorf("expression exceeds %d characters", maxSourceLength)
+	}
+	tokens, err := tokenize(source)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	root, err := p.parseExpr(0)
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != tokenEOF {
+		return nil, fmt.Errorf("unexpected %q at position %d", p.peek().text, p.peek().pos)
+	}
+	return &Program{Source: source, root: root}, nil
+}
+
+// Eval 计算表达式，结果必须为非负有限数值
+func (p *Program) Eval(env Env) (float64, error) {
+	v, err := p.root.eval(&env)
+	if err != nil {
+		return 0, err
+	}
+	if v.isStr {
+		return 0, errors.New("expression must evaluate to a number")
+	}
+	if math.IsNaN(v.num) || math.IsInf(v.num, 0) {
+		return 0, errors.New("expression result is not a finite number")
+	}
+	if v.num < 0 {
+		return 0, fmt.Errorf("expression result is negative: %v", v.num)
+	}
+	return v.num, nil
+}
+
+type value struct {
+	num   float64
+	str   string
+	isStr bool
+}
+
+func numberValue(n float64) value {
+	return value{num: n}
+}
+
+func boolValue(b bool) value {
+	if b {
+		return value{num: 1}
+	}
+	return value{num: 0}
+}
+
+func (v value) truthy() bool {
+	if v.isStr {
+		return v.str != ""
+	}
+	return v.num != 0
+}
+
+func (v value) number() (float64, error) {
+	if v.isStr {
+		n, err := strconv.ParseFloat(v.str, 64)
+		if err != nil {
+			return 0, fmt.Errorf("string %q is not a number", v.str)
+		}
+		return n, nil
+	}
+	return v.num, nil
+}
+
+func valueOf(raw any) value {
+	switch x := raw.(type) {
+	case nil:
+		return value{isStr: true}
+	case string:
+		return value{str: x, isStr: true}
+	case bool:
+		return boolValue(x)
+	case float64:
+		return numberValue(x)
+	case int:
+		return numberValue(float64(x))
+	case int64:
+		return numberValue(float64(x))
+	default:
+		return value{str: fmt.Sprint(x), isStr: true}
+	}
+}
+
+// ---- tokenizer ----
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenNumber
+	tokenString
+	tokenIdent
+	tokenOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	num  float64
+	pos  int
+}
+
+var twoCharOps = []string{"<=", ">=", "==", "!=", "&&", "||"}
+
+func tokenize(src string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case (c >= '0' && c <= '9') || (c == '.' && i+1 < len(src) && src[i+1] >= '0' && src[i+1] <= '9'):
+			start := i
+			for i < len(src) && (isDigit(src[i]) || src[i] == '.') {
+				i++
+			}
+			if i < len(src) && (src[i] == 'e' || src[i] == 'E') {
+				i++
+				if i < len(src) && (src[i] == '+' || src[i] == '-') {
+					i++
+				}
+				for i < len(src) && isDigit(src[i]) {
+					i++
+				}
+			}
+			n, err := strconv.ParseFloat(src[start:i], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number %q at position %d", src[start:i], start)
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: src[start:i], num: n, pos: start})
+		case c == '"' || c == '\'':
+			start := i
+			i++
+			var sb strings.Builder
+			for i < len(src) && src[i] != c {
+				if src[i] == '\\' && i+1 < len(src) {
+					i++
+				}
+				sb.WriteByte(src[i])
+				i++
+			}
+			if i >= len(src) {
+				return nil, fmt.Errorf("unterminated string at position %d", start)
+			}
+			i++
+			tokens = append(tokens, token{kind: tokenString, text: sb.String(), pos: start})
+		case isIdentStart(c):
+			start := i
+			for i < len(src) && (isIdentStart(src[i]) || isDigit(src[i])) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: src[start:i], pos: start})
+		default:
+			matched := false
+			for _, op := range twoCharOps {
+				if strings.HasPrefix(src[i:], op) {
+					tokens = append(tokens, token{kind: tokenOp, text: op, pos: i})
+					i += 2
+					matched = true
+					break
+				}
+			}
+			if matched {
+				continue
+			}
+			if strings.ContainsRune("+-*/%<>!?:(),", rune(c)) {
+				tokens = append(tokens, token{kind: tokenOp, text: string(c), pos: i})
+				i++
+				continue
+			}
+			return nil, fmt.Errorf("unexpected character %q at position %d", c, i)
+		}
+	}
+	return append(tokens, token{kind: tokenEOF, pos: len(src)}), nil
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// ---- parser ----
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) acceptOp(ops ...string) (string, bool) {
+	t := p.peek()
+	if t.kind != tokenOp {
+		return "", false
+	}
+	for _, op := range ops {
+		if t.text == op {
+			p.pos++
+			return op, true
+		}
+	}
+	return "", false
+}
+
+func (p *parser) expectOp(op string) error {
+	if _, ok := p.acceptOp(op); !ok {
+		t := p.peek()
+		return fmt.Errorf("expected %q at position %d", op, t.pos)
+	}
+	return nil
+}
+
+// 优先级从低到高：?: → || → && → 比较 → + - → * / % → 一元
+func (p *parser) parseExpr(depth int) (node, error) {
+	if depth > maxDepth {
+		return nil, errors.New("expression is nested too deeply")
+	}
+	cond, err := p.parseBinary(0, depth)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := p.acceptOp("?"); !ok {
+		return cond, nil
+	}
+	then, err := p.parseExpr(depth + 1)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectOp(":"); err != nil {
+		return nil, err
+	}
+	otherwise, err := p.parseExpr(depth + 1)
+	if err != nil {
+		return nil, err
+	}
+	return &condNode{cond: cond, then: then, otherwise: otherwise}, nil
+}
+
+var binaryLevels = [][]string{
+	{"||"},
+	{"&&"},
+	{"<", "<=", ">", ">=", "==", "!="},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+func (p *parser) parseBinary(level int, depth int) (node, error) {
+	if level == len(binaryLevels) {
+		return p.parseUnary(depth)
+	}
+	left, err := p.parseBinary(level+1, depth)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.acceptOp(binaryLevels[level]...)
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseBinary(level+1, depth)
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: op, left: left, right: right}
+	}
+}
+
+func (p *parser) parseUnary(depth int) (node, error) {
+	if depth > maxDepth {
+		return nil, errors.New("expression is nested too deeply")
+	}
+	if op, ok := p.acceptOp("-", "!"); ok {
+		operand, err := p.parseUnary(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return &unaryNode{op: op, operand: operand}, nil
+	}
+	return p.parsePrimary(depth)
+}
+
+func (p *parser) parsePrimary(depth int) (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenNumber:
+		return &literalNode{v: numberValue(t.num)}, nil
+	case tokenString:
+		return &literalNode{v: value{str: t.text, isStr: true}}, nil
+	case tokenIdent:
+		if _, ok := p.acceptOp("("); ok {
+			return p.parseCall(t, depth)
+		}
+		switch t.text {
+		case "true":
+			return &literalNode{v: boolValue(true)}, nil
+		case "false":
+			return &literalNode{v: boolValue(false)}, nil
+		}
+		if !knownVariables[t.text] {
+			return nil, fmt.Errorf("unknown variable %q at position %d", t.text, t.pos)
+		}
+		return &varNode{name: t.text}, nil
+	case tokenOp:
+		if t.text == "(" {
+			inner, err := p.parseExpr(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expectOp(")"); err != nil {
+				return nil, err
+			}
+			return inner, nil
+		}
+	case tokenEOF:
+		return nil, errors.New("unexpected end of expression")
+	}
+	return nil, fmt.Errorf("unexpected %q at position %d", t.text, t.pos)
+}
+
+func (p *parser) parseCall(name token, depth int) (node, error) {
+	fn, ok := functions[name.text]
+	if !ok {
+		return nil, fmt.Errorf("unknown function %q at position %d", name.text, name.pos)
+	}
+	var args []node
+	if _, closed := p.acceptOp(")"); !closed {
+		for {
+			arg, err := p.parseExpr(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+			if _, more := p.acceptOp(","); !more {
+				break
+			}
+		}
+		if err := p.expectOp(")"); err != nil {
+			return nil, err
+		}
+	}
+	if len(args) < fn.minArgs || (fn.maxArgs >= 0 && len(args) > fn.maxArgs) {
+		return nil, fmt.Errorf("function %s called with %d arguments", name.text, len(args))
+	}
+	return &callNode{name: name.text, fn: fn, args: args}, nil
+}
@@ -0,0 +1,67 @@
+package billingexpr
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEval(t *testing.T) {
+	env := Env{
+		Vars: map[string]float64{
+			VarPromptTokens:     1000,
+			VarCompletionTokens: 500,
+			VarCachedTokens:     2000,
+			VarInputTokens:      250000,
+			VarWebSearchCalls:   2,
+		},
+		Param: func(path string) any {
+			switch path {
+			case "quality":
+				return "hd"
+			case "n":
+				return float64(2)
+			}
+			return nil
+		},
+	}
+	cases := map[string]float64{
+		"per_million(prompt_tokens, 3) + per_million(completion_tokens, 15)":      0.0105,
+		"(input_tokens > 200000 ? 6 : 3) * prompt_tokens / 1e6":                   0.006,
+		"web_search_calls * 0.01 + per_million(cached_tokens, 0.3)":               0.0206,
+		"param('quality') == 'hd' ? 0.08 * param('n') : 0.04":                     0.16,
+		"param(\"size\", 1) * max(1, min(prompt_tokens, 3), -2)":                  3,
+		"has('quality') && !has('size') ? round(1.23456, 2) : 0":                  1.23,
+		"clamp(completion_tokens - prompt_tokens, 0, 10) + ceil(0.2) + 7 % 4 * 2": 7,
+	}
+	for source, want := range cases {
+		program, err := Compile(source)
+		require.NoError(t, err, source)
+		got, err := program.Eval(env)
+		require.NoError(t, err, source)
+		require.InDelta(t, want, got, 1e-9, source)
+	}
+}
+
+func TestCompileAndEvalErrors(t *testing.T) {
+	for _, source := range []string{
+		"",
+		"prompt_tokens +",
+		"unknown_var * 2",
+		"exec('rm')",
+		"(1 + 2",
+		"1 ? 2",
+		"'abc",
+		"min()",
+	} {
+		_, err := Compile(source)
+		require.Error(t, err, source)
+	}
+
+	for _, source := range []string{"1 / (prompt_tokens - prompt_tokens)", "0 - 1", "'hd'", "param('q') * 2"} {
+		program, err := Compile(source)
+		require.NoError(t, err, source)
+		_, err = program.Eval(Env{Param: func(string) any { return "x" }})
+		require.Error(t, err, source)
+	}
+}
@@ -52,6 +52,11 @@ type TaskAdaptor interface {
 	ParseTaskResult(respBody []byte) (*relaycommon.TaskInfo, error)
 }
 
+// TaskMediaParamsProvider 由适配器从各自的请求格式中解析媒体计费参数，未实现时从通用提交请求中解析
+type TaskMediaParamsProvider interface {
+	GetMediaParams(c *gin.Context, info *relaycommon.RelayInfo) (types.MediaParams, error)
+}
+
 type OpenAIVideoConverter interface {
 	ConvertToOpenAIVideo(originTask *model.Task) ([]byte, error)
 }
@@ -1,6 +1,7 @@
 package aws
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"net/http"
@@ -9,6 +10,7 @@ import (
 	"github.com/QuantumNous/new-api/dto"
 	"github.com/QuantumNous/new-api/relay/channel"
 	"github.com/QuantumNous/new-api/relay/channel/claude"
+	"github.com/QuantumNous/new-api/relay/channel/openai"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
 	"github.com/QuantumNous/new-api/service"
 	"github.com/QuantumNous/new-api/types"
@@ -30,7 +32,10 @@ type Adaptor struct {
 	AwsClient  *bedrockruntime.Client
 	AwsModelId string
 	AwsReq     any
-	IsNova     bool
+	// IsConverse 非 Claude 模型使用 Bedrock Converse API
+	IsConverse   bool
+	converseURL  string
+	converseBody []byte
 }
 
 func (a *Adaptor) ConvertGeminiRequest(*gin.Context, *relaycommon.RelayInfo, *dto.GeminiChatRequest) (any, error) {
@@ -39,6 +44,14 @@ func (a *Adaptor) ConvertGeminiRequest(*gin.Context, *relaycommon.RelayInfo, *dt
 }
 
 func (a *Adaptor) ConvertClaudeRequest(c *gin.Context, info *relaycommon.RelayInfo, request *dto.ClaudeRequest) (any, error) {
+	if a.IsConverse {
+		adaptor := openai.Adaptor{}
+		oaiReq, err := adaptor.ConvertClaudeRequest(c, info, request)
+		if err != nil {
+			return nil, err
+		}
+		return a.ConvertOpenAIRequest(c, info, oaiReq.(*dto.GeneralOpenAIRequest))
+	}
 	for i, message := range request.Messages {
 		updated := false
 		if !message.IsStringContent() {
@@ -72,6 +85,7 @@ func (a *Adaptor) ConvertClaudeRequest(c *gin.Context, info *relaycommon.RelayIn
 			request.Messages[i] = message
 		}
 	}
+	service.ApplyClaudePromptCache(info, request)
 	return request, nil
 }
 
@@ -86,9 +100,13 @@ func (a *Adaptor) ConvertImageRequest(c *gin.Context, info *relaycommon.RelayInf
 }
 
 func (a *Adaptor) Init(info *relaycommon.RelayInfo) {
+	a.IsConverse = !isClaudeModel(getAwsModelID(info.UpstreamModelName))
 }
 
 func (a *Adaptor) GetRequestURL(info *relaycommon.RelayInfo) (string, error) {
+	if a.IsConverse {
+		return getConverseRequestURL(info)
+	}
 	if info.ChannelOtherSettings.AwsKeyType == dto.AwsKeyTypeApiKey {
 		awsModelId := getAwsModelID(info.UpstreamModelName)
 		a.ClientMode = ClientModeApiKey
@@ -104,6 +122,9 @@ func (a *Adaptor) GetRequestURL(info *relaycommon.RelayInfo) (string, error) {
 }
 
 func (a *Adaptor) SetupRequestHeader(c *gin.Context, req *http.Header, info *relaycommon.RelayInfo) error {
+	if a.IsConverse {
+		return signConverseRequest(info, req, a.converseURL, a.converseBody)
+	}
 	claude.CommonClaudeHeadersOperation(c, req, info)
 	if a.ClientMode == ClientModeApiKey {
 		req.Set("Authorization", "Bearer "+info.ApiKey)
@@ -115,11 +136,8 @@ func (a *Adaptor) ConvertOpenAIRequest(c *gin.Context, info *relaycommon.RelayIn
 	if request == nil {
 		return nil, errors.New("request is nil")
 	}
-	// 检查是否为Nova模型
-	if isNovaModel(request.Model) {
-		novaReq := convertToNovaRequest(request)
-		a.IsNova = true
-		return novaReq, nil
+	if a.IsConverse {
+		return convertOpenAI2Converse(c, info, request)
 	}
 
 	// 原有的Claude模型处理逻辑
@@ -128,6 +146,7 @@ func (a *Adaptor) ConvertOpenAIRequest(c *gin.Context, info *relaycommon.RelayIn
 		return nil, errors.Wrap(err, "failed to convert openai request to claude request")
 	}
 	info.UpstreamModelName = claudeReq.Model
+	service.ApplyClaudePromptCache(info, claudeReq)
 	return claudeReq, err
 }
 
@@ -146,6 +165,19 @@ func (a *Adaptor) ConvertOpenAIResponsesRequest(c *gin.Context, info *relaycommo
 }
 
 func (a *Adaptor) DoRequest(c *gin.Context, info *relaycommon.RelayInfo, requestBody io.Reader) (any, error) {
+	if a.IsConverse {
+		// SigV4 签名需要完整的请求体和地址
+		body, err := io.ReadAll(requestBody)
+		if err != nil {
+			return nil, err
+		}
+		a.converseBody = body
+		a.converseURL, err = getConverseRequestURL(info)
+		if err != nil {
+			return nil, err
+		}
+		return channel.DoApiRequest(a, c, info, bytes.NewReader(body))
+	}
 	if a.ClientMode == ClientModeApiKey {
 		return channel.DoApiRequest(a, c, info, requestBody)
 	} else {
@@ -154,18 +186,22 @@ func (a *Adaptor) DoRequest(c *gin.Context, info *relaycommon.RelayInfo, request
 }
 
 func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (usage any, err *types.NewAPIError) {
+	if a.IsConverse {
+		if info.IsStream {
+			usage, err = converseStreamHandler(c, info, resp)
+		} else {
+			usage, err = converseHandler(c, info, resp)
+		}
+		return
+	}
 	if a.ClientMode == ClientModeApiKey {
 		claudeAdaptor := claude.Adaptor{}
 		usage, err = claudeAdaptor.DoResponse(c, resp, info)
 	} else {
-		if a.IsNova {
-			err, usage = handleNovaRequest(c, info, a)
+		if info.IsStream {
+			err, usage = awsStreamHandler(c, info, a)
 		} else {
-			if info.IsStream {
-				err, usage = awsStreamHandler(c, info, a)
-			} else {
-				err, usage = awsHandler(c, info, a)
-			}
+			err, usage = awsHandler(c, info, a)
 		}
 	}
 	return
@@ -1,7 +1,5 @@
 package aws
 
-import "strings"
-
 var awsModelIDMap = map[string]string{
 	"claude-3-sonnet-20240229":   "anthropic.claude-3-sonnet-20240229-v1:0",
 	"claude-3-opus-20240229":     "anthropic.claude-3-opus-20240229-v1:0",
@@ -136,8 +134,3 @@ var awsRegionCrossModelPrefixMap = map[string]string{
 }
 
 var ChannelName = "aws"
-
-// 判断是否为Nova模型
-func isNovaModel(modelId string) bool {
-	return strings.Contains(modelId, "nova-")
-}
@@ -0,0 +1,645 @@
+package aws
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/relay/channel/openai"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/protocol/eventstream"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+// Bedrock Converse API 请求体，字段与 REST JSON 协议一致
+
+type ConverseRequest struct {
+	Messages                     []ConverseMessage        `json:"messages"`
+	System                       []ConverseContentBlock   `json:"system,omitempty"`
+	InferenceConfig              *ConverseInferenceConfig `json:"inferenceConfig,omitempty"`
+	ToolConfig                   *ConverseToolConfig      `json:"toolConfig,omitempty"`
+	GuardrailConfig              *ConverseGuardrailConfig `json:"guardrailConfig,omitempty"`
+	AdditionalModelRequestFields map[string]any           `json:"additionalModelRequestFields,omitempty"`
+}
+
+type ConverseMessage struct {
+	Role    string                 `json:"role"`
+	Content []ConverseContentBlock `json:"content"`
+}
+
+type ConverseContentBlock struct {
+	Text             *string                   `json:"text,omitempty"`
+	Image            *ConverseImageBlock       `json:"image,omitempty"`
+	Document         *ConverseDocumentBlock    `json:"document,omitempty"`
+	ToolUse          *ConverseToolUseBlock     `json:"toolUse,omitempty"`
+	ToolResult       *ConverseToolResultBlock  `json:"toolResult,omitempty"`
+	ReasoningContent *ConverseReasoningContent `json:"reasoningContent,omitempty"`
+}
+
+type ConverseBytesSource struct {
+	Bytes string `json:"bytes"`
+}
+
+type ConverseImageBlock struct {
+	Format string              `json:"format"`
+	Source ConverseBytesSource `json:"source"`
+}
+
+type ConverseDocumentBlock struct {
+	Format string              `json:"format"`
+	Name   string              `json:"name"`
+	Source ConverseBytesSource `json:"source"`
+}
+
+type ConverseToolUseBlock struct {
+	ToolUseId string `json:"toolUseId"`
+	Name      string `json:"name"`
+	Input     any    `json:"input"`
+}
+
+type ConverseToolResultBlock struct {
+	ToolUseId string                 `json:"toolUseId"`
+	Content   []ConverseContentBlock `json:"content"`
+	Status    string                 `json:"status,omitempty"`
+}
+
+type ConverseReasoningContent struct {
+	ReasoningText *struct {
+		Text      string `json:"text"`
+		Signature string `json:"signature,omitempty"`
+	} `json:"reasoningText,omitempty"`
+}
+
+type ConverseInferenceConfig struct {
+	MaxTokens     uint     `json:"maxTokens,omitempty"`
+	Temperature   *float64 `json:"temperature,omitempty"`
+	TopP          float64  `json:"topP,omitempty"`
+	StopSequences []string `json:"stopSequences,omitempty"`
+}
+
+type ConverseToolConfig struct {
+	Tools      []ConverseTool `json:"tools"`
+	ToolChoice map[string]any `json:"toolChoice,omitempty"`
+}
+
+type ConverseTool struct {
+	ToolSpec ConverseToolSpec `json:"toolSpec"`
+}
+
+type ConverseToolSpec struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	InputSchema map[string]any `json:"inputSchema"`
+}
+
+type ConverseGuardrailConfig struct {
+	GuardrailIdentifier  string `json:"guardrailIdentifier"`
+	GuardrailVersion     string `json:"guardrailVersion"`
+	Trace                string `json:"trace,omitempty"`
+	StreamProcessingMode string `json:"streamProcessingMode,omitempty"`
+}
+
+type ConverseResponse struct {
+	Output struct {
+		Message ConverseMessage `json:"message"`
+	} `json:"output"`
+	StopReason string         `json:"stopReason"`
+	Usage      *ConverseUsage `json:"usage"`
+}
+
+type ConverseUsage struct {
+	InputTokens           int `json:"inputTokens"`
+	OutputTokens          int `json:"outputTokens"`
+	TotalTokens           int `json:"totalTokens"`
+	CacheReadInputTokens  int `json:"cacheReadInputTokens"`
+	CacheWriteInputTokens int `json:"cacheWriteInputTokens"`
+}
+
+// ConverseStreamEvent ConverseStream 的事件负载，事件类型来自 eventstream 的 :event-type 头
+type ConverseStreamEvent struct {
+	ContentBlockIndex int    `json:"contentBlockIndex"`
+	StopReason        string `json:"stopReason"`
+	Start             *struct {
+		ToolUse *struct {
+			ToolUseId string `json:"toolUseId"`
+			Name      string `json:"name"`
+		} `json:"toolUse"`
+	} `json:"start"`
+	Delta *struct {
+		Text    *string `json:"text"`
+		ToolUse *struct {
+			Input string `json:"input"`
+		} `json:"toolUse"`
+		ReasoningContent *struct {
+			Text string `json:"text"`
+		} `json:"reasoningContent"`
+	} `json:"delta"`
+	Usage   *ConverseUsage `json:"usage"`
+	Message string         `json:"message"`
+}
+
+var converseDocumentFormats = map[string]string{
+	"application/pdf":    "pdf",
+	"text/csv":           "csv",
+	"application/msword": "doc",
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document": "docx",
+	"application/vnd.ms-excel": "xls",
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet": "xlsx",
+	"text/html":     "html",
+	"text/plain":    "txt",
+	"text/markdown": "md",
+}
+
+var converseDocumentNameInvalidChars = regexp.MustCompile(`[^a-zA-Z0-9\s\-()\[\]]+`)
+
+// isClaudeModel Claude 模型继续使用 InvokeModel 的 Anthropic 原生协议，其余模型走 Converse
+func isClaudeModel(modelId string) bool {
+	return strings.Contains(modelId, "anthropic.") || strings.HasPrefix(modelId, "claude")
+}
+
+// getAwsRegion 从渠道密钥中解析区域，AK/SK 为 ak|sk|region，API Key 为 key|region
+func getAwsRegion(apiKey string) (string, error) {
+	parts := strings.Split(apiKey, "|")
+	switch len(parts) {
+	case 2:
+		return parts[1], nil
+	case 3:
+		return parts[2], nil
+	}
+	return "", errors.New("invalid aws secret key")
+}
+
+func getConverseModelId(info *relaycommon.RelayInfo, region string) string {
+	awsModelId := getAwsModelID(info.UpstreamModelName)
+	regionPrefix := getAwsRegionPrefix(region)
+	if awsModelCanCrossRegion(awsModelId, regionPrefix) {
+		awsModelId = awsModelCrossRegion(awsModelId, regionPrefix)
+	}
+	return awsModelId
+}
+
+func getConverseRequestURL(info *relaycommon.RelayInfo) (string, error) {
+	region, err := getAwsRegion(info.ApiKey)
+	if err != nil {
+		return "", err
+	}
+	action := "converse"
+	if info.IsStream {
+		action = "converse-stream"
+	}
+	return fmt.Sprintf("https://bedrock-runtime.%s.amazonaws.com/model/%s/%s", region, url.PathEscape(getConverseModelId(info, region)), action), nil
+}
+
+// signConverseRequest 为 Converse 请求设置鉴权头，API Key 使用 Bearer，AK/SK 使用 SigV4 签名
+func signConverseRequest(info *relaycommon.RelayInfo, header *http.Header, requestURL string, body []byte) error {
+	header.Set("Content-Type", "application/json")
+	parts := strings.Split(info.ApiKey, "|")
+	if len(parts) == 2 {
+		header.Set("Authorization", "Bearer "+parts[0])
+		return nil
+	}
+	if len(parts) != 3 {
+		return errors.New("invalid aws secret key")
+	}
+	req, err := http.NewRequest(http.MethodPost, requestURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header = *header
+	payloadHash := sha256.Sum256(body)
+	credentials := aws.Credentials{AccessKeyID: parts[0], SecretAccessKey: parts[1]}
+	return v4.NewSigner().SignHTTP(context.Background(), credentials, req, hex.EncodeToString(payloadHash[:]), "bedrock", parts[2], time.Now())
+}
+
+func convertOpenAI2Converse(c *gin.Context, info *relaycommon.RelayInfo, request *dto.GeneralOpenAIRequest) (*ConverseRequest, error) {
+	converseReq := &ConverseRequest{}
+	for _, message := range request.Messages {
+		switch message.Role {
+		case "system", "developer":
+			if text := message.StringContent(); text != "" {
+				converseReq.System = append(converseReq.System, ConverseContentBlock{Text: common.GetPointer(text)})
+			}
+		case "tool":
+			content := message.StringContent()
+			if content == "" {
+				content = "(empty)"
+			}
+			converseReq.appendMessage("user", ConverseContentBlock{ToolResult: &ConverseToolResultBlock{
+				ToolUseId: message.ToolCallId,
+				Content:   []ConverseContentBlock{{Text: common.GetPointer(content)}},
+			}})
+		default:
+			role := "user"
+			if message.Role == "assistant" {
+				role = "assistant"
+			}
+			blocks, err := convertConverseContent(c, message)
+			if err != nil {
+				return nil, err
+			}
+			if role == "assistant" {
+				for _, toolCall := range message.ParseToolCalls() {
+					var input any = map[string]any{}
+					if toolCall.Function.Arguments != "" {
+						if err := common.UnmarshalJsonStr(toolCall.Function.Arguments, &input); err != nil {
+							input = map[string]any{}
+						}
+					}
+					blocks = append(blocks, ConverseContentBlock{ToolUse: &ConverseToolUseBlock{
+						ToolUseId: toolCall.ID,
+						Name:      toolCall.Function.Name,
+						Input:     input,
+					}})
+				}
+			}
+			converseReq.appendMessage(role, blocks...)
+		}
+	}
+
+	maxTokens := request.GetMaxTokens()
+	stopSequences := parseStopSequences(request.Stop)
+	if maxTokens != 0 || request.Temperature != nil || request.TopP != 0 || len(stopSequences) > 0 {
+		converseReq.InferenceConfig = &ConverseInferenceConfig{
+			MaxTokens:     maxTokens,
+			Temperature:   request.Temperature,
+			TopP:          request.TopP,
+			StopSequences: stopSequences,
+		}
+	}
+
+	if len(request.Tools) > 0 {
+		toolConfig := &ConverseToolConfig{}
+		for _, tool := range request.Tools {
+			if tool.Type != "" && tool.Type != "function" {
+				continue
+			}
+			schema := tool.Function.Parameters
+			if schema == nil {
+				schema = map[string]any{"type": "object", "properties": map[string]any{}}
+			}
+			toolConfig.Tools = append(toolConfig.Tools, ConverseTool{ToolSpec: ConverseToolSpec{
+				Name:        tool.Function.Name,
+				Description: tool.Function.Description,
+				InputSchema: map[string]any{"json": schema},
+			}})
+		}
+		toolConfig.ToolChoice = convertConverseToolChoice(request.ToolChoice)
+		if len(toolConfig.Tools) > 0 {
+			converseReq.ToolConfig = toolConfig
+		}
+	}
+
+	if guardrail := info.ChannelOtherSettings.AwsGuardrail; guardrail != nil && guardrail.Identifier != "" {
+		converseReq.GuardrailConfig = &ConverseGuardrailConfig{
+			GuardrailIdentifier: guardrail.Identifier,
+			GuardrailVersion:    common.GetStringIfEmpty(guardrail.Version, "DRAFT"),
+			Trace:               guardrail.Trace,
+		}
+		if info.IsStream {
+			converseReq.GuardrailConfig.StreamProcessingMode = guardrail.StreamProcessingMode
+		}
+	}
+
+	if request.TopK != 0 {
+		converseReq.AdditionalModelRequestFields = map[string]any{"top_k": request.TopK}
+	}
+	return converseReq, nil
+}
+
+// appendMessage Converse 要求 user/assistant 交替出现，相同角色的连续消息合并为一条
+func (r *ConverseRequest) appendMessage(role string, blocks ...ConverseContentBlock) {
+	if len(blocks) == 0 {
+		return
+	}
+	if n := len(r.Messages); n > 0 && r.Messages[n-1].Role == role {
+		r.Messages[n-1].Content = append(r.Messages[n-1].Content, blocks...)
+		return
+	}
+	r.Messages = append(r.Messages, ConverseMessage{Role: role, Content: blocks})
+}
+
+func convertConverseContent(c *gin.Context, message dto.Message) ([]ConverseContentBlock, error) {
+	if message.IsStringContent() {
+		if text := message.StringContent(); text != "" {
+			return []ConverseContentBlock{{Text: common.GetPointer(text)}}, nil
+		}
+		return nil, nil
+	}
+	var blocks []ConverseContentBlock
+	for i, content := range message.ParseContent() {
+		switch content.Type {
+		case dto.ContentTypeText:
+			if content.Text != "" {
+				blocks = append(blocks, ConverseContentBlock{Text: common.GetPointer(content.Text)})
+			}
+		case dto.ContentTypeImageURL:
+			imageUrl := content.GetImageMedia()
+			if imageUrl == nil {
+				continue
+			}
+			var source *types.FileSource
+			if strings.HasPrefix(imageUrl.Url, "http") {
+				source = types.NewURLFileSource(imageUrl.Url)
+			} else {
+				source = types.NewBase64FileSource(imageUrl.Url, "")
+			}
+			base64Data, mimeType, err := service.GetBase64Data(c, source, "formatting image for Bedrock Converse")
+			if err != nil {
+				return nil, fmt.Errorf("get file data failed: %s", err.Error())
+			}
+			format := strings.TrimPrefix(mimeType, "image/")
+			if format == "jpg" {
+				format = "jpeg"
+			}
+			blocks = append(blocks, ConverseContentBlock{Image: &ConverseImageBlock{Format: format, Source: ConverseBytesSource{Bytes: base64Data}}})
+		case dto.ContentTypeFile:
+			file := content.GetFile()
+			if file == nil || file.FileData == "" {
+				return nil, errors.New("bedrock converse only supports inline file_data documents")
+			}
+			base64Data, mimeType, err := service.GetBase64Data(c, types.NewBase64FileSource(file.FileData, ""), "formatting document for Bedrock Converse")
+			if err != nil {
+				return nil, fmt.Errorf("get file data failed: %s", err.Error())
+			}
+			format, ok := converseDocumentFormats[strings.Split(mimeType, ";")[0]]
+			if !ok {
+				return nil, fmt.Errorf("unsupported document type for bedrock converse: %s", mimeType)
+			}
+			blocks = append(blocks, ConverseContentBlock{Document: &ConverseDocumentBlock{
+				Format: format,
+				Name:   converseDocumentName(file.FileName, i),
+				Source: ConverseBytesSource{Bytes: base64Data},
+			}})
+		default:
+			return nil, fmt.Errorf("unsupported content type for bedrock converse: %s", content.Type)
+		}
+	}
+	return blocks, nil
+}
+
+// converseDocumentName 文档名只允许字母数字、空白、连字符、括号和方括号
+func converseDocumentName(fileName string, index int) string {
+	name := converseDocumentNameInvalidChars.ReplaceAllString(fileName, "-")
+	name = strings.Join(strings.Fields(name), " ")
+	if name == "" {
+		name = fmt.Sprintf("document-%d", index+1)
+	}
+	return name
+}
+
+func convertConverseToolChoice(toolChoice any) map[string]any {
+	switch v := toolChoice.(type) {
+	case string:
+		switch v {
+		case "required":
+			return map[string]any{"any": map[string]any{}}
+		case "auto":
+			return map[string]any{"auto": map[string]any{}}
+		}
+	case map[string]any:
+		if function, ok := v["function"].(map[string]any); ok {
+			if name, ok := function["name"].(string); ok && name != "" {
+				return map[string]any{"tool": map[string]any{"name": name}}
+			}
+		}
+	}
+	// Converse 不支持 none，保留工具定义以便历史消息中的 toolUse 仍然合法
+	return nil
+}
+
+func converseStopReason2OpenAI(stopReason string) string {
+	switch stopReason {
+	case "tool_use":
+		return constant.FinishReasonToolCalls
+	case "max_tokens", "model_context_window_exceeded":
+		return constant.FinishReasonLength
+	case "guardrail_intervened", "content_filtered":
+		return constant.FinishReasonContentFilter
+	default:
+		return constant.FinishReasonStop
+	}
+}
+
+func converseUsage2OpenAI(usage *ConverseUsage) *dto.Usage {
+	if usage == nil {
+		return &dto.Usage{}
+	}
+	openAIUsage := &dto.Usage{
+		PromptTokens:     usage.InputTokens + usage.CacheReadInputTokens + usage.CacheWriteInputTokens,
+		CompletionTokens: usage.OutputTokens,
+	}
+	openAIUsage.TotalTokens = openAIUsage.PromptTokens + openAIUsage.CompletionTokens
+	openAIUsage.PromptTokensDetails.CachedTokens = usage.CacheReadInputTokens
+	openAIUsage.PromptTokensDetails.CachedCreationTokens = usage.CacheWriteInputTokens
+	return openAIUsage
+}
+
+func converseHandler(c *gin.Context, info *relaycommon.RelayInfo, resp *http.Response) (*dto.Usage, *types.NewAPIError) {
+	defer service.CloseResponseBodyGracefully(resp)
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, types.NewOpenAIError(err, types.ErrorCodeBadResponseBody, http.StatusInternalServerError)
+	}
+	var converseResp ConverseResponse
+	if err := common.Unmarshal(responseBody, &converseResp); err != nil {
+		return nil, types.NewOpenAIError(err, types.ErrorCodeBadResponseBody, http.StatusInternalServerError)
+	}
+
+	message := dto.Message{Role: "assistant"}
+	var text strings.Builder
+	var reasoning strings.Builder
+	var toolCalls []dto.ToolCallResponse
+	for _, block := range converseResp.Output.Message.Content {
+		switch {
+		case block.Text != nil:
+			text.WriteString(*block.Text)
+		case block.ReasoningContent != nil && block.ReasoningContent.ReasoningText != nil:
+			reasoning.WriteString(block.ReasoningContent.ReasoningText.Text)
+		case block.ToolUse != nil:
+			arguments, err := common.Marshal(block.ToolUse.Input)
+			if err != nil {
+				return nil, types.NewError(err, types.ErrorCodeBadResponseBody)
+			}
+			toolCalls = append(toolCalls, dto.ToolCallResponse{
+				ID:   block.ToolUse.ToolUseId,
+				Type: "function",
+				Function: dto.FunctionResponse{
+					Name:      block.ToolUse.Name,
+					Arguments: string(arguments),
+				},
+			})
+		}
+	}
+	message.SetStringContent(text.String())
+	message.ReasoningContent = reasoning.String()
+	if len(toolCalls) > 0 {
+		message.SetToolCalls(toolCalls)
+	}
+
+	usage := converseUsage2OpenAI(converseResp.Usage)
+	if usage.PromptTokens == 0 {
+		usage.PromptTokens = info.GetEstimatePromptTokens()
+		usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	}
+	fullTextResponse := dto.OpenAITextResponse{
+		Id:      helper.GetResponseID(c),
+		Object:  "chat.completion",
+		Created: common.GetTimestamp(),
+		Model:   info.UpstreamModelName,
+		Choices: []dto.OpenAITextResponseChoice{{
+			Index:        0,
+			Message:      message,
+			FinishReason: converseStopReason2OpenAI(converseResp.StopReason),
+		}},
+		Usage: *usage,
+	}
+
+	switch info.RelayFormat {
+	case types.RelayFormatClaude:
+		responseBody, err = common.Marshal(service.ResponseOpenAI2Claude(&fullTextResponse, info))
+	default:
+		responseBody, err = common.Marshal(fullTextResponse)
+	}
+	if err != nil {
+		return nil, types.NewError(err, types.ErrorCodeBadResponseBody)
+	}
+	resp.Header.Set("Content-Type", "application/json")
+	service.IOCopyBytesGracefully(c, resp, responseBody)
+	return usage, nil
+}
+
+func converseStreamHandler(c *gin.Context, info *relaycommon.RelayInfo, resp *http.Response) (*dto.Usage, *types.NewAPIError) {
+	defer service.CloseResponseBodyGracefully(resp)
+
+	id := helper.GetResponseID(c)
+	createAt := common.GetTimestamp()
+	model := info.UpstreamModelName
+	usage := &dto.Usage{}
+	toolIndexes := make(map[int]int)
+	decoder := eventstream.NewDecoder()
+	payloadBuf := make([]byte, 0, 10*1024)
+
+	newChunk := func() *dto.ChatCompletionsStreamResponse {
+		return &dto.ChatCompletionsStreamResponse{
+			Id:      id,
+			Object:  "chat.completion.chunk",
+			Created: createAt,
+			Model:   model,
+			Choices: []dto.ChatCompletionsStreamResponseChoice{{Index: 0}},
+		}
+	}
+
+	for {
+		msg, err := decoder.Decode(resp.Body, payloadBuf)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, types.NewOpenAIError(errors.Wrap(err, "decode converse stream"), types.ErrorCodeBadResponseBody, http.StatusInternalServerError)
+		}
+		info.SetFirstResponseTime()
+
+		var event ConverseStreamEvent
+		if len(msg.Payload) > 0 {
+			if err := common.Unmarshal(msg.Payload, &event); err != nil {
+				return nil, types.NewOpenAIError(err, types.ErrorCodeBadResponseBody, http.StatusInternalServerError)
+			}
+		}
+		if messageType := msg.Headers.Get(":message-type"); messageType != nil && messageType.String() == "exception" {
+			exceptionType := ""
+			if v := msg.Headers.Get(":exception-type"); v != nil {
+				exceptionType = v.String()
+			}
+			return nil, types.NewOpenAIError(fmt.Errorf("%s: %s", exceptionType, event.Message), types.ErrorCodeAwsInvokeError, http.StatusInternalServerError)
+		}
+
+		eventType := ""
+		if v := msg.Headers.Get(":event-type"); v != nil {
+			eventType = v.String()
+		}
+		chunk := newChunk()
+		delta := &chunk.Choices[0].Delta
+		switch eventType {
+		case "messageStart":
+			delta.Role = "assistant"
+			delta.SetContentString("")
+		case "contentBlockStart":
+			if event.Start == nil || event.Start.ToolUse == nil {
+				continue
+			}
+			index := len(toolIndexes)
+			toolIndexes[event.ContentBlockIndex] = index
+			toolCall := dto.ToolCallResponse{
+				ID:       event.Start.ToolUse.ToolUseId,
+				Type:     "function",
+				Function: dto.FunctionResponse{Name: event.Start.ToolUse.Name},
+			}
+			toolCall.SetIndex(index)
+			delta.ToolCalls = []dto.ToolCallResponse{toolCall}
+		case "contentBlockDelta":
+			if event.Delta == nil {
+				continue
+			}
+			switch {
+			case event.Delta.Text != nil:
+				delta.SetContentString(*event.Delta.Text)
+			case event.Delta.ReasoningContent != nil:
+				delta.SetReasoningContent(event.Delta.ReasoningContent.Text)
+			case event.Delta.ToolUse != nil:
+				toolCall := dto.ToolCallResponse{Type: "function", Function: dto.FunctionResponse{Arguments: event.Delta.ToolUse.Input}}
+				toolCall.SetIndex(toolIndexes[event.ContentBlockIndex])
+				delta.ToolCalls = []dto.ToolCallResponse{toolCall}
+			default:
+				continue
+			}
+		case "messageStop":
+			chunk = helper.GenerateStopResponse(id, createAt, model, converseStopReason2OpenAI(event.StopReason))
+		case "metadata":
+			usage = converseUsage2OpenAI(event.Usage)
+			continue
+		default:
+			continue
+		}
+		if err := handleConverseStream(c, info, chunk); err != nil {
+			logger.LogError(c, err.Error())
+		}
+	}
+
+	if usage.PromptTokens == 0 {
+		usage.PromptTokens = info.GetEstimatePromptTokens()
+		usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	}
+	finalResponse := helper.GenerateFinalUsageResponse(id, createAt, model, *usage)
+	finalData, err := common.Marshal(finalResponse)
+	if err != nil {
+		return usage, nil
+	}
+	openai.HandleFinalResponse(c, info, string(finalData), id, createAt, model, "", usage, false)
+	return usage, nil
+}
+
+func handleConverseStream(c *gin.Context, info *relaycommon.RelayInfo, resp *dto.ChatCompletionsStreamResponse) error {
+	streamData, err := common.Marshal(resp)
+	if err != nil {
+		return fmt.Errorf("failed to marshal stream response: %w", err)
+	}
+	return openai.HandleStreamFormat(c, info, string(streamData), info.ChannelSetting.ForceFormat, info.ChannelSetting.ThinkingToContent)
+}
@@ -0,0 +1,264 @@
+package aws
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/aws/aws-sdk-go-v2/aws/protocol/eventstream"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func newConverseTestContext() (*gin.Context, *httptest.ResponseRecorder) {
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	return c, recorder
+}
+
+func newConverseTestInfo(stream bool) *relaycommon.RelayInfo {
+	return &relaycommon.RelayInfo{
+		IsStream:           stream,
+		RelayFormat:        types.RelayFormatOpenAI,
+		ShouldIncludeUsage: true,
+		ChannelMeta:        &relaycommon.ChannelMeta{UpstreamModelName: "amazon.nova-pro-v1:0"},
+	}
+}
+
+func TestConvertOpenAI2Converse(t *testing.T) {
+	cases := []struct {
+		name    string
+		request string
+		check   func(t *testing.T, req *ConverseRequest)
+	}{
+		{
+			name: "system and consecutive user messages",
+			request: `{"model":"nova","max_tokens":256,"temperature":0.5,"stop":"END","top_k":40,"messages":[
+				{"role":"system","content":"be brief"},
+				{"role":"developer","content":"answer in english"},
+				{"role":"user","content":"hi"},
+				{"role":"user","content":[{"type":"text","text":"there"}]}]}`,
+			check: func(t *testing.T, req *ConverseRequest) {
+				require.Len(t, req.System, 2)
+				require.Equal(t, "be brief", *req.System[0].Text)
+				require.Len(t, req.Messages, 1)
+				require.Equal(t, "user", req.Messages[0].Role)
+				require.Len(t, req.Messages[0].Content, 2)
+				require.Equal(t, uint(256), req.InferenceConfig.MaxTokens)
+				require.Equal(t, 0.5, *req.InferenceConfig.Temperature)
+				require.Equal(t, []string{"END"}, req.InferenceConfig.StopSequences)
+				require.Equal(t, map[string]any{"top_k": 40}, req.AdditionalModelRequestFields)
+				require.Nil(t, req.ToolConfig)
+			},
+		},
+		{
+			name: "tool calls and results",
+			request: `{"model":"nova","tool_choice":"required","messages":[
+				{"role":"user","content":"weather?"},
+				{"role":"assistant","content":"","tool_calls":[{"id":"call_1","type":"function","function":{"name":"get_weather","arguments":"{\"city\":\"Paris\"}"}}]},
+				{"role":"tool","tool_call_id":"call_1","content":""}],
+				"tools":[{"type":"function","function":{"name":"get_weather","description":"weather","parameters":{"type":"object"}}},
+					{"type":"web_search"}]}`,
+			check: func(t *testing.T, req *ConverseRequest) {
+				require.Len(t, req.Messages, 3)
+				toolUse := req.Messages[1].Content[0].ToolUse
+				require.NotNil(t, toolUse)
+				require.Equal(t, "call_1", toolUse.ToolUseId)
+				require.Equal(t, map[string]any{"city": "Paris"}, toolUse.Input)
+				toolResult := req.Messages[2].Content[0].ToolResult
+				require.Equal(t, "user", req.Messages[2].Role)
+				require.Equal(t, "call_1", toolResult.ToolUseId)
+				require.Equal(t, "(empty)", *toolResult.Content[0].Text)
+				require.Len(t, req.ToolConfig.Tools, 1)
+				require.Equal(t, "get_weather", req.ToolConfig.Tools[0].ToolSpec.Name)
+				require.Equal(t, map[string]any{"json": map[string]any{"type": "object"}}, req.ToolConfig.Tools[0].ToolSpec.InputSchema)
+				require.Equal(t, map[string]any{"any": map[string]any{}}, req.ToolConfig.ToolChoice)
+			},
+		},
+		{
+			name: "inline image",
+			request: `{"model":"nova","messages":[{"role":"user","content":[
+				{"type":"text","text":"describe"},
+				{"type":"image_url","image_url":{"url":"data:image/jpg;base64,aGVsbG8="}}]}]}`,
+			check: func(t *testing.T, req *ConverseRequest) {
+				require.Len(t, req.Messages[0].Content, 2)
+				image := req.Messages[0].Content[1].Image
+				require.NotNil(t, image)
+				require.Equal(t, "jpeg", image.Format)
+				require.Equal(t, "aGVsbG8=", image.Source.Bytes)
+				require.Nil(t, req.InferenceConfig)
+			},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var request dto.GeneralOpenAIRequest
+			require.NoError(t, common.UnmarshalJsonStr(tc.request, &request))
+			c, _ := newConverseTestContext()
+			req, err := convertOpenAI2Converse(c, newConverseTestInfo(false), &request)
+			require.NoError(t, err)
+			tc.check(t, req)
+		})
+	}
+}
+
+func TestConverseGuardrailConfig(t *testing.T) {
+	var request dto.GeneralOpenAIRequest
+	require.NoError(t, common.UnmarshalJsonStr(`{"model":"nova","messages":[{"role":"user","content":"hi"}]}`, &request))
+	info := newConverseTestInfo(true)
+	info.ChannelOtherSettings.AwsGuardrail = &dto.AwsGuardrail{Identifier: "gr-1", StreamProcessingMode: "async"}
+	c, _ := newConverseTestContext()
+	req, err := convertOpenAI2Converse(c, info, &request)
+	require.NoError(t, err)
+	require.Equal(t, "gr-1", req.GuardrailConfig.GuardrailIdentifier)
+	require.Equal(t, "DRAFT", req.GuardrailConfig.GuardrailVersion)
+	require.Equal(t, "async", req.GuardrailConfig.StreamProcessingMode)
+}
+
+func TestConverseStopReasonAndUsage(t *testing.T) {
+	cases := map[string]string{
+		"end_turn":                      constant.FinishReasonStop,
+		"stop_sequence":                 constant.FinishReasonStop,
+		"tool_use":                      constant.FinishReasonToolCalls,
+		"max_tokens":                    constant.FinishReasonLength,
+		"model_context_window_exceeded": constant.FinishReasonLength,
+		"guardrail_intervened":          constant.FinishReasonContentFilter,
+		"content_filtered":              constant.FinishReasonContentFilter,
+	}
+	for stopReason, finishReason := range cases {
+		require.Equal(t, finishReason, converseStopReason2OpenAI(stopReason), stopReason)
+	}
+
+	usage := converseUsage2OpenAI(&ConverseUsage{InputTokens: 10, OutputTokens: 5, CacheReadInputTokens: 20, CacheWriteInputTokens: 30})
+	require.Equal(t, 60, usage.PromptTokens)
+	require.Equal(t, 5, usage.CompletionTokens)
+	require.Equal(t, 65, usage.TotalTokens)
+	require.Equal(t, 20, usage.PromptTokensDetails.CachedTokens)
+	require.Equal(t, 30, usage.PromptTokensDetails.CachedCreationTokens)
+	require.Equal(t, &dto.Usage{}, converseUsage2OpenAI(nil))
+}
+
+func TestConverseHandler(t *testing.T) {
+	body := `{"output":{"message":{"role":"assistant","content":[
+		{"reasoningContent":{"reasoningText":{"text":"thinking"}}},
+		{"text":"Sunny"},
+		{"toolUse":{"toolUseId":"tool_1","name":"get_weather","input":{"city":"Paris"}}}]}},
+		"stopReason":"tool_use","usage":{"inputTokens":12,"outputTokens":7,"totalTokens":19}}`
+	c, recorder := newConverseTestContext()
+	resp := &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(body))}
+
+	usage, apiErr := converseHandler(c, newConverseTestInfo(false), resp)
+	require.Nil(t, apiErr)
+	require.Equal(t, 12, usage.PromptTokens)
+	require.Equal(t, 7, usage.CompletionTokens)
+
+	var out dto.OpenAITextResponse
+	require.NoError(t, common.Unmarshal(recorder.Body.Bytes(), &out))
+	require.Len(t, out.Choices, 1)
+	choice := out.Choices[0]
+	require.Equal(t, constant.FinishReasonToolCalls, choice.FinishReason)
+	require.Equal(t, "Sunny", choice.Message.StringContent())
+	require.Equal(t, "thinking", choice.Message.ReasoningContent)
+	toolCalls := choice.Message.ParseToolCalls()
+	require.Len(t, toolCalls, 1)
+	require.Equal(t, "tool_1", toolCalls[0].ID)
+	require.JSONEq(t, `{"city":"Paris"}`, toolCalls[0].Function.Arguments)
+}
+
+// encodeConverseEvents 按 ConverseStream 的 eventstream 格式编码事件
+func encodeConverseEvents(t *testing.T, events [][2]string) io.ReadCloser {
+	var buf bytes.Buffer
+	encoder := eventstream.NewEncoder()
+	for _, event := range events {
+		msg := eventstream.Message{
+			Headers: eventstream.Headers{
+				{Name: ":message-type", Value: eventstream.StringValue("event")},
+				{Name: ":event-type", Value: eventstream.StringValue(event[0])},
+			},
+			Payload: []byte(event[1]),
+		}
+		require.NoError(t, encoder.Encode(&buf, msg))
+	}
+	return io.NopCloser(&buf)
+}
+
+func TestConverseStreamHandler(t *testing.T) {
+	body := encodeConverseEvents(t, [][2]string{
+		{"messageStart", `{"role":"assistant"}`},
+		{"contentBlockDelta", `{"contentBlockIndex":0,"delta":{"text":"Hel"}}`},
+		{"contentBlockDelta", `{"contentBlockIndex":0,"delta":{"text":"lo"}}`},
+		{"contentBlockStart", `{"contentBlockIndex":1,"start":{"toolUse":{"toolUseId":"tool_1","name":"get_weather"}}}`},
+		{"contentBlockDelta", `{"contentBlockIndex":1,"delta":{"toolUse":{"input":"{\"city\":"}}}`},
+		{"contentBlockDelta", `{"contentBlockIndex":1,"delta":{"toolUse":{"input":"\"Paris\"}"}}}`},
+		{"contentBlockStop", `{"contentBlockIndex":1}`},
+		{"messageStop", `{"stopReason":"tool_use"}`},
+		{"metadata", `{"usage":{"inputTokens":9,"outputTokens":4,"cacheReadInputTokens":3}}`},
+	})
+	c, recorder := newConverseTestContext()
+	resp := &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: body}
+
+	usage, apiErr := converseStreamHandler(c, newConverseTestInfo(true), resp)
+	require.Nil(t, apiErr)
+	require.Equal(t, 12, usage.PromptTokens)
+	require.Equal(t, 4, usage.CompletionTokens)
+	require.Equal(t, 3, usage.PromptTokensDetails.CachedTokens)
+
+	var content, arguments strings.Builder
+	var finishReason string
+	var usageChunk *dto.Usage
+	for _, line := range strings.Split(recorder.Body.String(), "\n") {
+		data, ok := strings.CutPrefix(line, "data: ")
+		if !ok || data == "[DONE]" {
+			continue
+		}
+		var chunk dto.ChatCompletionsStreamResponse
+		require.NoError(t, common.UnmarshalJsonStr(data, &chunk))
+		if chunk.Usage != nil && chunk.Usage.TotalTokens > 0 {
+			usageChunk = chunk.Usage
+		}
+		for _, choice := range chunk.Choices {
+			content.WriteString(choice.Delta.GetContentString())
+			for _, toolCall := range choice.Delta.ToolCalls {
+				require.Equal(t, 0, *toolCall.Index)
+				arguments.WriteString(toolCall.Function.Arguments)
+			}
+			if choice.FinishReason != nil {
+				finishReason = *choice.FinishReason
+			}
+		}
+	}
+	require.Equal(t, "Hello", content.String())
+	require.JSONEq(t, `{"city":"Paris"}`, arguments.String())
+	require.Equal(t, constant.FinishReasonToolCalls, finishReason)
+	require.NotNil(t, usageChunk)
+	require.Equal(t, 16, usageChunk.TotalTokens)
+	require.True(t, strings.HasSuffix(strings.TrimSpace(recorder.Body.String()), "data: [DONE]"))
+}
+
+func TestConverseStreamHandlerException(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, eventstream.NewEncoder().Encode(&buf, eventstream.Message{
+		Headers: eventstream.Headers{
+			{Name: ":message-type", Value: eventstream.StringValue("exception")},
+			{Name: ":exception-type", Value: eventstream.StringValue("throttlingException")},
+		},
+		Payload: []byte(`{"message":"Too many requests"}`),
+	}))
+	c, _ := newConverseTestContext()
+	resp := &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: io.NopCloser(&buf)}
+
+	_, apiErr := converseStreamHandler(c, newConverseTestInfo(true), resp)
+	require.NotNil(t, apiErr)
+	require.Contains(t, apiErr.Error(), "throttlingException: Too many requests")
+}
@@ -54,70 +54,6 @@ func formatRequest(requestBody io.Reader, requestHeader http.Header) (*AwsClaude
 	return &awsClaudeRequest, nil
 }
 
-// NovaMessage Nova模型使用messages-v1格式
-type NovaMessage struct {
-	Role    string        `json:"role"`
-	Content []NovaContent `json:"content"`
-}
-
-type NovaContent struct {
-	Text string `json:"text"`
-}
-
-type NovaRequest struct {
-	SchemaVersion   string               `json:"schemaVersion"`             // 请求版本，例如 "1.0"
-	Messages        []NovaMessage        `json:"messages"`                  // 对话消息列表
-	InferenceConfig *NovaInferenceConfig `json:"inferenceConfig,omitempty"` // 推理配置，可选
-}
-
-type NovaInferenceConfig struct {
-	MaxTokens     int      `json:"maxTokens,omitempty"`     // 最大生成的 token 数
-	Temperature   float64  `json:"temperature,omitempty"`   // 随机性 (默认 0.7, 范围 0-1)
-	TopP          float64  `json:"topP,omitempty"`          // nucleus sampling (默认 0.9, 范围 0-1)
-	TopK          int      `json:"topK,omitempty"`          // 限制候选 token 数 (默认 50, 范围 0-128)
-	StopSequences []string `json:"stopSequences,omitempty"` // 停止生成的序列
-}
-
-// 转换OpenAI请求为Nova格式
-func convertToNovaRequest(req *dto.GeneralOpenAIRequest) *NovaRequest {
-	novaMessages := make([]NovaMessage, len(req.Messages))
-	for i, msg := range req.Messages {
-		novaMessages[i] = NovaMessage{
-			Role:    msg.Role,
-			Content: []NovaContent{{Text: msg.StringContent()}},
-		}
-	}
-
-	novaReq := &NovaRequest{
-		SchemaVersion: "messages-v1",
-		Messages:      novaMessages,
-	}
-
-	// 设置推理配置
-	if req.MaxTokens != 0 || (req.Temperature != nil && *req.Temperature != 0) || req.TopP != 0 || req.TopK != 0 || req.Stop != nil {
-		novaReq.InferenceConfig = &NovaInferenceConfig{}
-		if req.MaxTokens != 0 {
-			novaReq.InferenceConfig.MaxTokens = int(req.MaxTokens)
-		}
-		if req.Temperature != nil && *req.Temperature != 0 {
-			novaReq.InferenceConfig.Temperature = *req.Temperature
-		}
-		if req.TopP != 0 {
-			novaReq.InferenceConfig.TopP = req.TopP
-		}
-		if req.TopK != 0 {
-			novaReq.InferenceConfig.TopK = req.TopK
-		}
-		if req.Stop != nil {
-			if stopSequences := parseStopSequences(req.Stop); len(stopSequences) > 0 {
-				novaReq.InferenceConfig.StopSequences = stopSequences
-			}
-		}
-	}
-
-	return novaReq
-}
-
 // parseStopSequences 解析停止序列，支持字符串或字符串数组
 func parseStopSequences(stop any) []string {
 	if stop == nil {
@@ -542,10 +542,19 @@ type ClaudeResponseInfo struct {
 	Created      int64
 	Model        string
 	ResponseText strings.Builder
+	ThinkingText strings.Builder
 	Usage        *dto.Usage
 	Done         bool
 }
 
+// setClaudeReasoningTokens Claude 的 output_tokens 已包含思考内容但不单独返回其数量，按明文思考内容估算推理 tokens
+func setClaudeReasoningTokens(usage *dto.Usage, thinking string, model string) {
+	if usage == nil || thinking == "" || usage.CompletionTokenDetails.ReasoningTokens > 0 {
+		return
+	}
+	usage.CompletionTokenDetails.ReasoningTokens = min(service.CountTextToken(thinking, model), usage.CompletionTokens)
+}
+
 func buildMessageDeltaPatchUsage(claudeResponse *dto.ClaudeResponse, claudeInfo *ClaudeResponseInfo) *dto.ClaudeUsage {
 	usage := &dto.ClaudeUsage{}
 	if claudeResponse != nil && claudeResponse.Usage != nil {
@@ -647,6 +656,7 @@ func FormatClaudeResponseInfo(claudeResponse *dto.ClaudeResponse, oaiResponse *d
 			}
 			if claudeResponse.Delta.Thinking != nil {
 				claudeInfo.ResponseText.WriteString(*claudeResponse.Delta.Thinking)
+				claudeInfo.ThinkingText.WriteString(*claudeResponse.Delta.Thinking)
 			}
 		}
 	} else if claudeResponse.Type == "message_delta" {
@@ -704,6 +714,9 @@ func HandleStreamResponseData(c *gin.Context, info *relaycommon.RelayInfo, claud
 	if claudeResponse.Delta != nil && claudeResponse.Delta.StopReason != nil {
 		maybeMarkClaudeRefusal(c, *claudeResponse.Delta.StopReason)
 	}
+	if claudeResponse.Type == "message_delta" && claudeResponse.Usage != nil && claudeResponse.Usage.ServerToolUse != nil && claudeResponse.Usage.ServerToolUse.WebSearchRequests > 0 {
+		c.Set("claude_web_search_requests", claudeResponse.Usage.ServerToolUse.WebSearchRequests)
+	}
 	if info.RelayFormat == types.RelayFormatClaude {
 		FormatClaudeResponseInfo(&claudeResponse, nil, claudeInfo)
 
@@ -745,6 +758,7 @@ func HandleStreamFinalResponse(c *gin.Context, info *relaycommon.RelayInfo, clau
 		}
 		claudeInfo.Usage = service.ResponseText2Usage(c, claudeInfo.ResponseText.String(), info.UpstreamModelName, claudeInfo.Usage.PromptTokens)
 	}
+	setClaudeReasoningTokens(claudeInfo.Usage, claudeInfo.ThinkingText.String(), info.UpstreamModelName)
 
 	if info.RelayFormat == types.RelayFormatClaude {
 		//
@@ -806,6 +820,13 @@ func HandleClaudeResponseData(c *gin.Context, info *relaycommon.RelayInfo, claud
 		claudeInfo.Usage.ClaudeCacheCreation5mTokens = claudeResponse.Usage.GetCacheCreation5mTokens()
 		claudeInfo.Usage.ClaudeCacheCreation1hTokens = claudeResponse.Usage.GetCacheCreation1hTokens()
 	}
+	var thinking strings.Builder
+	for _, content := range claudeResponse.Content {
+		if content.Type == "thinking" && content.Thinking != nil {
+			thinking.WriteString(*content.Thinking)
+		}
+	}
+	setClaudeReasoningTokens(claudeInfo.Usage, thinking.String(), info.UpstreamModelName)
 	var responseData []byte
 	switch info.RelayFormat {
 	case types.RelayFormatOpenAI:
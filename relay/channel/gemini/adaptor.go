@@ -127,6 +127,12 @@ func (a *Adaptor) Init(info *relaycommon.RelayInfo) {
 }
 
 func (a *Adaptor) GetRequestURL(info *relaycommon.RelayInfo) (string, error) {
+	if info.RelayMode == constant.RelayModeRealtime {
+		// Gemini Live 通过 websocket 的 BidiGenerateContent 提供实时会话
+		baseUrl := strings.Replace(info.ChannelBaseUrl, "https://", "wss://", 1)
+		baseUrl = strings.Replace(baseUrl, "http://", "ws://", 1)
+		return fmt.Sprintf("%s/ws/google.ai.generativelanguage.%s.GenerativeService.BidiGenerateContent", baseUrl, model_setting.GetGeminiVersionSetting(info.UpstreamModelName)), nil
+	}
 
 	if model_setting.GetGeminiSettings().ThinkingAdapterEnabled &&
 		!model_setting.ShouldPreserveThinkingSuffix(info.OriginModelName) {
@@ -184,6 +190,7 @@ func (a *Adaptor) ConvertOpenAIRequest(c *gin.Context, info *relaycommon.RelayIn
 	if err != nil {
 		return nil, err
 	}
+	applyGeminiPromptCache(c, info, geminiRequest)
 
 	return geminiRequest, nil
 }
@@ -241,10 +248,17 @@ func (a *Adaptor) ConvertOpenAIResponsesRequest(c *gin.Context, info *relaycommo
 }
 
 func (a *Adaptor) DoRequest(c *gin.Context, info *relaycommon.RelayInfo, requestBody io.Reader) (any, error) {
+	if info.RelayMode == constant.RelayModeRealtime {
+		return channel.DoWssRequest(a, c, info, requestBody)
+	}
 	return channel.DoApiRequest(a, c, info, requestBody)
 }
 
 func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (usage any, err *types.NewAPIError) {
+	if info.RelayMode == constant.RelayModeRealtime {
+		err, usage = GeminiLiveRealtimeHandler(c, info)
+		return
+	}
 	if info.RelayMode == constant.RelayModeGemini {
 		if strings.Contains(info.RequestURLPath, ":embedContent") ||
 			strings.Contains(info.RequestURLPath, ":batchEmbedContents") {
@@ -268,12 +282,14 @@ func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, info *relaycom
 		return GeminiEmbeddingHandler(c, info, resp)
 	}
 
+	var chatUsage *dto.Usage
 	if info.IsStream {
-		return GeminiChatStreamHandler(c, info, resp)
+		chatUsage, err = GeminiChatStreamHandler(c, info, resp)
 	} else {
-		return GeminiChatHandler(c, info, resp)
+		chatUsage, err = GeminiChatHandler(c, info, resp)
 	}
-
+	applyGeminiPromptCacheUsage(info, chatUsage)
+	return chatUsage, err
 }
 
 func (a *Adaptor) GetModelList() []string {
@@ -0,0 +1,204 @@
+package gemini
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/pkg/cachex"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/model_setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/samber/hot"
+)
+
+const geminiCachedContentNamespace = "new-api:gemini_cached_content:v1"
+
+// 提前失效，避免在上游过期的边界上引用已删除的 cachedContents
+const geminiCachedContentExpireSkew = 30 * time.Second
+
+var (
+	geminiCachedContentCacheOnce sync.Once
+	geminiCachedContentCache     *cachex.HybridCache[string]
+)
+
+type geminiCachedContentRequest struct {
+	Model             string                 `json:"model"`
+	SystemInstruction *dto.GeminiChatContent `json:"systemInstruction,omitempty"`
+	Tools             json.RawMessage        `json:"tools,omitempty"`
+	ToolConfig        *dto.ToolConfig        `json:"toolConfig,omitempty"`
+	Ttl               string                 `json:"ttl"`
+}
+
+type geminiCachedContentResponse struct {
+	Name          string `json:"name"`
+	UsageMetadata struct {
+		TotalTokenCount int `json:"totalTokenCount"`
+	} `json:"usageMetadata"`
+}
+
+func getGeminiCachedContentCache() *cachex.HybridCache[string] {
+	geminiCachedContentCacheOnce.Do(func() {
+		geminiCachedContentCache = cachex.NewHybridCache[string](cachex.HybridCacheConfig[string]{
+			Namespace: cachex.Namespace(geminiCachedContentNamespace),
+			Redis:     common.RDB,
+			RedisEnabled: func() bool {
+				return common.RedisEnabled && common.RDB != nil
+			},
+			RedisCodec: cachex.JSONCodec[string]{},
+			Memory: func() *hot.HotCache[string, string] {
+				return hot.NewHotCache[string, string](hot.LRU, 10000).
+					WithJanitor().
+					Build()
+			},
+		})
+	})
+	return geminiCachedContentCache
+}
+
+// applyGeminiPromptCache 按规则把系统提示词和工具定义放入 Gemini cachedContents，
+// 并在请求中以 cachedContent 引用。创建失败时不影响原请求。
+func applyGeminiPromptCache(c *gin.Context, info *relaycommon.RelayInfo, request *dto.GeminiChatRequest) {
+	if request == nil || request.CachedContent != "" || info.ChannelType != constant.ChannelTypeGemini {
+		return
+	}
+	rule, source, ok := service.ResolvePromptCacheRule(info)
+	if !ok {
+		return
+	}
+
+	cacheRequest := geminiCachedContentRequest{
+		Model: "models/" + info.UpstreamModelName,
+	}
+	if rule.CacheSystem {
+		cacheRequest.SystemInstruction = request.SystemInstructions
+	}
+	if rule.CacheTools && len(request.Tools) > 0 {
+		cacheRequest.Tools = request.Tools
+		cacheRequest.ToolConfig = request.ToolConfig
+	}
+	if cacheRequest.SystemInstruction == nil && cacheRequest.Tools == nil {
+		return
+	}
+	// cachedContents 引用后请求中不能再携带 systemInstruction / tools / toolConfig，
+	// 因此仅缓存其中一部分时无法使用，直接跳过
+	if (request.SystemInstructions != nil && cacheRequest.SystemInstruction == nil) ||
+		(len(request.Tools) > 0 && cacheRequest.Tools == nil) {
+		return
+	}
+
+	prefixJson, err := common.Marshal(cacheRequest)
+	if err != nil {
+		return
+	}
+	if service.EstimateTokenByModel(info.OriginModelName, string(prefixJson)) < rule.MinPrefixTokens {
+		return
+	}
+
+	ttl := time.Duration(5) * time.Minute
+	if service.NormalizePromptCacheTTL(rule.TTL) == service.PromptCacheTTL1h {
+		ttl = time.Hour
+	}
+	cacheRequest.Ttl = fmt.Sprintf("%ds", int(ttl.Seconds()))
+
+	keyHash := sha256.Sum256(append([]byte(info.ApiKey+"|"+info.ChannelBaseUrl+"|"), prefixJson...))
+	cacheKey := hex.EncodeToString(keyHash[:])
+
+	writeTokens := 0
+	name, found, _ := getGeminiCachedContentCache().Get(cacheKey)
+	if !found || name == "" {
+		created, err := createGeminiCachedContent(info, &cacheRequest)
+		if err != nil {
+			logger.LogWarn(c, "create gemini cached content failed: "+err.Error())
+			return
+		}
+		name = created.Name
+		writeTokens = created.UsageMetadata.TotalTokenCount
+		if err := getGeminiCachedContentCache().SetWithTTL(cacheKey, name, ttl-geminiCachedContentExpireSkew); err != nil {
+			logger.LogWarn(c, "store gemini cached content name failed: "+err.Error())
+		}
+	}
+
+	request.CachedContent = name
+	request.SystemInstructions = nil
+	request.Tools = nil
+	request.ToolConfig = nil
+	info.PromptCache = &relaycommon.PromptCacheInfo{
+		Provider:    service.PromptCacheProviderGemini,
+		Source:      source,
+		TTL:         service.NormalizePromptCacheTTL(rule.TTL),
+		WriteTokens: writeTokens,
+	}
+}
+
+func createGeminiCachedContent(info *relaycommon.RelayInfo, cacheRequest *geminiCachedContentRequest) (*geminiCachedContentResponse, error) {
+	body, err := common.Marshal(cacheRequest)
+	if err != nil {
+		return nil, err
+	}
+	version := model_setting.GetGeminiVersionSetting(info.UpstreamModelName)
+	url := fmt.Sprintf("%s/%s/cachedContents", strings.TrimSuffix(info.ChannelBaseUrl, "/"), version)
+
+	client := service.GetHttpClient()
+	if info.ChannelSetting.Proxy != "" {
+		client, err = service.NewProxyHttpClient(info.ChannelSetting.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("new proxy http client failed: %w", err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-goog-api-key", info.ApiKey)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status code %d: %s", resp.StatusCode, string(respBody))
+	}
+	var cacheResponse geminiCachedContentResponse
+	if err := common.Unmarshal(respBody, &cacheResponse); err != nil {
+		return nil, err
+	}
+	if cacheResponse.Name == "" {
+		return nil, fmt.Errorf("empty cached content name: %s", string(respBody))
+	}
+	return &cacheResponse, nil
+}
+
+// applyGeminiPromptCacheUsage 将创建 cachedContents 时写入的 token 计入缓存写入，
+// 与 OpenAI 语义保持一致：prompt_tokens 包含缓存读取和写入部分。
+func applyGeminiPromptCacheUsage(info *relaycommon.RelayInfo, usage *dto.Usage) {
+	if usage == nil || info.PromptCache == nil || info.PromptCache.WriteTokens <= 0 {
+		return
+	}
+	usage.PromptTokens += info.PromptCache.WriteTokens
+	usage.TotalTokens += info.PromptCache.WriteTokens
+	usage.PromptTokensDetails.CachedCreationTokens += info.PromptCache.WriteTokens
+}
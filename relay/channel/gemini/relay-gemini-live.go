@@ -0,0 +1,748 @@
+package gemini
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/relay/channel/openai"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/tidwall/gjson"
+)
+
+const geminiLiveSetupTimeout = 15 * time.Second
+
+// OpenAI realtime 的预置音色，Gemini 不支持时使用上游默认音色
+var openAIRealtimeVoices = map[string]bool{
+	"alloy": true, "ash": true, "ballad": true, "coral": true, "echo": true,
+	"sage": true, "shimmer": true, "verse": true, "marin": true, "cedar": true,
+}
+
+// geminiLiveBridge 在 OpenAI realtime 协议与 Gemini Live (BidiGenerateContent) 之间双向转换事件
+type geminiLiveBridge struct {
+	c          *gin.Context
+	info       *relaycommon.RelayInfo
+	clientConn *websocket.Conn
+	targetConn *websocket.Conn
+
+	// mu 保护以下状态以及对客户端连接的写入，两个读协程都会访问
+	mu             sync.Mutex
+	sessionId      string
+	session        dto.RealtimeSession
+	manualActivity bool
+	setupSent      bool
+	setupDone      chan struct{}
+	notifySetup    bool
+	activityActive bool
+	autoResponding bool
+	pendingTurns   []dto.GeminiChatContent
+	callNames      map[string]string
+
+	// 当前回复
+	responseId      string
+	itemId          string
+	outputIndex     int
+	contentIndex    int
+	contentStarted  bool
+	contentType     string
+	outputText      strings.Builder
+	inputTranscript strings.Builder
+	outputItems     []map[string]any
+
+	localUsage *dto.RealtimeUsage
+	sumUsage   *dto.RealtimeUsage
+}
+
+func GeminiLiveRealtimeHandler(c *gin.Context, info *relaycommon.RelayInfo) (*types.NewAPIError, *dto.RealtimeUsage) {
+	if info == nil || info.ClientWs == nil || info.TargetWs == nil {
+		return types.NewError(fmt.Errorf("invalid websocket connection"), types.ErrorCodeBadResponse), nil
+	}
+	info.IsStream = true
+
+	b := &geminiLiveBridge{
+		c:          c,
+		info:       info,
+		clientConn: info.ClientWs,
+		targetConn: info.TargetWs,
+		sessionId:  "sess_" + common.GetRandomString(24),
+		session: dto.RealtimeSession{
+			Modalities:        []string{"text", "audio"},
+			InputAudioFormat:  "pcm16",
+			OutputAudioFormat: "pcm16",
+			TurnDetection:     map[string]any{"type": "server_vad"},
+		},
+		setupDone:  make(chan struct{}),
+		callNames:  make(map[string]string),
+		localUsage: &dto.RealtimeUsage{},
+		sumUsage:   &dto.RealtimeUsage{},
+	}
+
+	clientClosed := make(chan struct{})
+	targetClosed := make(chan struct{})
+	errChan := make(chan error, 2)
+
+	b.mu.Lock()
+	err := b.sendClient("session.created", map[string]any{"session": b.sessionObject()})
+	b.mu.Unlock()
+	if err != nil {
+		return types.NewError(err, types.ErrorCodeBadResponse), nil
+	}
+
+	gopool.Go(func() {
+		defer func() {
+			if r := recover(); r != nil {
+				errChan <- fmt.Errorf("panic in client reader: %v", r)
+			}
+		}()
+		for {
+			select {
+			case <-c.Done():
+				return
+			default:
+			}
+			_, message, err := b.clientConn.ReadMessage()
+			if err != nil {
+				if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+					errChan <- fmt.Errorf("error reading from client: %v", err)
+				}
+				close(clientClosed)
+				return
+			}
+			if err := b.handleClientMessage(message, targetClosed); err != nil {
+				errChan <- err
+				return
+			}
+		}
+	})
+
+	gopool.Go(func() {
+		defer func() {
+			if r := recover(); r != nil {
+				errChan <- fmt.Errorf("panic in target reader: %v", r)
+			}
+		}()
+		for {
+			select {
+			case <-c.Done():
+				return
+			default:
+			}
+			_, message, err := b.targetConn.ReadMessage()
+			if err != nil {
+				if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+					errChan <- fmt.Errorf("error reading from target: %v", err)
+				}
+				close(targetClosed)
+				return
+			}
+			info.SetFirstResponseTime()
+			if err := b.handleServerMessage(message); err != nil {
+				errChan <- err
+				return
+			}
+		}
+	})
+
+	select {
+	case <-clientClosed:
+	case <-targetClosed:
+	case err := <-errChan:
+		logger.LogError(c, "gemini live error: "+err.Error())
+	case <-c.Done():
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.localUsage.TotalTokens != 0 {
+		_ = openai.PreConsumeRealtimeUsage(c, info, b.localUsage, b.sumUsage)
+		b.localUsage = &dto.RealtimeUsage{}
+	}
+	return nil, b.sumUsage
+}
+
+func (b *geminiLiveBridge) handleClientMessage(message []byte, targetClosed chan struct{}) error {
+	event := &dto.RealtimeEvent{}
+	if err := common.Unmarshal(message, event); err != nil {
+		return fmt.Errorf("error unmarshalling message: %v", err)
+	}
+
+	// Gemini 要求首条消息为 setup，且 setup 之后无法再修改会话配置
+	b.mu.Lock()
+	needSetup := !b.setupSent
+	if needSetup {
+		if event.Type == dto.RealtimeEventTypeSessionUpdate && event.Session != nil {
+			b.applySessionUpdate(event.Session, message)
+			b.notifySetup = true
+		}
+		if err := b.sendSetup(); err != nil {
+			b.mu.Unlock()
+			return err
+		}
+	}
+	b.mu.Unlock()
+	if needSetup {
+		select {
+		case <-b.setupDone:
+		case <-targetClosed:
+			return nil
+		case <-b.c.Done():
+			return nil
+		case <-time.After(geminiLiveSetupTimeout):
+			return fmt.Errorf("timeout waiting for gemini live setup")
+		}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	textToken, audioToken, err := service.CountTokenRealtime(b.info, *event, b.info.UpstreamModelName)
+	if err != nil {
+		return fmt.Errorf("error counting text token: %v", err)
+	}
+	b.localUsage.TotalTokens += textToken + audioToken
+	b.localUsage.InputTokens += textToken + audioToken
+	b.localUsage.InputTokenDetails.TextTokens += textToken
+	b.localUsage.InputTokenDetails.AudioTokens += audioToken
+
+	switch event.Type {
+	case dto.RealtimeEventTypeSessionUpdate:
+		if needSetup {
+			return nil
+		}
+		helper.WssError(b.c, b.clientConn, types.OpenAIError{
+			Message: "gemini live does not support updating the session after it has started",
+			Type:    "invalid_request_error",
+			Code:    "session_update_unsupported",
+		})
+		return nil
+	case dto.RealtimeEventInputAudioBufferAppend:
+		if b.manualActivity && !b.activityActive {
+			b.activityActive = true
+			if err := b.sendTarget(&dto.GeminiLiveClientMessage{RealtimeInput: &dto.GeminiLiveRealtimeInput{ActivityStart: &struct{}{}}}); err != nil {
+				return err
+			}
+		}
+		return b.sendTarget(&dto.GeminiLiveClientMessage{RealtimeInput: &dto.GeminiLiveRealtimeInput{
+			Audio: &dto.GeminiInlineData{MimeType: "audio/pcm;rate=24000", Data: event.Audio},
+		}})
+	case "input_audio_buffer.commit":
+		input := &dto.GeminiLiveRealtimeInput{AudioStreamEnd: true}
+		if b.manualActivity {
+			if !b.activityActive {
+				return nil
+			}
+			b.activityActive = false
+			b.autoResponding = true
+			input = &dto.GeminiLiveRealtimeInput{ActivityEnd: &struct{}{}}
+		}
+		if err := b.sendTarget(&dto.GeminiLiveClientMessage{RealtimeInput: input}); err != nil {
+			return err
+		}
+		return b.sendClient("input_audio_buffer.committed", map[string]any{"item_id": "item_" + common.GetRandomString(24)})
+	case "input_audio_buffer.clear":
+		return b.sendClient("input_audio_buffer.cleared", nil)
+	case dto.RealtimeEventTypeConversationCreate:
+		return b.handleConversationItem(event.Item)
+	case dto.RealtimeEventTypeResponseCreate:
+		if len(b.pendingTurns) == 0 && b.autoResponding {
+			// 上游在语音结束或收到工具结果后会自动回复
+			return nil
+		}
+		turns := b.pendingTurns
+		b.pendingTurns = nil
+		return b.sendTarget(&dto.GeminiLiveClientMessage{ClientContent: &dto.GeminiLiveClientContent{Turns: turns, TurnComplete: true}})
+	}
+	return nil
+}
+
+func (b *geminiLiveBridge) handleConversationItem(item *dto.RealtimeItem) error {
+	if item == nil {
+		return nil
+	}
+	if item.Id == "" {
+		item.Id = "item_" + common.GetRandomString(24)
+	}
+	switch item.Type {
+	case "message":
+		role := "user"
+		if item.Role == "assistant" {
+			role = "model"
+		}
+		var parts []dto.GeminiPart
+		for _, content := range item.Content {
+			switch content.Type {
+			case "input_text", "text":
+				parts = append(parts, dto.GeminiPart{Text: content.Text})
+			case "input_audio":
+				parts = append(parts, dto.GeminiPart{InlineData: &dto.GeminiInlineData{MimeType: "audio/pcm;rate=24000", Data: content.Audio}})
+			}
+		}
+		if len(parts) > 0 {
+			b.pendingTurns = append(b.pendingTurns, dto.GeminiChatContent{Role: role, Parts: parts})
+		}
+	case "function_call_output":
+		var output any
+		if err := common.UnmarshalJsonStr(item.Output, &output); err != nil {
+			output = item.Output
+		}
+		b.autoResponding = true
+		if err := b.sendTarget(&dto.GeminiLiveClientMessage{ToolResponse: &dto.GeminiLiveToolResponse{
+			FunctionResponses: []dto.GeminiLiveFunctionResponse{{
+				Id:       item.CallId,
+				Name:     b.callNames[item.CallId],
+				Response: map[string]any{"output": output},
+			}},
+		}}); err != nil {
+			return err
+		}
+	}
+	return b.sendClient(dto.RealtimeEventConversationItemCreated, map[string]any{"item": item})
+}
+
+func (b *geminiLiveBridge) handleServerMessage(message []byte) error {
+	var msg dto.GeminiLiveServerMessage
+	if err := common.Unmarshal(message, &msg); err != nil {
+		return fmt.Errorf("error unmarshalling message: %v", err)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if msg.Error != nil {
+		helper.WssError(b.c, b.clientConn, types.OpenAIError{
+			Message: msg.Error.Message,
+			Type:    "upstream_error",
+			Code:    msg.Error.Status,
+		})
+		return nil
+	}
+	if msg.SetupComplete != nil {
+		close(b.setupDone)
+		if b.notifySetup {
+			return b.sendClient(dto.RealtimeEventTypeSessionUpdated, map[string]any{"session": b.sessionObject()})
+		}
+		return nil
+	}
+	if msg.UsageMetadata != nil {
+		// 上游返回用量后以上游为准，丢弃本地估算
+		usage := convertGeminiLiveUsage(msg.UsageMetadata)
+		if usage.TotalTokens > 0 {
+			if err := openai.PreConsumeRealtimeUsage(b.c, b.info, usage, b.sumUsage); err != nil {
+				return fmt.Errorf("error consume usage: %v", err)
+			}
+			b.localUsage = &dto.RealtimeUsage{}
+		}
+	}
+	if msg.ToolCall != nil {
+		if err := b.handleToolCall(msg.ToolCall); err != nil {
+			return err
+		}
+	}
+	if msg.ServerContent != nil {
+		return b.handleServerContent(msg.ServerContent)
+	}
+	if msg.GoAway != nil {
+		logger.LogWarn(b.c, "gemini live session will be closed by upstream, time left: "+msg.GoAway.TimeLeft)
+	}
+	return nil
+}
+
+func (b *geminiLiveBridge) handleServerContent(content *dto.GeminiLiveServerContent) error {
+	if content.InputTranscription != nil {
+		b.inputTranscript.WriteString(content.InputTranscription.Text)
+	}
+	if content.Interrupted {
+		// OpenAI 客户端在收到 speech_started 时停止播放
+		if err := b.sendClient("input_audio_buffer.speech_started", map[string]any{"audio_start_ms": 0, "item_id": b.itemId}); err != nil {
+			return err
+		}
+		return b.finishResponse("cancelled")
+	}
+	if content.ModelTurn != nil {
+		for _, part := range content.ModelTurn.Parts {
+			if part.Thought {
+				continue
+			}
+			switch {
+			case part.InlineData != nil && strings.HasPrefix(part.InlineData.MimeType, "audio/"):
+				if err := b.startContent("audio"); err != nil {
+					return err
+				}
+				if err := b.sendDelta(dto.RealtimeEventResponseAudioDelta, part.InlineData.Data); err != nil {
+					return err
+				}
+			case part.Text != "":
+				if err := b.startContent("text"); err != nil {
+					return err
+				}
+				b.outputText.WriteString(part.Text)
+				if err := b.sendDelta("response.text.delta", part.Text); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if content.OutputTranscription != nil && content.OutputTranscription.Text != "" {
+		if err := b.startContent("audio"); err != nil {
+			return err
+		}
+		b.outputText.WriteString(content.OutputTranscription.Text)
+		if err := b.sendDelta(dto.RealtimeEventResponseAudioTranscriptionDelta, content.OutputTranscription.Text); err != nil {
+			return err
+		}
+	}
+	if content.TurnComplete {
+		return b.finishResponse("completed")
+	}
+	return nil
+}
+
+func (b *geminiLiveBridge) handleToolCall(toolCall *dto.GeminiLiveToolCall) error {
+	if err := b.startResponse(); err != nil {
+		return err
+	}
+	if err := b.finishContent(); err != nil {
+		return err
+	}
+	for _, call := range toolCall.FunctionCalls {
+		callId := call.Id
+		if callId == "" {
+			callId = "call_" + common.GetRandomString(24)
+		}
+		b.callNames[callId] = call.Name
+		args := "{}"
+		if call.Args != nil {
+			data, err := common.Marshal(call.Args)
+			if err != nil {
+				return err
+			}
+			args = string(data)
+		}
+		b.countOutput(dto.RealtimeEventResponseFunctionCallArgumentsDelta, args)
+		itemId := "item_" + common.GetRandomString(24)
+		item := map[string]any{
+			"id":        itemId,
+			"object":    "realtime.item",
+			"type":      "function_call",
+			"status":    "completed",
+			"name":      call.Name,
+			"call_id":   callId,
+			"arguments": args,
+		}
+		index := b.outputIndex
+		b.outputIndex++
+		if err := b.sendClient("response.output_item.added", map[string]any{"response_id": b.responseId, "output_index": index, "item": item}); err != nil {
+			return err
+		}
+		if err := b.sendClient(dto.RealtimeEventResponseFunctionCallArgumentsDone, map[string]any{
+			"response_id":  b.responseId,
+			"item_id":      itemId,
+			"output_index": index,
+			"call_id":      callId,
+			"name":         call.Name,
+			"arguments":    args,
+		}); err != nil {
+			return err
+		}
+		if err := b.sendClient("response.output_item.done", map[string]any{"response_id": b.responseId, "output_index": index, "item": item}); err != nil {
+			return err
+		}
+		b.outputItems = append(b.outputItems, item)
+	}
+	// 上游等待工具结果，不会再发送 turnComplete
+	return b.finishResponse("completed")
+}
+
+func (b *geminiLiveBridge) startResponse() error {
+	if b.responseId != "" {
+		return nil
+	}
+	b.autoResponding = false
+	b.responseId = "resp_" + common.GetRandomString(24)
+	b.outputIndex = 0
+	b.outputItems = nil
+	return b.sendClient("response.created", map[string]any{"response": map[string]any{
+		"id":     b.responseId,
+		"object": "realtime.response",
+		"status": "in_progress",
+		"output": []any{},
+	}})
+}
+
+func (b *geminiLiveBridge) startContent(contentType string) error {
+	if err := b.startResponse(); err != nil {
+		return err
+	}
+	if b.contentStarted {
+		return nil
+	}
+	b.contentStarted = true
+	b.contentType = contentType
+	b.itemId = "item_" + common.GetRandomString(24)
+	b.outputText.Reset()
+	b.contentIndex = b.outputIndex
+	b.outputIndex++
+	if err := b.sendClient("response.output_item.added", map[string]any{
+		"response_id":  b.responseId,
+		"output_index": b.contentIndex,
+		"item": map[string]any{
+			"id":      b.itemId,
+			"object":  "realtime.item",
+			"type":    "message",
+			"role":    "assistant",
+			"status":  "in_progress",
+			"content": []any{},
+		},
+	}); err != nil {
+		return err
+	}
+	return b.sendClient("response.content_part.added", map[string]any{
+		"response_id":   b.responseId,
+		"item_id":       b.itemId,
+		"output_index":  b.contentIndex,
+		"content_index": 0,
+		"part":          map[string]any{"type": contentType},
+	})
+}
+
+func (b *geminiLiveBridge) sendDelta(eventType string, delta string) error {
+	b.countOutput(eventType, delta)
+	return b.sendClient(eventType, map[string]any{
+		"response_id":   b.responseId,
+		"item_id":       b.itemId,
+		"output_index":  b.contentIndex,
+		"content_index": 0,
+		"delta":         delta,
+	})
+}
+
+func (b *geminiLiveBridge) finishContent() error {
+	if !b.contentStarted {
+		return nil
+	}
+	b.contentStarted = false
+	base := map[string]any{"response_id": b.responseId, "item_id": b.itemId, "output_index": b.contentIndex, "content_index": 0}
+	part := map[string]any{"type": b.contentType}
+	if b.contentType == "audio" {
+		part["transcript"] = b.outputText.String()
+		if err := b.sendClient("response.audio.done", base); err != nil {
+			return err
+		}
+		if err := b.sendClient("response.audio_transcript.done", mergeEvent(base, "transcript", b.outputText.String())); err != nil {
+			return err
+		}
+	} else {
+		part["text"] = b.outputText.String()
+		if err := b.sendClient("response.text.done", mergeEvent(base, "text", b.outputText.String())); err != nil {
+			return err
+		}
+	}
+	if err := b.sendClient("response.content_part.done", mergeEvent(base, "part", part)); err != nil {
+		return err
+	}
+	item := map[string]any{
+		"id":      b.itemId,
+		"object":  "realtime.item",
+		"type":    "message",
+		"role":    "assistant",
+		"status":  "completed",
+		"content": []any{part},
+	}
+	b.outputItems = append(b.outputItems, item)
+	return b.sendClient("response.output_item.done", map[string]any{"response_id": b.responseId, "output_index": b.contentIndex, "item": item})
+}
+
+func (b *geminiLiveBridge) finishResponse(status string) error {
+	if b.inputTranscript.Len() > 0 {
+		if err := b.sendClient("conversation.item.input_audio_transcription.completed", map[string]any{
+			"item_id":       "item_" + common.GetRandomString(24),
+			"content_index": 0,
+			"transcript":    b.inputTranscript.String(),
+		}); err != nil {
+			return err
+		}
+		b.inputTranscript.Reset()
+	}
+	if b.responseId == "" {
+		return nil
+	}
+	if err := b.finishContent(); err != nil {
+		return err
+	}
+	err := b.sendClient(dto.RealtimeEventTypeResponseDone, map[string]any{"response": map[string]any{
+		"id":     b.responseId,
+		"object": "realtime.response",
+		"status": status,
+		"output": b.outputItems,
+	}})
+	b.responseId = ""
+	b.outputItems = nil
+	return err
+}
+
+func (b *geminiLiveBridge) countOutput(eventType string, delta string) {
+	textToken, audioToken, err := service.CountTokenRealtime(b.info, dto.RealtimeEvent{Type: eventType, Delta: delta}, b.info.UpstreamModelName)
+	if err != nil {
+		logger.LogWarn(b.c, "error counting realtime output token: "+err.Error())
+		return
+	}
+	b.localUsage.TotalTokens += textToken + audioToken
+	b.localUsage.OutputTokens += textToken + audioToken
+	b.localUsage.OutputTokenDetails.TextTokens += textToken
+	b.localUsage.OutputTokenDetails.AudioTokens += audioToken
+}
+
+func (b *geminiLiveBridge) applySessionUpdate(session *dto.RealtimeSession, message []byte) {
+	if len(session.Modalities) > 0 {
+		b.session.Modalities = session.Modalities
+	}
+	b.session.Instructions = session.Instructions
+	b.session.Voice = session.Voice
+	b.session.Temperature = session.Temperature
+	b.session.InputAudioTranscription = session.InputAudioTranscription
+	if session.Tools != nil {
+		b.session.Tools = session.Tools
+		b.info.RealtimeTools = session.Tools
+	}
+	turnDetection := gjson.GetBytes(message, "session.turn_detection")
+	if turnDetection.Exists() {
+		b.session.TurnDetection = session.TurnDetection
+		b.manualActivity = turnDetection.Type == gjson.Null
+	}
+	for _, format := range []string{session.InputAudioFormat, session.OutputAudioFormat} {
+		if format != "" && format != "pcm16" {
+			helper.WssError(b.c, b.clientConn, types.OpenAIError{
+				Message: fmt.Sprintf("audio format %s is not supported by gemini live, using pcm16", format),
+				Type:    "invalid_request_error",
+				Code:    "unsupported_audio_format",
+			})
+			break
+		}
+	}
+}
+
+func (b *geminiLiveBridge) sendSetup() error {
+	b.setupSent = true
+	setup := &dto.GeminiLiveSetup{
+		Model:            "models/" + b.info.UpstreamModelName,
+		GenerationConfig: &dto.GeminiLiveGenerationConfig{ResponseModalities: []string{"TEXT"}},
+	}
+	for _, modality := range b.session.Modalities {
+		if modality == "audio" {
+			setup.GenerationConfig.ResponseModalities = []string{"AUDIO"}
+			setup.OutputAudioTranscription = &struct{}{}
+		}
+	}
+	if b.session.Temperature > 0 {
+		setup.GenerationConfig.Temperature = common.GetPointer(b.session.Temperature)
+	}
+	if b.session.Voice != "" && !openAIRealtimeVoices[b.session.Voice] {
+		setup.GenerationConfig.SpeechConfig, _ = common.Marshal(map[string]any{
+			"voiceConfig": map[string]any{"prebuiltVoiceConfig": map[string]any{"voiceName": b.session.Voice}},
+		})
+	}
+	if b.session.Instructions != "" {
+		setup.SystemInstruction = &dto.GeminiChatContent{Parts: []dto.GeminiPart{{Text: b.session.Instructions}}}
+	}
+	if len(b.session.Tools) > 0 {
+		declarations := make([]map[string]any, 0, len(b.session.Tools))
+		for _, tool := range b.session.Tools {
+			declaration := map[string]any{"name": tool.Name, "description": tool.Description}
+			if tool.Parameters != nil {
+				declaration["parameters"] = cleanFunctionParameters(tool.Parameters)
+			}
+			declarations = append(declarations, declaration)
+		}
+		setup.Tools = []dto.GeminiChatTool{{FunctionDeclarations: declarations}}
+	}
+	if b.session.InputAudioTranscription.Model != "" {
+		setup.InputAudioTranscription = &struct{}{}
+	}
+	if b.manualActivity {
+		setup.RealtimeInputConfig = &dto.GeminiLiveRealtimeInputConfig{
+			AutomaticActivityDetection: &dto.GeminiLiveActivityDetection{Disabled: true},
+		}
+	}
+	return b.sendTarget(&dto.GeminiLiveClientMessage{Setup: setup})
+}
+
+func (b *geminiLiveBridge) sessionObject() map[string]any {
+	return map[string]any{
+		"id":                        b.sessionId,
+		"object":                    "realtime.session",
+		"model":                     b.info.UpstreamModelName,
+		"modalities":                b.session.Modalities,
+		"instructions":              b.session.Instructions,
+		"voice":                     b.session.Voice,
+		"input_audio_format":        "pcm16",
+		"output_audio_format":       "pcm16",
+		"input_audio_transcription": b.session.InputAudioTranscription,
+		"turn_detection":            b.session.TurnDetection,
+		"tools":                     b.session.Tools,
+		"temperature":               b.session.Temperature,
+	}
+}
+
+func (b *geminiLiveBridge) sendTarget(msg *dto.GeminiLiveClientMessage) error {
+	if err := helper.WssObject(b.c, b.targetConn, msg); err != nil {
+		return fmt.Errorf("error writing to target: %v", err)
+	}
+	return nil
+}
+
+func (b *geminiLiveBridge) sendClient(eventType string, fields map[string]any) error {
+	event := map[string]any{
+		"event_id": "event_" + common.GetRandomString(24),
+		"type":     eventType,
+	}
+	for k, v := range fields {
+		event[k] = v
+	}
+	if err := helper.WssObject(b.c, b.clientConn, event); err != nil {
+		return fmt.Errorf("error writing to client: %v", err)
+	}
+	return nil
+}
+
+func mergeEvent(base map[string]any, key string, value any) map[string]any {
+	fields := make(map[string]any, len(base)+1)
+	for k, v := range base {
+		fields[k] = v
+	}
+	fields[key] = value
+	return fields
+}
+
+func convertGeminiLiveUsage(metadata *dto.GeminiLiveUsageMetadata) *dto.RealtimeUsage {
+	usage := &dto.RealtimeUsage{
+		InputTokens:  metadata.PromptTokenCount,
+		OutputTokens: metadata.ResponseTokenCount + metadata.ThoughtsTokenCount,
+	}
+	usage.TotalTokens = usage.InputTokens + usage.OutputTokens
+	usage.InputTokenDetails.CachedTokens = metadata.CachedContentTokenCount
+	for _, detail := range metadata.PromptTokensDetails {
+		if detail.Modality == "AUDIO" {
+			usage.InputTokenDetails.AudioTokens += detail.TokenCount
+		}
+	}
+	for _, detail := range metadata.ResponseTokensDetails {
+		if detail.Modality == "AUDIO" {
+			usage.OutputTokenDetails.AudioTokens += detail.TokenCount
+		}
+	}
+	// 非音频部分（文本、图像、视频）按文本计费
+	usage.InputTokenDetails.TextTokens = usage.InputTokens - usage.InputTokenDetails.AudioTokens
+	usage.OutputTokenDetails.TextTokens = usage.OutputTokens - usage.OutputTokenDetails.AudioTokens
+	return usage
+}
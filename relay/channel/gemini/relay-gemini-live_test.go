@@ -0,0 +1,266 @@
+package gemini
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+// newLiveTestConnPair 返回一对相连的 websocket 连接，bridge 写入前者，测试从后者读取
+func newLiveTestConnPair(t *testing.T) (*websocket.Conn, *websocket.Conn) {
+	t.Helper()
+	serverConns := make(chan *websocket.Conn, 1)
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		serverConns <- conn
+	}))
+	t.Cleanup(server.Close)
+
+	peer, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	require.NoError(t, err)
+	conn := <-serverConns
+	t.Cleanup(func() {
+		_ = peer.Close()
+		_ = conn.Close()
+	})
+	return conn, peer
+}
+
+func newLiveTestBridge(t *testing.T) (*geminiLiveBridge, *websocket.Conn, *websocket.Conn) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/v1/realtime", nil)
+	clientConn, client := newLiveTestConnPair(t)
+	targetConn, target := newLiveTestConnPair(t)
+	bridge := &geminiLiveBridge{
+		c: c,
+		info: &relaycommon.RelayInfo{
+			ChannelMeta: &relaycommon.ChannelMeta{UpstreamModelName: "gemini-2.0-flash-live-001"},
+		},
+		clientConn: clientConn,
+		targetConn: targetConn,
+		sessionId:  "sess_test",
+		setupDone:  make(chan struct{}),
+		callNames:  make(map[string]string),
+		localUsage: &dto.RealtimeUsage{},
+		sumUsage:   &dto.RealtimeUsage{},
+	}
+	return bridge, client, target
+}
+
+func readLiveMessage(t *testing.T, conn *websocket.Conn, v any) {
+	t.Helper()
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	_, data, err := conn.ReadMessage()
+	require.NoError(t, err)
+	require.NoError(t, common.Unmarshal(data, v))
+}
+
+func readLiveEventTypes(t *testing.T, conn *websocket.Conn, n int) []map[string]any {
+	t.Helper()
+	events := make([]map[string]any, 0, n)
+	for i := 0; i < n; i++ {
+		event := map[string]any{}
+		readLiveMessage(t, conn, &event)
+		events = append(events, event)
+	}
+	return events
+}
+
+func eventTypes(events []map[string]any) []string {
+	types := make([]string, 0, len(events))
+	for _, event := range events {
+		types = append(types, event["type"].(string))
+	}
+	return types
+}
+
+func TestConvertGeminiLiveUsage(t *testing.T) {
+	usage := convertGeminiLiveUsage(&dto.GeminiLiveUsageMetadata{
+		PromptTokenCount:        100,
+		ResponseTokenCount:      50,
+		ThoughtsTokenCount:      10,
+		CachedContentTokenCount: 20,
+		PromptTokensDetails: []dto.GeminiPromptTokensDetails{
+			{Modality: "AUDIO", TokenCount: 60},
+			{Modality: "TEXT", TokenCount: 40},
+		},
+		ResponseTokensDetails: []dto.GeminiPromptTokensDetails{
+			{Modality: "AUDIO", TokenCount: 30},
+		},
+	})
+	require.Equal(t, 100, usage.InputTokens)
+	require.Equal(t, 60, usage.OutputTokens)
+	require.Equal(t, 160, usage.TotalTokens)
+	require.Equal(t, 20, usage.InputTokenDetails.CachedTokens)
+	require.Equal(t, 60, usage.InputTokenDetails.AudioTokens)
+	require.Equal(t, 40, usage.InputTokenDetails.TextTokens)
+	require.Equal(t, 30, usage.OutputTokenDetails.AudioTokens)
+	// 思考 token 计入文本输出
+	require.Equal(t, 30, usage.OutputTokenDetails.TextTokens)
+}
+
+func TestGeminiLiveSetup(t *testing.T) {
+	bridge, client, target := newLiveTestBridge(t)
+
+	message := []byte(`{"type":"session.update","session":{"modalities":["text","audio"],"instructions":"be brief","voice":"Puck","temperature":0.6,"input_audio_transcription":{"model":"whisper-1"},"turn_detection":null,"tools":[{"type":"function","name":"get_weather","description":"get weather","parameters":{"type":"object","properties":{"city":{"type":"string"}}}}]}}`)
+	event := &dto.RealtimeEvent{}
+	require.NoError(t, common.Unmarshal(message, event))
+	bridge.applySessionUpdate(event.Session, message)
+	bridge.notifySetup = true
+	require.True(t, bridge.manualActivity)
+	require.NoError(t, bridge.sendSetup())
+
+	var sent dto.GeminiLiveClientMessage
+	readLiveMessage(t, target, &sent)
+	setup := sent.Setup
+	require.NotNil(t, setup)
+	require.Equal(t, "models/gemini-2.0-flash-live-001", setup.Model)
+	require.Equal(t, []string{"AUDIO"}, setup.GenerationConfig.ResponseModalities)
+	require.NotNil(t, setup.OutputAudioTranscription)
+	require.NotNil(t, setup.InputAudioTranscription)
+	require.InDelta(t, 0.6, *setup.GenerationConfig.Temperature, 1e-9)
+	require.JSONEq(t, `{"voiceConfig":{"prebuiltVoiceConfig":{"voiceName":"Puck"}}}`, string(setup.GenerationConfig.SpeechConfig))
+	require.Equal(t, "be brief", setup.SystemInstruction.Parts[0].Text)
+	require.Len(t, setup.Tools, 1)
+	require.Equal(t, "get_weather", setup.Tools[0].FunctionDeclarations.([]any)[0].(map[string]any)["name"])
+	require.True(t, setup.RealtimeInputConfig.AutomaticActivityDetection.Disabled)
+
+	// setupComplete 后通知客户端会话已更新
+	require.NoError(t, bridge.handleServerMessage([]byte(`{"setupComplete":{}}`)))
+	updated := map[string]any{}
+	readLiveMessage(t, client, &updated)
+	require.Equal(t, dto.RealtimeEventTypeSessionUpdated, updated["type"])
+	require.Equal(t, "be brief", updated["session"].(map[string]any)["instructions"])
+	select {
+	case <-bridge.setupDone:
+	default:
+		t.Fatal("setupDone should be closed")
+	}
+}
+
+func TestGeminiLiveOpenAIVoiceIgnored(t *testing.T) {
+	bridge, _, target := newLiveTestBridge(t)
+
+	message := []byte(`{"type":"session.update","session":{"voice":"alloy"}}`)
+	event := &dto.RealtimeEvent{}
+	require.NoError(t, common.Unmarshal(message, event))
+	bridge.applySessionUpdate(event.Session, message)
+	require.False(t, bridge.manualActivity)
+	require.NoError(t, bridge.sendSetup())
+
+	var sent dto.GeminiLiveClientMessage
+	readLiveMessage(t, target, &sent)
+	require.Equal(t, []string{"TEXT"}, sent.Setup.GenerationConfig.ResponseModalities)
+	require.Empty(t, sent.Setup.GenerationConfig.SpeechConfig)
+	require.Nil(t, sent.Setup.RealtimeInputConfig)
+}
+
+func TestGeminiLiveConversationItems(t *testing.T) {
+	bridge, client, target := newLiveTestBridge(t)
+	bridge.setupSent = true
+	close(bridge.setupDone)
+
+	require.NoError(t, bridge.handleClientMessage([]byte(`{"type":"conversation.item.create","item":{"type":"message","role":"assistant","content":[{"type":"text","text":"hi"}]}}`), nil))
+	require.NoError(t, bridge.handleClientMessage([]byte(`{"type":"conversation.item.create","item":{"type":"message","role":"user","content":[{"type":"input_text","text":"what's the weather"}]}}`), nil))
+	created := readLiveEventTypes(t, client, 2)
+	require.Equal(t, []string{dto.RealtimeEventConversationItemCreated, dto.RealtimeEventConversationItemCreated}, eventTypes(created))
+
+	require.NoError(t, bridge.handleClientMessage([]byte(`{"type":"response.create"}`), nil))
+	var sent dto.GeminiLiveClientMessage
+	readLiveMessage(t, target, &sent)
+	require.NotNil(t, sent.ClientContent)
+	require.True(t, sent.ClientContent.TurnComplete)
+	require.Len(t, sent.ClientContent.Turns, 2)
+	require.Equal(t, "model", sent.ClientContent.Turns[0].Role)
+	require.Equal(t, "hi", sent.ClientContent.Turns[0].Parts[0].Text)
+	require.Equal(t, "user", sent.ClientContent.Turns[1].Role)
+	require.Empty(t, bridge.pendingTurns)
+}
+
+func TestGeminiLiveServerContent(t *testing.T) {
+	bridge, client, _ := newLiveTestBridge(t)
+
+	require.NoError(t, bridge.handleServerMessage([]byte(`{"serverContent":{"inputTranscription":{"text":"hello"},"outputTranscription":{"text":"Hi there, how can I help?"}}}`)))
+	require.NoError(t, bridge.handleServerMessage([]byte(`{"serverContent":{"turnComplete":true}}`)))
+
+	events := readLiveEventTypes(t, client, 9)
+	require.Equal(t, []string{
+		"response.created",
+		"response.output_item.added",
+		"response.content_part.added",
+		dto.RealtimeEventResponseAudioTranscriptionDelta,
+		"conversation.item.input_audio_transcription.completed",
+		"response.audio.done",
+		"response.audio_transcript.done",
+		"response.content_part.done",
+		"response.output_item.done",
+	}, eventTypes(events))
+	require.Equal(t, "hello", events[4]["transcript"])
+	require.Equal(t, "Hi there, how can I help?", events[6]["transcript"])
+
+	done := map[string]any{}
+	readLiveMessage(t, client, &done)
+	require.Equal(t, dto.RealtimeEventTypeResponseDone, done["type"])
+	response := done["response"].(map[string]any)
+	require.Equal(t, "completed", response["status"])
+	require.Len(t, response["output"], 1)
+	require.Empty(t, bridge.responseId)
+
+	// 本地按转写文本估算输出 token
+	require.Greater(t, bridge.localUsage.OutputTokens, 0)
+	require.Equal(t, bridge.localUsage.OutputTokens, bridge.localUsage.OutputTokenDetails.TextTokens)
+}
+
+func TestGeminiLiveToolCall(t *testing.T) {
+	bridge, client, target := newLiveTestBridge(t)
+
+	require.NoError(t, bridge.handleServerMessage([]byte(`{"toolCall":{"functionCalls":[{"id":"fc_1","name":"get_weather","args":{"city":"Paris"}}]}}`)))
+	events := readLiveEventTypes(t, client, 5)
+	require.Equal(t, []string{
+		"response.created",
+		"response.output_item.added",
+		dto.RealtimeEventResponseFunctionCallArgumentsDone,
+		"response.output_item.done",
+		dto.RealtimeEventTypeResponseDone,
+	}, eventTypes(events))
+	require.Equal(t, "fc_1", events[2]["call_id"])
+	require.Equal(t, "get_weather", events[2]["name"])
+	require.JSONEq(t, `{"city":"Paris"}`, events[2]["arguments"].(string))
+	require.Greater(t, bridge.localUsage.OutputTokens, 0)
+
+	// 工具结果按 call_id 找回函数名，之后上游自动回复
+	require.NoError(t, bridge.handleConversationItem(&dto.RealtimeItem{Type: "function_call_output", CallId: "fc_1", Output: `{"temp":21}`}))
+	var sent dto.GeminiLiveClientMessage
+	readLiveMessage(t, target, &sent)
+	require.NotNil(t, sent.ToolResponse)
+	response := sent.ToolResponse.FunctionResponses[0]
+	require.Equal(t, "fc_1", response.Id)
+	require.Equal(t, "get_weather", response.Name)
+	require.Equal(t, map[string]any{"temp": float64(21)}, response.Response["output"])
+	require.True(t, bridge.autoResponding)
+	readLiveEventTypes(t, client, 1)
+
+	// 自动回复期间 response.create 不会再向上游发送空的 clientContent
+	bridge.setupSent = true
+	close(bridge.setupDone)
+	require.NoError(t, bridge.handleClientMessage([]byte(`{"type":"response.create"}`), nil))
+	require.NoError(t, target.SetReadDeadline(time.Now().Add(100*time.Millisecond)))
+	_, _, err := target.ReadMessage()
+	require.Error(t, err)
+}
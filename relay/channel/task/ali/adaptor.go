@@ -15,6 +15,7 @@ import (
 	"github.com/QuantumNous/new-api/relay/channel"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
 	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/types"
 	"github.com/samber/lo"
 
 	"github.com/gin-gonic/gin"
@@ -147,6 +148,21 @@ func (a *TaskAdaptor) BuildRequestHeader(c *gin.Context, req *http.Request, info
 	return nil
 }
 
+// GetMediaParams 使用转换后的万相请求参数计费
+func (a *TaskAdaptor) GetMediaParams(c *gin.Context, info *relaycommon.RelayInfo) (types.MediaParams, error) {
+	params := types.MediaParams{}
+	if a.aliReq == nil || a.aliReq.Parameters == nil {
+		return params, nil
+	}
+	params.Seconds = float64(a.aliReq.Parameters.Duration)
+	params.Size = a.aliReq.Parameters.Size
+	params.Resolution = a.aliReq.Parameters.Resolution
+	if params.Resolution == "" && params.Size != "" {
+		params.Resolution, _ = sizeToResolution(params.Size)
+	}
+	return params, nil
+}
+
 func (a *TaskAdaptor) BuildRequestBody(c *gin.Context, info *relaycommon.RelayInfo) (io.Reader, error) {
 	bodyBytes, err := common.Marshal(a.aliReq)
 	if err != nil {
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -364,6 +365,9 @@ func (a *TaskAdaptor) ParseTaskResult(respBody []byte) (*relaycommon.TaskInfo, e
 	if videos := resPayload.Data.TaskResult.Videos; len(videos) > 0 {
 		video := videos[0]
 		taskInfo.Url = video.Url
+		if seconds, err := strconv.ParseFloat(video.Duration, 64); err == nil {
+			taskInfo.Seconds = seconds
+		}
 	}
 	return taskInfo, nil
 }
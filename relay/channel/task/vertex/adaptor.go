@@ -20,6 +20,7 @@ import (
 	vertexcore "github.com/QuantumNous/new-api/relay/channel/vertex"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
 	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/types"
 )
 
 // ============================
@@ -133,6 +134,19 @@ func (a *TaskAdaptor) BuildRequestHeader(c *gin.Context, req *http.Request, info
 	return nil
 }
 
+// GetMediaParams 按生成时长与 sampleCount 计费
+func (a *TaskAdaptor) GetMediaParams(c *gin.Context, info *relaycommon.RelayInfo) (types.MediaParams, error) {
+	req, err := relaycommon.GetTaskRequest(c)
+	if err != nil {
+		return types.MediaParams{}, err
+	}
+	params := relaycommon.TaskMediaParams(req)
+	if v, ok := req.Metadata["sampleCount"].(float64); ok && v > 0 {
+		params.Count = int(v)
+	}
+	return params, nil
+}
+
 // BuildRequestBody converts request into Vertex specific format.
 func (a *TaskAdaptor) BuildRequestBody(c *gin.Context, info *relaycommon.RelayInfo) (io.Reader, error) {
 	v, ok := c.Get("task_request")
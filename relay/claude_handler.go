@@ -135,6 +135,9 @@ func ClaudeHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *typ
 		}
 		requestBody = common.ReaderOnly(storage)
 	} else {
+		if info.ChannelOtherSettings.EmulateTools {
+			info.ToolEmulation = service.ApplyClaudeToolEmulation(request)
+		}
 		convertedRequest, err := adaptor.ConvertClaudeRequest(c, info, request)
 		if err != nil {
 			return types.NewError(err, types.ErrorCodeConvertRequestFailed, types.ErrOptionWithSkipRetry())
@@ -183,7 +186,14 @@ func ClaudeHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *typ
 		}
 	}
 
+	var toolWriter *toolEmulationWriter
+	if info.ToolEmulation {
+		toolWriter = newToolEmulationWriter(c, info)
+	}
 	usage, newAPIError := adaptor.DoResponse(c, httpResp, info)
+	if toolWriter != nil {
+		toolWriter.finish(c, newAPIError != nil)
+	}
 	//log.Printf("usage: %v", usage)
 	if newAPIError != nil {
 		// reset status code 重置状态码
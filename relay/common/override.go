@@ -3,6 +3,7 @@ package common
 import (
 	"fmt"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -48,6 +49,56 @@ func ApplyParamOverride(jsonData []byte, paramOverride map[string]interface{}, c
 	return applyOperationsLegacy(jsonData, paramOverride)
 }
 
+// MergeParamOverride 合并两组参数覆盖，extra 在 base 之后生效。
+// 两者均为旧格式时直接合并键值，否则将旧格式转换为 set 操作后拼接操作列表
+func MergeParamOverride(base, extra map[string]interface{}) map[string]interface{} {
+	if len(extra) == 0 {
+		return base
+	}
+	if len(base) == 0 {
+		return extra
+	}
+	_, baseIsOps := tryParseOperations(base)
+	_, extraIsOps := tryParseOperations(extra)
+	if !baseIsOps && !extraIsOps {
+		merged := make(map[string]interface{}, len(base)+len(extra))
+		for k, v := range base {
+			merged[k] = v
+		}
+		for k, v := range extra {
+			merged[k] = v
+		}
+		return merged
+	}
+	var operations []interface{}
+	operations = append(operations, paramOverrideToOperations(base, baseIsOps)...)
+	operations = append(operations, paramOverrideToOperations(extra, extraIsOps)...)
+	return map[string]interface{}{"operations": operations}
+}
+
+var paramOverridePathEscaper = strings.NewReplacer(".", `\.`, "*", `\*`, "?", `\?`)
+
+func paramOverrideToOperations(paramOverride map[string]interface{}, isOps bool) []interface{} {
+	if isOps {
+		operations, _ := paramOverride["operations"].([]interface{})
+		return operations
+	}
+	keys := make([]string, 0, len(paramOverride))
+	for key := range paramOverride {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	operations := make([]interface{}, 0, len(keys))
+	for _, key := range keys {
+		operations = append(operations, map[string]interface{}{
+			"path":  paramOverridePathEscaper.Replace(key),
+			"mode":  "set",
+			"value": paramOverride[key],
+		})
+	}
+	return operations
+}
+
 func tryParseOperations(paramOverride map[string]interface{}) ([]ParamOperation, bool) {
 	// 检查是否包含 "operations" 字段
 	if opsValue, exists := paramOverride["operations"]; exists {
@@ -772,6 +772,35 @@ func TestApplyParamOverrideToUpper(t *testing.T) {
 	assertJSONEqual(t, `{"model":"GPT-4"}`, string(out))
 }
 
+func TestMergeParamOverride(t *testing.T) {
+	input := []byte(`{"model":"gpt-4o","temperature":0.7}`)
+
+	legacy := MergeParamOverride(
+		map[string]interface{}{"temperature": 0.2, "top_p": 0.9},
+		map[string]interface{}{"temperature": 0.5},
+	)
+	out, err := ApplyParamOverride(input, legacy, nil)
+	if err != nil {
+		t.Fatalf("ApplyParamOverride returned error: %v", err)
+	}
+	assertJSONEqual(t, `{"model":"gpt-4o","temperature":0.5,"top_p":0.9}`, string(out))
+
+	// 旧格式与操作格式混合时，后者在前者之后执行
+	mixed := MergeParamOverride(
+		map[string]interface{}{"temperature": 0.2, "metadata.tag": "a"},
+		map[string]interface{}{
+			"operations": []interface{}{
+				map[string]interface{}{"path": "temperature", "mode": "delete"},
+			},
+		},
+	)
+	out, err = ApplyParamOverride(input, mixed, nil)
+	if err != nil {
+		t.Fatalf("ApplyParamOverride returned error: %v", err)
+	}
+	assertJSONEqual(t, `{"model":"gpt-4o","metadata.tag":"a"}`, string(out))
+}
+
 func assertJSONEqual(t *testing.T, want, got string) {
 	t.Helper()
 
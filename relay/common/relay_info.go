@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http"
 	"strings"
 	"time"
 
@@ -57,6 +58,75 @@ type ResponsesUsageInfo struct {
 	BuiltInTools map[string]*BuildInToolInfo
 }
 
+// AddBuiltInToolCall 按 Responses 输出项类型累加内置工具调用次数
+func (u *ResponsesUsageInfo) AddBuiltInToolCall(itemType string) {
+	if u == nil {
+		return
+	}
+	var toolType string
+	switch itemType {
+	case dto.BuildInCallWebSearchCall:
+		toolType = dto.BuildInToolWebSearchPreview
+	case dto.BuildInCallFileSearchCall:
+		toolType = dto.BuildInToolFileSearch
+	case dto.BuildInCallCodeInterpreterCall:
+		toolType = dto.BuildInToolCodeInterpreter
+	default:
+		return
+	}
+	if u.BuiltInTools == nil {
+		u.BuiltInTools = make(map[string]*BuildInToolInfo)
+	}
+	tool, ok := u.BuiltInTools[toolType]
+	if !ok || tool == nil {
+		tool = &BuildInToolInfo{ToolName: toolType}
+		u.BuiltInTools[toolType] = tool
+	}
+	tool.CallCount++
+}
+
+// PromptCacheInfo 记录网关为本次请求自动开启的提示词缓存，用于计费与日志
+type PromptCacheInfo struct {
+	Provider string // claude / gemini
+	Source   string // channel / group / default
+	TTL      string
+	// WriteTokens 为 Gemini 创建 cachedContents 时写入的 token 数，Claude 的写入量由上游 usage 返回
+	WriteTokens int
+}
+
+// StructuredOutputState 记录网关结构化输出校验在多次尝试之间的状态，不随渠道重试重置
+type StructuredOutputState struct {
+	Schema     any
+	SchemaName string
+	Failures   int
+	// FailedUsage 为校验失败尝试的累计用量，按计费策略决定是否向用户收费
+	FailedUsage dto.Usage
+	LastError   string
+	// 最近一次失败尝试的完整响应，供修复模型修复后返回
+	LastContent string
+	LastStatus  int
+	LastHeader  http.Header
+	LastBody    []byte
+	// FixerModel 不为空表示最终结果由该修复模型修复
+	FixerModel string
+}
+
+// RecordFailure 记录一次未通过校验的尝试
+func (s *StructuredOutputState) RecordFailure(usage *dto.Usage, content string, validateErr error) {
+	s.Failures++
+	if usage != nil {
+		s.FailedUsage.PromptTokens += usage.PromptTokens
+		s.FailedUsage.CompletionTokens += usage.CompletionTokens
+		s.FailedUsage.TotalTokens += usage.TotalTokens
+		s.FailedUsage.PromptTokensDetails.CachedTokens += usage.PromptTokensDetails.CachedTokens
+		s.FailedUsage.PromptTokensDetails.CachedCreationTokens += usage.PromptTokensDetails.CachedCreationTokens
+	}
+	s.LastContent = content
+	if validateErr != nil {
+		s.LastError = validateErr.Error()
+	}
+}
+
 type ChannelMeta struct {
 	ChannelType          int
 	ChannelId            int
@@ -90,6 +160,9 @@ type RelayInfo struct {
 	UsingGroup        string // 使用的分组，当auto跨分组重试时，会变动
 	UserGroup         string // 用户所在分组
 	TokenUnlimited    bool
+	OrgId             int  // 组织令牌所属组织，非 0 时计费走组织钱包
+	TokenBudget       bool // 令牌启用了周期预算
+	ClientTokenId     int  // 通过客户端令牌访问时的客户端令牌 id，计费记在父令牌上
 	StartTime         time.Time
 	FirstResponseTime time.Time
 	isFirstResponse   bool
@@ -142,6 +215,12 @@ type RelayInfo struct {
 	IsChannelTest                         bool // channel test request
 
 	PriceData types.PriceData
+	// PromptCache 网关自动开启的提示词缓存信息，未开启时为 nil
+	PromptCache *PromptCacheInfo
+	// ToolEmulation 本次尝试是否以提示词模拟工具调用（按渠道设置，每次重试重新判断）
+	ToolEmulation bool
+	// StructuredOutput 网关结构化输出校验状态，未启用时为 nil
+	StructuredOutput *StructuredOutputState
 
 	Request dto.Request
 
@@ -162,7 +241,9 @@ type RelayInfo struct {
 
 func (info *RelayInfo) InitChannelMeta(c *gin.Context) {
 	channelType := common.GetContextKeyInt(c, constant.ContextKeyChannelType)
-	paramOverride := common.GetContextKeyStringMap(c, constant.ContextKeyChannelParamOverride)
+	// 虚拟模型目标的参数覆盖在渠道参数覆盖之后生效
+	paramOverride := MergeParamOverride(common.GetContextKeyStringMap(c, constant.ContextKeyChannelParamOverride),
+		common.GetContextKeyStringMap(c, constant.ContextKeyVirtualModelParamOverride))
 	headerOverride := common.GetContextKeyStringMap(c, constant.ContextKeyChannelHeaderOverride)
 	apiType, _ := common.ChannelType2APIType(channelType)
 	channelMeta := &ChannelMeta{
@@ -205,6 +286,9 @@ func (info *RelayInfo) InitChannelMeta(c *gin.Context) {
 	}
 
 	info.ChannelMeta = channelMeta
+	// 重试切换渠道时缓存规则需要重新解析
+	info.PromptCache = nil
+	info.ToolEmulation = false
 
 	// reset some fields based on channel meta
 	// 重置某些字段，例如模型名称等
@@ -370,6 +454,10 @@ func GenRelayInfoResponses(c *gin.Context, request *dto.OpenAIResponsesRequest)
 	if len(request.Tools) > 0 {
 		for _, tool := range request.GetToolsMap() {
 			toolType := common.Interface2String(tool["type"])
+			// web_search 与 web_search_preview 计费相同，统一记录
+			if toolType == dto.BuildInToolWebSearch {
+				toolType = dto.BuildInToolWebSearchPreview
+			}
 			info.ResponsesUsageInfo.BuiltInTools[toolType] = &BuildInToolInfo{
 				ToolName:  toolType,
 				CallCount: 0,
@@ -452,6 +540,9 @@ func genBaseRelayInfo(c *gin.Context, request dto.Request) *RelayInfo {
 		TokenKey:       common.GetContextKeyString(c, constant.ContextKeyTokenKey),
 		TokenUnlimited: common.GetContextKeyBool(c, constant.ContextKeyTokenUnlimited),
 		TokenGroup:     tokenGroup,
+		OrgId:          common.GetContextKeyInt(c, constant.ContextKeyTokenOrgId),
+		TokenBudget:    common.GetContextKeyBool(c, constant.ContextKeyTokenBudgetEnabled),
+		ClientTokenId:  common.GetContextKeyInt(c, constant.ContextKeyClientTokenId),
 
 		isFirstResponse: true,
 		RelayMode:       relayconstant.Path2RelayMode(c.Request.URL.Path),
@@ -694,15 +785,16 @@ func (t *TaskSubmitReq) UnmarshalMetadata(v any) error {
 }
 
 type TaskInfo struct {
-	Code             int    `json:"code"`
-	TaskID           string `json:"task_id"`
-	Status           string `json:"status"`
-	Reason           string `json:"reason,omitempty"`
-	Url              string `json:"url,omitempty"`
-	RemoteUrl        string `json:"remote_url,omitempty"`
-	Progress         string `json:"progress,omitempty"`
-	CompletionTokens int    `json:"completion_tokens,omitempty"` // 用于按倍率计费
-	TotalTokens      int    `json:"total_tokens,omitempty"`      // 用于按倍率计费
+	Code             int     `json:"code"`
+	TaskID           string  `json:"task_id"`
+	Status           string  `json:"status"`
+	Reason           string  `json:"reason,omitempty"`
+	Url              string  `json:"url,omitempty"`
+	RemoteUrl        string  `json:"remote_url,omitempty"`
+	Progress         string  `json:"progress,omitempty"`
+	CompletionTokens int     `json:"completion_tokens,omitempty"` // 用于按倍率计费
+	TotalTokens      int     `json:"total_tokens,omitempty"`      // 用于按倍率计费
+	Seconds          float64 `json:"seconds,omitempty"`           // 上游返回的实际生成时长，用于按秒结算
 }
 
 func FailTaskInfo(reason string) *TaskInfo {
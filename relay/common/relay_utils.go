@@ -9,6 +9,7 @@ import (
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/types"
 
 	"github.com/gin-gonic/gin"
 	"github.com/samber/lo"
@@ -71,6 +72,34 @@ func GetTaskRequest(c *gin.Context) (TaskSubmitReq, error) {
 	return req, nil
 }
 
+// TaskMediaParams 从通用提交请求中解析媒体计费参数，分辨率、帧率、质量等可通过 metadata 传入
+func TaskMediaParams(req TaskSubmitReq) types.MediaParams {
+	params := types.MediaParams{
+		Size:    req.Size,
+		Quality: req.Mode,
+	}
+	if seconds, err := strconv.ParseFloat(req.Seconds, 64); err == nil && seconds > 0 {
+		params.Seconds = seconds
+	} else if req.Duration > 0 {
+		params.Seconds = float64(req.Duration)
+	}
+	if req.Metadata != nil {
+		if v, ok := req.Metadata["resolution"].(string); ok {
+			params.Resolution = v
+		}
+		if v, ok := req.Metadata["quality"].(string); ok {
+			params.Quality = v
+		}
+		if v, ok := req.Metadata["fps"].(float64); ok {
+			params.Fps = int(v)
+		}
+		if v, ok := req.Metadata["n"].(float64); ok {
+			params.Count = int(v)
+		}
+	}
+	return params
+}
+
 func validatePrompt(prompt string) *dto.TaskError {
 	if strings.TrimSpace(prompt) == "" {
 		return createTaskError(fmt.Errorf("prompt is required"), "invalid_request", http.StatusBadRequest, true)
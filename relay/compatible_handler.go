@@ -13,6 +13,7 @@ import (
 	"github.com/QuantumNous/new-api/dto"
 	"github.com/QuantumNous/new-api/logger"
 	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/relay/channel"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
 	relayconstant "github.com/QuantumNous/new-api/relay/constant"
 	"github.com/QuantumNous/new-api/relay/helper"
@@ -111,6 +112,9 @@ func TextHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *types
 		}
 		requestBody = common.ReaderOnly(storage)
 	} else {
+		if info.ChannelOtherSettings.EmulateTools {
+			info.ToolEmulation = service.ApplyOpenAIToolEmulation(request)
+		}
 		convertedRequest, err := adaptor.ConvertOpenAIRequest(c, info, request)
 		if err != nil {
 			return types.NewError(err, types.ErrorCodeConvertRequestFailed, types.ErrOptionWithSkipRetry())
@@ -183,10 +187,34 @@ func TextHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *types
 		requestBody = bytes.NewBuffer(jsonData)
 	}
 
+	var usage any
+	var newApiErr *types.NewAPIError
+	if structured := prepareStructuredOutput(c, info, request); structured != nil {
+		usage, newApiErr = doStructuredOutputRequest(c, info, adaptor, requestBody, structured)
+	} else {
+		usage, newApiErr = doTextRequest(c, info, adaptor, requestBody)
+	}
+	if newApiErr != nil {
+		return newApiErr
+	}
+	extraContent := chargeStructuredOutputFailures(info, usage.(*dto.Usage))
+
+	var containAudioTokens = usage.(*dto.Usage).CompletionTokenDetails.AudioTokens > 0 || usage.(*dto.Usage).PromptTokensDetails.AudioTokens > 0
+	var containsAudioRatios = ratio_setting.ContainsAudioRatio(info.OriginModelName) || ratio_setting.ContainsAudioCompletionRatio(info.OriginModelName)
+
+	if containAudioTokens && containsAudioRatios {
+		service.PostAudioConsumeQuota(c, info, usage.(*dto.Usage), strings.Join(extraContent, ", "))
+	} else {
+		postConsumeQuota(c, info, usage.(*dto.Usage), extraContent...)
+	}
+	return nil
+}
+
+func doTextRequest(c *gin.Context, info *relaycommon.RelayInfo, adaptor channel.Adaptor, requestBody io.Reader) (any, *types.NewAPIError) {
 	var httpResp *http.Response
 	resp, err := adaptor.DoRequest(c, info, requestBody)
 	if err != nil {
-		return types.NewOpenAIError(err, types.ErrorCodeDoRequestFailed, http.StatusInternalServerError)
+		return nil, types.NewOpenAIError(err, types.ErrorCodeDoRequestFailed, http.StatusInternalServerError)
 	}
 
 	statusCodeMappingStr := c.GetString("status_code_mapping")
@@ -198,26 +226,24 @@ func TextHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *types
 			newApiErr := service.RelayErrorHandler(c.Request.Context(), httpResp, false)
 			// reset status code 重置状态码
 			service.ResetStatusCode(newApiErr, statusCodeMappingStr)
-			return newApiErr
+			return nil, newApiErr
 		}
 	}
 
+	var toolWriter *toolEmulationWriter
+	if info.ToolEmulation {
+		toolWriter = newToolEmulationWriter(c, info)
+	}
 	usage, newApiErr := adaptor.DoResponse(c, httpResp, info)
+	if toolWriter != nil {
+		toolWriter.finish(c, newApiErr != nil)
+	}
 	if newApiErr != nil {
 		// reset status code 重置状态码
 		service.ResetStatusCode(newApiErr, statusCodeMappingStr)
-		return newApiErr
+		return nil, newApiErr
 	}
-
-	var containAudioTokens = usage.(*dto.Usage).CompletionTokenDetails.AudioTokens > 0 || usage.(*dto.Usage).PromptTokensDetails.AudioTokens > 0
-	var containsAudioRatios = ratio_setting.ContainsAudioRatio(info.OriginModelName) || ratio_setting.ContainsAudioCompletionRatio(info.OriginModelName)
-
-	if containAudioTokens && containsAudioRatios {
-		service.PostAudioConsumeQuota(c, info, usage.(*dto.Usage), "")
-	} else {
-		postConsumeQuota(c, info, usage.(*dto.Usage))
-	}
-	return nil
+	return usage, nil
 }
 
 func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usage *dto.Usage, extraContent ...string) {
@@ -243,10 +269,18 @@ func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usage
 	imageTokens := usage.PromptTokensDetails.ImageTokens
 	audioTokens := usage.PromptTokensDetails.AudioTokens
 	completionTokens := usage.CompletionTokens
+	reasoningTokens := usage.CompletionTokenDetails.ReasoningTokens
 	cachedCreationTokens := usage.PromptTokensDetails.CachedCreationTokens
 
 	modelName := relayInfo.OriginModelName
 
+	// 按实际用量选择分档价格，Claude 语义的 input_tokens 不含缓存 tokens，需加回后再比较阈值
+	tierPromptTokens := promptTokens
+	if relayInfo.FinalRequestRelayFormat == types.RelayFormatClaude {
+		tierPromptTokens += cacheTokens + cachedCreationTokens
+	}
+	relayInfo.PriceData.ApplyPricingTier(tierPromptTokens, completionTokens)
+
 	tokenName := ctx.GetString("token_name")
 	completionRatio := relayInfo.PriceData.CompletionRatio
 	cacheRatio := relayInfo.PriceData.CacheRatio
@@ -261,9 +295,7 @@ func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usage
 	dCacheTokens := decimal.NewFromInt(int64(cacheTokens))
 	dImageTokens := decimal.NewFromInt(int64(imageTokens))
 	dAudioTokens := decimal.NewFromInt(int64(audioTokens))
-	dCompletionTokens := decimal.NewFromInt(int64(completionTokens))
 	dCachedCreationTokens := decimal.NewFromInt(int64(cachedCreationTokens))
-	dCompletionRatio := decimal.NewFromFloat(completionRatio)
 	dCacheRatio := decimal.NewFromFloat(cacheRatio)
 	dImageRatio := decimal.NewFromFloat(imageRatio)
 	dModelRatio := decimal.NewFromFloat(modelRatio)
@@ -281,7 +313,7 @@ func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usage
 	if relayInfo.ResponsesUsageInfo != nil {
 		if webSearchTool, exists := relayInfo.ResponsesUsageInfo.BuiltInTools[dto.BuildInToolWebSearchPreview]; exists && webSearchTool.CallCount > 0 {
 			// 计算 web search 调用的配额 (配额 = 价格 * 调用次数 / 1000 * 分组倍率)
-			webSearchPrice = operation_setting.GetWebSearchPricePerThousand(modelName, webSearchTool.SearchContextSize)
+			webSearchPrice = service.ToolCallPricePerThousand(modelName, dto.BuildInToolWebSearchPreview, webSearchTool.SearchContextSize)
 			dWebSearchQuota = decimal.NewFromFloat(webSearchPrice).
 				Mul(decimal.NewFromInt(int64(webSearchTool.CallCount))).
 				Div(decimal.NewFromInt(1000)).Mul(dGroupRatio).Mul(dQuotaPerUnit)
@@ -294,7 +326,7 @@ func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usage
 		if searchContextSize == "" {
 			searchContextSize = "medium"
 		}
-		webSearchPrice = operation_setting.GetWebSearchPricePerThousand(modelName, searchContextSize)
+		webSearchPrice = service.ToolCallPricePerThousand(modelName, dto.BuildInToolWebSearchPreview, searchContextSize)
 		dWebSearchQuota = decimal.NewFromFloat(webSearchPrice).
 			Div(decimal.NewFromInt(1000)).Mul(dGroupRatio).Mul(dQuotaPerUnit)
 		extraContent = append(extraContent, fmt.Sprintf("Web Search 调用 1 次，上下文大小 %s，调用花费 %s",
@@ -305,7 +337,7 @@ func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usage
 	var claudeWebSearchPrice float64
 	claudeWebSearchCallCount := ctx.GetInt("claude_web_search_requests")
 	if claudeWebSearchCallCount > 0 {
-		claudeWebSearchPrice = operation_setting.GetClaudeWebSearchPricePerThousand()
+		claudeWebSearchPrice = service.ToolCallPricePerThousand(modelName, dto.BuildInToolClaudeWebSearch, "")
 		dClaudeWebSearchQuota = decimal.NewFromFloat(claudeWebSearchPrice).
 			Div(decimal.NewFromInt(1000)).Mul(dGroupRatio).Mul(dQuotaPerUnit).Mul(decimal.NewFromInt(int64(claudeWebSearchCallCount)))
 		extraContent = append(extraContent, fmt.Sprintf("Claude Web Search 调用 %d 次，调用花费 %s",
@@ -316,7 +348,7 @@ func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usage
 	var fileSearchPrice float64
 	if relayInfo.ResponsesUsageInfo != nil {
 		if fileSearchTool, exists := relayInfo.ResponsesUsageInfo.BuiltInTools[dto.BuildInToolFileSearch]; exists && fileSearchTool.CallCount > 0 {
-			fileSearchPrice = operation_setting.GetFileSearchPricePerThousand()
+			fileSearchPrice = service.ToolCallPricePerThousand(modelName, dto.BuildInToolFileSearch, "")
 			dFileSearchQuota = decimal.NewFromFloat(fileSearchPrice).
 				Mul(decimal.NewFromInt(int64(fileSearchTool.CallCount))).
 				Div(decimal.NewFromInt(1000)).Mul(dGroupRatio).Mul(dQuotaPerUnit)
@@ -324,6 +356,21 @@ func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usage
 				fileSearchTool.CallCount, dFileSearchQuota.String()))
 		}
 	}
+	// code interpreter 工具计费，仅在配置了调用价格时收费
+	var dCodeInterpreterQuota decimal.Decimal
+	var codeInterpreterPrice float64
+	var codeInterpreterCallCount int
+	if relayInfo.ResponsesUsageInfo != nil {
+		if codeInterpreterTool, exists := relayInfo.ResponsesUsageInfo.BuiltInTools[dto.BuildInToolCodeInterpreter]; exists && codeInterpreterTool.CallCount > 0 {
+			codeInterpreterCallCount = codeInterpreterTool.CallCount
+			codeInterpreterPrice = service.ToolCallPricePerThousand(modelName, dto.BuildInToolCodeInterpreter, "")
+			dCodeInterpreterQuota = service.ToolCallQuota(codeInterpreterPrice, codeInterpreterCallCount, groupRatio)
+			if !dCodeInterpreterQuota.IsZero() {
+				extraContent = append(extraContent, fmt.Sprintf("Code Interpreter 调用 %d 次，调用花费 %s",
+					codeInterpreterCallCount, dCodeInterpreterQuota.String()))
+			}
+		}
+	}
 	var dImageGenerationCallQuota decimal.Decimal
 	var imageGenerationCallPrice float64
 	if ctx.GetBool("image_generation_call") {
@@ -378,7 +425,7 @@ func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usage
 			Add(imageTokensWithRatio).
 			Add(dCachedCreationTokensWithRatio)
 
-		completionQuota := dCompletionTokens.Mul(dCompletionRatio)
+		completionQuota := service.CompletionTokensWithRatio(&relayInfo.PriceData, completionTokens, reasoningTokens)
 
 		quotaCalculateDecimal = promptQuota.Add(completionQuota).Mul(ratio)
 
@@ -391,6 +438,7 @@ func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usage
 	// 添加 responses tools call 调用的配额
 	quotaCalculateDecimal = quotaCalculateDecimal.Add(dWebSearchQuota)
 	quotaCalculateDecimal = quotaCalculateDecimal.Add(dFileSearchQuota)
+	quotaCalculateDecimal = quotaCalculateDecimal.Add(dCodeInterpreterQuota)
 	// 添加 audio input 独立计费
 	quotaCalculateDecimal = quotaCalculateDecimal.Add(audioInputQuota)
 	// 添加 image generation call 计费
@@ -405,6 +453,10 @@ func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usage
 	}
 
 	quota := int(quotaCalculateDecimal.Round(0).IntPart())
+	expressionQuota, expressionInfo, useExpression := service.SettlePricingExpressionQuota(ctx, relayInfo, usage, isClaudeUsageSemantic)
+	if useExpression {
+		quota = expressionQuota
+	}
 	totalTokens := promptTokens + completionTokens
 
 	//var logContent string
@@ -443,6 +495,9 @@ func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usage
 	if adminRejectReason != "" {
 		other["reject_reason"] = adminRejectReason
 	}
+	for key, value := range expressionInfo {
+		other[key] = value
+	}
 	// For chat-based calls to the Claude model, tagging is required. Using Claude's rendering logs, the two approaches handle input rendering differently.
 	if isClaudeUsageSemantic {
 		other["claude"] = true
@@ -457,6 +512,8 @@ func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usage
 		other["cache_creation_tokens"] = cachedCreationTokens
 		other["cache_creation_ratio"] = cachedCreationRatio
 	}
+	service.AppendPromptCacheInfo(relayInfo, other, cacheTokens, cachedCreationTokens)
+	service.AppendReasoningInfo(&relayInfo.PriceData, other, reasoningTokens)
 	if !dWebSearchQuota.IsZero() {
 		if relayInfo.ResponsesUsageInfo != nil {
 			if webSearchTool, exists := relayInfo.ResponsesUsageInfo.BuiltInTools[dto.BuildInToolWebSearchPreview]; exists {
@@ -481,6 +538,10 @@ func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usage
 			other["file_search_price"] = fileSearchPrice
 		}
 	}
+	if codeInterpreterCallCount > 0 {
+		other["code_interpreter_call_count"] = codeInterpreterCallCount
+		other["code_interpreter_price"] = codeInterpreterPrice
+	}
 	if !audioInputQuota.IsZero() {
 		other["audio_input_seperate_price"] = true
 		other["audio_input_token_count"] = audioTokens
@@ -502,6 +563,8 @@ func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usage
 		UseTimeSeconds:   int(useTimeSeconds),
 		IsStream:         relayInfo.IsStream,
 		Group:            relayInfo.UsingGroup,
+		UpstreamCost:     service.CalculateRelayUpstreamCost(relayInfo, quota),
+		ReasoningTokens:  reasoningTokens,
 		Other:            other,
 	})
 }
@@ -2,10 +2,13 @@ package helper
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/service"
 	"github.com/QuantumNous/new-api/setting/operation_setting"
 	"github.com/QuantumNous/new-api/setting/ratio_setting"
 	"github.com/QuantumNous/new-api/types"
@@ -47,12 +50,62 @@ func HandleGroupRatio(ctx *gin.Context, relayInfo *relaycommon.RelayInfo) types.
 
 func ModelPriceHelper(c *gin.Context, info *relaycommon.RelayInfo, promptTokens int, meta *types.TokenCountMeta) (types.PriceData, error) {
 	modelPrice, usePrice := ratio_setting.GetModelPrice(info.OriginModelName, false)
+	// 图片生成按媒体计费配置的尺寸、质量、数量计价
+	var mediaRatios map[string]float64
+	if mediaPricing, ok := ratio_setting.GetMediaPricing(info.OriginModelName); ok && meta.Media != nil {
+		ratios, err := mediaPricing.Ratios(*meta.Media)
+		if err != nil {
+			return types.PriceData{}, err
+		}
+		if mediaPricing.Price > 0 {
+			modelPrice = mediaPricing.Price
+		}
+		usePrice = true
+		mediaRatios = ratios
+	}
+	// 本站原价，用于估算上游成本
+	listPrice, listUsePrice := modelPrice, usePrice
+	// 合同价优先于价格计划
+	contract := model.ResolveContractPrice(info.UserId, info.UserGroup, info.OriginModelName)
+	var scheduled *model.ScheduledPrice
+	if contract == nil {
+		scheduled = model.ResolveScheduledPrice(info.OriginModelName, time.Now())
+	}
+	if scheduled != nil {
+		if scheduled.HasModelPrice {
+			modelPrice, usePrice = scheduled.ModelPrice, true
+		} else if scheduled.HasModelRatio {
+			usePrice = false
+		}
+	}
+	if contract != nil {
+		switch contract.Type {
+		case model.ContractPriceTypePrice:
+			modelPrice, usePrice = contract.Value, true
+		case model.ContractPriceTypeRatio:
+			usePrice = false
+		}
+	}
 
-	groupRatioInfo := HandleGroupRatio(c, info)
+	// 计费表达式仅在价格计划和合同价未固定价格或倍率时生效，时段倍数与合同倍率仍作用于表达式结果
+	expression := ratio_setting.GetPricingExpression(info.OriginModelName)
+	if scheduled != nil && (scheduled.HasModelPrice || scheduled.HasModelRatio) {
+		expression = nil
+	}
+	if contract != nil && contract.Type != model.ContractPriceTypeMultiplier {
+		expression = nil
+	}
+	if expression != nil {
+		usePrice = false
+	}
+
+	groupRatioInfo := contractGroupRatio(HandleGroupRatio(c, info), contract)
 
 	var preConsumedQuota int
 	var modelRatio float64
 	var completionRatio float64
+	var reasoningRatio float64
+	var hasReasoningRatio bool
 	var cacheRatio float64
 	var imageRatio float64
 	var cacheCreationRatio float64
@@ -61,7 +114,26 @@ func ModelPriceHelper(c *gin.Context, info *relaycommon.RelayInfo, promptTokens
 	var audioRatio float64
 	var audioCompletionRatio float64
 	var freeModel bool
-	if !usePrice {
+	var pricingTiers []types.PricingTier
+	// 本站原价与实际计费价格（不含分组倍率）之比，无法还原原价时按实际计费价格估算
+	listPriceScale := 1.0
+	if expression != nil {
+		multiplier := 1.0
+		if scheduled != nil {
+			multiplier = scheduled.Multiplier
+		}
+		if contract != nil {
+			multiplier = contract.Multiplier()
+		}
+		if multiplier > 0 {
+			listPriceScale = 1 / multiplier
+		}
+		quota, err := service.EstimatePricingExpressionQuota(c, info, expression, common.Max(promptTokens, common.PreConsumedQuota), meta.MaxTokens, groupRatioInfo.GroupRatio, multiplier)
+		if err != nil {
+			return types.PriceData{}, err
+		}
+		preConsumedQuota = quota
+	} else if !usePrice {
 		preConsumedTokens := common.Max(promptTokens, common.PreConsumedQuota)
 		if meta.MaxTokens != 0 {
 			preConsumedTokens += meta.MaxTokens
@@ -69,6 +141,13 @@ func ModelPriceHelper(c *gin.Context, info *relaycommon.RelayInfo, promptTokens
 		var success bool
 		var matchName string
 		modelRatio, success, matchName = ratio_setting.GetModelRatio(info.OriginModelName)
+		listRatio, listRatioOk := modelRatio, success
+		if scheduled != nil && scheduled.HasModelRatio {
+			modelRatio, success = scheduled.ModelRatio, true
+		}
+		if contract != nil && contract.Type == model.ContractPriceTypeRatio {
+			modelRatio, success = contract.Value, true
+		}
 		if !success {
 			acceptUnsetRatio := false
 			if info.UserSetting.AcceptUnsetRatioModel {
@@ -79,6 +158,13 @@ func ModelPriceHelper(c *gin.Context, info *relaycommon.RelayInfo, promptTokens
 			}
 		}
 		completionRatio = ratio_setting.GetCompletionRatio(info.OriginModelName)
+		if scheduled != nil && scheduled.HasCompletionRatio {
+			completionRatio = scheduled.CompletionRatio
+		}
+		if contract != nil && contract.Type == model.ContractPriceTypeRatio && contract.CompletionRatio > 0 {
+			completionRatio = contract.CompletionRatio
+		}
+		reasoningRatio, hasReasoningRatio = ratio_setting.GetReasoningRatio(info.OriginModelName)
 		cacheRatio, _ = ratio_setting.GetCacheRatio(info.OriginModelName)
 		cacheCreationRatio, _ = ratio_setting.GetCreateCacheRatio(info.OriginModelName)
 		cacheCreationRatio5m = cacheCreationRatio
@@ -87,12 +173,54 @@ func ModelPriceHelper(c *gin.Context, info *relaycommon.RelayInfo, promptTokens
 		imageRatio, _ = ratio_setting.GetImageRatio(info.OriginModelName)
 		audioRatio = ratio_setting.GetAudioRatio(info.OriginModelName)
 		audioCompletionRatio = ratio_setting.GetAudioCompletionRatio(info.OriginModelName)
-		ratio := modelRatio * groupRatioInfo.GroupRatio
+		pricingTiers = ratio_setting.GetModelPricingTiers(info.OriginModelName)
+		if scheduled != nil && scheduled.Multiplier != 1 {
+			modelRatio *= scheduled.Multiplier
+			pricingTiers = scalePricingTiers(pricingTiers, scheduled.Multiplier)
+		}
+		if contract != nil {
+			if contract.Type == model.ContractPriceTypeRatio {
+				// 固定合同价不再按上下文长度分档
+				pricingTiers = nil
+			} else if contract.Multiplier() != 1 {
+				modelRatio *= contract.Multiplier()
+				pricingTiers = scalePricingTiers(pricingTiers, contract.Multiplier())
+			}
+		}
+		if listRatioOk && listRatio > 0 && modelRatio > 0 {
+			listPriceScale = listRatio / modelRatio
+		}
+		// 预扣时只知道提示长度，按提示 tokens 选择档位，结算时再按实际用量重新选择
+		preConsumeRatio := modelRatio
+		if tier := types.MatchPricingTier(pricingTiers, promptTokens, 0); tier != nil && tier.ModelRatio > 0 {
+			preConsumeRatio = tier.ModelRatio
+		}
+		ratio := preConsumeRatio * groupRatioInfo.GroupRatio
 		preConsumedQuota = int(float64(preConsumedTokens) * ratio)
 	} else {
-		if meta.ImagePriceRatio != 0 {
+		effectivePrice := modelPrice
+		if scheduled != nil {
+			effectivePrice *= scheduled.Multiplier
+		}
+		if contract != nil {
+			effectivePrice *= contract.Multiplier()
+		}
+		if listUsePrice && listPrice > 0 && effectivePrice > 0 {
+			listPriceScale = listPrice / effectivePrice
+		}
+		if mediaRatios != nil {
+			for _, ratio := range mediaRatios {
+				modelPrice *= ratio
+			}
+		} else if meta.ImagePriceRatio != 0 {
 			modelPrice = modelPrice * meta.ImagePriceRatio
 		}
+		if scheduled != nil {
+			modelPrice *= scheduled.Multiplier
+		}
+		if contract != nil {
+			modelPrice *= contract.Multiplier()
+		}
 		preConsumedQuota = int(modelPrice * common.QuotaPerUnit * groupRatioInfo.GroupRatio)
 	}
 
@@ -107,7 +235,7 @@ func ModelPriceHelper(c *gin.Context, info *relaycommon.RelayInfo, promptTokens
 				preConsumedQuota = 0
 				freeModel = true
 			}
-		} else {
+		} else if expression == nil {
 			if modelRatio == 0 {
 				preConsumedQuota = 0
 				freeModel = true
@@ -120,6 +248,8 @@ func ModelPriceHelper(c *gin.Context, info *relaycommon.RelayInfo, promptTokens
 		ModelPrice:           modelPrice,
 		ModelRatio:           modelRatio,
 		CompletionRatio:      completionRatio,
+		ReasoningRatio:       reasoningRatio,
+		HasReasoningRatio:    hasReasoningRatio,
 		GroupRatioInfo:       groupRatioInfo,
 		UsePrice:             usePrice,
 		CacheRatio:           cacheRatio,
@@ -130,7 +260,22 @@ func ModelPriceHelper(c *gin.Context, info *relaycommon.RelayInfo, promptTokens
 		CacheCreation5mRatio: cacheCreationRatio5m,
 		CacheCreation1hRatio: cacheCreationRatio1h,
 		QuotaToPreConsume:    preConsumedQuota,
+		PricingTiers:         pricingTiers,
+		PricingExpression:    expression,
+		ListPriceScale:       listPriceScale,
+	}
+	if scheduled != nil {
+		priceData.PriceScheduleIds = scheduled.ScheduleIds
+		priceData.PriceMultiplier = scheduled.Multiplier
+	}
+	if contract != nil {
+		priceData.ContractPriceId = contract.Id
+		priceData.PriceMultiplier = contract.Multiplier()
 	}
+	if usePrice {
+		priceData.MediaRatios = mediaRatios
+	}
+	priceData.ApplyPricingTier(promptTokens, 0)
 
 	if common.DebugEnabled {
 		println(fmt.Sprintf("model_price_helper result: %s", priceData.ToSetting()))
@@ -153,15 +298,61 @@ func ModelPriceHelperPerCall(c *gin.Context, info *relaycommon.RelayInfo) types.
 			modelPrice = defaultPrice
 		}
 	}
+	listPrice := modelPrice
+	// 按次计费只适用价格与倍率类型的合同价
+	contract := model.ResolveContractPrice(info.UserId, info.UserGroup, info.OriginModelName)
+	if contract != nil && contract.Type == model.ContractPriceTypeRatio {
+		contract = nil
+	}
+	var scheduled *model.ScheduledPrice
+	if contract == nil {
+		scheduled = model.ResolveScheduledPrice(info.OriginModelName, time.Now())
+	}
+	if scheduled != nil {
+		if scheduled.HasModelPrice {
+			modelPrice = scheduled.ModelPrice
+		}
+		modelPrice *= scheduled.Multiplier
+	}
+	if contract != nil {
+		if contract.Type == model.ContractPriceTypePrice {
+			modelPrice = contract.Value
+		}
+		modelPrice *= contract.Multiplier()
+		groupRatioInfo = contractGroupRatio(groupRatioInfo, contract)
+	}
 	quota := int(modelPrice * common.QuotaPerUnit * groupRatioInfo.GroupRatio)
 	priceData := types.PerCallPriceData{
 		ModelPrice:     modelPrice,
 		Quota:          quota,
 		GroupRatioInfo: groupRatioInfo,
+		ListPriceScale: 1,
+	}
+	if listPrice > 0 && modelPrice > 0 {
+		priceData.ListPriceScale = listPrice / modelPrice
+	}
+	if scheduled != nil {
+		priceData.PriceScheduleIds = scheduled.ScheduleIds
+		priceData.PriceMultiplier = scheduled.Multiplier
+	}
+	if contract != nil {
+		priceData.ContractPriceId = contract.Id
+		priceData.PriceMultiplier = contract.Multiplier()
 	}
 	return priceData
 }
 
+// contractGroupRatio 合同价即用户的最终价格，命中时不再叠加分组倍率
+func contractGroupRatio(groupRatioInfo types.GroupRatioInfo, contract *model.ContractPrice) types.GroupRatioInfo {
+	if contract == nil {
+		return groupRatioInfo
+	}
+	return types.GroupRatioInfo{
+		GroupRatio:        1,
+		GroupSpecialRatio: -1,
+	}
+}
+
 func ContainPriceOrRatio(modelName string) bool {
 	_, ok := ratio_setting.GetModelPrice(modelName, false)
 	if ok {
@@ -171,5 +362,20 @@ func ContainPriceOrRatio(modelName string) bool {
 	if ok {
 		return true
 	}
-	return false
+	return ratio_setting.GetPricingExpression(modelName) != nil
+}
+
+// scalePricingTiers 将价格计划的倍数同样作用于分档价格中的模型倍率
+func scalePricingTiers(tiers []types.PricingTier, multiplier float64) []types.PricingTier {
+	if len(tiers) == 0 {
+		return tiers
+	}
+	scaled := make([]types.PricingTier, len(tiers))
+	copy(scaled, tiers)
+	for i := range scaled {
+		if scaled[i].ModelRatio > 0 {
+			scaled[i].ModelRatio *= multiplier
+		}
+	}
+	return scaled
 }
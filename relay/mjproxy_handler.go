@@ -196,7 +196,7 @@ func RelaySwapFace(c *gin.Context, info *relaycommon.RelayInfo) *dto.MidjourneyR
 		}
 	}
 
-	if userQuota-priceData.Quota < 0 {
+	if !model.UserQuotaSufficient(info.UserId, userQuota, priceData.Quota) {
 		return &dto.MidjourneyResponse{
 			Code:        4,
 			Description: "quota_not_enough",
@@ -219,15 +219,17 @@ func RelaySwapFace(c *gin.Context, info *relaycommon.RelayInfo) *dto.MidjourneyR
 			tokenName := c.GetString("token_name")
 			logContent := fmt.Sprintf("模型固定价格 %.2f，分组倍率 %.2f，操作 %s", priceData.ModelPrice, priceData.GroupRatioInfo.GroupRatio, constant.MjActionSwapFace)
 			other := service.GenerateMjOtherInfo(info, priceData)
+			upstreamCost := service.CalculateUpstreamCost(info.ChannelId, modelName, priceData.Quota, priceData.GroupRatioInfo.GroupRatio, priceData.ListPriceScale)
 			model.RecordConsumeLog(c, info.UserId, model.RecordConsumeLogParams{
-				ChannelId: info.ChannelId,
-				ModelName: modelName,
-				TokenName: tokenName,
-				Quota:     priceData.Quota,
-				Content:   logContent,
-				TokenId:   info.TokenId,
-				Group:     info.UsingGroup,
-				Other:     other,
+				ChannelId:    info.ChannelId,
+				ModelName:    modelName,
+				TokenName:    tokenName,
+				Quota:        priceData.Quota,
+				Content:      logContent,
+				TokenId:      info.TokenId,
+				Group:        info.UsingGroup,
+				Other:        other,
+				UpstreamCost: upstreamCost,
 			})
 			model.UpdateUserUsedQuotaAndRequestCount(info.UserId, priceData.Quota)
 			model.UpdateChannelUsedQuota(info.ChannelId, priceData.Quota)
@@ -497,7 +499,7 @@ func RelayMidjourneySubmit(c *gin.Context, relayInfo *relaycommon.RelayInfo) *dt
 		}
 	}
 
-	if consumeQuota && userQuota-priceData.Quota < 0 {
+	if consumeQuota && !model.UserQuotaSufficient(relayInfo.UserId, userQuota, priceData.Quota) {
 		return &dto.MidjourneyResponse{
 			Code:        4,
 			Description: "quota_not_enough",
@@ -519,15 +521,17 @@ func RelayMidjourneySubmit(c *gin.Context, relayInfo *relaycommon.RelayInfo) *dt
 			tokenName := c.GetString("token_name")
 			logContent := fmt.Sprintf("模型固定价格 %.2f，分组倍率 %.2f，操作 %s，ID %s", priceData.ModelPrice, priceData.GroupRatioInfo.GroupRatio, midjRequest.Action, midjResponse.Result)
 			other := service.GenerateMjOtherInfo(relayInfo, priceData)
+			upstreamCost := service.CalculateUpstreamCost(relayInfo.ChannelId, modelName, priceData.Quota, priceData.GroupRatioInfo.GroupRatio, priceData.ListPriceScale)
 			model.RecordConsumeLog(c, relayInfo.UserId, model.RecordConsumeLogParams{
-				ChannelId: relayInfo.ChannelId,
-				ModelName: modelName,
-				TokenName: tokenName,
-				Quota:     priceData.Quota,
-				Content:   logContent,
-				TokenId:   relayInfo.TokenId,
-				Group:     relayInfo.UsingGroup,
-				Other:     other,
+				ChannelId:    relayInfo.ChannelId,
+				ModelName:    modelName,
+				TokenName:    tokenName,
+				Quota:        priceData.Quota,
+				Content:      logContent,
+				TokenId:      relayInfo.TokenId,
+				Group:        relayInfo.UsingGroup,
+				Other:        other,
+				UpstreamCost: upstreamCost,
 			})
 			model.UpdateUserUsedQuotaAndRequestCount(relayInfo.UserId, priceData.Quota)
 			model.UpdateChannelUsedQuota(relayInfo.ChannelId, priceData.Quota)
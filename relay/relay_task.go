@@ -19,6 +19,7 @@ import (
 	relayconstant "github.com/QuantumNous/new-api/relay/constant"
 	"github.com/QuantumNous/new-api/service"
 	"github.com/QuantumNous/new-api/setting/ratio_setting"
+	"github.com/QuantumNous/new-api/types"
 
 	"github.com/gin-gonic/gin"
 )
@@ -47,6 +48,7 @@ func RelayTaskSubmit(c *gin.Context, info *relaycommon.RelayInfo) (taskErr *dto.
 	}
 
 	platform := constant.TaskPlatform(c.GetString("platform"))
+	var mediaParams *types.MediaParams
 
 	// 获取原始任务信息
 	if info.OriginTaskID != "" {
@@ -118,6 +120,7 @@ func RelayTaskSubmit(c *gin.Context, info *relaycommon.RelayInfo) (taskErr *dto.
 			if sizeStr == "1792x1024" || sizeStr == "1024x1792" {
 				info.PriceData.OtherRatios["size"] = 1.666667
 			}
+			mediaParams = &types.MediaParams{Seconds: float64(seconds), Size: sizeStr}
 		}
 	}
 	if platform == "" {
@@ -158,6 +161,31 @@ func RelayTaskSubmit(c *gin.Context, info *relaycommon.RelayInfo) (taskErr *dto.
 		}
 	}
 
+	// 配置了媒体计费的模型按时长、分辨率等参数计价，替代适配器写入的临时倍率
+	var mediaRatios map[string]float64
+	var billedSeconds float64
+	if mediaPricing, ok := ratio_setting.GetMediaPricing(modelName); ok {
+		if mediaParams == nil {
+			params, err := getTaskMediaParams(c, adaptor, info)
+			if err != nil {
+				return service.TaskErrorWrapperLocal(err, "invalid_request", http.StatusBadRequest)
+			}
+			mediaParams = &params
+		}
+		ratios, err := mediaPricing.Ratios(*mediaParams)
+		if err != nil {
+			return service.TaskErrorWrapperLocal(err, "invalid_request", http.StatusBadRequest)
+		}
+		if mediaPricing.Price > 0 {
+			modelPrice = mediaPricing.Price
+		}
+		if mediaPricing.Unit == types.MediaPricingUnitSecond {
+			billedSeconds = mediaPricing.Seconds(*mediaParams)
+		}
+		mediaRatios = ratios
+		info.PriceData.OtherRatios = ratios
+	}
+
 	// 预扣
 	groupRatio := ratio_setting.GetGroupRatio(info.UsingGroup)
 	var ratio float64
@@ -184,7 +212,7 @@ func RelayTaskSubmit(c *gin.Context, info *relaycommon.RelayInfo) (taskErr *dto.
 		return
 	}
 	quota := int(ratio * common.QuotaPerUnit)
-	if userQuota-quota < 0 {
+	if !model.UserQuotaSufficient(info.UserId, userQuota, quota) {
 		taskErr = service.TaskErrorWrapperLocal(errors.New("user quota is not enough"), "quota_not_enough", http.StatusForbidden)
 		return
 	}
@@ -195,6 +223,10 @@ func RelayTaskSubmit(c *gin.Context, info *relaycommon.RelayInfo) (taskErr *dto.
 		taskErr = service.TaskErrorWrapper(err, "build_request_failed", http.StatusInternalServerError)
 		return
 	}
+	if mediaRatios != nil {
+		// 部分适配器构建请求时会写入自己的倍率，日志需与实际扣费一致
+		info.PriceData.OtherRatios = mediaRatios
+	}
 	// do request
 	resp, err := adaptor.DoRequest(c, info, requestBody)
 	if err != nil {
@@ -245,18 +277,21 @@ func RelayTaskSubmit(c *gin.Context, info *relaycommon.RelayInfo) (taskErr *dto.
 				}
 				other["model_price"] = modelPrice
 				other["group_ratio"] = groupRatio
+				effectiveGroupRatio := groupRatio
 				if hasUserGroupRatio {
 					other["user_group_ratio"] = userGroupRatio
+					effectiveGroupRatio = userGroupRatio
 				}
 				model.RecordConsumeLog(c, info.UserId, model.RecordConsumeLogParams{
-					ChannelId: info.ChannelId,
-					ModelName: modelName,
-					TokenName: tokenName,
-					Quota:     quota,
-					Content:   logContent,
-					TokenId:   info.TokenId,
-					Group:     info.UsingGroup,
-					Other:     other,
+					ChannelId:    info.ChannelId,
+					ModelName:    modelName,
+					TokenName:    tokenName,
+					Quota:        quota,
+					Content:      logContent,
+					TokenId:      info.TokenId,
+					Group:        info.UsingGroup,
+					UpstreamCost: service.CalculateUpstreamCost(info.ChannelId, modelName, quota, effectiveGroupRatio, 0),
+					Other:        other,
 				})
 				model.UpdateUserUsedQuotaAndRequestCount(info.UserId, quota)
 				model.UpdateChannelUsedQuota(info.ChannelId, quota)
@@ -273,6 +308,7 @@ func RelayTaskSubmit(c *gin.Context, info *relaycommon.RelayInfo) (taskErr *dto.
 	task := model.InitTask(platform, info)
 	task.TaskID = taskID
 	task.Quota = quota
+	task.Properties.BilledSeconds = billedSeconds
 	task.Data = taskData
 	task.Action = info.Action
 	err = task.Insert()
@@ -283,6 +319,18 @@ func RelayTaskSubmit(c *gin.Context, info *relaycommon.RelayInfo) (taskErr *dto.
 	return nil
 }
 
+// getTaskMediaParams 优先使用适配器解析的计费参数
+func getTaskMediaParams(c *gin.Context, adaptor channel.TaskAdaptor, info *relaycommon.RelayInfo) (types.MediaParams, error) {
+	if provider, ok := adaptor.(channel.TaskMediaParamsProvider); ok {
+		return provider.GetMediaParams(c, info)
+	}
+	req, err := relaycommon.GetTaskRequest(c)
+	if err != nil {
+		return types.MediaParams{}, err
+	}
+	return relaycommon.TaskMediaParams(req), nil
+}
+
 var fetchRespBuilders = map[int]func(c *gin.Context) (respBody []byte, taskResp *dto.TaskError){
 	relayconstant.RelayModeSunoFetchByID:  sunoFetchByIDRespBodyBuilder,
 	relayconstant.RelayModeSunoFetch:      sunoFetchRespBodyBuilder,
@@ -0,0 +1,139 @@
+package relay
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/relay/channel"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	relayconstant "github.com/QuantumNous/new-api/relay/constant"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/model_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// structuredOutputWriter 缓存上游响应，校验通过后才写给客户端
+type structuredOutputWriter struct {
+	gin.ResponseWriter
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newStructuredOutputWriter(w gin.ResponseWriter) *structuredOutputWriter {
+	return &structuredOutputWriter{
+		ResponseWriter: w,
+		header:         w.Header().Clone(),
+		status:         http.StatusOK,
+	}
+}
+
+func (w *structuredOutputWriter) Header() http.Header         { return w.header }
+func (w *structuredOutputWriter) WriteHeader(code int)        { w.status = code }
+func (w *structuredOutputWriter) WriteHeaderNow()             {}
+func (w *structuredOutputWriter) Write(b []byte) (int, error) { return w.body.Write(b) }
+func (w *structuredOutputWriter) WriteString(s string) (int, error) {
+	return w.body.WriteString(s)
+}
+func (w *structuredOutputWriter) Flush()        {}
+func (w *structuredOutputWriter) Status() int   { return w.status }
+func (w *structuredOutputWriter) Size() int     { return w.body.Len() }
+func (w *structuredOutputWriter) Written() bool { return w.body.Len() > 0 }
+
+// prepareStructuredOutput 判断本次请求是否需要网关校验结构化输出，仅支持非流式 chat completions
+func prepareStructuredOutput(c *gin.Context, info *relaycommon.RelayInfo, request *dto.GeneralOpenAIRequest) *relaycommon.StructuredOutputState {
+	if request.Stream || info.RelayMode != relayconstant.RelayModeChatCompletions {
+		return nil
+	}
+	if !model_setting.ShouldEnforceStructuredOutput(info.OriginModelName, info.ChannelOtherSettings.EnforceStructuredOutput) {
+		return nil
+	}
+	if info.StructuredOutput != nil {
+		return info.StructuredOutput
+	}
+	schema, name, ok, err := service.ParseStructuredOutputSchema(request.ResponseFormat)
+	if err != nil {
+		logger.LogWarn(c, "skip structured output validation: "+err.Error())
+		return nil
+	}
+	if !ok {
+		return nil
+	}
+	info.StructuredOutput = &relaycommon.StructuredOutputState{
+		Schema:     schema,
+		SchemaName: name,
+	}
+	return info.StructuredOutput
+}
+
+// doStructuredOutputRequest 发送请求并校验回复，校验失败时按配置在当前渠道重试，
+// 或返回可重试的错误交由上层切换渠道
+func doStructuredOutputRequest(c *gin.Context, info *relaycommon.RelayInfo, adaptor channel.Adaptor, requestBody io.Reader, state *relaycommon.StructuredOutputState) (any, *types.NewAPIError) {
+	body, err := io.ReadAll(requestBody)
+	if err != nil {
+		return nil, types.NewErrorWithStatusCode(err, types.ErrorCodeReadRequestBodyFailed, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+	}
+	settings := model_setting.GetStructuredOutputSettings()
+	for {
+		writer := newStructuredOutputWriter(c.Writer)
+		c.Writer = writer
+		usage, newApiErr := doTextRequest(c, info, adaptor, bytes.NewReader(body))
+		c.Writer = writer.ResponseWriter
+		if newApiErr != nil {
+			return nil, newApiErr
+		}
+
+		content, validateErr := service.ValidateStructuredOutputResponse(state.Schema, writer.body.Bytes())
+		if validateErr == nil {
+			service.IOCopyBytesGracefully(c, &http.Response{StatusCode: writer.status, Header: writer.header}, writer.body.Bytes())
+			return usage, nil
+		}
+
+		state.RecordFailure(usage.(*dto.Usage), content, validateErr)
+		state.LastStatus = writer.status
+		state.LastHeader = writer.header
+		state.LastBody = writer.body.Bytes()
+		logger.LogWarn(c, fmt.Sprintf("structured output validation failed (channel #%d, failures %d): %s", info.ChannelId, state.Failures, validateErr.Error()))
+
+		if state.Failures > settings.MaxRetries {
+			return nil, service.NewStructuredOutputError(state, false)
+		}
+		if !settings.RetrySameChannel {
+			return nil, service.NewStructuredOutputError(state, true)
+		}
+	}
+}
+
+// chargeStructuredOutputFailures 按计费策略把校验失败尝试的用量并入最终结算
+func chargeStructuredOutputFailures(info *relaycommon.RelayInfo, usage *dto.Usage) []string {
+	state := info.StructuredOutput
+	if state == nil || state.Failures == 0 || usage == nil {
+		return nil
+	}
+	if !model_setting.GetStructuredOutputSettings().ChargeFailedAttempts() {
+		return []string{fmt.Sprintf("结构化输出校验失败 %d 次，失败尝试不计费", state.Failures)}
+	}
+	usage.PromptTokens += state.FailedUsage.PromptTokens
+	usage.CompletionTokens += state.FailedUsage.CompletionTokens
+	usage.TotalTokens += state.FailedUsage.TotalTokens
+	usage.PromptTokensDetails.CachedTokens += state.FailedUsage.PromptTokensDetails.CachedTokens
+	usage.PromptTokensDetails.CachedCreationTokens += state.FailedUsage.PromptTokensDetails.CachedCreationTokens
+	return []string{fmt.Sprintf("结构化输出校验失败 %d 次，已计入失败尝试用量", state.Failures)}
+}
+
+// SettleStructuredOutputFailure 结构化输出最终由修复模型给出或彻底失败时，按计费策略结算失败尝试的费用。
+// 不收费时由调用方退还预扣费。
+func SettleStructuredOutputFailure(c *gin.Context, info *relaycommon.RelayInfo) {
+	state := info.StructuredOutput
+	if state == nil || state.Failures == 0 || !model_setting.GetStructuredOutputSettings().ChargeFailedAttempts() {
+		return
+	}
+	usage := state.FailedUsage
+	postConsumeQuota(c, info, &usage, fmt.Sprintf("结构化输出校验失败 %d 次", state.Failures))
+}
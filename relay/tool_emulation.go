@@ -0,0 +1,521 @@
+package relay
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// toolEmulationWriter 把模拟工具调用模式下模型输出的 <tool_call> 块改写为
+// OpenAI tool_calls / Claude tool_use，流式响应按 SSE 事件逐个改写，非流式响应整体缓存后改写
+type toolEmulationWriter struct {
+	gin.ResponseWriter
+	format types.RelayFormat
+	stream bool
+
+	// 非流式
+	header http.Header
+	status int
+	body   bytes.Buffer
+
+	// 流式
+	pending bytes.Buffer
+	openai  *openAIToolEmulationStream
+	claude  *claudeToolEmulationStream
+}
+
+func newToolEmulationWriter(c *gin.Context, info *relaycommon.RelayInfo) *toolEmulationWriter {
+	w := &toolEmulationWriter{
+		ResponseWriter: c.Writer,
+		format:         info.RelayFormat,
+		stream:         info.IsStream,
+	}
+	if w.stream {
+		if w.format == types.RelayFormatClaude {
+			w.claude = &claudeToolEmulationStream{indexMap: make(map[int]int), textBlocks: make(map[int]bool)}
+		} else {
+			w.openai = &openAIToolEmulationStream{}
+		}
+	} else {
+		w.header = c.Writer.Header().Clone()
+		w.status = http.StatusOK
+	}
+	c.Writer = w
+	return w
+}
+
+func (w *toolEmulationWriter) Header() http.Header {
+	if w.stream {
+		return w.ResponseWriter.Header()
+	}
+	return w.header
+}
+
+func (w *toolEmulationWriter) WriteHeader(code int) {
+	if w.stream {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	w.status = code
+}
+
+func (w *toolEmulationWriter) WriteHeaderNow() {
+	if w.stream {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *toolEmulationWriter) Write(b []byte) (int, error) {
+	if !w.stream {
+		return w.body.Write(b)
+	}
+	w.pending.Write(b)
+	for {
+		data := w.pending.Bytes()
+		idx := bytes.Index(data, []byte("\n\n"))
+		if idx < 0 {
+			break
+		}
+		event := string(data[:idx])
+		w.pending.Next(idx + 2)
+		if err := w.writeEvents(w.transformEvent(event)); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+func (w *toolEmulationWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *toolEmulationWriter) Flush() {
+	if w.stream {
+		w.ResponseWriter.Flush()
+	}
+}
+
+func (w *toolEmulationWriter) Status() int {
+	if w.stream {
+		return w.ResponseWriter.Status()
+	}
+	return w.status
+}
+
+func (w *toolEmulationWriter) Size() int {
+	if w.stream {
+		return w.ResponseWriter.Size()
+	}
+	return w.body.Len()
+}
+
+func (w *toolEmulationWriter) Written() bool {
+	if w.stream {
+		return w.ResponseWriter.Written()
+	}
+	return w.body.Len() > 0
+}
+
+// finish 还原 c.Writer 并输出剩余内容，discard 为 true 时丢弃缓存的非流式响应
+func (w *toolEmulationWriter) finish(c *gin.Context, discard bool) {
+	c.Writer = w.ResponseWriter
+	if w.stream {
+		if rest := strings.TrimSpace(w.pending.String()); rest != "" {
+			_ = w.writeEvents(w.transformEvent(rest))
+		}
+		var events []sseEvent
+		if w.openai != nil {
+			events = w.openai.flush()
+		} else {
+			events = w.claude.flush()
+		}
+		_ = w.writeEvents(events)
+		w.ResponseWriter.Flush()
+		return
+	}
+	if discard {
+		return
+	}
+	body := w.body.Bytes()
+	if w.format == types.RelayFormatClaude {
+		body = rewriteClaudeToolEmulationResponse(body)
+	} else {
+		body = rewriteOpenAIToolEmulationResponse(body)
+	}
+	service.IOCopyBytesGracefully(c, &http.Response{StatusCode: w.status, Header: w.header}, body)
+}
+
+type sseEvent struct {
+	name string
+	data string
+	raw  string // 非 data 事件（如 : PING）原样输出
+}
+
+func parseSSEEvent(event string) sseEvent {
+	var e sseEvent
+	for _, line := range strings.Split(strings.Trim(event, "\n"), "\n") {
+		switch {
+		case strings.HasPrefix(line, "event:"):
+			e.name = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			e.data = strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		}
+	}
+	if e.data == "" {
+		e.raw = strings.Trim(event, "\n")
+	}
+	return e
+}
+
+func (w *toolEmulationWriter) transformEvent(event string) []sseEvent {
+	e := parseSSEEvent(event)
+	if e.raw != "" {
+		return []sseEvent{e}
+	}
+	if w.openai != nil {
+		return w.openai.handle(e)
+	}
+	return w.claude.handle(e)
+}
+
+func (w *toolEmulationWriter) writeEvents(events []sseEvent) error {
+	for _, e := range events {
+		var sb strings.Builder
+		switch {
+		case e.raw != "":
+			sb.WriteString(e.raw)
+		case e.name != "":
+			sb.WriteString("event: " + e.name + "\ndata: " + e.data)
+		default:
+			sb.WriteString("data: " + e.data)
+		}
+		sb.WriteString("\n\n")
+		if _, err := w.ResponseWriter.Write([]byte(sb.String())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func newEmulatedToolCallId(format types.RelayFormat) string {
+	if format == types.RelayFormatClaude {
+		return "toolu_" + common.GetRandomString(24)
+	}
+	return "call_" + common.GetRandomString(24)
+}
+
+// openAIToolEmulationStream 改写 chat.completion.chunk 中的 delta.content
+type openAIToolEmulationStream struct {
+	parser    service.ToolEmulationParser
+	template  string
+	toolIndex int
+	flushed   bool
+}
+
+func (s *openAIToolEmulationStream) handle(e sseEvent) []sseEvent {
+	if e.data == "[DONE]" {
+		return append(s.flush(), e)
+	}
+	chunk := gjson.Parse(e.data)
+	if !chunk.Get("choices.0").Exists() {
+		// 仅包含 usage 的末尾数据块
+		return append(s.flush(), e)
+	}
+	s.template = e.data
+	content := chunk.Get("choices.0.delta.content")
+	finishReason := chunk.Get("choices.0.finish_reason").String()
+
+	var segments []service.ToolEmulationSegment
+	if content.Type == gjson.String && content.String() != "" {
+		segments = s.parser.Feed(content.String())
+	}
+	if finishReason != "" {
+		segments = append(segments, s.parser.Flush()...)
+		s.flushed = true
+	}
+
+	base, _ := sjson.Delete(e.data, "choices.0.delta.content")
+	// 拆分出的后续数据块不再重复 role、reasoning_content 等字段
+	emptyDelta, _ := sjson.Set(base, "choices.0.delta", map[string]any{})
+	var events []sseEvent
+	for i, segment := range segments {
+		segmentBase := base
+		if i > 0 {
+			segmentBase = emptyDelta
+		}
+		chunkData := s.segmentChunk(segmentBase, segment)
+		if i < len(segments)-1 || finishReason == "" {
+			chunkData, _ = sjson.Set(chunkData, "choices.0.finish_reason", nil)
+		}
+		events = append(events, sseEvent{data: s.rewriteFinishReason(chunkData)})
+	}
+	if len(segments) == 0 && (finishReason != "" || !content.Exists() || openAIChunkHasOtherDelta(base)) {
+		events = append(events, sseEvent{data: s.rewriteFinishReason(base)})
+	}
+	return events
+}
+
+func (s *openAIToolEmulationStream) segmentChunk(base string, segment service.ToolEmulationSegment) string {
+	if segment.Call == nil {
+		chunkData, _ := sjson.Set(base, "choices.0.delta.content", segment.Text)
+		return chunkData
+	}
+	chunkData, _ := sjson.Set(base, "choices.0.delta.tool_calls", []map[string]any{
+		{
+			"index": s.toolIndex,
+			"id":    newEmulatedToolCallId(types.RelayFormatOpenAI),
+			"type":  "function",
+			"function": map[string]any{
+				"name":      segment.Call.Name,
+				"arguments": segment.Call.Arguments,
+			},
+		},
+	})
+	s.toolIndex++
+	return chunkData
+}
+
+func (s *openAIToolEmulationStream) rewriteFinishReason(chunkData string) string {
+	if s.toolIndex > 0 && gjson.Get(chunkData, "choices.0.finish_reason").String() == "stop" {
+		chunkData, _ = sjson.Set(chunkData, "choices.0.finish_reason", "tool_calls")
+	}
+	return chunkData
+}
+
+// flush 上游未返回 finish_reason 就结束时输出暂存的内容
+func (s *openAIToolEmulationStream) flush() []sseEvent {
+	if s.flushed || s.template == "" {
+		return nil
+	}
+	s.flushed = true
+	base, _ := sjson.Delete(s.template, "choices.0.delta")
+	base, _ = sjson.Set(base, "choices.0.finish_reason", nil)
+	base, _ = sjson.Delete(base, "usage")
+	var events []sseEvent
+	for _, segment := range s.parser.Flush() {
+		events = append(events, sseEvent{data: s.segmentChunk(base, segment)})
+	}
+	return events
+}
+
+func openAIChunkHasOtherDelta(chunkData string) bool {
+	delta := gjson.Get(chunkData, "choices.0.delta")
+	hasOther := false
+	delta.ForEach(func(key, value gjson.Result) bool {
+		if value.Type != gjson.Null && value.String() != "" {
+			hasOther = true
+			return false
+		}
+		return true
+	})
+	return hasOther || gjson.Get(chunkData, "usage").Exists()
+}
+
+// claudeToolEmulationStream 改写 Claude SSE 中的文本块，工具调用作为新的 tool_use 块输出，并重排块序号
+type claudeToolEmulationStream struct {
+	parser     service.ToolEmulationParser
+	nextIndex  int
+	indexMap   map[int]int
+	textBlocks map[int]bool
+	textOpen   bool
+	textIndex  int
+	hasCalls   bool
+}
+
+func (s *claudeToolEmulationStream) handle(e sseEvent) []sseEvent {
+	data := gjson.Parse(e.data)
+	index := int(data.Get("index").Int())
+	switch data.Get("type").String() {
+	case "content_block_start":
+		if data.Get("content_block.type").String() == "text" {
+			s.textBlocks[index] = true
+			return s.emit(s.parser.Feed(data.Get("content_block.text").String()))
+		}
+		events := s.emit(s.parser.Flush())
+		events = append(events, s.closeText()...)
+		s.indexMap[index] = s.nextIndex
+		s.nextIndex++
+		return append(events, s.reindex(e, index))
+	case "content_block_delta":
+		if s.textBlocks[index] {
+			if data.Get("delta.type").String() == "text_delta" {
+				return s.emit(s.parser.Feed(data.Get("delta.text").String()))
+			}
+			return nil
+		}
+		return []sseEvent{s.reindex(e, index)}
+	case "content_block_stop":
+		if s.textBlocks[index] {
+			return append(s.emit(s.parser.Flush()), s.closeText()...)
+		}
+		return []sseEvent{s.reindex(e, index)}
+	case "message_delta":
+		events := append(s.emit(s.parser.Flush()), s.closeText()...)
+		if s.hasCalls && data.Get("delta.stop_reason").String() == "end_turn" {
+			e.data, _ = sjson.Set(e.data, "delta.stop_reason", "tool_use")
+		}
+		return append(events, e)
+	default:
+		return []sseEvent{e}
+	}
+}
+
+func (s *claudeToolEmulationStream) reindex(e sseEvent, index int) sseEvent {
+	if mapped, ok := s.indexMap[index]; ok {
+		e.data, _ = sjson.Set(e.data, "index", mapped)
+	}
+	return e
+}
+
+func (s *claudeToolEmulationStream) emit(segments []service.ToolEmulationSegment) []sseEvent {
+	var events []sseEvent
+	for _, segment := range segments {
+		if segment.Call == nil {
+			if segment.Text == "" {
+				continue
+			}
+			if !s.textOpen {
+				s.textOpen = true
+				s.textIndex = s.nextIndex
+				s.nextIndex++
+				events = append(events, claudeEvent("content_block_start", map[string]any{
+					"index":         s.textIndex,
+					"content_block": map[string]any{"type": "text", "text": ""},
+				}))
+			}
+			events = append(events, claudeEvent("content_block_delta", map[string]any{
+				"index": s.textIndex,
+				"delta": map[string]any{"type": "text_delta", "text": segment.Text},
+			}))
+			continue
+		}
+		events = append(events, s.closeText()...)
+		index := s.nextIndex
+		s.nextIndex++
+		s.hasCalls = true
+		events = append(events,
+			claudeEvent("content_block_start", map[string]any{
+				"index": index,
+				"content_block": map[string]any{
+					"type":  "tool_use",
+					"id":    newEmulatedToolCallId(types.RelayFormatClaude),
+					"name":  segment.Call.Name,
+					"input": map[string]any{},
+				},
+			}),
+			claudeEvent("content_block_delta", map[string]any{
+				"index": index,
+				"delta": map[string]any{"type": "input_json_delta", "partial_json": segment.Call.Arguments},
+			}),
+			claudeEvent("content_block_stop", map[string]any{"index": index}),
+		)
+	}
+	return events
+}
+
+func (s *claudeToolEmulationStream) closeText() []sseEvent {
+	if !s.textOpen {
+		return nil
+	}
+	s.textOpen = false
+	return []sseEvent{claudeEvent("content_block_stop", map[string]any{"index": s.textIndex})}
+}
+
+func (s *claudeToolEmulationStream) flush() []sseEvent {
+	return append(s.emit(s.parser.Flush()), s.closeText()...)
+}
+
+func claudeEvent(eventType string, payload map[string]any) sseEvent {
+	payload["type"] = eventType
+	data, _ := common.Marshal(payload)
+	return sseEvent{name: eventType, data: string(data)}
+}
+
+func rewriteOpenAIToolEmulationResponse(body []byte) []byte {
+	choices := gjson.GetBytes(body, "choices")
+	if !choices.IsArray() {
+		return body
+	}
+	for i, choice := range choices.Array() {
+		content := choice.Get("message.content")
+		if content.Type != gjson.String {
+			continue
+		}
+		text, calls := service.ParseEmulatedToolCalls(content.String())
+		if len(calls) == 0 {
+			continue
+		}
+		toolCalls := make([]map[string]any, 0, len(calls))
+		for _, call := range calls {
+			toolCalls = append(toolCalls, map[string]any{
+				"id":   newEmulatedToolCallId(types.RelayFormatOpenAI),
+				"type": "function",
+				"function": map[string]any{
+					"name":      call.Name,
+					"arguments": call.Arguments,
+				},
+			})
+		}
+		var newContent any
+		if text != "" {
+			newContent = text
+		}
+		body, _ = sjson.SetBytes(body, fmt.Sprintf("choices.%d.message.content", i), newContent)
+		body, _ = sjson.SetBytes(body, fmt.Sprintf("choices.%d.message.tool_calls", i), toolCalls)
+		body, _ = sjson.SetBytes(body, fmt.Sprintf("choices.%d.finish_reason", i), "tool_calls")
+	}
+	return body
+}
+
+func rewriteClaudeToolEmulationResponse(body []byte) []byte {
+	content := gjson.GetBytes(body, "content")
+	if !content.IsArray() {
+		return body
+	}
+	hasCalls := false
+	newContent := make([]any, 0, len(content.Array()))
+	for _, block := range content.Array() {
+		if block.Get("type").String() != "text" {
+			newContent = append(newContent, json.RawMessage(block.Raw))
+			continue
+		}
+		text, calls := service.ParseEmulatedToolCalls(block.Get("text").String())
+		if len(calls) == 0 {
+			newContent = append(newContent, json.RawMessage(block.Raw))
+			continue
+		}
+		hasCalls = true
+		if text != "" {
+			newContent = append(newContent, map[string]any{"type": "text", "text": text})
+		}
+		for _, call := range calls {
+			var input any = map[string]any{}
+			_ = common.UnmarshalJsonStr(call.Arguments, &input)
+			newContent = append(newContent, map[string]any{
+				"type":  "tool_use",
+				"id":    newEmulatedToolCallId(types.RelayFormatClaude),
+				"name":  call.Name,
+				"input": input,
+			})
+		}
+	}
+	if !hasCalls {
+		return body
+	}
+	body, _ = sjson.SetBytes(body, "content", newContent)
+	if gjson.GetBytes(body, "stop_reason").String() == "end_turn" {
+		body, _ = sjson.SetBytes(body, "stop_reason", "tool_use")
+	}
+	return body
+}
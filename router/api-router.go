@@ -47,6 +47,8 @@ func SetApiRouter(router *gin.Engine) {
 
 		apiRouter.POST("/stripe/webhook", controller.StripeWebhook)
 		apiRouter.POST("/creem/webhook", controller.CreemWebhook)
+		apiRouter.POST("/paypal/webhook", controller.PayPalWebhook)
+		apiRouter.GET("/paypal/return", controller.PayPalReturn)
 
 		// Universal secure verification routes
 		apiRouter.POST("/verify", middleware.UserAuth(), middleware.CriticalRateLimit(), controller.UniversalVerify)
@@ -88,6 +90,9 @@ func SetApiRouter(router *gin.Engine) {
 				selfRoute.POST("/stripe/pay", middleware.CriticalRateLimit(), controller.RequestStripePay)
 				selfRoute.POST("/stripe/amount", controller.RequestStripeAmount)
 				selfRoute.POST("/creem/pay", middleware.CriticalRateLimit(), controller.RequestCreemPay)
+				selfRoute.POST("/paypal/pay", middleware.CriticalRateLimit(), controller.RequestPayPalPay)
+				selfRoute.POST("/paypal/amount", controller.RequestPayPalAmount)
+				selfRoute.POST("/coupon/preview", controller.PreviewCoupon)
 				selfRoute.POST("/aff_transfer", controller.TransferAffQuota)
 				selfRoute.PUT("/setting", controller.UpdateUserSetting)
 
@@ -113,6 +118,7 @@ func SetApiRouter(router *gin.Engine) {
 				adminRoute.GET("/", controller.GetAllUsers)
 				adminRoute.GET("/topup", controller.GetAllTopUps)
 				adminRoute.POST("/topup/complete", controller.AdminCompleteTopUp)
+				adminRoute.POST("/topup/refund", controller.AdminRefundTopUp)
 				adminRoute.GET("/search", controller.SearchUsers)
 				adminRoute.GET("/:id", controller.GetUser)
 				adminRoute.POST("/", controller.CreateUser)
@@ -137,6 +143,7 @@ func SetApiRouter(router *gin.Engine) {
 			subscriptionRoute.POST("/epay/pay", middleware.CriticalRateLimit(), controller.SubscriptionRequestEpay)
 			subscriptionRoute.POST("/stripe/pay", middleware.CriticalRateLimit(), controller.SubscriptionRequestStripePay)
 			subscriptionRoute.POST("/creem/pay", middleware.CriticalRateLimit(), controller.SubscriptionRequestCreemPay)
+			subscriptionRoute.POST("/paypal/pay", middleware.CriticalRateLimit(), controller.SubscriptionRequestPayPalPay)
 		}
 		subscriptionAdminRoute := apiRouter.Group("/subscription/admin")
 		subscriptionAdminRoute.Use(middleware.AdminAuth())
@@ -154,6 +161,22 @@ func SetApiRouter(router *gin.Engine) {
 			subscriptionAdminRoute.DELETE("/user_subscriptions/:id", controller.AdminDeleteUserSubscription)
 		}
 
+		// Credit accounts and monthly invoices
+		invoiceRoute := apiRouter.Group("/invoice")
+		invoiceRoute.Use(middleware.UserAuth())
+		{
+			invoiceRoute.GET("/self", controller.GetInvoiceSelf)
+			invoiceRoute.POST("/pay", middleware.CriticalRateLimit(), controller.RequestInvoicePay)
+		}
+		invoiceAdminRoute := apiRouter.Group("/invoice/admin")
+		invoiceAdminRoute.Use(middleware.AdminAuth())
+		{
+			invoiceAdminRoute.GET("/invoices", controller.AdminListInvoices)
+			invoiceAdminRoute.POST("/invoices/:id/settle", controller.AdminSettleInvoice)
+			invoiceAdminRoute.GET("/credits", controller.AdminListUserCredits)
+			invoiceAdminRoute.POST("/credits", controller.AdminSaveUserCredit)
+		}
+
 		// Subscription payment callbacks (no auth)
 		apiRouter.POST("/subscription/epay/notify", controller.SubscriptionEpayNotify)
 		apiRouter.GET("/subscription/epay/notify", controller.SubscriptionEpayNotify)
@@ -207,6 +230,7 @@ func SetApiRouter(router *gin.Engine) {
 			channelRoute.GET("/test/:id", controller.TestChannel)
 			channelRoute.GET("/update_balance", controller.UpdateAllChannelsBalance)
 			channelRoute.GET("/update_balance/:id", controller.UpdateChannelBalance)
+			channelRoute.GET("/:id/balance_history", controller.GetChannelBalanceHistory)
 			channelRoute.POST("/", controller.AddChannel)
 			channelRoute.PUT("/", controller.UpdateChannel)
 			channelRoute.DELETE("/disabled", controller.DeleteDisabledChannel)
@@ -245,6 +269,29 @@ func SetApiRouter(router *gin.Engine) {
 			tokenRoute.POST("/batch", controller.DeleteTokenBatch)
 		}
 
+		organizationRoute := apiRouter.Group("/organization")
+		organizationRoute.Use(middleware.UserAuth())
+		{
+			organizationRoute.GET("/", controller.GetSelfOrganizations)
+			organizationRoute.POST("/", controller.CreateOrganization)
+			organizationRoute.GET("/:id", controller.GetOrganization)
+			organizationRoute.PUT("/:id", controller.UpdateOrganization)
+			organizationRoute.DELETE("/:id", controller.DeleteOrganization)
+			organizationRoute.GET("/:id/members", controller.GetOrganizationMembers)
+			organizationRoute.POST("/:id/members", controller.AddOrganizationMember)
+			organizationRoute.PUT("/:id/members/:user_id", controller.UpdateOrganizationMember)
+			organizationRoute.DELETE("/:id/members/:user_id", controller.RemoveOrganizationMember)
+			organizationRoute.POST("/:id/transfer", middleware.CriticalRateLimit(), controller.TransferOrganizationQuota)
+			organizationRoute.GET("/:id/tokens", controller.GetOrganizationTokens)
+			organizationRoute.GET("/:id/usage", controller.GetOrganizationUsage)
+		}
+		organizationAdminRoute := apiRouter.Group("/organization/admin")
+		organizationAdminRoute.Use(middleware.AdminAuth())
+		{
+			organizationAdminRoute.GET("/", controller.AdminListOrganizations)
+			organizationAdminRoute.POST("/:id/quota", controller.AdminAdjustOrganizationQuota)
+		}
+
 		usageRoute := apiRouter.Group("/usage")
 		usageRoute.Use(middleware.CORS(), middleware.CriticalRateLimit())
 		{
@@ -261,15 +308,47 @@ func SetApiRouter(router *gin.Engine) {
 			redemptionRoute.GET("/", controller.GetAllRedemptions)
 			redemptionRoute.GET("/search", controller.SearchRedemptions)
 			redemptionRoute.GET("/:id", controller.GetRedemption)
+			redemptionRoute.GET("/:id/stats", controller.GetRedemptionStats)
 			redemptionRoute.POST("/", controller.AddRedemption)
 			redemptionRoute.PUT("/", controller.UpdateRedemption)
 			redemptionRoute.DELETE("/invalid", controller.DeleteInvalidRedemption)
 			redemptionRoute.DELETE("/:id", controller.DeleteRedemption)
 		}
+		couponRoute := apiRouter.Group("/coupon")
+		couponRoute.Use(middleware.AdminAuth())
+		{
+			couponRoute.GET("/", controller.GetAllCoupons)
+			couponRoute.GET("/:id", controller.GetCoupon)
+			couponRoute.GET("/:id/usages", controller.GetCouponUsages)
+			couponRoute.POST("/", controller.AddCoupon)
+			couponRoute.PUT("/", controller.UpdateCoupon)
+			couponRoute.DELETE("/:id", controller.DeleteCoupon)
+		}
+		priceScheduleRoute := apiRouter.Group("/price_schedule")
+		priceScheduleRoute.Use(middleware.RootAuth())
+		{
+			priceScheduleRoute.GET("/", controller.GetAllPriceSchedules)
+			priceScheduleRoute.GET("/preview", controller.PreviewScheduledPrice)
+			priceScheduleRoute.GET("/:id", controller.GetPriceSchedule)
+			priceScheduleRoute.POST("/", controller.AddPriceSchedule)
+			priceScheduleRoute.PUT("/", controller.UpdatePriceSchedule)
+			priceScheduleRoute.DELETE("/:id", controller.DeletePriceSchedule)
+		}
+		contractPriceRoute := apiRouter.Group("/contract_price")
+		contractPriceRoute.Use(middleware.RootAuth())
+		{
+			contractPriceRoute.GET("/", controller.GetContractPrices)
+			contractPriceRoute.GET("/preview", controller.PreviewContractPrice)
+			contractPriceRoute.POST("/", controller.AddContractPrice)
+			contractPriceRoute.PUT("/", controller.UpdateContractPrice)
+			contractPriceRoute.DELETE("/:id", controller.DeleteContractPrice)
+		}
+		apiRouter.POST("/pricing_expression/dry_run", middleware.RootAuth(), controller.DryRunPricingExpression)
 		logRoute := apiRouter.Group("/log")
 		logRoute.GET("/", middleware.AdminAuth(), controller.GetAllLogs)
 		logRoute.DELETE("/", middleware.AdminAuth(), controller.DeleteHistoryLogs)
 		logRoute.GET("/stat", middleware.AdminAuth(), controller.GetLogsStat)
+		logRoute.GET("/cost_report", middleware.AdminAuth(), controller.GetChannelCostReport)
 		logRoute.GET("/self/stat", middleware.UserAuth(), controller.GetLogsSelfStat)
 		logRoute.GET("/channel_affinity_usage_cache", middleware.AdminAuth(), controller.GetChannelAffinityUsageCacheStats)
 		logRoute.GET("/search", middleware.AdminAuth(), controller.SearchAllLogs)
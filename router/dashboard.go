@@ -18,5 +18,7 @@ func SetDashboardRouter(router *gin.Engine) {
 		apiRouter.GET("/v1/dashboard/billing/subscription", controller.GetSubscription)
 		apiRouter.GET("/dashboard/billing/usage", controller.GetUsage)
 		apiRouter.GET("/v1/dashboard/billing/usage", controller.GetUsage)
+		apiRouter.POST("/v1/client_tokens", controller.CreateClientToken)
+		apiRouter.DELETE("/v1/client_tokens/:id", controller.RevokeClientToken)
 	}
 }
@@ -0,0 +1,64 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
+)
+
+// ChannelBalanceDisableReason 因余额低于下限被禁用的渠道使用的禁用原因，余额回升后据此自动启用
+const ChannelBalanceDisableReason = "余额低于下限"
+
+// IsChannelDisabledByBalance 渠道是否因余额低于下限被自动禁用
+func IsChannelDisabledByBalance(channel *model.Channel) bool {
+	if channel.Status != common.ChannelStatusAutoDisabled {
+		return false
+	}
+	reason, _ := channel.GetOtherInfo()["status_reason"].(string)
+	return reason == ChannelBalanceDisableReason
+}
+
+// HandleChannelBalance 根据渠道的余额阈值配置在余额刷新后发送告警并执行降级或禁用，余额回升后恢复。
+// previous 为刷新前的余额，firstCheck 表示此前从未获取过余额
+func HandleChannelBalance(channel *model.Channel, previous float64, firstCheck bool, balance float64) {
+	alert := channel.GetOtherSettings().BalanceAlert
+	if alert == nil {
+		return
+	}
+	if alert.NotifyBelow > 0 && balance < alert.NotifyBelow && (firstCheck || previous >= alert.NotifyBelow) {
+		subject := fmt.Sprintf("通道「%s」（#%d）余额不足", channel.Name, channel.Id)
+		content := fmt.Sprintf("通道「%s」（#%d）当前余额 %.2f，低于告警阈值 %.2f", channel.Name, channel.Id, balance, alert.NotifyBelow)
+		NotifyRootUser(fmt.Sprintf("%s_balance_%d", dto.NotifyTypeChannelUpdate, channel.Id), subject, content)
+	}
+
+	belowFloor := balance < alert.Floor
+	switch alert.Action {
+	case dto.BalanceAlertActionDisable:
+		if belowFloor && channel.Status == common.ChannelStatusEnabled {
+			if model.UpdateChannelStatus(channel.Id, "", common.ChannelStatusAutoDisabled, ChannelBalanceDisableReason) {
+				subject := fmt.Sprintf("通道「%s」（#%d）已被禁用", channel.Name, channel.Id)
+				content := fmt.Sprintf("通道「%s」（#%d）余额 %.2f 低于下限 %.2f，已被禁用", channel.Name, channel.Id, balance, alert.Floor)
+				NotifyRootUser(formatNotifyType(channel.Id, common.ChannelStatusAutoDisabled), subject, content)
+			}
+		} else if !belowFloor && IsChannelDisabledByBalance(channel) {
+			EnableChannel(channel.Id, "", channel.Name)
+		}
+	case dto.BalanceAlertActionLowerPriority:
+		if belowFloor {
+			lowered, err := model.LowerChannelPriorityByBalance(channel.Id, alert.Priority)
+			if err != nil {
+				common.SysLog(fmt.Sprintf("failed to lower channel priority: channel_id=%d, error=%v", channel.Id, err))
+			} else if lowered {
+				subject := fmt.Sprintf("通道「%s」（#%d）优先级已降低", channel.Name, channel.Id)
+				content := fmt.Sprintf("通道「%s」（#%d）余额 %.2f 低于下限 %.2f，优先级已降为 %d", channel.Name, channel.Id, balance, alert.Floor, alert.Priority)
+				NotifyRootUser(fmt.Sprintf("%s_priority_%d", dto.NotifyTypeChannelUpdate, channel.Id), subject, content)
+			}
+		} else if channel.IsPriorityLoweredByBalance() {
+			if _, err := model.RestoreChannelPriorityByBalance(channel.Id); err != nil {
+				common.SysLog(fmt.Sprintf("failed to restore channel priority: channel_id=%d, error=%v", channel.Id, err))
+			}
+		}
+	}
+}
@@ -12,7 +12,7 @@ import (
 
 // FundingSource 抽象了预扣费的资金来源。
 type FundingSource interface {
-	// Source 返回资金来源标识："wallet" 或 "subscription"
+	// Source 返回资金来源标识："wallet"、"subscription" 或 "organization"
 	Source() string
 	// PreConsume 从该资金来源预扣 amount 额度
 	PreConsume(amount int) error
@@ -63,6 +63,45 @@ func (w *WalletFunding) Refund() error {
 	return model.IncreaseUserQuota(w.userId, w.consumed, false)
 }
 
+// ---------------------------------------------------------------------------
+// OrganizationFunding — 组织钱包资金来源实现
+// ---------------------------------------------------------------------------
+
+// OrganizationFunding 从组织共享钱包扣费，同时累计成员在组织内的已用额度，
+// 预扣时校验成员预算上限。
+type OrganizationFunding struct {
+	orgId    int
+	userId   int
+	consumed int
+}
+
+func (o *OrganizationFunding) Source() string { return BillingSourceOrganization }
+
+func (o *OrganizationFunding) PreConsume(amount int) error {
+	if amount <= 0 {
+		return nil
+	}
+	if err := model.PreConsumeOrganizationQuota(o.orgId, o.userId, amount); err != nil {
+		return err
+	}
+	o.consumed = amount
+	return nil
+}
+
+func (o *OrganizationFunding) Settle(delta int) error {
+	return model.DeltaUpdateOrganizationQuota(o.orgId, o.userId, delta)
+}
+
+func (o *OrganizationFunding) Refund() error {
+	if o.consumed <= 0 {
+		return nil
+	}
+	// 基于事务的退款，可以重试
+	return refundWithRetry(func() error {
+		return model.DeltaUpdateOrganizationQuota(o.orgId, o.userId, -o.consumed)
+	})
+}
+
 // ---------------------------------------------------------------------------
 // SubscriptionFunding — 订阅资金来源实现
 // ---------------------------------------------------------------------------
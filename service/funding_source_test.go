@@ -0,0 +1,100 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+// setupOrganizationFundingDB 创建带一名开发者成员的组织，使用内存数据库，不能与其他数据库测试并行
+func setupOrganizationFundingDB(t *testing.T, quota int, quotaLimit int) (orgId int, userId int) {
+	t.Helper()
+	restore, err := model.UseTestDB(t.Name(), &model.Organization{}, &model.OrganizationMember{})
+	require.NoError(t, err)
+	t.Cleanup(restore)
+
+	org, err := model.CreateOrganization("acme", 1)
+	require.NoError(t, err)
+	require.NoError(t, model.AdjustOrganizationQuota(org.Id, quota))
+	userId = 2
+	require.NoError(t, model.AddOrganizationMember(&model.OrganizationMember{OrgId: org.Id, UserId: userId, Role: model.OrgRoleDeveloper, QuotaLimit: quotaLimit}))
+	return org.Id, userId
+}
+
+func requireOrganizationUsage(t *testing.T, orgId int, userId int, quota int, memberUsed int) {
+	t.Helper()
+	org, err := model.GetOrganizationById(orgId)
+	require.NoError(t, err)
+	require.Equal(t, quota, org.Quota)
+	member, err := model.GetOrganizationMember(orgId, userId)
+	require.NoError(t, err)
+	require.Equal(t, memberUsed, member.UsedQuota)
+}
+
+func TestOrganizationFunding(t *testing.T) {
+	orgId, userId := setupOrganizationFundingDB(t, 1000, 600)
+	funding := &OrganizationFunding{orgId: orgId, userId: userId}
+	require.Equal(t, BillingSourceOrganization, funding.Source())
+
+	require.NoError(t, funding.PreConsume(300))
+	requireOrganizationUsage(t, orgId, userId, 700, 300)
+
+	// 实际用量高于预扣时补扣，低于时退还
+	require.NoError(t, funding.Settle(100))
+	requireOrganizationUsage(t, orgId, userId, 600, 400)
+	require.NoError(t, funding.Settle(-150))
+	requireOrganizationUsage(t, orgId, userId, 750, 250)
+
+	// 请求失败时退还全部预扣额度
+	second := &OrganizationFunding{orgId: orgId, userId: userId}
+	require.NoError(t, second.PreConsume(200))
+	requireOrganizationUsage(t, orgId, userId, 550, 450)
+	require.NoError(t, second.Refund())
+	requireOrganizationUsage(t, orgId, userId, 750, 250)
+}
+
+func TestOrganizationFundingRejected(t *testing.T) {
+	orgId, userId := setupOrganizationFundingDB(t, 500, 300)
+
+	// 超出成员预算
+	funding := &OrganizationFunding{orgId: orgId, userId: userId}
+	require.ErrorIs(t, funding.PreConsume(301), model.ErrOrgMemberBudgetExceeded)
+	require.NoError(t, funding.Refund())
+	requireOrganizationUsage(t, orgId, userId, 500, 0)
+
+	// 组织余额不足
+	member, err := model.GetOrganizationMember(orgId, userId)
+	require.NoError(t, err)
+	member.QuotaLimit = 0
+	require.NoError(t, model.UpdateOrganizationMember(member, false))
+	require.ErrorIs(t, funding.PreConsume(501), model.ErrOrgQuotaInsufficient)
+	requireOrganizationUsage(t, orgId, userId, 500, 0)
+
+	// 组织令牌在预扣前检查组织余额
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	session, apiErr := NewBillingSession(c, &relaycommon.RelayInfo{OrgId: orgId, UserId: userId}, 600)
+	require.Nil(t, session)
+	require.NotNil(t, apiErr)
+	require.Equal(t, types.ErrorCodeInsufficientUserQuota, apiErr.GetErrorCode())
+	require.Equal(t, http.StatusForbidden, apiErr.StatusCode)
+	requireOrganizationUsage(t, orgId, userId, 500, 0)
+
+	// 非组织成员使用组织令牌
+	outsider := &OrganizationFunding{orgId: orgId, userId: userId + 1}
+	require.ErrorIs(t, outsider.PreConsume(100), model.ErrOrgMemberNotFound)
+	session, apiErr = NewBillingSession(c, &relaycommon.RelayInfo{OrgId: orgId, UserId: userId + 1, IsPlayground: true}, 100)
+	require.Nil(t, session)
+	require.NotNil(t, apiErr)
+	require.Equal(t, types.ErrorCodeAccessDenied, apiErr.GetErrorCode())
+	require.Equal(t, http.StatusForbidden, apiErr.StatusCode)
+	requireOrganizationUsage(t, orgId, userId, 500, 0)
+}
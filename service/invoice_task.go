@@ -0,0 +1,75 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+const (
+	invoiceTickInterval = 10 * time.Minute
+	invoiceBatchSize    = 200
+)
+
+var (
+	invoiceTaskOnce    sync.Once
+	invoiceTaskRunning atomic.Bool
+)
+
+// StartInvoiceTask 信用账户月度出账与逾期处理，仅在主节点运行
+func StartInvoiceTask() {
+	invoiceTaskOnce.Do(func() {
+		if !common.IsMasterNode {
+			return
+		}
+		gopool.Go(func() {
+			logger.LogInfo(context.Background(), fmt.Sprintf("invoice task started: tick=%s", invoiceTickInterval))
+			ticker := time.NewTicker(invoiceTickInterval)
+			defer ticker.Stop()
+
+			runInvoiceTaskOnce()
+			for range ticker.C {
+				runInvoiceTaskOnce()
+			}
+		})
+	})
+}
+
+func runInvoiceTaskOnce() {
+	if !invoiceTaskRunning.CompareAndSwap(false, true) {
+		return
+	}
+	defer invoiceTaskRunning.Store(false)
+
+	ctx := context.Background()
+	periodEnd := model.InvoicePeriodEnd(time.Now(), setting.InvoiceBillingDay).Unix()
+	for {
+		n, err := model.GenerateInvoices(periodEnd, invoiceBatchSize)
+		if err != nil {
+			logger.LogWarn(ctx, fmt.Sprintf("invoice generate task failed: %v", err))
+			return
+		}
+		if n < invoiceBatchSize {
+			break
+		}
+	}
+	for {
+		n, err := model.MarkOverdueInvoices(invoiceBatchSize)
+		if err != nil {
+			logger.LogWarn(ctx, fmt.Sprintf("invoice overdue task failed: %v", err))
+			return
+		}
+		if n < invoiceBatchSize {
+			break
+		}
+	}
+}
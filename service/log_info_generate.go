@@ -7,6 +7,7 @@ import (
 	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/dto"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/model_setting"
 	"github.com/QuantumNous/new-api/types"
 
 	"github.com/gin-gonic/gin"
@@ -50,6 +51,10 @@ func GenerateTextOtherInfo(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, m
 		other["upstream_model_name"] = relayInfo.UpstreamModelName
 	}
 
+	if relayInfo.OrgId != 0 {
+		other["org_id"] = relayInfo.OrgId
+	}
+
 	isSystemPromptOverwritten := common.GetContextKeyBool(ctx, constant.ContextKeySystemPromptOverride)
 	if isSystemPromptOverwritten {
 		other["is_system_prompt_overwritten"] = true
@@ -67,6 +72,9 @@ func GenerateTextOtherInfo(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, m
 	if isLocalCountTokens {
 		adminInfo["local_count_tokens"] = isLocalCountTokens
 	}
+	if relayInfo.ToolEmulation {
+		adminInfo["tool_emulation"] = true
+	}
 
 	AppendChannelAffinityAdminInfo(ctx, adminInfo)
 
@@ -74,9 +82,76 @@ func GenerateTextOtherInfo(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, m
 	appendRequestPath(ctx, relayInfo, other)
 	appendRequestConversionChain(relayInfo, other)
 	appendBillingInfo(relayInfo, other)
+	appendStructuredOutputInfo(relayInfo, other)
+	appendPricingTierInfo(relayInfo, other)
+	appendVirtualModelInfo(ctx, other)
+	if len(relayInfo.PriceData.PriceScheduleIds) > 0 {
+		other["price_schedule_ids"] = relayInfo.PriceData.PriceScheduleIds
+		other["price_multiplier"] = relayInfo.PriceData.PriceMultiplier
+	}
+	if relayInfo.PriceData.ContractPriceId != 0 {
+		other["contract_price_id"] = relayInfo.PriceData.ContractPriceId
+		other["price_multiplier"] = relayInfo.PriceData.PriceMultiplier
+	}
+	if len(relayInfo.PriceData.MediaRatios) > 0 {
+		other["media_ratios"] = relayInfo.PriceData.MediaRatios
+	}
 	return other
 }
 
+// appendVirtualModelInfo 记录请求的虚拟模型及此前失败的目标模型，实际服务的模型即日志的模型名
+func appendVirtualModelInfo(c *gin.Context, other map[string]interface{}) {
+	virtualModel := common.GetContextKeyString(c, constant.ContextKeyVirtualModel)
+	if virtualModel == "" {
+		return
+	}
+	other["virtual_model"] = virtualModel
+	index := common.GetContextKeyInt(c, constant.ContextKeyVirtualModelIndex)
+	targets := getVirtualModelTargets(c)
+	if index > 0 && index <= len(targets) {
+		fallbacks := make([]string, 0, index)
+		for _, target := range targets[:index] {
+			fallbacks = append(fallbacks, target.Model)
+		}
+		other["virtual_model_fallbacks"] = fallbacks
+	}
+}
+
+// appendPricingTierInfo 记录结算时生效的分档价格
+func appendPricingTierInfo(relayInfo *relaycommon.RelayInfo, other map[string]interface{}) {
+	if relayInfo == nil || other == nil || relayInfo.PriceData.PricingTier == nil {
+		return
+	}
+	tier := relayInfo.PriceData.PricingTier
+	pricingTier := map[string]interface{}{
+		"name":                tier.Label(),
+		"prompt_tokens_above": tier.PromptTokensAbove,
+	}
+	if tier.CompletionTokensAbove > 0 {
+		pricingTier["completion_tokens_above"] = tier.CompletionTokensAbove
+	}
+	other["pricing_tier"] = pricingTier
+}
+
+func appendStructuredOutputInfo(relayInfo *relaycommon.RelayInfo, other map[string]interface{}) {
+	if relayInfo == nil || other == nil || relayInfo.StructuredOutput == nil {
+		return
+	}
+	state := relayInfo.StructuredOutput
+	structuredOutput := map[string]interface{}{
+		"failures":       state.Failures,
+		"billing_policy": model_setting.GetStructuredOutputSettings().BillingPolicy,
+	}
+	if state.Failures > 0 {
+		structuredOutput["failed_prompt_tokens"] = state.FailedUsage.PromptTokens
+		structuredOutput["failed_completion_tokens"] = state.FailedUsage.CompletionTokens
+	}
+	if state.FixerModel != "" {
+		structuredOutput["fixer_model"] = state.FixerModel
+	}
+	other["structured_output"] = structuredOutput
+}
+
 func appendBillingInfo(relayInfo *relaycommon.RelayInfo, other map[string]interface{}) {
 	if relayInfo == nil || other == nil {
 		return
@@ -131,6 +206,27 @@ func appendBillingInfo(relayInfo *relaycommon.RelayInfo, other map[string]interf
 	}
 }
 
+// AppendPromptCacheInfo 以统一字段记录各格式的缓存读取/写入 token，以及网关自动开启的提示词缓存。
+func AppendPromptCacheInfo(relayInfo *relaycommon.RelayInfo, other map[string]interface{}, cacheReadTokens int, cacheWriteTokens int) {
+	if other == nil {
+		return
+	}
+	if cacheReadTokens != 0 {
+		other["cache_read_tokens"] = cacheReadTokens
+	}
+	if cacheWriteTokens != 0 {
+		other["cache_write_tokens"] = cacheWriteTokens
+	}
+	if relayInfo == nil || relayInfo.PromptCache == nil {
+		return
+	}
+	other["prompt_cache"] = map[string]interface{}{
+		"provider": relayInfo.PromptCache.Provider,
+		"source":   relayInfo.PromptCache.Source,
+		"ttl":      relayInfo.PromptCache.TTL,
+	}
+}
+
 func appendRequestConversionChain(relayInfo *relaycommon.RelayInfo, other map[string]interface{}) {
 	if relayInfo == nil || other == nil {
 		return
@@ -193,6 +289,7 @@ func GenerateClaudeOtherInfo(ctx *gin.Context, relayInfo *relaycommon.RelayInfo,
 	info["claude"] = true
 	info["cache_creation_tokens"] = cacheCreationTokens
 	info["cache_creation_ratio"] = cacheCreationRatio
+	AppendPromptCacheInfo(relayInfo, info, cacheTokens, cacheCreationTokens)
 	if cacheCreationTokens5m != 0 {
 		info["cache_creation_tokens_5m"] = cacheCreationTokens5m
 		info["cache_creation_ratio_5m"] = cacheCreationRatio5m
@@ -211,6 +308,12 @@ func GenerateMjOtherInfo(relayInfo *relaycommon.RelayInfo, priceData types.PerCa
 	if priceData.GroupRatioInfo.HasSpecialRatio {
 		other["user_group_ratio"] = priceData.GroupRatioInfo.GroupSpecialRatio
 	}
+	if len(priceData.PriceScheduleIds) > 0 {
+		other["price_schedule_ids"] = priceData.PriceScheduleIds
+	}
+	if priceData.ContractPriceId != 0 {
+		other["contract_price_id"] = priceData.ContractPriceId
+	}
 	appendRequestPath(nil, relayInfo, other)
 	return other
 }
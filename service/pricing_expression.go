@@ -0,0 +1,150 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/pkg/billingexpr"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+	"github.com/tidwall/gjson"
+)
+
+// PricingExpressionVars 由上游用量构造计费表达式变量，claudeSemantic 表示 prompt_tokens 不含缓存读写 tokens
+func PricingExpressionVars(usage *dto.Usage, claudeSemantic bool) map[string]float64 {
+	cached := usage.PromptTokensDetails.CachedTokens
+	cacheWrite := usage.PromptTokensDetails.CachedCreationTokens
+	image := usage.PromptTokensDetails.ImageTokens
+	audio := usage.PromptTokensDetails.AudioTokens
+
+	input := usage.PromptTokens
+	if claudeSemantic {
+		input += cached + cacheWrite
+	}
+	prompt := input - cached - cacheWrite - image - audio
+	if prompt < 0 {
+		prompt = 0
+	}
+	return map[string]float64{
+		billingexpr.VarPromptTokens:       float64(prompt),
+		billingexpr.VarInputTokens:        float64(input),
+		billingexpr.VarCompletionTokens:   float64(usage.CompletionTokens),
+		billingexpr.VarReasoningTokens:    float64(usage.CompletionTokenDetails.ReasoningTokens),
+		billingexpr.VarCachedTokens:       float64(cached),
+		billingexpr.VarCacheWriteTokens:   float64(cacheWrite),
+		billingexpr.VarCacheWrite1hTokens: float64(usage.ClaudeCacheCreation1hTokens),
+		billingexpr.VarAudioInputTokens:   float64(audio),
+		billingexpr.VarAudioOutputTokens:  float64(usage.CompletionTokenDetails.AudioTokens),
+		billingexpr.VarImageTokens:        float64(image),
+	}
+}
+
+// addPricingExpressionToolCalls 补充内置工具调用次数
+func addPricingExpressionToolCalls(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, vars map[string]float64) {
+	if relayInfo.ResponsesUsageInfo != nil {
+		if tool, ok := relayInfo.ResponsesUsageInfo.BuiltInTools[dto.BuildInToolWebSearchPreview]; ok {
+			vars[billingexpr.VarWebSearchCalls] = float64(tool.CallCount)
+		}
+		if tool, ok := relayInfo.ResponsesUsageInfo.BuiltInTools[dto.BuildInToolFileSearch]; ok {
+			vars[billingexpr.VarFileSearchCalls] = float64(tool.CallCount)
+		}
+		if tool, ok := relayInfo.ResponsesUsageInfo.BuiltInTools[dto.BuildInToolCodeInterpreter]; ok {
+			vars[billingexpr.VarCodeInterpreterCalls] = float64(tool.CallCount)
+		}
+	} else if strings.HasSuffix(relayInfo.OriginModelName, "search-preview") {
+		vars[billingexpr.VarWebSearchCalls] = 1
+	}
+	if n := ctx.GetInt("claude_web_search_requests"); n > 0 {
+		vars[billingexpr.VarWebSearchCalls] += float64(n)
+	}
+	if ctx.GetBool("image_generation_call") {
+		vars[billingexpr.VarImageGenerationCalls] = 1
+	}
+	if relayInfo.IsStream {
+		vars[billingexpr.VarStream] = 1
+	}
+}
+
+// PricingExpressionParams 以 JSON 路径读取请求体中的参数，非 JSON 请求体时参数均不存在
+func PricingExpressionParams(body []byte) func(path string) any {
+	return func(path string) any {
+		if len(body) == 0 || path == "" {
+			return nil
+		}
+		result := gjson.GetBytes(body, path)
+		if !result.Exists() {
+			return nil
+		}
+		return result.Value()
+	}
+}
+
+func pricingExpressionRequestParams(ctx *gin.Context) func(path string) any {
+	var body []byte
+	loaded := false
+	return func(path string) any {
+		if !loaded {
+			loaded = true
+			if storage, err := common.GetBodyStorage(ctx); err == nil {
+				body, _ = storage.Bytes()
+			}
+		}
+		return PricingExpressionParams(body)(path)
+	}
+}
+
+// PricingExpressionQuota 美元价格换算为额度，multiplier 为价格计划或合同价倍率，0 表示不调整
+func PricingExpressionQuota(cost float64, groupRatio float64, multiplier float64) int {
+	quota := decimal.NewFromFloat(cost).
+		Mul(decimal.NewFromFloat(common.QuotaPerUnit)).
+		Mul(decimal.NewFromFloat(groupRatio))
+	if multiplier > 0 {
+		quota = quota.Mul(decimal.NewFromFloat(multiplier))
+	}
+	return int(quota.Round(0).IntPart())
+}
+
+// EstimatePricingExpressionQuota 预扣时以估算的提示 tokens 和 max_tokens 计算表达式
+func EstimatePricingExpressionQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, program *billingexpr.Program, promptTokens int, maxTokens int, groupRatio float64, multiplier float64) (int, error) {
+	vars := map[string]float64{
+		billingexpr.VarPromptTokens:     float64(promptTokens),
+		billingexpr.VarInputTokens:      float64(promptTokens),
+		billingexpr.VarCompletionTokens: float64(maxTokens),
+		billingexpr.VarPreConsume:       1,
+	}
+	if relayInfo.IsStream {
+		vars[billingexpr.VarStream] = 1
+	}
+	cost, err := program.Eval(billingexpr.Env{Vars: vars, Param: pricingExpressionRequestParams(ctx)})
+	if err != nil {
+		return 0, fmt.Errorf("计费表达式计算失败: %w", err)
+	}
+	return PricingExpressionQuota(cost, groupRatio, multiplier), nil
+}
+
+// SettlePricingExpressionQuota 配置了计费表达式时按实际用量计算额度，ok 为 false 表示未使用表达式。
+// 表达式计算失败时按预扣额度结算，并写入日志
+func SettlePricingExpressionQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usage *dto.Usage, claudeSemantic bool) (quota int, other map[string]interface{}, ok bool) {
+	program := relayInfo.PriceData.PricingExpression
+	if program == nil || usage == nil {
+		return 0, nil, false
+	}
+	vars := PricingExpressionVars(usage, claudeSemantic)
+	addPricingExpressionToolCalls(ctx, relayInfo, vars)
+	other = map[string]interface{}{
+		"pricing_expression": program.Source,
+	}
+	cost, err := program.Eval(billingexpr.Env{Vars: vars, Param: pricingExpressionRequestParams(ctx)})
+	if err != nil {
+		logger.LogError(ctx, fmt.Sprintf("pricing expression failed, model %s: %s", relayInfo.OriginModelName, err.Error()))
+		other["pricing_expression_error"] = err.Error()
+		return relayInfo.FinalPreConsumedQuota, other, true
+	}
+	other["expression_cost"] = cost
+	return PricingExpressionQuota(cost, relayInfo.PriceData.GroupRatioInfo.GroupRatio, relayInfo.PriceData.PriceMultiplier), other, true
+}
@@ -0,0 +1,34 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/pkg/billingexpr"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPricingExpressionVars(t *testing.T) {
+	usage := &dto.Usage{
+		PromptTokens:     1000,
+		CompletionTokens: 300,
+		PromptTokensDetails: dto.InputTokenDetails{
+			CachedTokens:         400,
+			CachedCreationTokens: 100,
+		},
+		CompletionTokenDetails: dto.OutputTokenDetails{ReasoningTokens: 200},
+	}
+	openai := PricingExpressionVars(usage, false)
+	require.Equal(t, float64(500), openai[billingexpr.VarPromptTokens])
+	require.Equal(t, float64(1000), openai[billingexpr.VarInputTokens])
+	require.Equal(t, float64(200), openai[billingexpr.VarReasoningTokens])
+
+	claude := PricingExpressionVars(usage, true)
+	require.Equal(t, float64(1000), claude[billingexpr.VarPromptTokens])
+	require.Equal(t, float64(1500), claude[billingexpr.VarInputTokens])
+
+	params := PricingExpressionParams([]byte(`{"quality":"hd","metadata":{"n":2}}`))
+	require.Equal(t, "hd", params("quality"))
+	require.Equal(t, float64(2), params("metadata.n"))
+	require.Nil(t, params("size"))
+}
@@ -0,0 +1,162 @@
+package service
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/model_setting"
+)
+
+const (
+	PromptCacheProviderClaude = "claude"
+	PromptCacheProviderGemini = "gemini"
+
+	PromptCacheTTL5m = "5m"
+	PromptCacheTTL1h = "1h"
+)
+
+// ResolvePromptCacheRule 解析当前请求生效的提示词缓存规则（渠道 > 分组 > 默认）。
+func ResolvePromptCacheRule(info *relaycommon.RelayInfo) (dto.PromptCacheRule, string, bool) {
+	if info == nil {
+		return dto.PromptCacheRule{}, "", false
+	}
+	var channelRule *dto.PromptCacheRule
+	if info.ChannelMeta != nil {
+		channelRule = info.ChannelOtherSettings.PromptCache
+	}
+	return model_setting.ResolvePromptCacheRule(channelRule, info.UsingGroup, info.OriginModelName)
+}
+
+// NormalizePromptCacheTTL 仅支持 5m 与 1h 两档，其他值按 5m 处理。
+func NormalizePromptCacheTTL(ttl string) string {
+	if strings.TrimSpace(ttl) == PromptCacheTTL1h {
+		return PromptCacheTTL1h
+	}
+	return PromptCacheTTL5m
+}
+
+// ApplyClaudePromptCache 按规则为 Claude / Bedrock Claude 请求的工具定义和系统提示词插入 cache_control 断点。
+// 请求中已有 cache_control 时尊重客户端的设置，不做任何改动。
+func ApplyClaudePromptCache(info *relaycommon.RelayInfo, request *dto.ClaudeRequest) bool {
+	if request == nil {
+		return false
+	}
+	rule, source, ok := ResolvePromptCacheRule(info)
+	if !ok {
+		return false
+	}
+	if claudeRequestHasCacheControl(request) {
+		return false
+	}
+
+	var prefix strings.Builder
+	if rule.CacheTools && request.Tools != nil {
+		toolsJson, _ := common.Marshal(request.Tools)
+		prefix.Write(toolsJson)
+	}
+	if rule.CacheSystem && request.System != nil {
+		prefix.WriteString(claudeSystemText(request))
+	}
+	if prefix.Len() == 0 || EstimateTokenByModel(info.OriginModelName, prefix.String()) < rule.MinPrefixTokens {
+		return false
+	}
+
+	ttl := NormalizePromptCacheTTL(rule.TTL)
+	cacheControl := json.RawMessage(`{"type":"ephemeral"}`)
+	if ttl == PromptCacheTTL1h {
+		cacheControl = json.RawMessage(`{"type":"ephemeral","ttl":"1h"}`)
+	}
+
+	applied := false
+	// 缓存前缀顺序为 tools -> system -> messages，两处断点可以让系统提示词变化时仍命中工具缓存
+	if rule.CacheTools && setClaudeToolsCacheControl(request, cacheControl) {
+		applied = true
+	}
+	if rule.CacheSystem && setClaudeSystemCacheControl(request, cacheControl) {
+		applied = true
+	}
+	if applied {
+		info.PromptCache = &relaycommon.PromptCacheInfo{
+			Provider: PromptCacheProviderClaude,
+			Source:   source,
+			TTL:      ttl,
+		}
+	}
+	return applied
+}
+
+func claudeRequestHasCacheControl(request *dto.ClaudeRequest) bool {
+	for _, raw := range []any{request.System, request.Tools} {
+		if raw == nil {
+			continue
+		}
+		data, err := common.Marshal(raw)
+		if err == nil && strings.Contains(string(data), `"cache_control"`) {
+			return true
+		}
+	}
+	for _, message := range request.Messages {
+		if message.IsStringContent() {
+			continue
+		}
+		data, err := common.Marshal(message.Content)
+		if err == nil && strings.Contains(string(data), `"cache_control"`) {
+			return true
+		}
+	}
+	return false
+}
+
+func claudeSystemText(request *dto.ClaudeRequest) string {
+	if request.IsStringSystem() {
+		return request.GetStringSystem()
+	}
+	var sb strings.Builder
+	for _, media := range request.ParseSystem() {
+		sb.WriteString(media.GetText())
+	}
+	return sb.String()
+}
+
+func setClaudeToolsCacheControl(request *dto.ClaudeRequest, cacheControl json.RawMessage) bool {
+	tools := request.GetTools()
+	// 从后往前找到最后一个可设置断点的工具，服务端工具（如 web_search）跳过
+	for i := len(tools) - 1; i >= 0; i-- {
+		switch tool := tools[i].(type) {
+		case *dto.Tool:
+			tool.CacheControl = cacheControl
+			return true
+		case map[string]any:
+			tool["cache_control"] = cacheControl
+			return true
+		}
+	}
+	return false
+}
+
+func setClaudeSystemCacheControl(request *dto.ClaudeRequest, cacheControl json.RawMessage) bool {
+	if request.IsStringSystem() {
+		system := request.GetStringSystem()
+		if system == "" {
+			return false
+		}
+		request.System = []dto.ClaudeMediaMessage{
+			{
+				Type:         "text",
+				Text:         common.GetPointer[string](system),
+				CacheControl: cacheControl,
+			},
+		}
+		return true
+	}
+	systemMedia := request.ParseSystem()
+	if len(systemMedia) == 0 {
+		return false
+	}
+	systemMedia[len(systemMedia)-1].CacheControl = cacheControl
+	request.System = systemMedia
+	return true
+}
@@ -0,0 +1,76 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/stretchr/testify/require"
+)
+
+func newPromptCacheRelayInfo(rule *dto.PromptCacheRule) *relaycommon.RelayInfo {
+	return &relaycommon.RelayInfo{
+		OriginModelName: "claude-sonnet-4-5",
+		ChannelMeta: &relaycommon.ChannelMeta{
+			ChannelOtherSettings: dto.ChannelOtherSettings{PromptCache: rule},
+		},
+	}
+}
+
+func TestApplyClaudePromptCache(t *testing.T) {
+	t.Parallel()
+
+	rule := &dto.PromptCacheRule{
+		Enabled:     true,
+		CacheSystem: true,
+		CacheTools:  true,
+		TTL:         "1h",
+	}
+	info := newPromptCacheRelayInfo(rule)
+	request := &dto.ClaudeRequest{
+		System: "you are a helpful assistant",
+		Tools: []any{
+			&dto.Tool{Name: "get_weather", InputSchema: map[string]any{"type": "object"}},
+			&dto.ClaudeWebSearchTool{Type: "web_search_20250305", Name: "web_search"},
+		},
+	}
+
+	require.True(t, ApplyClaudePromptCache(info, request))
+	require.NotNil(t, info.PromptCache)
+	require.Equal(t, PromptCacheProviderClaude, info.PromptCache.Provider)
+	require.Equal(t, "channel", info.PromptCache.Source)
+
+	tool := request.Tools.([]any)[0].(*dto.Tool)
+	require.JSONEq(t, `{"type":"ephemeral","ttl":"1h"}`, string(tool.CacheControl))
+
+	system, ok := request.System.([]dto.ClaudeMediaMessage)
+	require.True(t, ok)
+	require.Len(t, system, 1)
+	require.JSONEq(t, `{"type":"ephemeral","ttl":"1h"}`, string(system[0].CacheControl))
+}
+
+func TestApplyClaudePromptCacheSkips(t *testing.T) {
+	t.Parallel()
+
+	t.Run("prefix below threshold", func(t *testing.T) {
+		info := newPromptCacheRelayInfo(&dto.PromptCacheRule{Enabled: true, CacheSystem: true, MinPrefixTokens: 1024})
+		request := &dto.ClaudeRequest{System: "short"}
+		require.False(t, ApplyClaudePromptCache(info, request))
+		require.Nil(t, info.PromptCache)
+	})
+
+	t.Run("client already set cache_control", func(t *testing.T) {
+		info := newPromptCacheRelayInfo(&dto.PromptCacheRule{Enabled: true, CacheSystem: true})
+		var request dto.ClaudeRequest
+		require.NoError(t, common.Unmarshal([]byte(`{"system":[{"type":"text","text":"sys","cache_control":{"type":"ephemeral"}}]}`), &request))
+		require.False(t, ApplyClaudePromptCache(info, &request))
+	})
+
+	t.Run("model pattern mismatch", func(t *testing.T) {
+		info := newPromptCacheRelayInfo(&dto.PromptCacheRule{Enabled: true, CacheSystem: true, ModelPatterns: []string{"^claude-opus"}})
+		request := &dto.ClaudeRequest{System: strings.Repeat("long system prompt ", 10)}
+		require.False(t, ApplyClaudePromptCache(info, request))
+	})
+}
@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"log"
 	"math"
-	"strings"
 	"time"
 
 	"github.com/QuantumNous/new-api/common"
@@ -95,7 +94,7 @@ func PreWssConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usag
 		return err
 	}
 
-	token, err := model.GetTokenByKey(strings.TrimPrefix(relayInfo.TokenKey, "sk-"), false)
+	token, err := model.GetCachedTokenById(relayInfo.TokenId)
 	if err != nil {
 		return err
 	}
@@ -138,7 +137,7 @@ func PreWssConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usag
 
 	quota := calculateAudioQuota(quotaInfo)
 
-	if userQuota < quota {
+	if !model.UserQuotaSufficient(relayInfo.UserId, userQuota, quota) {
 		return fmt.Errorf("user quota is not enough, user quota: %s, need quota: %s", logger.FormatQuota(userQuota), logger.FormatQuota(quota))
 	}
 
@@ -169,6 +168,7 @@ func PostWssConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, mod
 	audioRatio := decimal.NewFromFloat(ratio_setting.GetAudioRatio(relayInfo.OriginModelName))
 	audioCompletionRatio := decimal.NewFromFloat(ratio_setting.GetAudioCompletionRatio(modelName))
 
+	relayInfo.PriceData.ApplyPricingTier(usage.InputTokens, usage.OutputTokens)
 	modelRatio := relayInfo.PriceData.ModelRatio
 	groupRatio := relayInfo.PriceData.GroupRatioInfo.GroupRatio
 	modelPrice := relayInfo.PriceData.ModelPrice
@@ -231,6 +231,7 @@ func PostWssConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, mod
 		UseTimeSeconds:   int(useTimeSeconds),
 		IsStream:         relayInfo.IsStream,
 		Group:            relayInfo.UsingGroup,
+		UpstreamCost:     CalculateRelayUpstreamCost(relayInfo, quota),
 		Other:            other,
 	})
 }
@@ -240,8 +241,16 @@ func PostClaudeConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo,
 	useTimeSeconds := time.Now().Unix() - relayInfo.StartTime.Unix()
 	promptTokens := usage.PromptTokens
 	completionTokens := usage.CompletionTokens
+	reasoningTokens := usage.CompletionTokenDetails.ReasoningTokens
 	modelName := relayInfo.OriginModelName
 
+	// 按实际用量选择分档价格，OpenRouter 的 prompt_tokens 已包含缓存 tokens
+	tierPromptTokens := promptTokens
+	if relayInfo.ChannelType != constant.ChannelTypeOpenRouter {
+		tierPromptTokens += usage.PromptTokensDetails.CachedTokens + usage.PromptTokensDetails.CachedCreationTokens
+	}
+	relayInfo.PriceData.ApplyPricingTier(tierPromptTokens, completionTokens)
+
 	tokenName := ctx.GetString("token_name")
 	completionRatio := relayInfo.PriceData.CompletionRatio
 	modelRatio := relayInfo.PriceData.ModelRatio
@@ -279,17 +288,29 @@ func PostClaudeConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo,
 		if remainingCacheCreationTokens > 0 {
 			calculateQuota += float64(remainingCacheCreationTokens) * cacheCreationRatio
 		}
-		calculateQuota += float64(completionTokens) * completionRatio
+		calculateQuota += CompletionTokensWithRatio(&relayInfo.PriceData, completionTokens, reasoningTokens).InexactFloat64()
 		calculateQuota = calculateQuota * groupRatio * modelRatio
 	} else {
 		calculateQuota = modelPrice * common.QuotaPerUnit * groupRatio
 	}
 
+	// claude web search tool 计费
+	var claudeWebSearchPrice float64
+	claudeWebSearchCallCount := ctx.GetInt("claude_web_search_requests")
+	if claudeWebSearchCallCount > 0 {
+		claudeWebSearchPrice = ToolCallPricePerThousand(modelName, dto.BuildInToolClaudeWebSearch, "")
+		calculateQuota += ToolCallQuota(claudeWebSearchPrice, claudeWebSearchCallCount, groupRatio).InexactFloat64()
+	}
+
 	if modelRatio != 0 && calculateQuota <= 0 {
 		calculateQuota = 1
 	}
 
 	quota := int(calculateQuota)
+	expressionQuota, expressionInfo, useExpression := SettlePricingExpressionQuota(ctx, relayInfo, usage, relayInfo.ChannelType != constant.ChannelTypeOpenRouter)
+	if useExpression {
+		quota = expressionQuota
+	}
 
 	totalTokens := promptTokens + completionTokens
 
@@ -317,6 +338,15 @@ func PostClaudeConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo,
 		cacheCreationTokens5m, cacheCreationRatio5m,
 		cacheCreationTokens1h, cacheCreationRatio1h,
 		modelPrice, relayInfo.PriceData.GroupRatioInfo.GroupSpecialRatio)
+	AppendReasoningInfo(&relayInfo.PriceData, other, reasoningTokens)
+	if claudeWebSearchCallCount > 0 {
+		other["web_search"] = true
+		other["web_search_call_count"] = claudeWebSearchCallCount
+		other["web_search_price"] = claudeWebSearchPrice
+	}
+	for key, value := range expressionInfo {
+		other[key] = value
+	}
 	model.RecordConsumeLog(ctx, relayInfo.UserId, model.RecordConsumeLogParams{
 		ChannelId:        relayInfo.ChannelId,
 		PromptTokens:     promptTokens,
@@ -329,6 +359,8 @@ func PostClaudeConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo,
 		UseTimeSeconds:   int(useTimeSeconds),
 		IsStream:         relayInfo.IsStream,
 		Group:            relayInfo.UsingGroup,
+		UpstreamCost:     CalculateRelayUpstreamCost(relayInfo, quota),
+		ReasoningTokens:  reasoningTokens,
 		Other:            other,
 	})
 
@@ -369,6 +401,7 @@ func PostAudioConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, u
 	audioRatio := decimal.NewFromFloat(ratio_setting.GetAudioRatio(relayInfo.OriginModelName))
 	audioCompletionRatio := decimal.NewFromFloat(ratio_setting.GetAudioCompletionRatio(relayInfo.OriginModelName))
 
+	relayInfo.PriceData.ApplyPricingTier(usage.PromptTokens, usage.CompletionTokens)
 	modelRatio := relayInfo.PriceData.ModelRatio
 	groupRatio := relayInfo.PriceData.GroupRatioInfo.GroupRatio
 	modelPrice := relayInfo.PriceData.ModelPrice
@@ -390,6 +423,10 @@ func PostAudioConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, u
 	}
 
 	quota := calculateAudioQuota(quotaInfo)
+	expressionQuota, expressionInfo, useExpression := SettlePricingExpressionQuota(ctx, relayInfo, usage, false)
+	if useExpression {
+		quota = expressionQuota
+	}
 
 	totalTokens := usage.TotalTokens
 	var logContent string
@@ -423,6 +460,9 @@ func PostAudioConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, u
 	}
 	other := GenerateAudioOtherInfo(ctx, relayInfo, usage, modelRatio, groupRatio,
 		completionRatio.InexactFloat64(), audioRatio.InexactFloat64(), audioCompletionRatio.InexactFloat64(), modelPrice, relayInfo.PriceData.GroupRatioInfo.GroupSpecialRatio)
+	for key, value := range expressionInfo {
+		other[key] = value
+	}
 	model.RecordConsumeLog(ctx, relayInfo.UserId, model.RecordConsumeLogParams{
 		ChannelId:        relayInfo.ChannelId,
 		PromptTokens:     usage.PromptTokens,
@@ -435,6 +475,8 @@ func PostAudioConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, u
 		UseTimeSeconds:   int(useTimeSeconds),
 		IsStream:         relayInfo.IsStream,
 		Group:            relayInfo.UsingGroup,
+		UpstreamCost:     CalculateRelayUpstreamCost(relayInfo, quota),
+		ReasoningTokens:  usage.CompletionTokenDetails.ReasoningTokens,
 		Other:            other,
 	})
 }
@@ -449,20 +491,94 @@ func PreConsumeTokenQuota(relayInfo *relaycommon.RelayInfo, quota int) error {
 	//if relayInfo.TokenUnlimited {
 	//	return nil
 	//}
-	token, err := model.GetTokenByKey(relayInfo.TokenKey, false)
+	token, err := model.GetCachedTokenById(relayInfo.TokenId)
 	if err != nil {
 		return err
 	}
 	if !relayInfo.TokenUnlimited && token.RemainQuota < quota {
 		return fmt.Errorf("token quota is not enough, token remain quota: %s, need quota: %s", logger.FormatQuota(token.RemainQuota), logger.FormatQuota(quota))
 	}
-	err = model.DecreaseTokenQuota(relayInfo.TokenId, relayInfo.TokenKey, quota)
+	if token.HasBudget() {
+		if err := checkTokenBudget(relayInfo, token, quota); err != nil {
+			return err
+		}
+	}
+	if relayInfo.ClientTokenId != 0 {
+		if err := model.PreConsumeClientTokenQuota(relayInfo.ClientTokenId, quota); err != nil {
+			if errors.Is(err, model.ErrClientTokenQuotaExceeded) {
+				return errors.New("客户端令牌额度不足")
+			}
+			return err
+		}
+	}
+	if quota == 0 {
+		return nil
+	}
+	if token.HasBudget() && token.BudgetLimit > 0 {
+		err = model.DecreaseTokenQuotaWithinBudget(relayInfo.TokenId, quota)
+		if errors.Is(err, model.ErrTokenBudgetExceeded) {
+			err = tokenBudgetExceededError(token)
+		}
+	} else {
+		err = model.DecreaseTokenQuota(relayInfo.TokenId, relayInfo.TokenKey, quota)
+	}
 	if err != nil {
+		updateClientTokenQuota(relayInfo.ClientTokenId, -quota)
+		return err
+	}
+	return nil
+}
+
+// updateClientTokenQuota 结算、退款时同步调整客户端令牌已用额度，失败只记录日志
+func updateClientTokenQuota(clientTokenId int, delta int) {
+	if clientTokenId == 0 || delta == 0 {
+		return
+	}
+	if err := model.DeltaUpdateClientTokenQuota(clientTokenId, delta); err != nil {
+		common.SysLog(fmt.Sprintf("failed to update client token %d quota: %s", clientTokenId, err.Error()))
+	}
+}
+
+// checkTokenBudget 校验令牌周期预算：窗口过期时先重置，超过硬上限拒绝，首次超过软上限时通知用户
+func checkTokenBudget(relayInfo *relaycommon.RelayInfo, token *model.Token, quota int) error {
+	if err := model.RefreshTokenBudgetWindow(token); err != nil {
 		return err
 	}
+	if token.BudgetLimit > 0 && token.BudgetUsed+quota > token.BudgetLimit {
+		return tokenBudgetExceededError(token)
+	}
+	if token.BudgetSoftLimit > 0 && !token.BudgetNotified && token.BudgetUsed+quota >= token.BudgetSoftLimit {
+		marked, err := model.MarkTokenBudgetNotified(token)
+		if err != nil {
+			common.SysLog(fmt.Sprintf("failed to mark token %d budget notified: %s", token.Id, err.Error()))
+		} else if marked {
+			sendTokenBudgetNotify(relayInfo, token)
+		}
+	}
 	return nil
 }
 
+func tokenBudgetExceededError(token *model.Token) error {
+	return fmt.Errorf("token %s budget exceeded, used: %s, limit: %s, resets at %s",
+		token.BudgetPeriod, logger.FormatQuota(token.BudgetUsed), logger.FormatQuota(token.BudgetLimit),
+		time.Unix(token.BudgetResetAt(), 0).Format(time.RFC3339))
+}
+
+func sendTokenBudgetNotify(relayInfo *relaycommon.RelayInfo, token *model.Token) {
+	used := logger.FormatQuota(token.BudgetUsed)
+	softLimit := logger.FormatQuota(token.BudgetSoftLimit)
+	name := token.Name
+	gopool.Go(func() {
+		prompt := "令牌周期预算即将用尽"
+		content := "令牌 {{value}} 本周期已使用 {{value}}，已超过预警额度 {{value}}。"
+		values := []interface{}{name, used, softLimit}
+		err := NotifyUser(relayInfo.UserId, relayInfo.UserEmail, relayInfo.UserSetting, dto.NewNotify(dto.NotifyTypeTokenBudget, prompt, content, values))
+		if err != nil {
+			common.SysError(fmt.Sprintf("failed to send token budget notify to user %d: %s", relayInfo.UserId, err.Error()))
+		}
+	})
+}
+
 func PostConsumeQuota(relayInfo *relaycommon.RelayInfo, quota int, preConsumedQuota int, sendEmail bool) (err error) {
 
 	// 1) Consume from wallet quota OR subscription item
@@ -477,6 +593,11 @@ func PostConsumeQuota(relayInfo *relaycommon.RelayInfo, quota int, preConsumedQu
 			}
 			relayInfo.SubscriptionPostDelta += delta
 		}
+	} else if relayInfo != nil && relayInfo.OrgId != 0 {
+		// 组织令牌（含无 BillingSession 的按次计费路径）
+		if err := model.DeltaUpdateOrganizationQuota(relayInfo.OrgId, relayInfo.UserId, quota); err != nil {
+			return err
+		}
 	} else {
 		// Wallet
 		if quota > 0 {
@@ -498,9 +619,10 @@ func PostConsumeQuota(relayInfo *relaycommon.RelayInfo, quota int, preConsumedQu
 		if err != nil {
 			return err
 		}
+		updateClientTokenQuota(relayInfo.ClientTokenId, quota)
 	}
 
-	if sendEmail {
+	if sendEmail && relayInfo.OrgId == 0 {
 		if (quota + preConsumedQuota) != 0 {
 			checkAndSendQuotaNotify(relayInfo, quota, preConsumedQuota)
 		}
@@ -0,0 +1,94 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+const structuredOutputFixerPrompt = "You repair JSON documents. Rewrite the given output so that it is a single JSON value strictly conforming to the given JSON Schema. " +
+	"Keep the original information whenever possible. Reply with the JSON value only, without markdown fences or explanations."
+
+// ParseStructuredOutputSchema 解析 response_format.json_schema 中的 schema，非 json_schema 格式返回 ok=false
+func ParseStructuredOutputSchema(format *dto.ResponseFormat) (schema any, name string, ok bool, err error) {
+	if format == nil || format.Type != "json_schema" || len(format.JsonSchema) == 0 {
+		return nil, "", false, nil
+	}
+	var jsonSchema struct {
+		Name   string `json:"name"`
+		Schema any    `json:"schema"`
+	}
+	if err := common.Unmarshal(format.JsonSchema, &jsonSchema); err != nil {
+		return nil, "", false, fmt.Errorf("invalid response_format.json_schema: %w", err)
+	}
+	if jsonSchema.Schema == nil {
+		return nil, "", false, nil
+	}
+	return jsonSchema.Schema, jsonSchema.Name, true, nil
+}
+
+// ValidateStructuredOutputContent 校验助手回复是否为符合 schema 的 JSON
+func ValidateStructuredOutputContent(schema any, content string) error {
+	var value any
+	if err := common.UnmarshalJsonStr(strings.TrimSpace(content), &value); err != nil {
+		return fmt.Errorf("assistant message is not valid JSON: %w", err)
+	}
+	return common.ValidateJSONSchema(schema, value)
+}
+
+// ValidateStructuredOutputResponse 从 OpenAI 格式的非流式响应中取出助手回复并校验，返回回复内容。
+// 模型拒答（refusal）时不做校验。
+func ValidateStructuredOutputResponse(schema any, body []byte) (string, error) {
+	message := gjson.GetBytes(body, "choices.0.message")
+	if !message.Exists() {
+		return "", errors.New("response has no assistant message")
+	}
+	if refusal := message.Get("refusal"); refusal.Exists() && refusal.String() != "" {
+		return "", nil
+	}
+	content := message.Get("content").String()
+	return content, ValidateStructuredOutputContent(schema, content)
+}
+
+// ReplaceStructuredOutputContent 将响应中的助手回复替换为修复后的内容
+func ReplaceStructuredOutputContent(body []byte, content string) ([]byte, error) {
+	return sjson.SetBytes(body, "choices.0.message.content", content)
+}
+
+// BuildStructuredOutputFixRequest 构造交给修复模型的请求
+func BuildStructuredOutputFixRequest(fixerModel string, state *relaycommon.StructuredOutputState) (*dto.GeneralOpenAIRequest, error) {
+	schemaJson, err := common.Marshal(state.Schema)
+	if err != nil {
+		return nil, err
+	}
+	userPrompt := fmt.Sprintf("JSON Schema:\n%s\n\nValidation error:\n%s\n\nOutput to repair:\n%s", string(schemaJson), state.LastError, state.LastContent)
+	return &dto.GeneralOpenAIRequest{
+		Model: fixerModel,
+		Messages: []dto.Message{
+			{Role: "system", Content: structuredOutputFixerPrompt},
+			{Role: "user", Content: userPrompt},
+		},
+		ResponseFormat: &dto.ResponseFormat{Type: "json_object"},
+	}, nil
+}
+
+// NewStructuredOutputError 构造结构化输出校验失败的错误，retryable 为 false 时不再切换渠道重试
+func NewStructuredOutputError(state *relaycommon.StructuredOutputState, retryable bool) *types.NewAPIError {
+	err := fmt.Errorf("structured output does not match response_format json_schema after %d attempt(s): %s", state.Failures, state.LastError)
+	if state.SchemaName != "" {
+		err = fmt.Errorf("structured output does not match response_format json_schema %q after %d attempt(s): %s", state.SchemaName, state.Failures, state.LastError)
+	}
+	if retryable {
+		return types.NewErrorWithStatusCode(err, types.ErrorCodeStructuredOutputInvalid, http.StatusUnprocessableEntity)
+	}
+	return types.NewErrorWithStatusCode(err, types.ErrorCodeStructuredOutputInvalid, http.StatusUnprocessableEntity, types.ErrOptionWithSkipRetry())
+}
@@ -67,6 +67,17 @@ func runSubscriptionQuotaResetOnce() {
 			break
 		}
 	}
+	for {
+		n, err := model.ExpireDueUserGroupGrants(subscriptionResetBatchSize)
+		if err != nil {
+			logger.LogWarn(ctx, fmt.Sprintf("group grant expire task failed: %v", err))
+			return
+		}
+		totalExpired += n
+		if n < subscriptionResetBatchSize {
+			break
+		}
+	}
 	for {
 		n, err := model.ResetDueSubscriptions(subscriptionResetBatchSize)
 		if err != nil {
@@ -0,0 +1,344 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+)
+
+const (
+	ToolEmulationCallStartTag = "<tool_call>"
+	ToolEmulationCallEndTag   = "</tool_call>"
+)
+
+// EmulatedTool 注入到提示词中的工具定义
+type EmulatedTool struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Parameters  any    `json:"parameters,omitempty"`
+}
+
+// EmulatedToolCall 从模型输出中解析出的工具调用，Arguments 为 JSON 字符串
+type EmulatedToolCall struct {
+	Name      string
+	Arguments string
+}
+
+// ToolEmulationSegment 解析结果片段，Call 为 nil 时表示普通文本
+type ToolEmulationSegment struct {
+	Text string
+	Call *EmulatedToolCall
+}
+
+// BuildToolEmulationPrompt 生成工具定义及严格调用格式的系统提示词
+func BuildToolEmulationPrompt(tools []EmulatedTool, required bool, forcedTool string) string {
+	toolsJson, _ := common.Marshal(tools)
+	var sb strings.Builder
+	sb.WriteString("# Tools\n\nYou may call one or more of the following tools to help answer the user. Tool definitions (JSON Schema parameters):\n<tools>\n")
+	sb.Write(toolsJson)
+	sb.WriteString("\n</tools>\n\n")
+	sb.WriteString("To call a tool, output exactly one block per call in this format and nothing else inside the block:\n")
+	sb.WriteString(ToolEmulationCallStartTag + `{"name": "<tool name>", "arguments": {<arguments as a JSON object>}}` + ToolEmulationCallEndTag + "\n\n")
+	sb.WriteString("Rules:\n")
+	sb.WriteString("- The content of each block must be a single valid JSON object and the arguments must follow the tool's parameters schema.\n")
+	sb.WriteString("- You may output several blocks to call several tools. After the last block stop and wait for the results.\n")
+	sb.WriteString("- Tool results are returned to you inside <tool_result> blocks.\n")
+	sb.WriteString("- Only call tools that are listed above. Never invent tool results.\n")
+	if forcedTool != "" {
+		sb.WriteString(fmt.Sprintf("- You must call the tool %q in this turn.\n", forcedTool))
+	} else if required {
+		sb.WriteString("- You must call at least one tool in this turn.\n")
+	}
+	return sb.String()
+}
+
+func formatEmulatedToolCall(name string, arguments string) string {
+	args := strings.TrimSpace(arguments)
+	if args == "" || !json.Valid([]byte(args)) {
+		args = "{}"
+	}
+	nameJson, _ := common.Marshal(name)
+	return ToolEmulationCallStartTag + `{"name": ` + string(nameJson) + `, "arguments": ` + args + `}` + ToolEmulationCallEndTag
+}
+
+func formatEmulatedToolResult(name string, id string, content string) string {
+	return fmt.Sprintf("<tool_result name=%q id=%q>\n%s\n</tool_result>", name, id, content)
+}
+
+// ApplyOpenAIToolEmulation 将 OpenAI 请求中的工具定义和工具调用历史改写为纯文本提示词，
+// 返回 false 表示请求不包含工具，无需模拟
+func ApplyOpenAIToolEmulation(request *dto.GeneralOpenAIRequest) bool {
+	if request == nil || len(request.Tools) == 0 {
+		return false
+	}
+	required, forcedTool, disabled := parseOpenAIToolChoice(request.ToolChoice)
+	tools := make([]EmulatedTool, 0, len(request.Tools))
+	for _, tool := range request.Tools {
+		if tool.Type != "" && tool.Type != "function" {
+			continue
+		}
+		tools = append(tools, EmulatedTool{
+			Name:        tool.Function.Name,
+			Description: tool.Function.Description,
+			Parameters:  tool.Function.Parameters,
+		})
+	}
+
+	toolNames := make(map[string]string)
+	messages := make([]dto.Message, 0, len(request.Messages)+1)
+	for _, message := range request.Messages {
+		switch {
+		case message.Role == "assistant" && len(message.ToolCalls) > 0:
+			var sb strings.Builder
+			sb.WriteString(message.StringContent())
+			for _, call := range message.ParseToolCalls() {
+				toolNames[call.ID] = call.Function.Name
+				if sb.Len() > 0 {
+					sb.WriteString("\n")
+				}
+				sb.WriteString(formatEmulatedToolCall(call.Function.Name, call.Function.Arguments))
+			}
+			message.ToolCalls = nil
+			message.SetStringContent(sb.String())
+			messages = append(messages, message)
+		case message.Role == "tool":
+			result := formatEmulatedToolResult(toolNames[message.ToolCallId], message.ToolCallId, message.StringContent())
+			// 连续的工具结果合并为一条用户消息
+			if last := len(messages) - 1; last >= 0 && messages[last].Role == "user" && strings.HasSuffix(messages[last].StringContent(), "</tool_result>") {
+				messages[last].SetStringContent(messages[last].StringContent() + "\n" + result)
+				continue
+			}
+			messages = append(messages, dto.Message{Role: "user", Content: result})
+		default:
+			messages = append(messages, message)
+		}
+	}
+
+	if !disabled && len(tools) > 0 {
+		prompt := BuildToolEmulationPrompt(tools, required, forcedTool)
+		if len(messages) > 0 && messages[0].Role == "system" && messages[0].IsStringContent() {
+			messages[0].SetStringContent(messages[0].StringContent() + "\n\n" + prompt)
+		} else {
+			messages = append([]dto.Message{{Role: "system", Content: prompt}}, messages...)
+		}
+	}
+	request.Messages = messages
+	request.Tools = nil
+	request.ToolChoice = nil
+	request.ParallelTooCalls = nil
+	return true
+}
+
+func parseOpenAIToolChoice(toolChoice any) (required bool, forcedTool string, disabled bool) {
+	switch choice := toolChoice.(type) {
+	case string:
+		return choice == "required", "", choice == "none"
+	case map[string]any:
+		if function, ok := choice["function"].(map[string]any); ok {
+			name, _ := function["name"].(string)
+			return true, name, false
+		}
+	}
+	return false, "", false
+}
+
+// ApplyClaudeToolEmulation 将 Claude 请求中的工具定义、tool_use 和 tool_result 改写为纯文本提示词，
+// 返回 false 表示请求不包含工具，无需模拟
+func ApplyClaudeToolEmulation(request *dto.ClaudeRequest) bool {
+	if request == nil || len(request.GetTools()) == 0 {
+		return false
+	}
+	var rawTools []struct {
+		Type        string `json:"type"`
+		Name        string `json:"name"`
+		Description string `json:"description"`
+		InputSchema any    `json:"input_schema"`
+	}
+	toolsJson, err := common.Marshal(request.Tools)
+	if err != nil || common.Unmarshal(toolsJson, &rawTools) != nil {
+		return false
+	}
+	tools := make([]EmulatedTool, 0, len(rawTools))
+	for _, tool := range rawTools {
+		// 服务端工具（web_search 等）无法模拟
+		if tool.Type != "" && tool.Type != "custom" {
+			continue
+		}
+		tools = append(tools, EmulatedTool{Name: tool.Name, Description: tool.Description, Parameters: tool.InputSchema})
+	}
+
+	required, forcedTool, disabled := false, "", false
+	if choiceJson, err := common.Marshal(request.ToolChoice); err == nil && request.ToolChoice != nil {
+		var choice dto.ClaudeToolChoice
+		if common.Unmarshal(choiceJson, &choice) == nil {
+			required = choice.Type == "any" || choice.Type == "tool"
+			disabled = choice.Type == "none"
+			if choice.Type == "tool" {
+				forcedTool = choice.Name
+			}
+		}
+	}
+
+	toolNames := make(map[string]string)
+	for i, message := range request.Messages {
+		if message.IsStringContent() {
+			continue
+		}
+		contents, err := message.ParseContent()
+		if err != nil {
+			continue
+		}
+		changed := false
+		newContents := make([]dto.ClaudeMediaMessage, 0, len(contents))
+		for _, content := range contents {
+			var text string
+			switch content.Type {
+			case "tool_use":
+				toolNames[content.Id] = content.Name
+				input, _ := common.Marshal(content.Input)
+				text = formatEmulatedToolCall(content.Name, string(input))
+			case "tool_result":
+				text = formatEmulatedToolResult(toolNames[content.ToolUseId], content.ToolUseId, content.GetStringContent())
+			default:
+				newContents = append(newContents, content)
+				continue
+			}
+			changed = true
+			block := dto.ClaudeMediaMessage{Type: dto.ContentTypeText}
+			block.SetText(text)
+			newContents = append(newContents, block)
+		}
+		if changed {
+			request.Messages[i].SetContent(newContents)
+		}
+	}
+
+	if !disabled && len(tools) > 0 {
+		prompt := BuildToolEmulationPrompt(tools, required, forcedTool)
+		if request.System == nil {
+			request.SetStringSystem(prompt)
+		} else if request.IsStringSystem() {
+			request.SetStringSystem(request.GetStringSystem() + "\n\n" + prompt)
+		} else {
+			block := dto.ClaudeMediaMessage{Type: dto.ContentTypeText}
+			block.SetText(prompt)
+			request.System = append(request.ParseSystem(), block)
+		}
+	}
+	request.Tools = nil
+	request.ToolChoice = nil
+	return true
+}
+
+// ToolEmulationParser 从模型输出中流式解析 <tool_call> 块，
+// 可能是起始标签前缀的内容会暂存，直到能确定是否为工具调用
+type ToolEmulationParser struct {
+	pending string
+	inCall  bool
+}
+
+func (p *ToolEmulationParser) Feed(text string) []ToolEmulationSegment {
+	p.pending += text
+	var segments []ToolEmulationSegment
+	for {
+		if p.inCall {
+			end := strings.Index(p.pending, ToolEmulationCallEndTag)
+			if end < 0 {
+				return segments
+			}
+			segments = append(segments, parseToolEmulationBlock(p.pending[:end]))
+			p.pending = p.pending[end+len(ToolEmulationCallEndTag):]
+			p.inCall = false
+			continue
+		}
+		start := strings.Index(p.pending, ToolEmulationCallStartTag)
+		if start >= 0 {
+			if start > 0 {
+				segments = append(segments, ToolEmulationSegment{Text: p.pending[:start]})
+			}
+			p.pending = p.pending[start+len(ToolEmulationCallStartTag):]
+			p.inCall = true
+			continue
+		}
+		keep := partialTagSuffixLen(p.pending, ToolEmulationCallStartTag)
+		if emit := p.pending[:len(p.pending)-keep]; emit != "" {
+			segments = append(segments, ToolEmulationSegment{Text: emit})
+		}
+		p.pending = p.pending[len(p.pending)-keep:]
+		return segments
+	}
+}
+
+// Flush 输出剩余内容，未闭合的工具调用块（上游在结束标签前停止）仍尝试解析
+func (p *ToolEmulationParser) Flush() []ToolEmulationSegment {
+	pending, inCall := p.pending, p.inCall
+	p.pending, p.inCall = "", false
+	if pending == "" {
+		return nil
+	}
+	if inCall {
+		return []ToolEmulationSegment{parseToolEmulationBlock(pending)}
+	}
+	return []ToolEmulationSegment{{Text: pending}}
+}
+
+// ParseEmulatedToolCalls 解析完整的模型输出，返回去除工具调用块后的文本和工具调用
+func ParseEmulatedToolCalls(text string) (string, []EmulatedToolCall) {
+	var parser ToolEmulationParser
+	segments := append(parser.Feed(text), parser.Flush()...)
+	var sb strings.Builder
+	var calls []EmulatedToolCall
+	for _, segment := range segments {
+		if segment.Call != nil {
+			calls = append(calls, *segment.Call)
+			continue
+		}
+		sb.WriteString(segment.Text)
+	}
+	if len(calls) == 0 {
+		return text, nil
+	}
+	return strings.TrimSpace(sb.String()), calls
+}
+
+func partialTagSuffixLen(s string, tag string) int {
+	for n := min(len(s), len(tag)-1); n > 0; n-- {
+		if strings.HasSuffix(s, tag[:n]) {
+			return n
+		}
+	}
+	return 0
+}
+
+func parseToolEmulationBlock(raw string) ToolEmulationSegment {
+	body := strings.TrimSpace(raw)
+	body = strings.TrimPrefix(body, "```json")
+	body = strings.TrimPrefix(body, "```")
+	body = strings.TrimSpace(strings.TrimSuffix(body, "```"))
+	var call struct {
+		Name       string          `json:"name"`
+		Arguments  json.RawMessage `json:"arguments"`
+		Parameters json.RawMessage `json:"parameters"`
+	}
+	if err := common.UnmarshalJsonStr(body, &call); err != nil || call.Name == "" {
+		// 格式不正确时按普通文本原样返回
+		return ToolEmulationSegment{Text: ToolEmulationCallStartTag + raw + ToolEmulationCallEndTag}
+	}
+	arguments := call.Arguments
+	if len(arguments) == 0 {
+		arguments = call.Parameters
+	}
+	args := strings.TrimSpace(string(arguments))
+	// 部分模型会把 arguments 输出为 JSON 字符串
+	var argsString string
+	if strings.HasPrefix(args, `"`) && common.UnmarshalJsonStr(args, &argsString) == nil {
+		args = argsString
+	}
+	if args == "" || args == "null" {
+		args = "{}"
+	}
+	return ToolEmulationSegment{Call: &EmulatedToolCall{Name: call.Name, Arguments: args}}
+}
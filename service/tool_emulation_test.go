@@ -0,0 +1,41 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestToolEmulationParserStreaming(t *testing.T) {
+	t.Parallel()
+
+	var parser ToolEmulationParser
+	var segments []ToolEmulationSegment
+	for _, chunk := range []string{"Let me check.", "<tool", "_call>{\"name\":\"get_weather\",", "\"arguments\":{\"city\":\"Paris\"}}</tool_", "call> done"} {
+		segments = append(segments, parser.Feed(chunk)...)
+	}
+	segments = append(segments, parser.Flush()...)
+
+	require.Len(t, segments, 3)
+	require.Equal(t, "Let me check.", segments[0].Text)
+	require.NotNil(t, segments[1].Call)
+	require.Equal(t, "get_weather", segments[1].Call.Name)
+	require.JSONEq(t, `{"city":"Paris"}`, segments[1].Call.Arguments)
+	require.Equal(t, " done", segments[2].Text)
+}
+
+func TestParseEmulatedToolCalls(t *testing.T) {
+	t.Parallel()
+
+	text, calls := ParseEmulatedToolCalls("<tool_call>\n```json\n{\"name\":\"search\",\"arguments\":\"{\\\"q\\\":\\\"go\\\"}\"}\n```\n</tool_call>")
+	require.Empty(t, text)
+	require.Len(t, calls, 1)
+	require.Equal(t, "search", calls[0].Name)
+	require.JSONEq(t, `{"q":"go"}`, calls[0].Arguments)
+
+	// 格式错误的块按普通文本保留
+	raw := "answer <tool_call>not json</tool_call>"
+	text, calls = ParseEmulatedToolCalls(raw)
+	require.Equal(t, raw, text)
+	require.Empty(t, calls)
+}
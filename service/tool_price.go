@@ -0,0 +1,59 @@
+package service
+
+import (
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/shopspring/decimal"
+)
+
+// ToolCallPricePerThousand 返回内置工具每千次调用价格（美元），优先使用 ToolCallPrice 配置，未配置时使用内置价格
+func ToolCallPricePerThousand(modelName string, tool string, searchContextSize string) float64 {
+	if price, ok := ratio_setting.GetToolCallPrice(modelName, tool); ok {
+		return price
+	}
+	switch tool {
+	case dto.BuildInToolWebSearchPreview:
+		return operation_setting.GetWebSearchPricePerThousand(modelName, searchContextSize)
+	case dto.BuildInToolFileSearch:
+		return operation_setting.GetFileSearchPricePerThousand()
+	case dto.BuildInToolClaudeWebSearch:
+		return operation_setting.GetClaudeWebSearchPricePerThousand()
+	}
+	return 0
+}
+
+// ToolCallQuota 工具调用额度 = 每千次价格 * 调用次数 / 1000 * 分组倍率
+func ToolCallQuota(pricePerThousand float64, callCount int, groupRatio float64) decimal.Decimal {
+	return decimal.NewFromFloat(pricePerThousand).
+		Mul(decimal.NewFromInt(int64(callCount))).
+		Div(decimal.NewFromInt(1000)).
+		Mul(decimal.NewFromFloat(groupRatio)).
+		Mul(decimal.NewFromFloat(common.QuotaPerUnit))
+}
+
+// CompletionTokensWithRatio 输出 tokens 乘以补全倍率，配置了推理倍率时推理 tokens 按推理倍率单独计价
+func CompletionTokensWithRatio(priceData *types.PriceData, completionTokens int, reasoningTokens int) decimal.Decimal {
+	dCompletionTokens := decimal.NewFromInt(int64(completionTokens))
+	dCompletionRatio := decimal.NewFromFloat(priceData.CompletionRatio)
+	if !priceData.HasReasoningRatio || reasoningTokens <= 0 {
+		return dCompletionTokens.Mul(dCompletionRatio)
+	}
+	dReasoningTokens := decimal.NewFromInt(int64(min(reasoningTokens, completionTokens)))
+	return dCompletionTokens.Sub(dReasoningTokens).Mul(dCompletionRatio).
+		Add(dReasoningTokens.Mul(decimal.NewFromFloat(priceData.ReasoningRatio)))
+}
+
+// AppendReasoningInfo 在消费日志中记录推理 tokens 及其倍率
+func AppendReasoningInfo(priceData *types.PriceData, other map[string]interface{}, reasoningTokens int) {
+	if reasoningTokens <= 0 {
+		return
+	}
+	other["reasoning_tokens"] = reasoningTokens
+	if priceData.HasReasoningRatio {
+		other["reasoning_ratio"] = priceData.ReasoningRatio
+	}
+}
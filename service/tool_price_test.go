@@ -0,0 +1,19 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompletionTokensWithRatio(t *testing.T) {
+	priceData := &types.PriceData{CompletionRatio: 4}
+	require.Equal(t, float64(4000), CompletionTokensWithRatio(priceData, 1000, 600).InexactFloat64())
+
+	priceData.HasReasoningRatio = true
+	priceData.ReasoningRatio = 2
+	require.Equal(t, float64(400*4+600*2), CompletionTokensWithRatio(priceData, 1000, 600).InexactFloat64())
+	// 推理 tokens 不应超过输出 tokens
+	require.Equal(t, float64(200), CompletionTokensWithRatio(priceData, 100, 300).InexactFloat64())
+}
@@ -0,0 +1,43 @@
+package service
+
+import (
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+
+	"github.com/shopspring/decimal"
+)
+
+// upstreamCostQuota 将用户实际扣费还原为本站原价（去掉分组倍率，按原价与实际价格之比换算价格计划和合同价）后乘以渠道成本比例
+func upstreamCostQuota(quota int, groupRatio float64, listPriceScale float64, costRatio float64) int {
+	// 免费分组无法从扣费还原原价
+	if quota <= 0 || groupRatio <= 0 || costRatio <= 0 {
+		return 0
+	}
+	base := decimal.NewFromInt(int64(quota)).Div(decimal.NewFromFloat(groupRatio))
+	if listPriceScale > 0 {
+		base = base.Mul(decimal.NewFromFloat(listPriceScale))
+	}
+	return int(base.Mul(decimal.NewFromFloat(costRatio)).Round(0).IntPart())
+}
+
+// CalculateUpstreamCost 按渠道成本配置估算本次请求的上游成本额度，渠道未配置成本时返回 0
+func CalculateUpstreamCost(channelId int, modelName string, quota int, groupRatio float64, listPriceScale float64) int {
+	if channelId == 0 || quota <= 0 {
+		return 0
+	}
+	channel, err := model.CacheGetChannel(channelId)
+	if err != nil {
+		return 0
+	}
+	costRatio, ok := channel.GetCostRatio(modelName)
+	if !ok {
+		return 0
+	}
+	return upstreamCostQuota(quota, groupRatio, listPriceScale, costRatio)
+}
+
+// CalculateRelayUpstreamCost 使用请求的价格数据估算上游成本
+func CalculateRelayUpstreamCost(relayInfo *relaycommon.RelayInfo, quota int) int {
+	return CalculateUpstreamCost(relayInfo.ChannelId, relayInfo.OriginModelName, quota,
+		relayInfo.PriceData.GroupRatioInfo.GroupRatio, relayInfo.PriceData.ListPriceScale)
+}
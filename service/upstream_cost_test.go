@@ -0,0 +1,18 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpstreamCostQuota(t *testing.T) {
+	// 分组 2 倍、闲时 5 折（原价为实际价格 2 倍）、上游 7 折：原价 1000，成本 700
+	require.Equal(t, 700, upstreamCostQuota(1000, 2, 2, 0.7))
+	// 合同价 0.01 美元/次、原价 0.04 美元/次：原价 2000，成本 1400
+	require.Equal(t, 1400, upstreamCostQuota(500, 1, 4, 0.7))
+	require.Equal(t, 350, upstreamCostQuota(500, 1, 0, 0.7))
+	require.Equal(t, 0, upstreamCostQuota(500, 0, 1, 0.7))
+	require.Equal(t, 0, upstreamCostQuota(0, 1, 1, 0.7))
+	require.Equal(t, 0, upstreamCostQuota(500, 1, 1, 0))
+}
@@ -0,0 +1,93 @@
+package service
+
+import (
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/model_setting"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SetupVirtualModel 请求的模型为虚拟模型时确定本次的目标尝试顺序并保存到上下文，返回是否为虚拟模型
+func SetupVirtualModel(c *gin.Context, modelName string) bool {
+	targets, ok := model_setting.ResolveVirtualModelTargets(modelName)
+	if !ok {
+		return false
+	}
+	common.SetContextKey(c, constant.ContextKeyVirtualModel, modelName)
+	common.SetContextKey(c, constant.ContextKeyVirtualModelTargets, targets)
+	return true
+}
+
+func getVirtualModelTargets(c *gin.Context) []model_setting.VirtualModelTarget {
+	targets, _ := common.GetContextKeyType[[]model_setting.VirtualModelTarget](c, constant.ContextKeyVirtualModelTargets)
+	return targets
+}
+
+// useVirtualModelTarget 切换到第 index 个目标模型，返回目标模型名
+func useVirtualModelTarget(c *gin.Context, index int) (string, bool) {
+	targets := getVirtualModelTargets(c)
+	if index < 0 || index >= len(targets) {
+		return "", false
+	}
+	common.SetContextKey(c, constant.ContextKeyVirtualModelIndex, index)
+	common.SetContextKey(c, constant.ContextKeyVirtualModelParamOverride, targets[index].ParamOverride)
+	// 切换模型后自动分组重新从第一个分组开始选择
+	common.SetContextKey(c, constant.ContextKeyAutoGroupIndex, 0)
+	common.SetContextKey(c, constant.ContextKeyAutoGroupRetryIndex, 0)
+	return targets[index].Model, true
+}
+
+// tokenAllowsModel 按令牌（含客户端令牌）的模型限制检查目标模型是否可用，与分发时的检查一致
+func tokenAllowsModel(c *gin.Context, modelName string) bool {
+	if !common.GetContextKeyBool(c, constant.ContextKeyTokenModelLimitEnabled) {
+		return true
+	}
+	tokenModelLimit, _ := common.GetContextKeyType[map[string]bool](c, constant.ContextKeyTokenModelLimit)
+	_, ok := tokenModelLimit[ratio_setting.FormatMatchingModelName(modelName)]
+	return ok
+}
+
+// NextVirtualModelTarget 切换到虚拟模型的下一个令牌可用的目标模型，非虚拟模型请求或目标已用完时返回 false
+func NextVirtualModelTarget(c *gin.Context) (string, bool) {
+	if common.GetContextKeyString(c, constant.ContextKeyVirtualModel) == "" {
+		return "", false
+	}
+	for index := common.GetContextKeyInt(c, constant.ContextKeyVirtualModelIndex) + 1; ; index++ {
+		modelName, ok := useVirtualModelTarget(c, index)
+		if !ok || tokenAllowsModel(c, modelName) {
+			return modelName, ok
+		}
+	}
+}
+
+// SelectVirtualModelChannel 按顺序为虚拟模型选择第一个有可用渠道的目标模型
+func SelectVirtualModelChannel(c *gin.Context, tokenGroup string) (*model.Channel, string, string, error) {
+	selectGroup := tokenGroup
+	var lastErr error
+	for i := 0; ; i++ {
+		modelName, ok := useVirtualModelTarget(c, i)
+		if !ok {
+			break
+		}
+		if !tokenAllowsModel(c, modelName) {
+			continue
+		}
+		channel, group, err := CacheGetRandomSatisfiedChannel(&RetryParam{
+			Ctx:        c,
+			ModelName:  modelName,
+			TokenGroup: tokenGroup,
+			Retry:      common.GetPointer(0),
+		})
+		if err == nil && channel != nil {
+			return channel, modelName, group, nil
+		}
+		selectGroup = group
+		if err != nil {
+			lastErr = err
+		}
+	}
+	return nil, "", selectGroup, lastErr
+}
@@ -0,0 +1,63 @@
+package service
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/setting/model_setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNextVirtualModelTarget(t *testing.T) {
+	settings := model_setting.GetVirtualModelSettings()
+	old := settings.Models
+	settings.Models = map[string]model_setting.VirtualModel{
+		"smart": {Targets: []model_setting.VirtualModelTarget{
+			{Model: "gpt-4o"},
+			{Model: "claude-sonnet-4", ParamOverride: map[string]interface{}{"temperature": 0.2}},
+		}},
+	}
+	t.Cleanup(func() {
+		settings.Models = old
+	})
+	gin.SetMode(gin.TestMode)
+
+	// 非虚拟模型请求不回退
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	require.False(t, SetupVirtualModel(c, "gpt-4o"))
+	_, ok := NextVirtualModelTarget(c)
+	require.False(t, ok)
+
+	c, _ = gin.CreateTestContext(httptest.NewRecorder())
+	require.True(t, SetupVirtualModel(c, "smart"))
+	modelName, ok := useVirtualModelTarget(c, 0)
+	require.True(t, ok)
+	require.Equal(t, "gpt-4o", modelName)
+	common.SetContextKey(c, constant.ContextKeyAutoGroupIndex, 2)
+
+	modelName, ok = NextVirtualModelTarget(c)
+	require.True(t, ok)
+	require.Equal(t, "claude-sonnet-4", modelName)
+	require.Equal(t, 1, common.GetContextKeyInt(c, constant.ContextKeyVirtualModelIndex))
+	require.Equal(t, map[string]interface{}{"temperature": 0.2}, common.GetContextKeyStringMap(c, constant.ContextKeyVirtualModelParamOverride))
+	// 切换目标后自动分组从头开始
+	require.Equal(t, 0, common.GetContextKeyInt(c, constant.ContextKeyAutoGroupIndex))
+
+	_, ok = NextVirtualModelTarget(c)
+	require.False(t, ok)
+	require.Equal(t, 1, common.GetContextKeyInt(c, constant.ContextKeyVirtualModelIndex))
+
+	// 跳过令牌模型限制不允许的目标
+	c, _ = gin.CreateTestContext(httptest.NewRecorder())
+	require.True(t, SetupVirtualModel(c, "smart"))
+	common.SetContextKey(c, constant.ContextKeyTokenModelLimitEnabled, true)
+	common.SetContextKey(c, constant.ContextKeyTokenModelLimit, map[string]bool{"smart": true, "gpt-4o": true})
+	_, ok = useVirtualModelTarget(c, 0)
+	require.True(t, ok)
+	_, ok = NextVirtualModelTarget(c)
+	require.False(t, ok)
+}
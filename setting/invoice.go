@@ -0,0 +1,5 @@
+package setting
+
+var InvoiceBillingDay = 1        // 每月出账日（1-28）
+var InvoicePaymentTermDays = 15  // 账单出具后的付款期限（天）
+var InvoiceOverdueSuspend = true // 账单逾期后自动暂停信用额度
@@ -0,0 +1,69 @@
+package model_setting
+
+import (
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+const (
+	PromptCacheRuleSourceChannel = "channel"
+	PromptCacheRuleSourceGroup   = "group"
+	PromptCacheRuleSourceDefault = "default"
+)
+
+// PromptCacheSettings 网关自动提示词缓存配置，渠道规则 > 分组规则 > 默认规则
+type PromptCacheSettings struct {
+	Enabled     bool                           `json:"enabled"`
+	DefaultRule dto.PromptCacheRule            `json:"default_rule"`
+	GroupRules  map[string]dto.PromptCacheRule `json:"group_rules"`
+}
+
+// 默认配置
+var defaultPromptCacheSettings = PromptCacheSettings{
+	Enabled: false,
+	DefaultRule: dto.PromptCacheRule{
+		Enabled:         true,
+		CacheSystem:     true,
+		CacheTools:      true,
+		MinPrefixTokens: 1024,
+		TTL:             "5m",
+	},
+	GroupRules: map[string]dto.PromptCacheRule{},
+}
+
+// 全局实例
+var promptCacheSettings = defaultPromptCacheSettings
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("prompt_cache", &promptCacheSettings)
+}
+
+func GetPromptCacheSettings() *PromptCacheSettings {
+	return &promptCacheSettings
+}
+
+// ResolvePromptCacheRule 按 渠道 > 分组 > 默认 的优先级解析生效的缓存规则。
+// 渠道规则不受全局开关影响；返回的 source 用于日志记录。
+func ResolvePromptCacheRule(channelRule *dto.PromptCacheRule, group string, modelName string) (rule dto.PromptCacheRule, source string, ok bool) {
+	switch {
+	case channelRule != nil:
+		rule, source = *channelRule, PromptCacheRuleSourceChannel
+	case !promptCacheSettings.Enabled:
+		return rule, "", false
+	default:
+		if groupRule, exists := promptCacheSettings.GroupRules[group]; exists {
+			rule, source = groupRule, PromptCacheRuleSourceGroup
+		} else {
+			rule, source = promptCacheSettings.DefaultRule, PromptCacheRuleSourceDefault
+		}
+	}
+	if !rule.Enabled || (!rule.CacheSystem && !rule.CacheTools) {
+		return rule, source, false
+	}
+	if len(rule.ModelPatterns) > 0 && !common.MatchAnyRegex(rule.ModelPatterns, modelName) {
+		return rule, source, false
+	}
+	return rule, source, true
+}
@@ -0,0 +1,65 @@
+package model_setting
+
+import (
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+const (
+	// StructuredOutputBillingChargeAll 校验失败的尝试同样向用户计费
+	StructuredOutputBillingChargeAll = "charge_all"
+	// StructuredOutputBillingChargeSuccess 仅对最终返回给用户的结果计费，失败尝试由平台承担
+	StructuredOutputBillingChargeSuccess = "charge_success"
+)
+
+// StructuredOutputSettings 网关结构化输出校验配置：
+// 对 response_format 为 json_schema 的非流式请求校验最终回复，失败时重试或交给修复模型处理
+type StructuredOutputSettings struct {
+	Enabled          bool     `json:"enabled"`
+	ModelPatterns    []string `json:"model_patterns"`     // 模型名正则，为空表示匹配所有模型
+	MaxRetries       int      `json:"max_retries"`        // 校验失败后的最大重试次数
+	RetrySameChannel bool     `json:"retry_same_channel"` // true 在同一渠道重试，false 切换到下一个渠道
+	FixerModel       string   `json:"fixer_model"`        // 重试用尽后用于修复输出的模型，为空表示不修复
+	BillingPolicy    string   `json:"billing_policy"`     // charge_all 或 charge_success
+}
+
+// 默认配置
+var defaultStructuredOutputSettings = StructuredOutputSettings{
+	Enabled:          false,
+	ModelPatterns:    []string{},
+	MaxRetries:       1,
+	RetrySameChannel: false,
+	FixerModel:       "",
+	BillingPolicy:    StructuredOutputBillingChargeSuccess,
+}
+
+// 全局实例
+var structuredOutputSettings = defaultStructuredOutputSettings
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("structured_output", &structuredOutputSettings)
+}
+
+func GetStructuredOutputSettings() *StructuredOutputSettings {
+	return &structuredOutputSettings
+}
+
+// ShouldEnforceStructuredOutput 判断模型是否启用结构化输出校验，渠道开启强制校验时不受全局开关影响
+func ShouldEnforceStructuredOutput(modelName string, channelEnforced bool) bool {
+	if channelEnforced {
+		return true
+	}
+	if !structuredOutputSettings.Enabled {
+		return false
+	}
+	if len(structuredOutputSettings.ModelPatterns) == 0 {
+		return true
+	}
+	return common.MatchAnyRegex(structuredOutputSettings.ModelPatterns, modelName)
+}
+
+// ChargeFailedAttempts 校验失败的尝试是否向用户计费
+func (s *StructuredOutputSettings) ChargeFailedAttempts() bool {
+	return s.BillingPolicy == StructuredOutputBillingChargeAll
+}
@@ -0,0 +1,127 @@
+package model_setting
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// VirtualModelTarget 虚拟模型的一个目标模型
+type VirtualModelTarget struct {
+	Model string `json:"model"`
+	// 大于 0 时，与相邻同样设置了权重的目标组成分流组，组内按权重随机决定尝试顺序，用于 A/B 分流
+	Weight int `json:"weight,omitempty"`
+	// 使用该目标时叠加在渠道参数覆盖之后的参数覆盖，格式同渠道参数覆盖
+	ParamOverride map[string]interface{} `json:"param_override,omitempty"`
+}
+
+// VirtualModel 管理员定义的虚拟模型，请求时按顺序尝试目标模型，前一个无可用渠道或重试用尽后回退到下一个
+type VirtualModel struct {
+	Targets []VirtualModelTarget `json:"targets"`
+}
+
+// VirtualModelSettings 虚拟模型配置，虚拟模型名 -> 定义
+type VirtualModelSettings struct {
+	Models map[string]VirtualModel `json:"models"`
+}
+
+// 默认配置
+var defaultVirtualModelSettings = VirtualModelSettings{
+	Models: map[string]VirtualModel{},
+}
+
+// 全局实例
+var virtualModelSettings = defaultVirtualModelSettings
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("virtual_model", &virtualModelSettings)
+}
+
+func GetVirtualModelSettings() *VirtualModelSettings {
+	return &virtualModelSettings
+}
+
+// ValidateVirtualModels 校验虚拟模型配置
+func ValidateVirtualModels(jsonStr string) error {
+	if jsonStr == "" {
+		return nil
+	}
+	var models map[string]VirtualModel
+	if err := common.UnmarshalJsonStr(jsonStr, &models); err != nil {
+		return err
+	}
+	for name, virtualModel := range models {
+		if len(virtualModel.Targets) == 0 {
+			return fmt.Errorf("虚拟模型 %s 未配置目标模型", name)
+		}
+		for _, target := range virtualModel.Targets {
+			if target.Model == "" {
+				return fmt.Errorf("虚拟模型 %s 的目标模型不能为空", name)
+			}
+			if _, ok := models[target.Model]; ok {
+				return fmt.Errorf("虚拟模型 %s 的目标 %s 不能是虚拟模型", name, target.Model)
+			}
+			if target.Weight < 0 {
+				return errors.New("目标模型权重不能为负数")
+			}
+		}
+	}
+	return nil
+}
+
+// IsVirtualModel 模型名是否为虚拟模型
+func IsVirtualModel(name string) bool {
+	_, ok := virtualModelSettings.Models[name]
+	return ok
+}
+
+// ResolveVirtualModelTargets 返回本次请求的目标尝试顺序，分流组内按权重随机排序
+func ResolveVirtualModelTargets(name string) ([]VirtualModelTarget, bool) {
+	virtualModel, ok := virtualModelSettings.Models[name]
+	if !ok || len(virtualModel.Targets) == 0 {
+		return nil, false
+	}
+	targets := make([]VirtualModelTarget, 0, len(virtualModel.Targets))
+	for i := 0; i < len(virtualModel.Targets); {
+		if virtualModel.Targets[i].Weight <= 0 {
+			targets = append(targets, virtualModel.Targets[i])
+			i++
+			continue
+		}
+		j := i
+		for j < len(virtualModel.Targets) && virtualModel.Targets[j].Weight > 0 {
+			j++
+		}
+		targets = append(targets, weightedShuffle(virtualModel.Targets[i:j])...)
+		i = j
+	}
+	return targets, true
+}
+
+// weightedShuffle 按权重依次不放回抽取
+func weightedShuffle(group []VirtualModelTarget) []VirtualModelTarget {
+	remaining := append([]VirtualModelTarget(nil), group...)
+	result := make([]VirtualModelTarget, 0, len(group))
+	for len(remaining) > 0 {
+		total := 0
+		for _, target := range remaining {
+			total += target.Weight
+		}
+		pick := rand.Intn(total)
+		idx := 0
+		for i, target := range remaining {
+			if pick < target.Weight {
+				idx = i
+				break
+			}
+			pick -= target.Weight
+		}
+		result = append(result, remaining[idx])
+		remaining = append(remaining[:idx], remaining[idx+1:]...)
+	}
+	return result
+}
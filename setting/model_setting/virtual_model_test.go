@@ -0,0 +1,94 @@
+package model_setting
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func setVirtualModels(t *testing.T, models map[string]VirtualModel) {
+	t.Helper()
+	old := virtualModelSettings.Models
+	virtualModelSettings.Models = models
+	t.Cleanup(func() {
+		virtualModelSettings.Models = old
+	})
+}
+
+func targetModels(targets []VirtualModelTarget) []string {
+	names := make([]string, 0, len(targets))
+	for _, target := range targets {
+		names = append(names, target.Model)
+	}
+	return names
+}
+
+func TestValidateVirtualModels(t *testing.T) {
+	tests := []struct {
+		name    string
+		json    string
+		wantErr bool
+	}{
+		{name: "empty", json: ""},
+		{name: "valid", json: `{"smart":{"targets":[{"model":"gpt-4o","weight":3},{"model":"claude-sonnet-4","weight":1},{"model":"gpt-4o-mini"}]}}`},
+		{name: "invalid json", json: `{"smart":`, wantErr: true},
+		{name: "no targets", json: `{"smart":{"targets":[]}}`, wantErr: true},
+		{name: "empty target", json: `{"smart":{"targets":[{"model":""}]}}`, wantErr: true},
+		{name: "nested virtual model", json: `{"smart":{"targets":[{"model":"fast"}]},"fast":{"targets":[{"model":"gpt-4o-mini"}]}}`, wantErr: true},
+		{name: "negative weight", json: `{"smart":{"targets":[{"model":"gpt-4o","weight":-1}]}}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateVirtualModels(tt.json)
+			if tt.wantErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestResolveVirtualModelTargets(t *testing.T) {
+	setVirtualModels(t, map[string]VirtualModel{
+		"smart": {Targets: []VirtualModelTarget{
+			{Model: "a"},
+			{Model: "b", Weight: 1},
+			{Model: "c", Weight: 3},
+			{Model: "d"},
+			{Model: "e", Weight: 2},
+		}},
+	})
+
+	_, ok := ResolveVirtualModelTargets("gpt-4o")
+	require.False(t, ok)
+
+	// 固定目标保持原位，分流组只在组内打乱
+	for i := 0; i < 50; i++ {
+		targets, ok := ResolveVirtualModelTargets("smart")
+		require.True(t, ok)
+		names := targetModels(targets)
+		require.Len(t, names, 5)
+		require.Equal(t, "a", names[0])
+		require.ElementsMatch(t, []string{"b", "c"}, names[1:3])
+		require.Equal(t, "d", names[3])
+		require.Equal(t, "e", names[4])
+	}
+}
+
+func TestWeightedShuffle(t *testing.T) {
+	group := []VirtualModelTarget{{Model: "heavy", Weight: 9}, {Model: "light", Weight: 1}}
+	heavyFirst := 0
+	for i := 0; i < 2000; i++ {
+		result := weightedShuffle(group)
+		require.ElementsMatch(t, []string{"heavy", "light"}, targetModels(result))
+		if result[0].Model == "heavy" {
+			heavyFirst++
+		}
+	}
+	// 期望约 90% 的请求先尝试权重较大的目标
+	require.Greater(t, heavyFirst, 1600)
+	require.Less(t, heavyFirst, 1950)
+	// 不修改配置中的目标顺序
+	require.Equal(t, []string{"heavy", "light"}, targetModels(group))
+}
@@ -0,0 +1,10 @@
+package setting
+
+var PayPalClientId = ""
+var PayPalClientSecret = ""
+var PayPalWebhookId = ""
+var PayPalSandbox = false
+var PayPalApiBase = "" // 自定义 API 地址，留空按 PayPalSandbox 选择官方环境
+var PayPalCurrency = "USD"
+var PayPalUnitPrice = 1.0
+var PayPalMinTopUp = 1
@@ -0,0 +1,35 @@
+package ratio_setting
+
+import (
+	"fmt"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/types"
+)
+
+// channelTagCostRatioMap 渠道标签 -> 上游成本比例，渠道自身未配置成本时使用
+var channelTagCostRatioMap = types.NewRWMap[string, float64]()
+
+func ChannelTagCostRatio2JSONString() string {
+	return channelTagCostRatioMap.MarshalJSONString()
+}
+
+func UpdateChannelTagCostRatioByJSONString(jsonStr string) error {
+	var ratios map[string]float64
+	if err := common.Unmarshal([]byte(jsonStr), &ratios); err != nil {
+		return err
+	}
+	for tag, ratio := range ratios {
+		if ratio < 0 {
+			return fmt.Errorf("标签 %s 的成本比例不能为负数", tag)
+		}
+	}
+	return types.LoadFromJsonString(channelTagCostRatioMap, jsonStr)
+}
+
+func GetChannelTagCostRatio(tag string) (float64, bool) {
+	if tag == "" {
+		return 0, false
+	}
+	return channelTagCostRatioMap.Get(tag)
+}
@@ -0,0 +1,50 @@
+package ratio_setting
+
+import (
+	"fmt"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/types"
+)
+
+// 默认配置不设置 Price，沿用模型固定价格作为每秒价格
+var defaultMediaPricing = map[string]types.MediaPricing{
+	"sora-2": {
+		Unit:           types.MediaPricingUnitSecond,
+		DefaultSeconds: 4,
+		Resolution:     map[string]float64{"720x1280": 1, "1280x720": 1},
+	},
+	"sora-2-pro": {
+		Unit:           types.MediaPricingUnitSecond,
+		DefaultSeconds: 4,
+		Resolution:     map[string]float64{"720x1280": 1, "1280x720": 1, "1792x1024": 1.666667, "1024x1792": 1.666667},
+	},
+}
+
+var mediaPricingMap = types.NewRWMap[string, types.MediaPricing]()
+
+func MediaPricing2JSONString() string {
+	return mediaPricingMap.MarshalJSONString()
+}
+
+func UpdateMediaPricingByJSONString(jsonStr string) error {
+	var pricing map[string]types.MediaPricing
+	if err := common.Unmarshal([]byte(jsonStr), &pricing); err != nil {
+		return err
+	}
+	for name, item := range pricing {
+		if err := item.Validate(); err != nil {
+			return fmt.Errorf("模型 %s: %w", name, err)
+		}
+	}
+	return types.LoadFromJsonStringWithCallback(mediaPricingMap, jsonStr, InvalidateExposedDataCache)
+}
+
+// GetMediaPricing 返回模型的媒体计费配置，Price 为 0 时由调用方使用模型固定价格
+func GetMediaPricing(name string) (*types.MediaPricing, bool) {
+	pricing, ok := mediaPricingMap.Get(FormatMatchingModelName(name))
+	if !ok {
+		return nil, false
+	}
+	return &pricing, true
+}
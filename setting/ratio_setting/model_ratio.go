@@ -339,6 +339,8 @@ func InitRatioSettings() {
 	imageRatioMap.AddAll(defaultImageRatio)
 	audioRatioMap.AddAll(defaultAudioRatio)
 	audioCompletionRatioMap.AddAll(defaultAudioCompletionRatio)
+	modelPricingTiersMap.AddAll(defaultModelPricingTiers)
+	mediaPricingMap.AddAll(defaultMediaPricing)
 }
 
 func GetModelPriceMap() map[string]float64 {
@@ -0,0 +1,59 @@
+package ratio_setting
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/pkg/billingexpr"
+	"github.com/QuantumNous/new-api/types"
+)
+
+// 模型 -> 计费表达式，表达式结果为本次请求的美元价格（不含分组倍率），配置后优先于模型倍率和固定价格
+var pricingExpressionMap = types.NewRWMap[string, string]()
+
+var pricingExpressionPrograms atomic.Pointer[map[string]*billingexpr.Program]
+
+func PricingExpression2JSONString() string {
+	return pricingExpressionMap.MarshalJSONString()
+}
+
+func compilePricingExpressions(expressions map[string]string) (map[string]*billingexpr.Program, error) {
+	programs := make(map[string]*billingexpr.Program, len(expressions))
+	for name, source := range expressions {
+		program, err := billingexpr.Compile(source)
+		if err != nil {
+			return nil, fmt.Errorf("模型 %s: %w", name, err)
+		}
+		programs[name] = program
+	}
+	return programs, nil
+}
+
+func UpdatePricingExpressionByJSONString(jsonStr string) error {
+	var expressions map[string]string
+	if err := common.Unmarshal([]byte(jsonStr), &expressions); err != nil {
+		return err
+	}
+	programs, err := compilePricingExpressions(expressions)
+	if err != nil {
+		return err
+	}
+	if err := types.LoadFromJsonStringWithCallback(pricingExpressionMap, jsonStr, InvalidateExposedDataCache); err != nil {
+		return err
+	}
+	pricingExpressionPrograms.Store(&programs)
+	return nil
+}
+
+// GetPricingExpression 返回模型的计费表达式，未配置时返回 nil
+func GetPricingExpression(name string) *billingexpr.Program {
+	programs := pricingExpressionPrograms.Load()
+	if programs == nil {
+		return nil
+	}
+	if program, ok := (*programs)[name]; ok {
+		return program
+	}
+	return (*programs)[FormatMatchingModelName(name)]
+}
@@ -0,0 +1,48 @@
+package ratio_setting
+
+import (
+	"fmt"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/types"
+)
+
+// 长上下文加价：Gemini 2.5 Pro、Claude Sonnet 4 / 4.5（1M 上下文）提示超过 200K tokens 时输入输出均按更高价格计费
+var defaultModelPricingTiers = map[string][]types.PricingTier{
+	"gemini-2.5-pro":             {{Name: "long-context", PromptTokensAbove: 200000, ModelRatio: 1.25, CompletionRatio: 6}},
+	"gemini-2.5-pro-thinking-*":  {{Name: "long-context", PromptTokensAbove: 200000, ModelRatio: 1.25, CompletionRatio: 6}},
+	"claude-sonnet-4-20250514":   {{Name: "long-context", PromptTokensAbove: 200000, ModelRatio: 3, CompletionRatio: 3.75}},
+	"claude-sonnet-4-5-20250929": {{Name: "long-context", PromptTokensAbove: 200000, ModelRatio: 3, CompletionRatio: 3.75}},
+}
+
+var modelPricingTiersMap = types.NewRWMap[string, []types.PricingTier]()
+
+func ModelPricingTiers2JSONString() string {
+	return modelPricingTiersMap.MarshalJSONString()
+}
+
+func UpdateModelPricingTiersByJSONString(jsonStr string) error {
+	var tiers map[string][]types.PricingTier
+	if err := common.Unmarshal([]byte(jsonStr), &tiers); err != nil {
+		return err
+	}
+	for name, modelTiers := range tiers {
+		for _, tier := range modelTiers {
+			if tier.PromptTokensAbove < 0 || tier.CompletionTokensAbove < 0 ||
+				tier.ModelRatio < 0 || tier.CompletionRatio < 0 || tier.CacheRatio < 0 {
+				return fmt.Errorf("模型 %s 的分档价格不能为负数", name)
+			}
+		}
+	}
+	return types.LoadFromJsonStringWithCallback(modelPricingTiersMap, jsonStr, InvalidateExposedDataCache)
+}
+
+// GetModelPricingTiers 返回模型的分档价格，未配置时为 nil
+func GetModelPricingTiers(name string) []types.PricingTier {
+	tiers, _ := modelPricingTiersMap.Get(FormatMatchingModelName(name))
+	return tiers
+}
+
+func GetModelPricingTiersCopy() map[string][]types.PricingTier {
+	return modelPricingTiersMap.ReadAll()
+}
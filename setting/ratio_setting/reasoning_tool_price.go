@@ -0,0 +1,73 @@
+package ratio_setting
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/types"
+)
+
+// 模型 -> 推理 tokens 倍率（相对模型倍率，与补全倍率同口径），未配置的模型推理 tokens 按补全倍率计费
+var reasoningRatioMap = types.NewRWMap[string, float64]()
+
+// 工具 -> 每千次调用价格（美元），可用 "模型:工具" 按模型覆盖，优先于内置的工具价格
+var toolCallPriceMap = types.NewRWMap[string, float64]()
+
+func ReasoningRatio2JSONString() string {
+	return reasoningRatioMap.MarshalJSONString()
+}
+
+func UpdateReasoningRatioByJSONString(jsonStr string) error {
+	var ratios map[string]float64
+	if err := common.Unmarshal([]byte(jsonStr), &ratios); err != nil {
+		return err
+	}
+	for name, ratio := range ratios {
+		if ratio < 0 {
+			return fmt.Errorf("模型 %s 的推理倍率不能为负数", name)
+		}
+	}
+	return types.LoadFromJsonStringWithCallback(reasoningRatioMap, jsonStr, InvalidateExposedDataCache)
+}
+
+// GetReasoningRatio 返回模型的推理 tokens 倍率，未配置时 ok 为 false
+func GetReasoningRatio(name string) (float64, bool) {
+	if ratio, ok := reasoningRatioMap.Get(name); ok {
+		return ratio, true
+	}
+	return reasoningRatioMap.Get(FormatMatchingModelName(name))
+}
+
+func ToolCallPrice2JSONString() string {
+	return toolCallPriceMap.MarshalJSONString()
+}
+
+func UpdateToolCallPriceByJSONString(jsonStr string) error {
+	var prices map[string]float64
+	if err := common.Unmarshal([]byte(jsonStr), &prices); err != nil {
+		return err
+	}
+	for key, price := range prices {
+		if price < 0 {
+			return fmt.Errorf("%s 的调用价格不能为负数", key)
+		}
+		if strings.TrimSpace(key) == "" || strings.HasSuffix(key, ":") {
+			return fmt.Errorf("无效的工具名称 %q", key)
+		}
+	}
+	return types.LoadFromJsonStringWithCallback(toolCallPriceMap, jsonStr, InvalidateExposedDataCache)
+}
+
+// GetToolCallPrice 返回工具每千次调用价格，按 模型:工具 > 工具 的顺序匹配，未配置时 ok 为 false
+func GetToolCallPrice(modelName string, tool string) (float64, bool) {
+	if modelName != "" {
+		if price, ok := toolCallPriceMap.Get(modelName + ":" + tool); ok {
+			return price, true
+		}
+		if price, ok := toolCallPriceMap.Get(FormatMatchingModelName(modelName) + ":" + tool); ok {
+			return price, true
+		}
+	}
+	return toolCallPriceMap.Get(tool)
+}
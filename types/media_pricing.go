@@ -0,0 +1,138 @@
+package types
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	MediaPricingUnitSecond = "second" // 按生成时长计费
+	MediaPricingUnitItem   = "item"   // 按生成数量计费（图片、按条计费的视频）
+)
+
+// MediaParams 图片、视频生成请求中参与计费的参数
+type MediaParams struct {
+	Seconds    float64 `json:"seconds,omitempty"`
+	Resolution string  `json:"resolution,omitempty"` // 如 720p、1080p
+	Size       string  `json:"size,omitempty"`       // 如 1280x720
+	Fps        int     `json:"fps,omitempty"`
+	Quality    string  `json:"quality,omitempty"` // 如 standard、hd、pro
+	Count      int     `json:"count,omitempty"`   // 生成数量，0 视为 1
+}
+
+// MediaPricing 媒体模型的声明式价格：单价（美元）× 时长或数量 × 各维度倍率。
+// 维度表为空时不参与计费；非空时请求值必须在表内，避免按未知规格低价出图
+type MediaPricing struct {
+	Unit           string             `json:"unit"`
+	Price          float64            `json:"price"`                     // 每秒或每张的基础价格
+	DefaultSeconds float64            `json:"default_seconds,omitempty"` // 请求未指定时长时使用
+	MaxSeconds     float64            `json:"max_seconds,omitempty"`
+	Resolution     map[string]float64 `json:"resolution,omitempty"` // 尺寸（如 1792x1024）或分辨率（如 1080p）-> 倍率
+	Fps            map[string]float64 `json:"fps,omitempty"`
+	Quality        map[string]float64 `json:"quality,omitempty"`
+}
+
+func (p *MediaPricing) Validate() error {
+	if p.Unit != MediaPricingUnitSecond && p.Unit != MediaPricingUnitItem {
+		return fmt.Errorf("无效的计费单位 %s", p.Unit)
+	}
+	if p.Price < 0 || p.DefaultSeconds < 0 || p.MaxSeconds < 0 {
+		return fmt.Errorf("价格和时长不能为负数")
+	}
+	for _, table := range []map[string]float64{p.Resolution, p.Fps, p.Quality} {
+		for key, ratio := range table {
+			if ratio < 0 {
+				return fmt.Errorf("%s 的倍率不能为负数", key)
+			}
+		}
+	}
+	return nil
+}
+
+func lookupMediaRatio(table map[string]float64, dimension string, values ...string) (float64, error) {
+	if len(table) == 0 {
+		return 1, nil
+	}
+	specified := ""
+	for _, value := range values {
+		if value == "" {
+			continue
+		}
+		if ratio, ok := table[value]; ok {
+			return ratio, nil
+		}
+		if ratio, ok := table[strings.ToLower(value)]; ok {
+			return ratio, nil
+		}
+		if specified == "" {
+			specified = value
+		}
+	}
+	if specified == "" {
+		if ratio, ok := table["default"]; ok {
+			return ratio, nil
+		}
+		return 1, nil
+	}
+	return 0, fmt.Errorf("不支持的%s: %s", dimension, specified)
+}
+
+// Seconds 返回计费时长，未指定时使用默认时长
+func (p *MediaPricing) Seconds(params MediaParams) float64 {
+	if params.Seconds > 0 {
+		return params.Seconds
+	}
+	return p.DefaultSeconds
+}
+
+// Ratios 计算各计费维度的倍率，与 Price 相乘即为本次请求的价格（美元）
+func (p *MediaPricing) Ratios(params MediaParams) (map[string]float64, error) {
+	ratios := make(map[string]float64)
+	if p.Unit == MediaPricingUnitSecond {
+		seconds := p.Seconds(params)
+		if seconds <= 0 {
+			return nil, fmt.Errorf("缺少视频时长")
+		}
+		if p.MaxSeconds > 0 && seconds > p.MaxSeconds {
+			return nil, fmt.Errorf("视频时长不能超过 %g 秒", p.MaxSeconds)
+		}
+		ratios["seconds"] = seconds
+	}
+	if params.Count > 1 {
+		ratios["count"] = float64(params.Count)
+	}
+	var err error
+	if ratios["resolution"], err = lookupMediaRatio(p.Resolution, "分辨率", params.Size, params.Resolution); err != nil {
+		return nil, err
+	}
+	fps := ""
+	if params.Fps > 0 {
+		fps = strconv.Itoa(params.Fps)
+	}
+	if ratios["fps"], err = lookupMediaRatio(p.Fps, "帧率", fps); err != nil {
+		return nil, err
+	}
+	if ratios["quality"], err = lookupMediaRatio(p.Quality, "质量", params.Quality); err != nil {
+		return nil, err
+	}
+	for key, ratio := range ratios {
+		if ratio == 1 {
+			delete(ratios, key)
+		}
+	}
+	return ratios, nil
+}
+
+// Quote 返回本次请求的价格（美元）与各维度倍率
+func (p *MediaPricing) Quote(params MediaParams) (float64, map[string]float64, error) {
+	ratios, err := p.Ratios(params)
+	if err != nil {
+		return 0, nil, err
+	}
+	price := p.Price
+	for _, ratio := range ratios {
+		price *= ratio
+	}
+	return price, ratios, nil
+}
@@ -0,0 +1,38 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMediaPricingQuote(t *testing.T) {
+	video := MediaPricing{
+		Unit:           MediaPricingUnitSecond,
+		Price:          0.1,
+		DefaultSeconds: 5,
+		MaxSeconds:     10,
+		Resolution:     map[string]float64{"720p": 1, "1080p": 2, "1792x1024": 1.5},
+		Quality:        map[string]float64{"std": 1, "pro": 1.75},
+	}
+
+	price, ratios, err := video.Quote(MediaParams{Seconds: 8, Resolution: "1080P", Quality: "pro"})
+	require.NoError(t, err)
+	require.InDelta(t, 0.1*8*2*1.75, price, 1e-9)
+	require.Equal(t, map[string]float64{"seconds": 8, "resolution": 2, "quality": 1.75}, ratios)
+
+	// 尺寸优先于分辨率，未指定时长使用默认时长
+	price, _, err = video.Quote(MediaParams{Size: "1792x1024", Resolution: "720p"})
+	require.NoError(t, err)
+	require.InDelta(t, 0.1*5*1.5, price, 1e-9)
+
+	_, _, err = video.Quote(MediaParams{Seconds: 12})
+	require.Error(t, err)
+	_, _, err = video.Quote(MediaParams{Seconds: 5, Resolution: "4k"})
+	require.Error(t, err)
+
+	image := MediaPricing{Unit: MediaPricingUnitItem, Price: 0.04, Quality: map[string]float64{"hd": 2}}
+	price, _, err = image.Quote(MediaParams{Count: 3, Quality: "hd", Size: "1024x1024"})
+	require.NoError(t, err)
+	require.InDelta(t, 0.04*3*2, price, 1e-9)
+}
@@ -1,6 +1,10 @@
 package types
 
-import "fmt"
+import (
+	"fmt"
+
+	"github.com/QuantumNous/new-api/pkg/billingexpr"
+)
 
 type GroupRatioInfo struct {
 	GroupRatio        float64
@@ -13,6 +17,8 @@ type PriceData struct {
 	ModelPrice           float64
 	ModelRatio           float64
 	CompletionRatio      float64
+	ReasoningRatio       float64 // 推理 tokens 倍率，仅 HasReasoningRatio 为 true 时生效，否则推理 tokens 按补全倍率计费
+	HasReasoningRatio    bool
 	CacheRatio           float64
 	CacheCreationRatio   float64
 	CacheCreation5mRatio float64
@@ -24,6 +30,15 @@ type PriceData struct {
 	UsePrice             bool
 	QuotaToPreConsume    int // 预消耗额度
 	GroupRatioInfo       GroupRatioInfo
+	PricingTiers         []PricingTier // 模型配置的分档价格
+	PricingTier          *PricingTier  // 当前生效的档位，nil 表示使用基础倍率
+	tierBase             *tierBaseRatios
+	PriceScheduleIds     []int                // 生效的价格计划
+	PriceMultiplier      float64              // 价格计划的时段倍数或合同价倍率，已计入模型倍率或价格
+	ContractPriceId      int                  // 生效的合同价，0 表示未使用
+	MediaRatios          map[string]float64   // 媒体计费各维度倍率，已计入 ModelPrice
+	PricingExpression    *billingexpr.Program // 模型计费表达式，非 nil 时结算按表达式计算
+	ListPriceScale       float64              // 本站原价与实际计费价格（不含分组倍率）之比，用于估算上游成本，0 视为 1
 }
 
 func (p *PriceData) AddOtherRatio(key string, ratio float64) {
@@ -37,9 +52,13 @@ func (p *PriceData) AddOtherRatio(key string, ratio float64) {
 }
 
 type PerCallPriceData struct {
-	ModelPrice     float64
-	Quota          int
-	GroupRatioInfo GroupRatioInfo
+	ModelPrice       float64
+	Quota            int
+	GroupRatioInfo   GroupRatioInfo
+	PriceScheduleIds []int   // 生效的价格计划
+	PriceMultiplier  float64 // 价格计划的时段倍数或合同价倍率，已计入价格
+	ContractPriceId  int     // 生效的合同价
+	ListPriceScale   float64 // 本站原价与实际计费价格（不含分组倍率）之比，用于估算上游成本，0 视为 1
 }
 
 func (p *PriceData) ToSetting() string {
@@ -0,0 +1,78 @@
+package types
+
+import "fmt"
+
+// PricingTier 按请求长度分档的价格。提示 tokens 超过 PromptTokensAbove 且输出 tokens 超过
+// CompletionTokensAbove 时生效；为 0 的倍率沿用模型的基础配置
+type PricingTier struct {
+	Name                  string  `json:"name,omitempty"`
+	PromptTokensAbove     int     `json:"prompt_tokens_above"`
+	CompletionTokensAbove int     `json:"completion_tokens_above,omitempty"`
+	ModelRatio            float64 `json:"model_ratio,omitempty"`
+	CompletionRatio       float64 `json:"completion_ratio,omitempty"`
+	CacheRatio            float64 `json:"cache_ratio,omitempty"`
+}
+
+func (t *PricingTier) Label() string {
+	if t.Name != "" {
+		return t.Name
+	}
+	if t.CompletionTokensAbove > 0 {
+		return fmt.Sprintf("prompt>%d,completion>%d", t.PromptTokensAbove, t.CompletionTokensAbove)
+	}
+	return fmt.Sprintf("prompt>%d", t.PromptTokensAbove)
+}
+
+// MatchPricingTier 返回满足条件的档位中阈值最高的一档，都不满足时返回 nil
+func MatchPricingTier(tiers []PricingTier, promptTokens int, completionTokens int) *PricingTier {
+	var matched *PricingTier
+	for i := range tiers {
+		tier := &tiers[i]
+		if promptTokens <= tier.PromptTokensAbove || completionTokens <= tier.CompletionTokensAbove {
+			continue
+		}
+		if matched == nil || tier.PromptTokensAbove > matched.PromptTokensAbove ||
+			(tier.PromptTokensAbove == matched.PromptTokensAbove && tier.CompletionTokensAbove > matched.CompletionTokensAbove) {
+			matched = tier
+		}
+	}
+	return matched
+}
+
+type tierBaseRatios struct {
+	modelRatio      float64
+	completionRatio float64
+	cacheRatio      float64
+}
+
+// ApplyPricingTier 按用量选择档位并覆盖倍率，可重复调用（预扣按提示长度，结算按实际用量），
+// 每次都以首次调用前的基础倍率为准。返回生效的档位
+func (p *PriceData) ApplyPricingTier(promptTokens int, completionTokens int) *PricingTier {
+	if p.UsePrice || len(p.PricingTiers) == 0 {
+		return nil
+	}
+	if p.tierBase == nil {
+		p.tierBase = &tierBaseRatios{
+			modelRatio:      p.ModelRatio,
+			completionRatio: p.CompletionRatio,
+			cacheRatio:      p.CacheRatio,
+		}
+	}
+	p.ModelRatio = p.tierBase.modelRatio
+	p.CompletionRatio = p.tierBase.completionRatio
+	p.CacheRatio = p.tierBase.cacheRatio
+	p.PricingTier = MatchPricingTier(p.PricingTiers, promptTokens, completionTokens)
+	if p.PricingTier == nil {
+		return nil
+	}
+	if p.PricingTier.ModelRatio > 0 {
+		p.ModelRatio = p.PricingTier.ModelRatio
+	}
+	if p.PricingTier.CompletionRatio > 0 {
+		p.CompletionRatio = p.PricingTier.CompletionRatio
+	}
+	if p.PricingTier.CacheRatio > 0 {
+		p.CacheRatio = p.PricingTier.CacheRatio
+	}
+	return p.PricingTier
+}
@@ -0,0 +1,50 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyPricingTier(t *testing.T) {
+	t.Parallel()
+
+	p := &PriceData{
+		ModelRatio:      1.5,
+		CompletionRatio: 5,
+		CacheRatio:      0.1,
+		PricingTiers: []PricingTier{
+			{PromptTokensAbove: 200000, ModelRatio: 3, CompletionRatio: 3.75},
+			{Name: "long-output", PromptTokensAbove: 200000, CompletionTokensAbove: 32000, CompletionRatio: 4},
+			{PromptTokensAbove: 32000, ModelRatio: 2},
+		},
+	}
+
+	require.Nil(t, p.ApplyPricingTier(1000, 100))
+	require.Equal(t, 1.5, p.ModelRatio)
+
+	tier := p.ApplyPricingTier(250000, 100)
+	require.NotNil(t, tier)
+	require.Equal(t, "prompt>200000", tier.Label())
+	require.Equal(t, 3.0, p.ModelRatio)
+	require.Equal(t, 3.75, p.CompletionRatio)
+	require.Equal(t, 0.1, p.CacheRatio)
+
+	tier = p.ApplyPricingTier(250000, 40000)
+	require.Equal(t, "long-output", tier.Label())
+	require.Equal(t, 1.5, p.ModelRatio)
+	require.Equal(t, 4.0, p.CompletionRatio)
+
+	// 结算用量回落到低档时恢复基础倍率
+	tier = p.ApplyPricingTier(50000, 100)
+	require.Equal(t, "prompt>32000", tier.Label())
+	require.Equal(t, 2.0, p.ModelRatio)
+	require.Equal(t, 5.0, p.CompletionRatio)
+
+	require.Nil(t, p.ApplyPricingTier(32000, 100))
+	require.Equal(t, 1.5, p.ModelRatio)
+	require.Nil(t, p.PricingTier)
+
+	p.UsePrice = true
+	require.Nil(t, p.ApplyPricingTier(250000, 100))
+}
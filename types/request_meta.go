@@ -26,7 +26,8 @@ type TokenCountMeta struct {
 	Files         []*FileMeta `json:"files,omitempty"`          // List of files, each with type and content
 	MaxTokens     int         `json:"max_tokens,omitempty"`     // Maximum tokens allowed in the request
 
-	ImagePriceRatio float64 `json:"image_ratio,omitempty"` // Ratio for image size, if applicable
+	ImagePriceRatio float64      `json:"image_ratio,omitempty"` // Ratio for image size, if applicable
+	Media           *MediaParams `json:"media,omitempty"`       // 图片生成的计费参数，模型配置了媒体计费时替代 ImagePriceRatio
 	//IsStreaming   bool        `json:"is_streaming,omitempty"`   // Indicates if the request is streaming
 }
 
@@ -0,0 +1,63 @@
+/*
+Copyright (C) 2025 QuantumNous
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as
+published by the Free Software Foundation, either version 3 of the
+License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+For commercial licensing, please contact support@quantumnous.com
+*/
+
+import React from 'react';
+import { Modal, Input, Typography } from '@douyinfe/semi-ui';
+import { showError } from '../../../helpers';
+
+/**
+ * 令牌 key 只在创建时返回一次，需要完整令牌的功能（聊天链接、一键填充等）由用户粘贴已保存的令牌
+ * @param {Function} t - 翻译函数
+ * @param {string} maskedKey - 列表中返回的掩码 key（如 "abcd1234********"），用于校验粘贴的令牌
+ * @returns {Promise<string|null>} 不含 "sk-" 前缀的令牌，取消或不匹配时为 null
+ */
+export function promptTokenKey(t, maskedKey = '') {
+  const prefix = maskedKey.replace(/\*+$/, '');
+  let value = '';
+  return new Promise((resolve) => {
+    Modal.confirm({
+      title: t('请输入令牌'),
+      content: (
+        <div>
+          <Typography.Text type='tertiary'>
+            {t('令牌仅在创建时显示一次，请粘贴已保存的完整令牌')}
+          </Typography.Text>
+          <Input
+            className='mt-2'
+            placeholder='sk-...'
+            autoFocus
+            onChange={(v) => {
+              value = v;
+            }}
+          />
+        </div>
+      ),
+      onOk: () => {
+        const key = value.trim().replace(/^sk-/, '');
+        if (!key || (prefix && !key.startsWith(prefix))) {
+          showError(t('令牌与所选记录不匹配'));
+          resolve(null);
+          return;
+        }
+        resolve(key);
+      },
+      onCancel: () => resolve(null),
+    });
+  });
+}
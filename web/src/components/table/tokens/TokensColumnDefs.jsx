@@ -40,12 +40,7 @@ import {
   getModelCategories,
   showError,
 } from '../../../helpers';
-import {
-  IconTreeTriangleDown,
-  IconCopy,
-  IconEyeOpened,
-  IconEyeClosed,
-} from '@douyinfe/semi-icons';
+import { IconTreeTriangleDown } from '@douyinfe/semi-icons';
 
 // progress color helper
 const getProgressColor = (pct) => {
@@ -108,45 +103,11 @@ const renderGroupColumn = (text, record, t) => {
 };
 
 // Render token key column with show/hide and copy functionality
-const renderTokenKey = (text, record, showKeys, setShowKeys, copyText) => {
-  const fullKey = 'sk-' + record.key;
-  const maskedKey =
-    'sk-' + record.key.slice(0, 4) + '**********' + record.key.slice(-4);
-  const revealed = !!showKeys[record.id];
-
+// 令牌 key 仅在创建时展示一次，列表中只返回前缀
+const renderTokenKey = (text, record) => {
   return (
     <div className='w-[200px]'>
-      <Input
-        readOnly
-        value={revealed ? fullKey : maskedKey}
-        size='small'
-        suffix={
-          <div className='flex items-center'>
-            <Button
-              theme='borderless'
-              size='small'
-              type='tertiary'
-              icon={revealed ? <IconEyeClosed /> : <IconEyeOpened />}
-              aria-label='toggle token visibility'
-              onClick={(e) => {
-                e.stopPropagation();
-                setShowKeys((prev) => ({ ...prev, [record.id]: !revealed }));
-              }}
-            />
-            <Button
-              theme='borderless'
-              size='small'
-              type='tertiary'
-              icon={<IconCopy />}
-              aria-label='copy token key'
-              onClick={async (e) => {
-                e.stopPropagation();
-                await copyText(fullKey);
-              }}
-            />
-          </div>
-        }
-      />
+      <Input readOnly value={'sk-' + record.key} size='small' />
     </div>
   );
 };
@@ -461,7 +422,7 @@ export const getTokensColumns = ({
       title: t('密钥'),
       key: 'token_key',
       render: (text, record) =>
-        renderTokenKey(text, record, showKeys, setShowKeys, copyText),
+        renderTokenKey(text, record),
     },
     {
       title: t('可用模型'),
@@ -41,6 +41,7 @@ import EditTokenModal from './modals/EditTokenModal';
 import { useTokensData } from '../../../hooks/tokens/useTokensData';
 import { useIsMobile } from '../../../hooks/common/useIsMobile';
 import { createCardProPagination } from '../../../helpers/utils';
+import { promptTokenKey } from '../../common/modals/TokenKeyPromptModal';
 
 function TokensPage() {
   // Define the function first, then pass it into the hook to avoid TDZ errors
@@ -184,7 +185,7 @@ function TokensPage() {
   openFluentNotificationRef.current = openFluentNotification;
 
   // Prefill to Fluent handler
-  const handlePrefillToFluent = () => {
+  const handlePrefillToFluent = async () => {
     const {
       tokens,
       selectedKeys,
@@ -227,7 +228,12 @@ function TokensPage() {
         Toast.warning(t('没有可用令牌用于填充'));
         return;
       }
-      apiKeyToUse = 'sk-' + token.key;
+      // 列表只返回掩码 key，需要用户粘贴已保存的完整令牌
+      const key = await promptTokenKey(t, token.key);
+      if (!key) {
+        return;
+      }
+      apiKeyToUse = 'sk-' + key;
     }
 
     const payload = {
@@ -335,9 +341,7 @@ function TokensPage() {
     selectedKeys,
     setEditingToken,
     setShowEdit,
-    batchCopyTokens,
     batchDeleteTokens,
-    copyText,
 
     // Filters state
     formInitValues,
@@ -378,9 +382,7 @@ function TokensPage() {
               selectedKeys={selectedKeys}
               setEditingToken={setEditingToken}
               setShowEdit={setShowEdit}
-              batchCopyTokens={batchCopyTokens}
               batchDeleteTokens={batchDeleteTokens}
-              copyText={copyText}
               t={t}
             />
 
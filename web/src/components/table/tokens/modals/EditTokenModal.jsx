@@ -38,6 +38,7 @@ import {
   Card,
   Tag,
   Avatar,
+  Modal,
   Form,
   Col,
   Row,
@@ -236,6 +237,7 @@ const EditTokenModal = (props) => {
     } else {
       const count = parseInt(values.tokenCount, 10) || 1;
       let successCount = 0;
+      const createdKeys = [];
       for (let i = 0; i < count; i++) {
         let { tokenCount: _tc, ...localInputs } = values;
         const baseName =
@@ -259,16 +261,36 @@ const EditTokenModal = (props) => {
         localInputs.model_limits = localInputs.model_limits.join(',');
         localInputs.model_limits_enabled = localInputs.model_limits.length > 0;
         let res = await API.post(`/api/token/`, localInputs);
-        const { success, message } = res.data;
+        const { success, message, data } = res.data;
         if (success) {
           successCount++;
+          if (data?.key) {
+            createdKeys.push('sk-' + data.key);
+          }
         } else {
           showError(t(message));
           break;
         }
       }
       if (successCount > 0) {
-        showSuccess(t('令牌创建成功，请在列表页面点击复制获取令牌！'));
+        showSuccess(t('令牌创建成功！'));
+        if (createdKeys.length > 0) {
+          Modal.info({
+            title: t('请立即保存令牌'),
+            content: (
+              <div>
+                <Typography.Text type='warning'>
+                  {t('令牌仅显示这一次，关闭后将无法再次查看')}
+                </Typography.Text>
+                {createdKeys.map((k) => (
+                  <Typography.Paragraph key={k} copyable={{ content: k }}>
+                    <code>{k}</code>
+                  </Typography.Paragraph>
+                ))}
+              </div>
+            ),
+          });
+        }
         props.refresh();
         props.handleClose();
       }
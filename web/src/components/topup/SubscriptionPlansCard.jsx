@@ -44,7 +44,11 @@ const { Text } = Typography;
 // 过滤易支付方式
 function getEpayMethods(payMethods = []) {
   return (payMethods || []).filter(
-    (m) => m?.type && m.type !== 'stripe' && m.type !== 'creem',
+    (m) =>
+      m?.type &&
+      m.type !== 'stripe' &&
+      m.type !== 'creem' &&
+      m.type !== 'paypal',
   );
 }
 
@@ -76,6 +80,7 @@ const SubscriptionPlansCard = ({
   payMethods = [],
   enableOnlineTopUp = false,
   enableStripeTopUp = false,
+  enablePayPalTopUp = false,
   enableCreemTopUp = false,
   billingPreference,
   onChangeBillingPreference,
@@ -141,6 +146,30 @@ const SubscriptionPlansCard = ({
     }
   };
 
+  const payPayPal = async () => {
+    setPaying(true);
+    try {
+      const res = await API.post('/api/subscription/paypal/pay', {
+        plan_id: selectedPlan.plan.id,
+      });
+      if (res.data?.message === 'success') {
+        window.open(res.data.data?.pay_link, '_blank');
+        showSuccess(t('已打开支付页面'));
+        closeBuy();
+      } else {
+        const errorMsg =
+          typeof res.data?.data === 'string'
+            ? res.data.data
+            : res.data?.message || t('支付失败');
+        showError(errorMsg);
+      }
+    } catch (e) {
+      showError(t('支付请求失败'));
+    } finally {
+      setPaying(false);
+    }
+  };
+
   const payCreem = async () => {
     if (!selectedPlan?.plan?.creem_product_id) {
       showError(t('该套餐未配置 Creem'));
@@ -664,6 +693,7 @@ const SubscriptionPlansCard = ({
         epayMethods={epayMethods}
         enableOnlineTopUp={enableOnlineTopUp}
         enableStripeTopUp={enableStripeTopUp}
+        enablePayPalTopUp={enablePayPalTopUp}
         enableCreemTopUp={enableCreemTopUp}
         purchaseLimitInfo={
           selectedPlan?.plan?.id
@@ -674,6 +704,7 @@ const SubscriptionPlansCard = ({
             : null
         }
         onPayStripe={payStripe}
+        onPayPayPal={payPayPal}
         onPayCreem={payCreem}
         onPayEpay={payEpay}
       />
@@ -61,6 +61,7 @@ const TopUp = () => {
   const [enableStripeTopUp, setEnableStripeTopUp] = useState(
     statusState?.status?.enable_stripe_topup || false,
   );
+  const [enablePayPalTopUp, setEnablePayPalTopUp] = useState(false);
   const [statusLoading, setStatusLoading] = useState(true);
 
   // Creem 相关状态
@@ -155,6 +156,11 @@ const TopUp = () => {
         showError(t('管理员未开启Stripe充值！'));
         return;
       }
+    } else if (payment === 'paypal') {
+      if (!enablePayPalTopUp) {
+        showError(t('管理员未开启PayPal充值！'));
+        return;
+      }
     } else {
       if (!enableOnlineTopUp) {
         showError(t('管理员未开启在线充值！'));
@@ -165,8 +171,8 @@ const TopUp = () => {
     setPayWay(payment);
     setPaymentLoading(true);
     try {
-      if (payment === 'stripe') {
-        await getStripeAmount();
+      if (payment === 'stripe' || payment === 'paypal') {
+        await getStripeAmount(undefined, payment);
       } else {
         await getAmount();
       }
@@ -184,10 +190,10 @@ const TopUp = () => {
   };
 
   const onlineTopUp = async () => {
-    if (payWay === 'stripe') {
-      // Stripe 支付处理
+    if (payWay === 'stripe' || payWay === 'paypal') {
+      // Stripe / PayPal 支付处理
       if (amount === 0) {
-        await getStripeAmount();
+        await getStripeAmount(undefined, payWay);
       }
     } else {
       // 普通支付处理
@@ -203,11 +209,11 @@ const TopUp = () => {
     setConfirmLoading(true);
     try {
       let res;
-      if (payWay === 'stripe') {
-        // Stripe 支付请求
-        res = await API.post('/api/user/stripe/pay', {
+      if (payWay === 'stripe' || payWay === 'paypal') {
+        // Stripe / PayPal 支付请求
+        res = await API.post(`/api/user/${payWay}/pay`, {
           amount: parseInt(topUpCount),
-          payment_method: 'stripe',
+          payment_method: payWay,
         });
       } else {
         // 普通支付请求
@@ -220,8 +226,8 @@ const TopUp = () => {
       if (res !== undefined) {
         const { message, data } = res.data;
         if (message === 'success') {
-          if (payWay === 'stripe') {
-            // Stripe 支付回调处理
+          if (payWay === 'stripe' || payWay === 'paypal') {
+            // Stripe / PayPal 跳转到支付页面
             window.open(data.pay_link, '_blank');
           } else {
             // 普通支付表单提交
@@ -445,13 +451,17 @@ const TopUp = () => {
           const enableStripeTopUp = data.enable_stripe_topup || false;
           const enableOnlineTopUp = data.enable_online_topup || false;
           const enableCreemTopUp = data.enable_creem_topup || false;
+          const enablePayPalTopUp = data.enable_paypal_topup || false;
           const minTopUpValue = enableOnlineTopUp
             ? data.min_topup
             : enableStripeTopUp
               ? data.stripe_min_topup
-              : 1;
+              : enablePayPalTopUp
+                ? data.paypal_min_topup
+                : 1;
           setEnableOnlineTopUp(enableOnlineTopUp);
           setEnableStripeTopUp(enableStripeTopUp);
+          setEnablePayPalTopUp(enablePayPalTopUp);
           setEnableCreemTopUp(enableCreemTopUp);
           setMinTopUp(minTopUpValue);
           setTopUpCount(minTopUpValue);
@@ -592,13 +602,13 @@ const TopUp = () => {
     setAmountLoading(false);
   };
 
-  const getStripeAmount = async (value) => {
+  const getStripeAmount = async (value, way = 'stripe') => {
     if (value === undefined) {
       value = topUpCount;
     }
     setAmountLoading(true);
     try {
-      const res = await API.post('/api/user/stripe/amount', {
+      const res = await API.post(`/api/user/${way}/amount`, {
         amount: parseFloat(value),
       });
       if (res !== undefined) {
@@ -737,6 +747,7 @@ const TopUp = () => {
           t={t}
           enableOnlineTopUp={enableOnlineTopUp}
           enableStripeTopUp={enableStripeTopUp}
+          enablePayPalTopUp={enablePayPalTopUp}
           enableCreemTopUp={enableCreemTopUp}
           creemProducts={creemProducts}
           creemPreTopUp={creemPreTopUp}
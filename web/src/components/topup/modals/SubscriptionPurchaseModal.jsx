@@ -29,7 +29,7 @@ import {
   Tooltip,
 } from '@douyinfe/semi-ui';
 import { Crown, CalendarClock, Package } from 'lucide-react';
-import { SiStripe } from 'react-icons/si';
+import { SiStripe, SiPaypal } from 'react-icons/si';
 import { IconCreditCard } from '@douyinfe/semi-icons';
 import { renderQuota } from '../../../helpers';
 import { getCurrencyConfig } from '../../../helpers/render';
@@ -51,9 +51,11 @@ const SubscriptionPurchaseModal = ({
   epayMethods = [],
   enableOnlineTopUp = false,
   enableStripeTopUp = false,
+  enablePayPalTopUp = false,
   enableCreemTopUp = false,
   purchaseLimitInfo = null,
   onPayStripe,
+  onPayPayPal,
   onPayCreem,
   onPayEpay,
 }) => {
@@ -68,8 +70,10 @@ const SubscriptionPurchaseModal = ({
   // 只有当管理员开启支付网关 AND 套餐配置了对应的支付ID时才显示
   const hasStripe = enableStripeTopUp && !!plan?.stripe_price_id;
   const hasCreem = enableCreemTopUp && !!plan?.creem_product_id;
+  // PayPal 按套餐价格直接下单，无需额外配置
+  const hasPayPal = enablePayPalTopUp;
   const hasEpay = enableOnlineTopUp && epayMethods.length > 0;
-  const hasAnyPayment = hasStripe || hasCreem || hasEpay;
+  const hasAnyPayment = hasStripe || hasCreem || hasPayPal || hasEpay;
   const purchaseLimit = Number(purchaseLimitInfo?.limit || 0);
   const purchaseCount = Number(purchaseLimitInfo?.count || 0);
   const purchaseLimitReached =
@@ -185,8 +189,8 @@ const SubscriptionPurchaseModal = ({
                 {t('选择支付方式')}：
               </Text>
 
-              {/* Stripe / Creem */}
-              {(hasStripe || hasCreem) && (
+              {/* Stripe / PayPal / Creem */}
+              {(hasStripe || hasPayPal || hasCreem) && (
                 <div className='flex gap-2'>
                   {hasStripe && (
                     <Button
@@ -200,6 +204,18 @@ const SubscriptionPurchaseModal = ({
                       Stripe
                     </Button>
                   )}
+                  {hasPayPal && (
+                    <Button
+                      theme='light'
+                      className='flex-1'
+                      icon={<SiPaypal size={14} color='#003087' />}
+                      onClick={onPayPayPal}
+                      loading={paying}
+                      disabled={purchaseLimitReached}
+                    >
+                      PayPal
+                    </Button>
+                  )}
                   {hasCreem && (
                     <Button
                       theme='light'
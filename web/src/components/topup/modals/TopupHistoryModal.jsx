@@ -45,6 +45,7 @@ const STATUS_CONFIG = {
   success: { type: 'success', key: '成功' },
   pending: { type: 'warning', key: '待支付' },
   expired: { type: 'danger', key: '已过期' },
+  refunded: { type: 'warning', key: '已退款' },
 };
 
 // 支付方式映射
@@ -17,27 +17,6 @@ along with this program. If not, see <https://www.gnu.org/licenses/>.
 For commercial licensing, please contact support@quantumnous.com
 */
 
-import { API } from './api';
-
-/**
- * 获取可用的token keys
- * @returns {Promise<string[]>} 返回active状态的token key数组
- */
-export async function fetchTokenKeys() {
-  try {
-    const response = await API.get('/api/token/?p=1&size=10');
-    const { success, data } = response.data;
-    if (!success) throw new Error('Failed to fetch token keys');
-
-    const tokenItems = Array.isArray(data) ? data : data.items || [];
-    const activeTokens = tokenItems.filter((token) => token.status === 1);
-    return activeTokens.map((token) => token.key);
-  } catch (error) {
-    console.error('Error fetching token keys:', error);
-    return [];
-  }
-}
-
 /**
  * 获取服务器地址
  * @returns {string} 服务器地址
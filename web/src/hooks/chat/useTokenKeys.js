@@ -18,28 +18,27 @@ For commercial licensing, please contact support@quantumnous.com
 */
 
 import { useEffect, useState } from 'react';
-import { fetchTokenKeys, getServerAddress } from '../../helpers/token';
-import { showError } from '../../helpers';
+import { useTranslation } from 'react-i18next';
+import { getServerAddress } from '../../helpers/token';
+import { promptTokenKey } from '../../components/common/modals/TokenKeyPromptModal';
 
+// 令牌 key 只在创建时返回一次，聊天页面使用用户粘贴的已保存令牌
 export function useTokenKeys(id) {
+  const { t } = useTranslation();
   const [keys, setKeys] = useState([]);
   const [serverAddress, setServerAddress] = useState('');
   const [isLoading, setIsLoading] = useState(true);
 
   useEffect(() => {
     const loadAllData = async () => {
-      const fetchedKeys = await fetchTokenKeys();
-      if (fetchedKeys.length === 0) {
-        showError('当前没有可用的启用令牌，请确认是否有令牌处于启用状态！');
-        setTimeout(() => {
-          window.location.href = '/console/token';
-        }, 1500); // 延迟 1.5 秒后跳转
+      setServerAddress(getServerAddress());
+      const key = await promptTokenKey(t);
+      if (!key) {
+        window.location.href = '/console/token';
+        return;
       }
-      setKeys(fetchedKeys);
+      setKeys([key]);
       setIsLoading(false);
-
-      const address = getServerAddress();
-      setServerAddress(address);
     };
 
     loadAllData();
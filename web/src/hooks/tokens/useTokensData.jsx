@@ -29,6 +29,7 @@ import {
 } from '../../helpers';
 import { ITEMS_PER_PAGE } from '../../constants';
 import { useTableCompactMode } from '../common/useTableCompactMode';
+import { promptTokenKey } from '../../components/common/modals/TokenKeyPromptModal';
 
 export const useTokensData = (openFluentNotification) => {
   const { t } = useTranslation();
@@ -123,9 +124,14 @@ export const useTokensData = (openFluentNotification) => {
   };
 
   // Open link function for chat integrations
+  // 列表只返回掩码 key，需要用户粘贴已保存的完整令牌
   const onOpenLink = async (type, url, record) => {
+    const key = await promptTokenKey(t, record.key);
+    if (!key) {
+      return;
+    }
     if (url && url.startsWith('fluent')) {
-      openFluentNotification(record.key);
+      openFluentNotification(key);
       return;
     }
     let status = localStorage.getItem('status');
@@ -141,7 +147,7 @@ export const useTokensData = (openFluentNotification) => {
       let cherryConfig = {
         id: 'new-api',
         baseUrl: serverAddress,
-        apiKey: 'sk-' + record.key,
+        apiKey: 'sk-' + key,
       };
       let encodedConfig = encodeURIComponent(
         encodeToBase64(JSON.stringify(cherryConfig)),
@@ -150,7 +156,7 @@ export const useTokensData = (openFluentNotification) => {
     } else {
       let encodedServerAddress = encodeURIComponent(serverAddress);
       url = url.replaceAll('{address}', encodedServerAddress);
-      url = url.replaceAll('{key}', 'sk-' + record.key);
+      url = url.replaceAll('{key}', 'sk-' + key);
     }
 
     window.open(url, '_blank');
@@ -299,51 +305,6 @@ export const useTokensData = (openFluentNotification) => {
     }
   };
 
-  // Batch copy tokens
-  const batchCopyTokens = (copyType) => {
-    if (selectedKeys.length === 0) {
-      showError(t('请至少选择一个令牌！'));
-      return;
-    }
-
-    Modal.info({
-      title: t('复制令牌'),
-      icon: null,
-      content: t('请选择你的复制方式'),
-      footer: (
-        <div className='flex gap-2'>
-          <button
-            className='px-3 py-1 bg-gray-200 rounded'
-            onClick={async () => {
-              let content = '';
-              for (let i = 0; i < selectedKeys.length; i++) {
-                content +=
-                  selectedKeys[i].name + '    sk-' + selectedKeys[i].key + '\n';
-              }
-              await copyText(content);
-              Modal.destroyAll();
-            }}
-          >
-            {t('名称+密钥')}
-          </button>
-          <button
-            className='px-3 py-1 bg-blue-500 text-white rounded'
-            onClick={async () => {
-              let content = '';
-              for (let i = 0; i < selectedKeys.length; i++) {
-                content += 'sk-' + selectedKeys[i].key + '\n';
-              }
-              await copyText(content);
-              Modal.destroyAll();
-            }}
-          >
-            {t('仅密钥')}
-          </button>
-        </div>
-      ),
-    });
-  };
-
   // Initialize data
   useEffect(() => {
     loadTokens(1)
@@ -398,7 +359,6 @@ export const useTokensData = (openFluentNotification) => {
     rowSelection,
     handleRow,
     batchDeleteTokens,
-    batchCopyTokens,
     syncPageData,
 
     // Translation
@@ -0,0 +1,229 @@
+/*
+Copyright (C) 2025 QuantumNous
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as
+published by the Free Software Foundation, either version 3 of the
+License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+For commercial licensing, please contact support@quantumnous.com
+*/
+import React, { useEffect, useState, useRef } from 'react';
+import { Banner, Button, Form, Row, Col, Spin } from '@douyinfe/semi-ui';
+import {
+  API,
+  removeTrailingSlash,
+  showError,
+  showSuccess,
+} from '../../../helpers';
+import { useTranslation } from 'react-i18next';
+
+export default function SettingsPaymentGatewayPayPal(props) {
+  const { t } = useTranslation();
+  const [loading, setLoading] = useState(false);
+  const [inputs, setInputs] = useState({
+    PayPalClientId: '',
+    PayPalClientSecret: '',
+    PayPalWebhookId: '',
+    PayPalSandbox: false,
+    PayPalApiBase: '',
+    PayPalCurrency: 'USD',
+    PayPalUnitPrice: 1.0,
+    PayPalMinTopUp: 1,
+  });
+  const formApiRef = useRef(null);
+
+  useEffect(() => {
+    if (props.options && formApiRef.current) {
+      const currentInputs = {
+        PayPalClientId: props.options.PayPalClientId || '',
+        PayPalClientSecret: props.options.PayPalClientSecret || '',
+        PayPalWebhookId: props.options.PayPalWebhookId || '',
+        PayPalSandbox:
+          props.options.PayPalSandbox === true ||
+          props.options.PayPalSandbox === 'true',
+        PayPalApiBase: props.options.PayPalApiBase || '',
+        PayPalCurrency: props.options.PayPalCurrency || 'USD',
+        PayPalUnitPrice:
+          props.options.PayPalUnitPrice !== undefined
+            ? parseFloat(props.options.PayPalUnitPrice)
+            : 1.0,
+        PayPalMinTopUp:
+          props.options.PayPalMinTopUp !== undefined
+            ? parseFloat(props.options.PayPalMinTopUp)
+            : 1,
+      };
+      setInputs(currentInputs);
+      formApiRef.current.setValues(currentInputs);
+    }
+  }, [props.options]);
+
+  const handleFormChange = (values) => {
+    setInputs(values);
+  };
+
+  const submitPayPalSetting = async () => {
+    if (props.options.ServerAddress === '') {
+      showError(t('请先填写服务器地址'));
+      return;
+    }
+
+    setLoading(true);
+    try {
+      const options = [
+        { key: 'PayPalClientId', value: inputs.PayPalClientId || '' },
+        { key: 'PayPalWebhookId', value: inputs.PayPalWebhookId || '' },
+        {
+          key: 'PayPalSandbox',
+          value: inputs.PayPalSandbox ? 'true' : 'false',
+        },
+        { key: 'PayPalApiBase', value: inputs.PayPalApiBase || '' },
+        { key: 'PayPalCurrency', value: inputs.PayPalCurrency || 'USD' },
+      ];
+      if (inputs.PayPalClientSecret && inputs.PayPalClientSecret !== '') {
+        options.push({
+          key: 'PayPalClientSecret',
+          value: inputs.PayPalClientSecret,
+        });
+      }
+      if (
+        inputs.PayPalUnitPrice !== undefined &&
+        inputs.PayPalUnitPrice !== null
+      ) {
+        options.push({
+          key: 'PayPalUnitPrice',
+          value: inputs.PayPalUnitPrice.toString(),
+        });
+      }
+      if (
+        inputs.PayPalMinTopUp !== undefined &&
+        inputs.PayPalMinTopUp !== null
+      ) {
+        options.push({
+          key: 'PayPalMinTopUp',
+          value: inputs.PayPalMinTopUp.toString(),
+        });
+      }
+
+      const results = await Promise.all(
+        options.map((opt) =>
+          API.put('/api/option/', {
+            key: opt.key,
+            value: opt.value,
+          }),
+        ),
+      );
+
+      const errorResults = results.filter((res) => !res.data.success);
+      if (errorResults.length > 0) {
+        errorResults.forEach((res) => {
+          showError(res.data.message);
+        });
+      } else {
+        showSuccess(t('更新成功'));
+        props.refresh?.();
+      }
+    } catch (error) {
+      showError(t('更新失败'));
+    }
+    setLoading(false);
+  };
+
+  return (
+    <Spin spinning={loading}>
+      <Form
+        initValues={inputs}
+        onValueChange={handleFormChange}
+        getFormApi={(api) => (formApiRef.current = api)}
+      >
+        <Form.Section text={t('PayPal 设置')}>
+          <Banner
+            type='info'
+            description={`Webhook 填：${props.options.ServerAddress ? removeTrailingSlash(props.options.ServerAddress) : t('网站地址')}/api/paypal/webhook`}
+          />
+          <Banner
+            type='warning'
+            description={t(
+              '需要包含事件：CHECKOUT.ORDER.APPROVED、PAYMENT.CAPTURE.COMPLETED、PAYMENT.CAPTURE.DENIED 和 PAYMENT.CAPTURE.REFUNDED',
+            )}
+          />
+          <Row gutter={{ xs: 8, sm: 16, md: 24, lg: 24, xl: 24, xxl: 24 }}>
+            <Col xs={24} sm={24} md={8} lg={8} xl={8}>
+              <Form.Input field='PayPalClientId' label='Client ID' />
+            </Col>
+            <Col xs={24} sm={24} md={8} lg={8} xl={8}>
+              <Form.Input
+                field='PayPalClientSecret'
+                label='Client Secret'
+                placeholder={t('敏感信息不会发送到前端显示')}
+                type='password'
+              />
+            </Col>
+            <Col xs={24} sm={24} md={8} lg={8} xl={8}>
+              <Form.Input field='PayPalWebhookId' label='Webhook ID' />
+            </Col>
+          </Row>
+          <Row
+            gutter={{ xs: 8, sm: 16, md: 24, lg: 24, xl: 24, xxl: 24 }}
+            style={{ marginTop: 16 }}
+          >
+            <Col xs={24} sm={24} md={8} lg={8} xl={8}>
+              <Form.InputNumber
+                field='PayPalUnitPrice'
+                precision={2}
+                label={t('充值价格（x元/美金）')}
+                placeholder={t('例如：7，就是7元/美金')}
+              />
+            </Col>
+            <Col xs={24} sm={24} md={8} lg={8} xl={8}>
+              <Form.InputNumber
+                field='PayPalMinTopUp'
+                label={t('最低充值美元数量')}
+                placeholder={t('例如：2，就是最低充值2$')}
+              />
+            </Col>
+            <Col xs={24} sm={24} md={8} lg={8} xl={8}>
+              <Form.Input
+                field='PayPalCurrency'
+                label={t('支付币种')}
+                placeholder='USD'
+              />
+            </Col>
+          </Row>
+          <Row
+            gutter={{ xs: 8, sm: 16, md: 24, lg: 24, xl: 24, xxl: 24 }}
+            style={{ marginTop: 16 }}
+          >
+            <Col xs={24} sm={24} md={8} lg={8} xl={8}>
+              <Form.Switch
+                field='PayPalSandbox'
+                size='default'
+                checkedText='｜'
+                uncheckedText='〇'
+                label={t('使用 PayPal 沙箱环境')}
+              />
+            </Col>
+            <Col xs={24} sm={24} md={16} lg={16} xl={16}>
+              <Form.Input
+                field='PayPalApiBase'
+                label={t('自定义 API 地址')}
+                placeholder={t(
+                  '留空使用 PayPal 官方地址，可填写本地模拟服务地址用于测试',
+                )}
+              />
+            </Col>
+          </Row>
+          <Button onClick={submitPayPalSetting}>{t('更新 PayPal 设置')}</Button>
+        </Form.Section>
+      </Form>
+    </Spin>
+  );
+}